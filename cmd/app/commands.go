@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/febriaricandra/book-shop/internal/services"
+)
+
+// commandDeps holds the services available to maintenance commands
+type commandDeps struct {
+	catalogService  *services.CatalogService
+	coverService    *services.CoverService
+	wishlistService *services.WishlistService
+}
+
+func runCommand(name string, args []string, deps *commandDeps) error {
+	switch name {
+	case "import":
+		return importCommand(args, deps)
+	case "export":
+		return exportCommand(args, deps)
+	case "backfill-covers":
+		return backfillCoversCommand(args, deps)
+	case "collect-uploads":
+		return collectUploadsCommand(deps)
+	case "reconcile-covers":
+		return reconcileCoversCommand(args, deps)
+	case "notify-wishlists":
+		return notifyWishlistsCommand(deps)
+	}
+	return fmt.Errorf("unknown command %q, expected one of: import, export, backfill-covers, collect-uploads, reconcile-covers, notify-wishlists", name)
+}
+
+// importCommand loads a catalog file: `main import [-format csv] [-dry-run] books.csv`
+func importCommand(args []string, deps *commandDeps) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "catalog format (csv, json or onix), defaults to the file extension")
+	dryRun := flags.Bool("dry-run", false, "validate and report without writing")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: import [-format csv|json|onix] [-dry-run] <file>")
+	}
+
+	path := flags.Arg(0)
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	rows, rowErrors, err := services.ParseCatalog(*format, file)
+	if err != nil {
+		return err
+	}
+
+	processed := 0
+	report := deps.catalogService.Import(rows, rowErrors, *dryRun, func() {
+		processed++
+		if processed%100 == 0 {
+			fmt.Fprintf(os.Stderr, "processed %d/%d rows\n", processed, len(rows))
+		}
+	})
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// exportCommand writes the catalog: `main export [-format csv] [-o books.csv]`
+func exportCommand(args []string, deps *commandDeps) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", services.CatalogFormatCSV, "catalog format (csv, json or onix)")
+	output := flags.String("o", "", "output file, defaults to stdout")
+	flags.Parse(args)
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	buffered := bufio.NewWriter(w)
+	if err := deps.catalogService.Export(*format, buffered); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// backfillCoversCommand generates cover variants for books uploaded before
+// covers were processed: `main backfill-covers [-dry-run]`
+func backfillCoversCommand(args []string, deps *commandDeps) error {
+	flags := flag.NewFlagSet("backfill-covers", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "count the books that need variants without processing them")
+	flags.Parse(args)
+
+	report, err := deps.coverService.BackfillCovers(context.Background(), *dryRun)
+	if report != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(report); encodeErr != nil && err == nil {
+			err = encodeErr
+		}
+	}
+	return err
+}
+
+// collectUploadsCommand deletes presigned uploads that were never confirmed,
+// the server also does this every 15 minutes: `main collect-uploads`
+func collectUploadsCommand(deps *commandDeps) error {
+	collected, err := deps.coverService.CollectExpiredUploads(context.Background())
+	fmt.Printf("collected %d expired uploads\n", collected)
+	return err
+}
+
+// reconcileCoversCommand deletes bucket objects no book refers to:
+// `main reconcile-covers [-dry-run]`
+func reconcileCoversCommand(args []string, deps *commandDeps) error {
+	flags := flag.NewFlagSet("reconcile-covers", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "report the orphaned objects without deleting them")
+	flags.Parse(args)
+
+	report, err := deps.coverService.ReconcileCovers(context.Background(), *dryRun)
+	if report != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(report); encodeErr != nil && err == nil {
+			err = encodeErr
+		}
+	}
+	return err
+}
+
+// notifyWishlistsCommand emails users about price drops and restocks on their
+// wishlists, the server also does this every hour: `main notify-wishlists`
+func notifyWishlistsCommand(deps *commandDeps) error {
+	report, err := deps.wishlistService.NotifyChanges(context.Background())
+	fmt.Printf("checked %d items, sent %d emails, %d failed\n", report.Checked, report.Emails, report.Failed)
+	return err
+}
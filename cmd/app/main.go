@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -9,19 +10,24 @@ import (
 
 	cfg "github.com/febriaricandra/book-shop/config"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/febriaricandra/book-shop/internal/handlers"
 	"github.com/febriaricandra/book-shop/internal/models"
 	"github.com/febriaricandra/book-shop/internal/repositories"
 	"github.com/febriaricandra/book-shop/internal/routers"
+	"github.com/febriaricandra/book-shop/internal/scheduler"
 	"github.com/febriaricandra/book-shop/internal/services"
 	"github.com/febriaricandra/book-shop/pkg/db"
+	"github.com/febriaricandra/book-shop/pkg/mail"
+	"github.com/febriaricandra/book-shop/pkg/openlibrary"
+	"github.com/febriaricandra/book-shop/pkg/storage"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
-var R2Client *s3.Client
+var ObjectStore storage.ObjectStore
+var Mailer mail.Sender
+var ShippingPolicy models.ShippingPolicy
 
 func init() {
 	err := godotenv.Load(".env")
@@ -29,10 +35,22 @@ func init() {
 		slog.Error("Error loading .env file")
 	}
 
-	R2Client, err = cfg.InitR2Client()
+	ObjectStore, err = cfg.InitObjectStore(cfg.LoadConfig())
 	if err != nil {
-		slog.Error("Error initializing R2 client", "error", err)
-		panic(fmt.Sprintf("failed to initialize R2 client: %v", err))
+		slog.Error("Error initializing object store", "error", err)
+		panic(fmt.Sprintf("failed to initialize object store: %v", err))
+	}
+
+	Mailer, err = cfg.InitMailSender(cfg.LoadConfig())
+	if err != nil {
+		slog.Error("Error initializing mail sender", "error", err)
+		panic(fmt.Sprintf("failed to initialize mail sender: %v", err))
+	}
+
+	ShippingPolicy, err = cfg.ShippingPolicy(cfg.LoadConfig())
+	if err != nil {
+		slog.Error("Error initializing shipping policy", "error", err)
+		panic(fmt.Sprintf("failed to initialize shipping policy: %v", err))
 	}
 
 	if err := db.DatabaseConnection(); err != nil {
@@ -40,8 +58,15 @@ func init() {
 		panic(fmt.Sprintf("failed to connect database: %v", err))
 	}
 
+	// Prices used to be floats, convert them to minor units before AutoMigrate
+	// sees the new column types
+	if err := db.MigrateMoneyColumns(); err != nil {
+		slog.Error("Error migrating money columns", "error", err)
+		panic(fmt.Sprintf("failed to migrate money columns: %v", err))
+	}
+
 	// Migrate the schema
-	err = db.DB.AutoMigrate(&models.User{}, &models.Book{}, &models.Order{}, &models.OrderBook{})
+	err = db.DB.AutoMigrate(&models.User{}, &models.Book{}, &models.Order{}, &models.OrderBook{}, &models.CoverUpload{}, &models.BookImage{}, &models.Review{}, &models.ReviewVote{}, &models.Wishlist{}, &models.WishlistItem{}, &models.Coupon{}, &models.CouponRedemption{}, &models.PriceRule{}, &models.PriceRuleBook{}, &models.PriceChange{}, &models.ExchangeRate{}, &models.TaxRate{}, &models.OrderTax{}, &models.Invoice{}, &models.InvoiceCounter{}, &models.RegionCache{}, &models.Shipment{})
 
 	if err != nil {
 		slog.Error("Error migrating models", "error", err)
@@ -52,40 +77,148 @@ func init() {
 }
 
 func main() {
+	appConfig := cfg.LoadConfig()
 
 	// Initialize repositories and services
 	orderRepo := repositories.NewOrderRepository(db.DB)
 	bookRepo := repositories.NewBookRepository(db.DB)
 	userRepo := repositories.NewUserRepository(db.DB)
+	uploadRepo := repositories.NewUploadRepository(db.DB)
+	imageRepo := repositories.NewImageRepository(db.DB)
+	reviewRepo := repositories.NewReviewRepository(db.DB)
+	wishlistRepo := repositories.NewWishlistRepository(db.DB)
+	recommendationRepo := repositories.NewRecommendationRepository(db.DB)
+	couponRepo := repositories.NewCouponRepository(db.DB)
+	priceRepo := repositories.NewPriceRepository(db.DB)
+	currencyRepo := repositories.NewCurrencyRepository(db.DB)
+	taxRepo := repositories.NewTaxRepository(db.DB)
+	taxPolicy := cfg.TaxPolicy(appConfig)
+	invoiceRepo := repositories.NewInvoiceRepository(db.DB)
+	shipmentRepo := repositories.NewShipmentRepository(db.DB)
+	var regionRepo repositories.RegionRepository
+	if appConfig.RajaOngkirCachePersist {
+		regionRepo = repositories.NewRegionRepository(db.DB)
+	}
 
-	orderService := services.NewOrderService(orderRepo)
+	invoiceService := services.NewInvoiceService(invoiceRepo, orderRepo, Mailer, cfg.InvoiceStore(appConfig), appConfig.InvoicePrefix)
+	rajaOngkir := cfg.RajaOngkirClient(appConfig)
+	shippingService := services.NewShippingService(rajaOngkir, regionRepo, bookRepo, appConfig.RajaOngkirCacheTTL, ShippingPolicy)
+	orderService := services.NewOrderService(orderRepo, bookRepo, couponRepo, taxRepo, taxPolicy, shippingService, invoiceService)
+	shipmentService := services.NewShipmentService(shipmentRepo, orderRepo, orderService, rajaOngkir, appConfig.TrackingCacheTTL)
 	bookService := services.NewBookService(bookRepo)
 	userService := services.NewUserService(userRepo)
+	catalogService := services.NewCatalogService(bookRepo, appConfig.StoreName)
+	coverService := services.NewCoverService(bookRepo, uploadRepo, ObjectStore, cfg.CoverUploadPolicy(appConfig))
+	galleryService := services.NewGalleryService(imageRepo, bookRepo, coverService)
+	reviewService := services.NewReviewService(reviewRepo, orderRepo, bookRepo)
+	couponService := services.NewCouponService(couponRepo)
+	taxService := services.NewTaxService(taxRepo, taxPolicy)
+	priceService := services.NewPriceService(priceRepo, bookRepo)
+	recommendationService := services.NewRecommendationService(recommendationRepo, bookRepo, appConfig.BestsellerWindow, appConfig.RecommendationCacheTTL)
+	currencyService := services.NewCurrencyService(currencyRepo, userRepo, cfg.ExchangeRateProvider(appConfig))
+	wishlistService := services.NewWishlistService(wishlistRepo, bookRepo, userRepo, Mailer, appConfig.StoreName, appConfig.StorefrontURL)
+
+	// Run a maintenance command instead of the server, e.g. `main import books.csv`
+	if len(os.Args) > 1 {
+		deps := &commandDeps{catalogService: catalogService, coverService: coverService, wishlistService: wishlistService}
+		if err := runCommand(os.Args[1], os.Args[2:], deps); err != nil {
+			slog.Error("Command failed", "command", os.Args[1], "error", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Initialize handlers
-	orderHandler := handlers.NewOrderHandler(orderService)
-	bookHandler := handlers.NewBookHandler(bookService, R2Client, "bookshop", os.Getenv("ENDPOINT_URL"))
+	orderHandler := handlers.NewOrderHandler(orderService, currencyService, invoiceService)
+	metadataClient := openlibrary.NewClient(appConfig.OpenLibraryURL, appConfig.OpenLibraryCoversURL)
+	bookHandler := handlers.NewBookHandler(bookService, coverService, currencyService, metadataClient)
 	userHandler := handlers.NewUserHandler(userService)
-	rajaOngkirHandler := handlers.NewRajaOngkirHandler(os.Getenv("RAJAONGKIR_API_KEY"))
+	catalogHandler := handlers.NewCatalogHandler(catalogService)
+	galleryHandler := handlers.NewGalleryHandler(galleryService, coverService)
+	reviewHandler := handlers.NewReviewHandler(reviewService)
+	wishlistHandler := handlers.NewWishlistHandler(wishlistService)
+	recommendationHandler := handlers.NewRecommendationHandler(recommendationService, currencyService)
+	couponHandler := handlers.NewCouponHandler(couponService)
+	priceHandler := handlers.NewPriceHandler(priceService)
+	currencyHandler := handlers.NewCurrencyHandler(currencyService)
+	taxHandler := handlers.NewTaxHandler(taxService)
+	rajaOngkirHandler := handlers.NewRajaOngkirHandler(shippingService)
+	shipmentHandler := handlers.NewShipmentHandler(shipmentService)
+
+	// Background jobs stop with the process
+	go scheduler.Every(context.Background(), "collect-cover-uploads", 15*time.Minute, func(ctx context.Context) error {
+		collected, err := coverService.CollectExpiredUploads(ctx)
+		if collected > 0 {
+			slog.Info("Collected expired cover uploads", "count", collected)
+		}
+		return err
+	})
+	go scheduler.Every(context.Background(), "apply-price-rules", time.Minute, func(ctx context.Context) error {
+		report, err := priceService.ApplyPriceRules(ctx)
+		if report.Started > 0 || report.Ended > 0 {
+			slog.Info("Applied price rules", "started", report.Started, "ended", report.Ended, "on_sale", report.OnSale, "restored", report.Restored)
+		}
+		return err
+	})
+	go scheduler.Every(context.Background(), "notify-wishlists", time.Hour, func(ctx context.Context) error {
+		report, err := wishlistService.NotifyChanges(ctx)
+		if report.Emails > 0 || report.Failed > 0 {
+			slog.Info("Sent wishlist notifications", "emails", report.Emails, "failed", report.Failed)
+		}
+		return err
+	})
+
+	if rajaOngkir.Tier.CanTrack() {
+		go scheduler.Every(context.Background(), "track-shipments", appConfig.TrackingCacheTTL, func(ctx context.Context) error {
+			report, err := shipmentService.TrackShipments(ctx)
+			if report.Tracked > 0 || report.Failed > 0 {
+				slog.Info("Tracked shipments", "tracked", report.Tracked, "delivered", report.Delivered, "failed", report.Failed)
+			}
+			return err
+		})
+	} else {
+		slog.Info("Shipment tracking is off, the RajaOngkir tier cannot look waybills up", "tier", rajaOngkir.Tier)
+	}
+
+	if appConfig.ExchangeRateURL != "" {
+		go scheduler.Every(context.Background(), "refresh-exchange-rates", appConfig.ExchangeRateRefresh, func(ctx context.Context) error {
+			_, err := currencyService.RefreshRates(ctx)
+			return err
+		})
+	}
 
 	// entry point of the application
 	router := gin.Default()
-	// router.Static("/uploads", "./uploads")
+
+	// Serve local uploads in development, production covers come from the bucket
+	if localStore, ok := ObjectStore.(*storage.LocalStore); ok && appConfig.LocalStorageServe {
+		router.Static("/uploads", localStore.Dir())
+	}
 
 	//CORs configuration
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:  []string{"*"},
 		AllowMethods:  []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:  []string{"*", "Origin", "Content-Type", "Authorization"},
-		ExposeHeaders: []string{"Content-Length"},
+		AllowHeaders:  []string{"*", "Origin", "Content-Type", "Authorization", "If-Match"},
+		ExposeHeaders: []string{"Content-Length", "ETag"},
 		MaxAge:        12 * time.Hour,
 	}))
 
 	//init route
 	routers.BookRouter(router, bookHandler)
+	routers.CatalogRouter(router, catalogHandler)
+	routers.GalleryRouter(router, galleryHandler)
+	routers.ReviewRouter(router, reviewHandler)
+	routers.RecommendationRouter(router, recommendationHandler)
+	routers.WishlistRouter(router, wishlistHandler)
 	routers.UserRouter(router, userHandler)
 	routers.OrderRouter(router, orderHandler)
+	routers.CouponRouter(router, couponHandler)
+	routers.PriceRouter(router, priceHandler)
+	routers.CurrencyRouter(router, currencyHandler)
+	routers.TaxRouter(router, taxHandler)
 	routers.RajaOngkirRouter(router, rajaOngkirHandler)
+	routers.ShipmentRouter(router, shipmentHandler)
 
 	router.Use(gin.Logger())
 
@@ -1,15 +1,189 @@
 package config
 
 import (
+	"log/slog"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	JWTSecret []byte
+
+	// StoreName identifies the shop in exported feeds, the store details and
+	// InvoicePrefix go on invoices
+	StoreName     string
+	StoreAddress  string
+	StoreEmail    string
+	StorePhone    string
+	StoreTaxID    string
+	InvoicePrefix string
+
+	// Object storage for uploads, StorageDriver is "r2" or "local"
+	StorageDriver     string
+	R2Bucket          string
+	R2PublicURL       string
+	LocalStorageDir   string
+	LocalStorageURL   string
+	LocalStorageServe bool
+
+	// Limits for cover uploads, COVER_ALLOWED_TYPES is a comma separated list
+	CoverMaxBytes     int64
+	CoverMaxWidth     int
+	CoverMaxHeight    int
+	CoverAllowedTypes []string
+
+	// Outgoing mail, MailDriver is "smtp" or "log"
+	MailDriver   string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+
+	// StorefrontURL is the customer facing site, used for links in emails
+	// and shared wishlists
+	StorefrontURL string
+
+	// BestsellerWindow is how far back sales count towards bestsellers,
+	// RecommendationCacheTTL how long rankings are cached
+	BestsellerWindow       time.Duration
+	RecommendationCacheTTL time.Duration
+
+	// ExchangeRateURL is the rate API automatic rates are fetched from every
+	// ExchangeRateRefresh, see exchangerate.Client for the format
+	ExchangeRateURL     string
+	ExchangeRateRefresh time.Duration
+
+	// Default tax on books, TaxMode is "inclusive" when book prices include
+	// it or "exclusive" when it is added at checkout
+	TaxMode    string
+	TaxName    string
+	TaxPercent float64
+
+	// RajaOngkir account for provinces, cities and shipping costs,
+	// RajaOngkirBaseURL defaults to the tier's API. Provinces and cities are
+	// cached for RajaOngkirCacheTTL, and in the database too unless
+	// RajaOngkirCachePersist is off
+	RajaOngkirAPIKey       string
+	RajaOngkirTier         string
+	RajaOngkirBaseURL      string
+	RajaOngkirTimeout      time.Duration
+	RajaOngkirCacheTTL     time.Duration
+	RajaOngkirCachePersist bool
+
+	// Shipping is quoted from the warehouse's RajaOngkir city ID, books
+	// without a weight count as ShippingDefaultWeight grams. Quotes are signed
+	// with ShippingQuoteSecret, JWTSecret when unset, and last ShippingQuoteTTL
+	ShippingOrigin        string
+	ShippingDefaultWeight int64
+	ShippingQuoteSecret   []byte
+	ShippingQuoteTTL      time.Duration
+
+	// Parcels are tracked again once their last answer is older than
+	// TrackingCacheTTL, shipped orders are checked on that schedule too
+	TrackingCacheTTL time.Duration
+
+	// Open Library compatible metadata API used to pre-fill books by ISBN
+	OpenLibraryURL       string
+	OpenLibraryCoversURL string
 }
 
 func LoadConfig() *Config {
 	return &Config{
-		JWTSecret: []byte(os.Getenv("JWT_SECRET")),
+		JWTSecret:              []byte(os.Getenv("JWT_SECRET")),
+		StoreName:              getEnv("STORE_NAME", "Book Shop"),
+		StoreAddress:           strings.ReplaceAll(os.Getenv("STORE_ADDRESS"), `\n`, "\n"),
+		StoreEmail:             os.Getenv("STORE_EMAIL"),
+		StorePhone:             os.Getenv("STORE_PHONE"),
+		StoreTaxID:             os.Getenv("STORE_NPWP"),
+		InvoicePrefix:          getEnv("INVOICE_PREFIX", "INV-"),
+		StorageDriver:          getEnv("STORAGE_DRIVER", "r2"),
+		R2Bucket:               getEnv("R2_BUCKET", "bookshop"),
+		R2PublicURL:            os.Getenv("ENDPOINT_URL"),
+		LocalStorageDir:        getEnv("LOCAL_STORAGE_DIR", "uploads"),
+		LocalStorageURL:        getEnv("LOCAL_STORAGE_URL", "http://localhost:8080/uploads"),
+		LocalStorageServe:      getEnv("LOCAL_STORAGE_SERVE", "true") == "true",
+		CoverMaxBytes:          int64(getEnvInt("COVER_MAX_BYTES", 5<<20)),
+		CoverMaxWidth:          getEnvInt("COVER_MAX_WIDTH", 4000),
+		CoverMaxHeight:         getEnvInt("COVER_MAX_HEIGHT", 6000),
+		CoverAllowedTypes:      strings.Split(getEnv("COVER_ALLOWED_TYPES", "image/jpeg,image/png,image/webp"), ","),
+		MailDriver:             getEnv("MAIL_DRIVER", "log"),
+		SMTPHost:               os.Getenv("SMTP_HOST"),
+		SMTPPort:               getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:           os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:           os.Getenv("SMTP_PASSWORD"),
+		MailFrom:               getEnv("MAIL_FROM", "Book Shop <no-reply@bookshop.local>"),
+		StorefrontURL:          strings.TrimRight(getEnv("STOREFRONT_URL", "http://localhost:3000"), "/"),
+		BestsellerWindow:       time.Duration(getEnvInt("BESTSELLER_WINDOW_DAYS", 30)) * 24 * time.Hour,
+		RecommendationCacheTTL: time.Duration(getEnvInt("RECOMMENDATION_CACHE_SECONDS", 600)) * time.Second,
+		ExchangeRateURL:        os.Getenv("EXCHANGE_RATE_URL"),
+		ExchangeRateRefresh:    time.Duration(getEnvInt("EXCHANGE_RATE_REFRESH_MINUTES", 60)) * time.Minute,
+		TaxMode:                getEnv("TAX_MODE", "inclusive"),
+		TaxName:                getEnv("TAX_NAME", "PPN"),
+		TaxPercent:             getEnvFloat("TAX_PERCENT", 11),
+		RajaOngkirAPIKey:       os.Getenv("RAJAONGKIR_API_KEY"),
+		RajaOngkirTier:         getEnv("RAJAONGKIR_TIER", "starter"),
+		RajaOngkirBaseURL:      os.Getenv("RAJAONGKIR_BASE_URL"),
+		RajaOngkirTimeout:      time.Duration(getEnvInt("RAJAONGKIR_TIMEOUT_SECONDS", 10)) * time.Second,
+		RajaOngkirCacheTTL:     time.Duration(getEnvInt("RAJAONGKIR_CACHE_HOURS", 24)) * time.Hour,
+		RajaOngkirCachePersist: getEnv("RAJAONGKIR_CACHE_PERSIST", "true") == "true",
+		ShippingOrigin:         os.Getenv("SHIPPING_ORIGIN_CITY_ID"),
+		ShippingDefaultWeight:  int64(getEnvInt("SHIPPING_DEFAULT_WEIGHT", 300)),
+		ShippingQuoteSecret:    []byte(getEnv("SHIPPING_QUOTE_SECRET", os.Getenv("JWT_SECRET"))),
+		ShippingQuoteTTL:       time.Duration(getEnvInt("SHIPPING_QUOTE_MINUTES", 30)) * time.Minute,
+		TrackingCacheTTL:       time.Duration(getEnvPositiveInt("TRACKING_CACHE_MINUTES", 60)) * time.Minute,
+		OpenLibraryURL:         getEnv("OPENLIBRARY_URL", "https://openlibrary.org"),
+		OpenLibraryCoversURL:   getEnv("OPENLIBRARY_COVERS_URL", "https://covers.openlibrary.org"),
+	}
+}
+
+// getEnv returns the value of the environment variable or fallback when unset
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt is getEnv for integers, invalid values fall back too
+func getEnvInt(key string, fallback int) int {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Error("Invalid integer in environment, using the default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+	return n
+}
+
+// getEnvPositiveInt is getEnvInt for values that must be above zero, such as
+// schedules, zero and below fall back too
+func getEnvPositiveInt(key string, fallback int) int {
+	n := getEnvInt(key, fallback)
+	if n <= 0 {
+		slog.Error("Environment value must be positive, using the default", "key", key, "value", n, "default", fallback)
+		return fallback
+	}
+	return n
+}
+
+// getEnvFloat is getEnv for decimal numbers, invalid values fall back too
+func getEnvFloat(key string, fallback float64) float64 {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		slog.Error("Invalid number in environment, using the default", "key", key, "value", value, "default", fallback)
+		return fallback
 	}
+	return f
 }
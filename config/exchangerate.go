@@ -0,0 +1,12 @@
+package config
+
+import "github.com/febriaricandra/book-shop/pkg/exchangerate"
+
+// ExchangeRateProvider is the rate API at EXCHANGE_RATE_URL, nil when it is
+// not set and rates are only set by admins
+func ExchangeRateProvider(cfg *Config) exchangerate.Provider {
+	if cfg.ExchangeRateURL == "" {
+		return nil
+	}
+	return exchangerate.NewClient(cfg.ExchangeRateURL)
+}
@@ -0,0 +1,14 @@
+package config
+
+import "github.com/febriaricandra/book-shop/internal/invoice"
+
+// InvoiceStore is the seller printed on invoices
+func InvoiceStore(cfg *Config) invoice.Store {
+	return invoice.Store{
+		Name:    cfg.StoreName,
+		Address: cfg.StoreAddress,
+		Email:   cfg.StoreEmail,
+		Phone:   cfg.StorePhone,
+		TaxID:   cfg.StoreTaxID,
+	}
+}
@@ -0,0 +1,21 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/febriaricandra/book-shop/pkg/mail"
+)
+
+// InitMailSender builds the sender selected by MAIL_DRIVER
+func InitMailSender(cfg *Config) (mail.Sender, error) {
+	switch cfg.MailDriver {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("MAIL_DRIVER is smtp but SMTP_HOST is not set")
+		}
+		return mail.NewSMTPSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom), nil
+	case "log":
+		return mail.LogSender{}, nil
+	}
+	return nil, fmt.Errorf("unknown MAIL_DRIVER %q, expected smtp or log", cfg.MailDriver)
+}
@@ -0,0 +1,18 @@
+package config
+
+import (
+	"log/slog"
+
+	"github.com/febriaricandra/book-shop/pkg/rajaongkir"
+)
+
+// RajaOngkirClient is the RajaOngkir account from RAJAONGKIR_API_KEY and
+// RAJAONGKIR_TIER, an unknown tier falls back to starter
+func RajaOngkirClient(cfg *Config) *rajaongkir.Client {
+	tier, err := rajaongkir.ParseTier(cfg.RajaOngkirTier)
+	if err != nil {
+		slog.Error("Invalid RAJAONGKIR_TIER, using starter", "value", cfg.RajaOngkirTier)
+		tier = rajaongkir.Starter
+	}
+	return rajaongkir.NewClient(cfg.RajaOngkirAPIKey, tier, cfg.RajaOngkirBaseURL, cfg.RajaOngkirTimeout)
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+)
+
+// ShippingPolicy is how shipping is quoted from the SHIPPING_* settings.
+// Without SHIPPING_ORIGIN_CITY_ID nothing can be quoted, so no order can be
+// placed. Without a quote secret anyone could sign a quote with their own
+// shipping cost, so that is an error
+func ShippingPolicy(cfg *Config) (models.ShippingPolicy, error) {
+	if len(cfg.ShippingQuoteSecret) == 0 {
+		return models.ShippingPolicy{}, errors.New("neither SHIPPING_QUOTE_SECRET nor JWT_SECRET is set, shipping quotes cannot be signed")
+	}
+	if cfg.ShippingOrigin == "" {
+		slog.Error("SHIPPING_ORIGIN_CITY_ID is not set, shipping cannot be quoted")
+	}
+	return models.ShippingPolicy{
+		Origin:        cfg.ShippingOrigin,
+		DefaultWeight: cfg.ShippingDefaultWeight,
+		QuoteTTL:      cfg.ShippingQuoteTTL,
+		QuoteSecret:   cfg.ShippingQuoteSecret,
+	}, nil
+}
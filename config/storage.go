@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/febriaricandra/book-shop/internal/media"
+	"github.com/febriaricandra/book-shop/pkg/storage"
+)
+
+// InitObjectStore builds the object store selected by STORAGE_DRIVER
+func InitObjectStore(cfg *Config) (storage.ObjectStore, error) {
+	switch cfg.StorageDriver {
+	case "r2", "s3":
+		client, err := InitR2Client()
+		if err != nil {
+			return nil, err
+		}
+		return storage.NewS3Store(client, cfg.R2Bucket, cfg.R2PublicURL), nil
+	case "local":
+		return storage.NewLocalStore(cfg.LocalStorageDir, cfg.LocalStorageURL)
+	}
+	return nil, fmt.Errorf("unknown STORAGE_DRIVER %q, expected r2 or local", cfg.StorageDriver)
+}
+
+// CoverUploadPolicy builds the cover upload limits from the COVER_* settings
+func CoverUploadPolicy(cfg *Config) media.UploadPolicy {
+	var allowed []string
+	for _, contentType := range cfg.CoverAllowedTypes {
+		if contentType = strings.TrimSpace(contentType); contentType != "" {
+			allowed = append(allowed, contentType)
+		}
+	}
+	if len(allowed) == 0 {
+		allowed = media.DefaultAllowedTypes
+	}
+
+	return media.UploadPolicy{
+		MaxBytes:     cfg.CoverMaxBytes,
+		MaxWidth:     cfg.CoverMaxWidth,
+		MaxHeight:    cfg.CoverMaxHeight,
+		AllowedTypes: allowed,
+	}
+}
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+)
+
+// TaxPolicy is the default tax from TAX_MODE, TAX_NAME and TAX_PERCENT,
+// invalid settings fall back to prices including 11% PPN
+func TaxPolicy(cfg *Config) models.TaxPolicy {
+	policy := models.TaxPolicy{Mode: strings.ToLower(cfg.TaxMode), Name: cfg.TaxName, Percent: cfg.TaxPercent}
+	if policy.Mode != models.TaxInclusive && policy.Mode != models.TaxExclusive {
+		slog.Error("Invalid TAX_MODE, using inclusive", "value", cfg.TaxMode)
+		policy.Mode = models.TaxInclusive
+	}
+	if policy.Percent < 0 || policy.Percent > 100 {
+		slog.Error("Invalid TAX_PERCENT, using 11", "value", cfg.TaxPercent)
+		policy.Percent = 11
+	}
+	return policy
+}
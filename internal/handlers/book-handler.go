@@ -1,36 +1,38 @@
 package handlers
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"path/filepath"
 	"strconv"
+	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/febriaricandra/book-shop/internal/media"
 	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
 	"github.com/febriaricandra/book-shop/internal/services"
 	"github.com/febriaricandra/book-shop/internal/utils"
-	"github.com/febriaricandra/book-shop/pkg/db"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/febriaricandra/book-shop/pkg/openlibrary"
+	"github.com/febriaricandra/book-shop/pkg/storage"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type BookHandler struct {
-	bookService *services.BookService
-	R2Client    *s3.Client
-	Bucket      string
-	EndPoint    string
+	bookService     *services.BookService
+	coverService    *services.CoverService
+	currencyService *services.CurrencyService
+	metadata        *openlibrary.Client
 }
 
-func NewBookHandler(bookService *services.BookService, R2Client *s3.Client, Bucket string, Endpoint string) *BookHandler {
-	return &BookHandler{bookService: bookService, R2Client: R2Client, Bucket: Bucket, EndPoint: Endpoint}
+func NewBookHandler(bookService *services.BookService, coverService *services.CoverService, currencyService *services.CurrencyService, metadata *openlibrary.Client) *BookHandler {
+	return &BookHandler{bookService: bookService, coverService: coverService, currencyService: currencyService, metadata: metadata}
 }
 
-func (h *BookHandler) HomeBooks(c *gin.Context) {
-	//Get the page and page size from the query string
+func (h *BookHandler) GetBooks(c *gin.Context) {
 	pageStr := c.DefaultQuery("page", "1")
 	pageSizeStr := c.DefaultQuery("page_size", "10")
 
@@ -47,40 +49,22 @@ func (h *BookHandler) HomeBooks(c *gin.Context) {
 		return
 	}
 
-	topSellerBooks, recommendedBooks, total, err := h.bookService.GetHomeBooks(page, page_size)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+	sort := c.Query("sort")
+	if _, ok := repositories.BookSortOrders[sort]; sort != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort", "status": false})
 		return
 	}
-
-	//Calculate the total pages
-	totalItems, totalPages := utils.CalculatePagination(total, page, page_size)
-
-	c.JSON(http.StatusOK, gin.H{"topSellerBooks": topSellerBooks, "recommendedBooks": recommendedBooks, "page": page, "page_size": page_size, "total_items": totalItems, "total_pages": totalPages, "status": true})
-}
-
-func (h *BookHandler) GetBooks(c *gin.Context) {
-	pageStr := c.DefaultQuery("page", "1")
-	pageSizeStr := c.DefaultQuery("page_size", "10")
-
-	//convert the page and page size to int
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number", "status": false})
-		return
-	}
-
-	page_size, err := strconv.Atoi(pageSizeStr)
-	if err != nil || page_size < 1 || page_size > 100 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page size", "status": false})
+	display, ok := displayRate(c, h.currencyService, "")
+	if !ok {
 		return
 	}
 
-	books, totalBook, err := h.bookService.GetAllBooks(page, page_size)
+	books, totalBook, err := h.bookService.GetAllBooks(page, page_size, sort)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
 		return
 	}
+	services.SetDisplayPrices(books, display)
 
 	//Calculate the total pages
 	totalItems, totalPages := utils.CalculatePagination(totalBook, page, page_size)
@@ -89,14 +73,15 @@ func (h *BookHandler) GetBooks(c *gin.Context) {
 }
 
 func (h *BookHandler) CreateBook(c *gin.Context) {
+	if !parseUploadForm(c, h.coverService.Policy().MaxBytes) {
+		return
+	}
+
 	var book models.Book
-	book.Title = c.PostForm("title")
-	book.Description = c.PostForm("description")
-	book.Category = c.PostForm("category")
-	book.Trending = c.PostForm("trending") == "true"
-	book.OldPrice, _ = strconv.ParseFloat(c.PostForm("old_price"), 64)
-	book.NewPrice, _ = strconv.ParseFloat(c.PostForm("new_price"), 64)
-	book.Weight, _ = strconv.ParseInt(c.PostForm("weight"), 10, 64)
+	if errs := bindBookForm(c, &book); len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
 
 	// Handle file upload
 	file, err := c.FormFile("cover_image")
@@ -113,36 +98,23 @@ func (h *BookHandler) CreateBook(c *gin.Context) {
 	}
 	defer fileData.Close()
 
-	// Get the Content-Type from the file header
-	fileContentType := file.Header.Get("Content-Type")
-	slog.Info("Content Type", "content_type", fileContentType)
-
-	// Generate a unique file name
-	extension := filepath.Ext(file.Filename)
-	newFileName := fmt.Sprintf("%s%s", uuid.New().String(), extension)
-
-	// Upload the file to R2 with ContentType
-	_, err = h.R2Client.PutObject(c.Request.Context(), &s3.PutObjectInput{
-		Bucket:      aws.String(h.Bucket),
-		Key:         aws.String(newFileName),
-		Body:        fileData,
-		ContentType: aws.String(fileContentType), // Set the Content-Type explicitly
-	})
-
+	// Resize, re-encode and upload every cover variant
+	book.CoverImage, book.CoverImages, err = h.coverService.StoreCover(c.Request.Context(), fileData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+		coverError(c, err)
 		return
 	}
 
-	// Generate the public URL for the uploaded file
-	book.CoverImage = fmt.Sprintf("%s/%s", h.EndPoint, newFileName)
-
 	// Save the book record in the database
+	book.PriceSource = services.ManualPriceChange(c.GetUint("userId"))
 	if err := h.bookService.CreateBook(&book); err != nil {
+		// Do not leave the uploaded cover behind without a book
+		h.coverService.ReleaseCovers(c.Request.Context(), book.CoverURLs()...)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
 		return
 	}
 
+	c.Header("ETag", bookETag(&book))
 	c.JSON(http.StatusCreated, gin.H{"status": true, "message": "Book created successfully", "data": book})
 }
 
@@ -154,11 +126,22 @@ func (h *BookHandler) GetBookById(c *gin.Context) {
 		return
 	}
 
-	book, err := h.bookService.GetBookById(uint(id))
+	display, ok := displayRate(c, h.currencyService, "")
+	if !ok {
+		return
+	}
+
+	book, err := h.bookService.GetBookWithImages(uint(id), c.GetBool("isAdmin"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found", "status": false})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
 		return
 	}
+	services.SetDisplayPrice(book, display)
+	c.Header("ETag", bookETag(book))
 	c.JSON(http.StatusOK, gin.H{"status": true, "data": book})
 }
 
@@ -174,17 +157,28 @@ func (h *BookHandler) UpdateBook(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid Book ID", "status": false})
 		return
 	}
+	if !parseUploadForm(c, h.coverService.Policy().MaxBytes) {
+		return
+	}
+
+	// If-Match is optional on PUT, when sent it must match the stored version
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" && ifMatch != "*" {
+		version, ok := parseBookETag(ifMatch, book.ID)
+		if !ok || version != book.Version {
+			c.Header("ETag", bookETag(book))
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": repositories.ErrVersionConflict.Error(), "status": false})
+			return
+		}
+	}
 
 	book.ID = uint(id)
-	book.Title = c.PostForm("title")
-	book.Description = c.PostForm("description")
-	book.Category = c.PostForm("category")
-	book.Trending = c.PostForm("trending") == "true"
-	book.OldPrice, _ = strconv.ParseFloat(c.PostForm("old_price"), 64)
-	book.NewPrice, _ = strconv.ParseFloat(c.PostForm("new_price"), 64)
-	book.Weight, _ = strconv.ParseInt(c.PostForm("weight"), 10, 64)
+	if errs := bindBookForm(c, book); len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
 
 	//hamdle file upload
+	var replacedCovers []string
 	file, err := c.FormFile("cover_image")
 	if err != nil {
 		if errors.Is(err, http.ErrMissingFile) {
@@ -194,24 +188,417 @@ func (h *BookHandler) UpdateBook(c *gin.Context) {
 			return
 		}
 	} else {
-		//Generate a unique file name using uuid and keep the original extension
-		extension := filepath.Ext(file.Filename) //get the file extension
-		newFileName := fmt.Sprintf("%s%s", uuid.New().String(), extension)
-
-		filePath := filepath.Join("uploads", newFileName)
-
-		if err := c.SaveUploadedFile(file, filePath); err != nil {
+		fileData, err := file.Open()
+		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
 			return
 		}
+		defer fileData.Close()
 
-		book.CoverImage = filePath
+		replacedCovers = book.CoverURLs()
+		book.CoverImage, book.CoverImages, err = h.coverService.StoreCover(c.Request.Context(), fileData)
+		if err != nil {
+			coverError(c, err)
+			return
+		}
 	}
 
-	if err := db.DB.Save(&book).Error; err != nil {
+	book.PriceSource = services.ManualPriceChange(c.GetUint("userId"))
+	if err := h.bookService.UpdateBook(book); err != nil {
+		if replacedCovers != nil {
+			h.coverService.ReleaseCovers(c.Request.Context(), book.CoverURLs()...)
+		}
+		if errors.Is(err, repositories.ErrVersionConflict) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error(), "status": false})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
 		return
 	}
 
+	h.coverService.ReleaseCovers(c.Request.Context(), replacedCovers...)
+
+	c.Header("ETag", bookETag(book))
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Book updated successfully", "data": book})
+}
+
+// PatchBook updates only the fields present in the JSON body. The request
+// must carry the ETag from GET /books/:id in If-Match so concurrent edits are
+// rejected with 412 instead of overwriting each other
+func (h *BookHandler) PatchBook(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header with the book ETag is required", "status": false})
+		return
+	}
+	var expectedVersion uint
+	if ifMatch != "*" {
+		version, ok := parseBookETag(ifMatch, uint(id))
+		if !ok {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "If-Match does not match this book", "status": false})
+			return
+		}
+		expectedVersion = version
+	}
+
+	var patch services.BookPatch
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		if field, message, ok := jsonFieldError(err); ok {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": services.FieldErrors{field: message}, "status": false})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	book, errs, err := h.bookService.PatchBook(uint(id), expectedVersion, c.GetUint("userId"), &patch)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found", "status": false})
+		case errors.Is(err, repositories.ErrVersionConflict):
+			if current, err := h.bookService.GetBookById(uint(id)); err == nil {
+				c.Header("ETag", bookETag(current))
+			}
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error(), "status": false})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+		}
+		return
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
+
+	c.Header("ETag", bookETag(book))
 	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Book updated successfully", "data": book})
 }
+
+func (h *BookHandler) DeleteBook(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	archived, err := h.bookService.DeleteBook(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found", "status": false})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	if archived {
+		c.JSON(http.StatusOK, gin.H{"status": true, "archived": true, "message": "Book has open orders and was archived instead of deleted"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": true, "archived": false, "message": "Book deleted successfully"})
+}
+
+func (h *BookHandler) GetDeletedBooks(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number", "status": false})
+		return
+	}
+
+	page_size, err := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if err != nil || page_size < 1 || page_size > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page size", "status": false})
+		return
+	}
+
+	books, total, err := h.bookService.GetDeletedBooks(page, page_size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	totalItems, totalPages := utils.CalculatePagination(total, page, page_size)
+
+	c.JSON(http.StatusOK, gin.H{"data": books, "page": page, "page_size": page_size, "total_items": totalItems, "total_pages": totalPages, "status": true})
+}
+
+func (h *BookHandler) RestoreBook(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	if err := h.bookService.RestoreBook(uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found", "status": false})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	book, err := h.bookService.GetBookById(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Book restored successfully", "data": book})
+}
+
+// ImportMetadata drafts a book from the metadata API by ISBN. The draft is not
+// saved, the cover is copied into our bucket so the admin can submit it as is
+func (h *BookHandler) ImportMetadata(c *gin.Context) {
+	var input struct {
+		ISBN string `json:"isbn" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	edition, err := h.metadata.LookupISBN(c.Request.Context(), input.ISBN)
+	if err != nil {
+		if errors.Is(err, openlibrary.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No metadata found for this ISBN", "status": false})
+			return
+		}
+		slog.Error("Error looking up ISBN", "isbn", input.ISBN, "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	book := models.Book{
+		ISBN:        edition.ISBN,
+		Title:       edition.Title,
+		Author:      strings.Join(edition.Authors, ", "),
+		Description: edition.Description,
+		PageCount:   edition.PageCount,
+	}
+	if edition.Subtitle != "" {
+		book.Title = fmt.Sprintf("%s: %s", edition.Title, edition.Subtitle)
+	}
+
+	cover, _, err := h.metadata.FetchCover(c.Request.Context(), edition.CoverURL)
+	if err != nil {
+		// A missing cover should not block the draft, the admin can upload one
+		slog.Warn("Error fetching cover", "isbn", edition.ISBN, "error", err)
+		c.JSON(http.StatusOK, gin.H{"status": true, "data": book, "warning": "Cover image could not be imported"})
+		return
+	}
+	defer cover.Close()
+
+	book.CoverImage, book.CoverImages, err = h.coverService.StoreCover(c.Request.Context(), cover)
+	if err != nil {
+		coverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": book})
+}
+
+// PresignCover returns a presigned PUT URL so the admin's browser uploads the
+// cover straight to the bucket, followed by a call to ConfirmCover
+func (h *BookHandler) PresignCover(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	var input struct {
+		ContentType   string `json:"content_type" binding:"required"`
+		ContentLength int64  `json:"content_length" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	upload, err := h.coverService.PresignCover(c.Request.Context(), uint(id), input.ContentType, input.ContentLength)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found", "status": false})
+		case errors.Is(err, storage.ErrUnsupported):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "Direct uploads need the r2 storage driver, upload the cover with PUT /books/:id instead", "status": false})
+		default:
+			coverError(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": upload})
+}
+
+// ConfirmCover processes a cover uploaded with a presigned URL and attaches it
+// to the book
+func (h *BookHandler) ConfirmCover(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	var input struct {
+		UploadID string `json:"upload_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	book, err := h.coverService.ConfirmCover(c.Request.Context(), uint(id), input.UploadID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUploadNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "status": false})
+		case errors.Is(err, services.ErrUploadExpired):
+			c.JSON(http.StatusGone, gin.H{"error": err.Error(), "status": false})
+		case errors.Is(err, services.ErrUploadIncomplete), errors.Is(err, services.ErrUploadMismatch), errors.Is(err, repositories.ErrVersionConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": false})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found", "status": false})
+		default:
+			coverError(c, err)
+		}
+		return
+	}
+
+	c.Header("ETag", bookETag(book))
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Cover updated successfully", "data": book})
+}
+
+// coverFormOverhead leaves room for the other book fields next to the cover
+const coverFormOverhead = 1 << 20
+
+// parseUploadForm caps the request body at the upload size limit and parses
+// the multipart form up front, so an oversized upload is a 413 rather than a
+// half read form
+func parseUploadForm(c *gin.Context, maxBytes int64) bool {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+coverFormOverhead)
+
+	err := c.Request.ParseMultipartForm(32 << 20)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": media.ErrTooLarge.Error(), "status": false})
+		return false
+	}
+	return true
+}
+
+// coverError reports a failed cover upload, files that break the upload
+// policy or do not decode are the client's fault
+func coverError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, media.ErrTooLarge), errors.Is(err, media.ErrDimensionsTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error(), "status": false})
+	case errors.Is(err, media.ErrUnsupportedType):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error(), "status": false})
+	case errors.Is(err, media.ErrInvalidImage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+	}
+}
+
+// bindBookForm reads the multipart book fields, reporting values that do not
+// parse instead of silently storing zero
+func bindBookForm(c *gin.Context, book *models.Book) services.FieldErrors {
+	errs := services.FieldErrors{}
+
+	book.ISBN = openlibrary.NormalizeISBN(c.PostForm("isbn"))
+	book.Title = strings.TrimSpace(c.PostForm("title"))
+	book.Author = strings.TrimSpace(c.PostForm("author"))
+	book.Description = c.PostForm("description")
+	book.Category = strings.TrimSpace(c.PostForm("category"))
+	book.Trending = c.PostForm("trending") == "true"
+	book.Publisher = strings.TrimSpace(c.PostForm("publisher"))
+	book.Series = strings.TrimSpace(c.PostForm("series"))
+	if availability := c.PostForm("availability"); availability != "" {
+		book.Availability = availability
+	}
+
+	var err error
+	if book.OldPrice, err = parseFormMoney(c, "old_price"); err != nil {
+		errs["old_price"] = "must be an amount with at most 2 decimals"
+	}
+	if book.NewPrice, err = parseFormMoney(c, "new_price"); err != nil {
+		errs["new_price"] = "must be an amount with at most 2 decimals"
+	}
+	if value := c.PostForm("weight"); value != "" {
+		if book.Weight, err = strconv.ParseInt(value, 10, 64); err != nil {
+			errs["weight"] = "must be a whole number of grams"
+		}
+	}
+	if value := c.PostForm("page_count"); value != "" {
+		if book.PageCount, err = strconv.Atoi(value); err != nil {
+			errs["page_count"] = "must be a whole number"
+		}
+	}
+
+	for field, message := range services.ValidateBook(book) {
+		if _, exists := errs[field]; !exists {
+			errs[field] = message
+		}
+	}
+	return errs
+}
+
+func parseFormMoney(c *gin.Context, field string) (money.Money, error) {
+	value := c.PostForm(field)
+	if value == "" {
+		return money.Money{}, nil
+	}
+	return money.Parse(value, money.DefaultCurrency)
+}
+
+// bookETag is a strong validator built from the id and version, e.g. "12-3"
+func bookETag(book *models.Book) string {
+	return fmt.Sprintf(`"%d-%d"`, book.ID, book.Version)
+}
+
+func parseBookETag(etag string, id uint) (uint, bool) {
+	etag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(etag), "W/"), `"`)
+	parts := strings.SplitN(etag, "-", 2)
+	if len(parts) != 2 || parts[0] != strconv.FormatUint(uint64(id), 10) {
+		return 0, false
+	}
+
+	version, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint(version), true
+}
+
+// jsonFieldError turns type and unknown field decode errors into a field name
+// and message
+func jsonFieldError(err error) (string, string, bool) {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		kinds := map[string]string{"string": "a string", "bool": "a boolean", "float64": "a number", "int": "a whole number", "int64": "a whole number", "money.Money": "an amount with at most 2 decimals"}
+		kind, ok := kinds[typeErr.Type.String()]
+		if !ok {
+			kind = "a " + typeErr.Type.String()
+		}
+		return typeErr.Field, "must be " + kind, true
+	}
+
+	const unknownPrefix = "json: unknown field "
+	if strings.HasPrefix(err.Error(), unknownPrefix) {
+		return strings.Trim(strings.TrimPrefix(err.Error(), unknownPrefix), `"`), "is not a book field", true
+	}
+	return "", "", false
+}
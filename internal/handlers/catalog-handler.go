@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// asyncImportThreshold is the number of rows above which an import runs in the
+// background even when the client did not ask for it
+const asyncImportThreshold = 500
+
+type CatalogHandler struct {
+	catalogService *services.CatalogService
+}
+
+func NewCatalogHandler(service *services.CatalogService) *CatalogHandler {
+	return &CatalogHandler{catalogService: service}
+}
+
+func (h *CatalogHandler) ImportCatalog(c *gin.Context) {
+	body, filename, err := catalogUpload(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+	defer body.Close()
+
+	format := catalogFormat(c.Query("format"), filename, c.ContentType())
+	dryRun := c.Query("dry_run") == "true"
+
+	rows, rowErrors, err := services.ParseCatalog(format, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	if c.Query("async") == "true" || len(rows) > asyncImportThreshold {
+		job := h.catalogService.StartImport(rows, rowErrors, dryRun)
+		c.JSON(http.StatusAccepted, gin.H{"status": true, "message": "Import started", "data": job})
+		return
+	}
+
+	report := h.catalogService.Import(rows, rowErrors, dryRun, nil)
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": report})
+}
+
+func (h *CatalogHandler) GetImportJob(c *gin.Context) {
+	job, ok := h.catalogService.GetImportJob(c.Param("job_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import job not found", "status": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": job})
+}
+
+func (h *CatalogHandler) ExportCatalog(c *gin.Context) {
+	format := c.DefaultQuery("format", services.CatalogFormatCSV)
+	contentType, ok := catalogContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported format", "status": false})
+		return
+	}
+
+	extension := format
+	if format == services.CatalogFormatONIX {
+		extension = "xml"
+	}
+	filename := fmt.Sprintf("catalog-%s.%s", time.Now().Format("20060102-150405"), extension)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	// Headers are already sent, so a failure can only be logged
+	if err := h.catalogService.Export(format, c.Writer); err != nil {
+		slog.Error("Error exporting catalog", "format", format, "error", err)
+	}
+}
+
+var catalogContentTypes = map[string]string{
+	services.CatalogFormatCSV:  "text/csv; charset=utf-8",
+	services.CatalogFormatJSON: "application/json; charset=utf-8",
+	services.CatalogFormatONIX: "application/xml; charset=utf-8",
+}
+
+// catalogUpload accepts the catalog either as a multipart "file" field or as
+// the raw request body
+func catalogUpload(c *gin.Context) (io.ReadCloser, string, error) {
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, err := c.FormFile("file")
+		if err != nil {
+			return nil, "", err
+		}
+		body, err := file.Open()
+		return body, file.Filename, err
+	}
+
+	return c.Request.Body, "", nil
+}
+
+func catalogFormat(format, filename, contentType string) string {
+	if format != "" {
+		return strings.ToLower(format)
+	}
+	if ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), "."); ext != "" {
+		return ext
+	}
+	if strings.Contains(contentType, "json") {
+		return services.CatalogFormatJSON
+	}
+	if strings.Contains(contentType, "xml") {
+		return services.CatalogFormatONIX
+	}
+	return services.CatalogFormatCSV
+}
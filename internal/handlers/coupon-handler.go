@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CouponHandler struct {
+	couponService *services.CouponService
+}
+
+func NewCouponHandler(service *services.CouponService) *CouponHandler {
+	return &CouponHandler{couponService: service}
+}
+
+func (h *CouponHandler) GetCoupons(c *gin.Context) {
+	page, pageSize, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	coupons, total, err := h.couponService.GetCoupons(page, pageSize)
+	if err != nil {
+		couponError(c, err)
+		return
+	}
+
+	totalItems, totalPages := utils.CalculatePagination(total, page, pageSize)
+	c.JSON(http.StatusOK, gin.H{"data": coupons, "page": page, "page_size": pageSize, "total_items": totalItems, "total_pages": totalPages, "status": true})
+}
+
+func (h *CouponHandler) GetCoupon(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	coupon, err := h.couponService.GetCoupon(id)
+	if err != nil {
+		couponError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": coupon})
+}
+
+func (h *CouponHandler) CreateCoupon(c *gin.Context) {
+	var input services.CouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	coupon, errs, err := h.couponService.CreateCoupon(&input)
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
+	if err != nil {
+		couponError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"status": true, "message": "Coupon created successfully", "data": coupon})
+}
+
+// UpdateCoupon replaces the terms of a coupon, its code stays the same
+func (h *CouponHandler) UpdateCoupon(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input services.CouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	coupon, errs, err := h.couponService.UpdateCoupon(id, &input)
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
+	if err != nil {
+		couponError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Coupon updated successfully", "data": coupon})
+}
+
+func (h *CouponHandler) DeleteCoupon(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.couponService.DeleteCoupon(id); err != nil {
+		couponError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Coupon deleted successfully"})
+}
+
+func (h *CouponHandler) GetRedemptions(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+	page, pageSize, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	redemptions, total, err := h.couponService.GetRedemptions(id, page, pageSize)
+	if err != nil {
+		couponError(c, err)
+		return
+	}
+
+	totalItems, totalPages := utils.CalculatePagination(total, page, pageSize)
+	c.JSON(http.StatusOK, gin.H{"data": redemptions, "page": page, "page_size": pageSize, "total_items": totalItems, "total_pages": totalPages, "status": true})
+}
+
+// GetReports sums up redemptions per coupon. Query: from and to as
+// YYYY-MM-DD, both inclusive, default the last 30 days
+func (h *CouponHandler) GetReports(c *gin.Context) {
+	from, to, ok := reportRange(c)
+	if !ok {
+		return
+	}
+
+	reports, err := h.couponService.GetReports(from, to.AddDate(0, 0, 1))
+	if err != nil {
+		couponError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": reports, "from": from.Format(time.DateOnly), "to": to.Format(time.DateOnly)})
+}
+
+// reportRange reads the from and to query dates of a report, both inclusive
+// and the last 30 days by default. It answers 400 and returns false when
+// they are invalid
+func reportRange(c *gin.Context) (time.Time, time.Time, bool) {
+	today := time.Now().Truncate(24 * time.Hour)
+	from, to := today.AddDate(0, 0, -29), today
+
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse(time.DateOnly, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD", "status": false})
+			return from, to, false
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse(time.DateOnly, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD", "status": false})
+			return from, to, false
+		}
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from", "status": false})
+		return from, to, false
+	}
+	return from, to, true
+}
+
+func couponError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found", "status": false})
+	case errors.Is(err, repositories.ErrCouponExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+	}
+}
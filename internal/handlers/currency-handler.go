@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CurrencyHandler struct {
+	currencyService *services.CurrencyService
+}
+
+func NewCurrencyHandler(service *services.CurrencyService) *CurrencyHandler {
+	return &CurrencyHandler{currencyService: service}
+}
+
+// GetRates lists the currencies prices can be shown in
+func (h *CurrencyHandler) GetRates(c *gin.Context) {
+	rates, err := h.currencyService.GetRates()
+	if err != nil {
+		currencyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "settlement_currency": money.DefaultCurrency, "data": rates})
+}
+
+// SetRate fixes a currency's rate or makes it follow the rate provider
+func (h *CurrencyHandler) SetRate(c *gin.Context) {
+	var input services.RateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	rate, errs, err := h.currencyService.SetRate(c.Request.Context(), c.Param("currency"), &input)
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
+	if err != nil {
+		currencyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Exchange rate saved", "data": rate})
+}
+
+func (h *CurrencyHandler) DeleteRate(c *gin.Context) {
+	if err := h.currencyService.DeleteRate(c.Param("currency")); err != nil {
+		currencyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Exchange rate deleted"})
+}
+
+// RefreshRates fetches the automatic rates now instead of waiting for the
+// scheduled refresh
+func (h *CurrencyHandler) RefreshRates(c *gin.Context) {
+	report, err := h.currencyService.RefreshRates(c.Request.Context())
+	if err != nil {
+		currencyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": report})
+}
+
+// SetUserCurrency saves the currency the user wants prices shown in
+func (h *CurrencyHandler) SetUserCurrency(c *gin.Context) {
+	var input struct {
+		Currency string `json:"currency"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	if err := h.currencyService.SetUserCurrency(c.GetUint("userId"), input.Currency); err != nil {
+		currencyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Currency saved", "data": gin.H{"currency": services.NormalizeCurrency(input.Currency)}})
+}
+
+// displayRate resolves the currency to show prices in from requested, the
+// currency query parameter, the X-Currency header or the user's setting, in
+// that order. It answers 400 and returns false for currencies without a rate
+func displayRate(c *gin.Context, currencyService *services.CurrencyService, requested string) (*models.ExchangeRate, bool) {
+	if requested == "" {
+		requested = c.Query("currency")
+	}
+	if requested == "" {
+		requested = c.GetHeader("X-Currency")
+	}
+
+	rate, err := currencyService.DisplayRate(requested, c.GetUint("userId"))
+	if err != nil {
+		currencyError(c, err)
+		return nil, false
+	}
+	return rate, true
+}
+
+func currencyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exchange rate not found", "status": false})
+	case errors.Is(err, services.ErrUnsupportedCurrency):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+	case errors.Is(err, services.ErrNoRateProvider):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+	}
+}
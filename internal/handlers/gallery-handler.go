@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type GalleryHandler struct {
+	galleryService *services.GalleryService
+	coverService   *services.CoverService
+}
+
+func NewGalleryHandler(galleryService *services.GalleryService, coverService *services.CoverService) *GalleryHandler {
+	return &GalleryHandler{galleryService: galleryService, coverService: coverService}
+}
+
+func (h *GalleryHandler) GetImages(c *gin.Context) {
+	bookID, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	images, err := h.galleryService.GetImages(bookID)
+	if err != nil {
+		galleryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": images})
+}
+
+// AddImage uploads a multipart "image" with optional "alt_text" and
+// "is_primary" fields and appends it to the gallery
+func (h *GalleryHandler) AddImage(c *gin.Context) {
+	bookID, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+	if !parseUploadForm(c, h.coverService.Policy().MaxBytes) {
+		return
+	}
+
+	isPrimary, err := strconv.ParseBool(c.DefaultPostForm("is_primary", "false"))
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": services.FieldErrors{"is_primary": "must be true or false"}, "status": false})
+		return
+	}
+	altText := c.PostForm("alt_text")
+	if len(altText) > 255 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": services.FieldErrors{"alt_text": "must be at most 255 characters"}, "status": false})
+		return
+	}
+
+	file, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+	fileData, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+	defer fileData.Close()
+
+	image, err := h.galleryService.AddImage(c.Request.Context(), bookID, fileData, altText, isPrimary)
+	if err != nil {
+		galleryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"status": true, "message": "Image added successfully", "data": image})
+}
+
+func (h *GalleryHandler) UpdateImage(c *gin.Context) {
+	bookID, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+	imageID, ok := uintParam(c, "image_id")
+	if !ok {
+		return
+	}
+
+	var patch services.ImagePatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+	if patch.AltText != nil && len(*patch.AltText) > 255 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": services.FieldErrors{"alt_text": "must be at most 255 characters"}, "status": false})
+		return
+	}
+
+	image, err := h.galleryService.UpdateImage(bookID, imageID, &patch)
+	if err != nil {
+		galleryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Image updated successfully", "data": image})
+}
+
+// ReorderImages takes every image id of the book in the new order
+func (h *GalleryHandler) ReorderImages(c *gin.Context) {
+	bookID, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		ImageIDs []uint `json:"image_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	images, err := h.galleryService.ReorderImages(bookID, input.ImageIDs)
+	if err != nil {
+		galleryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Images reordered successfully", "data": images})
+}
+
+func (h *GalleryHandler) DeleteImage(c *gin.Context) {
+	bookID, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+	imageID, ok := uintParam(c, "image_id")
+	if !ok {
+		return
+	}
+
+	if err := h.galleryService.DeleteImage(c.Request.Context(), bookID, imageID); err != nil {
+		galleryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Image deleted successfully"})
+}
+
+func galleryError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book or image not found", "status": false})
+	case errors.Is(err, services.ErrGalleryFull), errors.Is(err, repositories.ErrImageOrderMismatch):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "status": false})
+	default:
+		coverError(c, err)
+	}
+}
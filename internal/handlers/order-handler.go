@@ -1,23 +1,28 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"strconv"
-	"sync"
 
 	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
 	"github.com/febriaricandra/book-shop/internal/services"
 	"github.com/febriaricandra/book-shop/internal/utils"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type OrderHandler struct {
-	orderService *services.OrderService
+	orderService    *services.OrderService
+	currencyService *services.CurrencyService
+	invoiceService  *services.InvoiceService
 }
 
-func NewOrderHandler(service *services.OrderService) *OrderHandler {
-	return &OrderHandler{orderService: service}
+func NewOrderHandler(service *services.OrderService, currencyService *services.CurrencyService, invoiceService *services.InvoiceService) *OrderHandler {
+	return &OrderHandler{orderService: service, currencyService: currencyService, invoiceService: invoiceService}
 }
 
 func (h *OrderHandler) GetOrdersForUser(c *gin.Context) {
@@ -35,18 +40,19 @@ func (h *OrderHandler) GetOrdersForUser(c *gin.Context) {
 	}
 }
 
+// CreateOrder places an order for the books, priced by the server from the
+// current book prices, the shipping quote and the optional coupon
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	var order models.Order
 	var orderInput struct {
-		models.BaseModel
-		Name       string          `json:"name" gorm:"type:varchar(255);not null"`
-		Email      string          `json:"email" gorm:"type:varchar(255);not null"`
-		Address    models.Address  `json:"address" gorm:"embedded"`
-		Phone      string          `json:"phone" gorm:"type:varchar(20);not null"`
-		TotalPrice float64         `json:"total_price" gorm:"column:total_price;not null"`
-		UserId     uint            `json:"user_id" gorm:"not null"`
-		BookIds    []int           `json:"book_ids"`
-		Shipping   models.Shipping `json:"shipping" gorm:"embedded"`
+		Name            string         `json:"name"`
+		Email           string         `json:"email"`
+		Address         models.Address `json:"address"`
+		Phone           string         `json:"phone"`
+		BookIds         []uint         `json:"book_ids"`
+		CouponCode      string         `json:"coupon_code"`
+		ShippingQuoteID string         `json:"shipping_quote_id"` // from POST /api/shipping/quote
+		Currency        string         `json:"currency"`          // display currency, see displayRate
 	}
 
 	if err := c.ShouldBindJSON(&orderInput); err != nil {
@@ -64,56 +70,65 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	order.Name = orderInput.Name
 	order.Email = orderInput.Email
 	order.Address = orderInput.Address
-	order.Shipping = orderInput.Shipping
-	slog.Info("Order name", "name", order.Shipping)
-	slog.Info("Order address", "address", order.Address)
 	order.Phone = orderInput.Phone
-	order.TotalPrice = orderInput.TotalPrice
 
-	// Create the order first
-	orderId, err := h.orderService.CreateOrder(&order)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	display, ok := displayRate(c, h.currencyService, orderInput.Currency)
+	if !ok {
 		return
 	}
 
-	slog.Info("Order created successfully", "order_id", orderId)
-
-	// Initiate wait group
-	var wg sync.WaitGroup
-	errorChan := make(chan error)
-
-	// Iterate over the book ids and create order book
-	for _, bookId := range orderInput.BookIds {
-		wg.Add(1)
-		go func(bookId int, wg *sync.WaitGroup) {
-			defer wg.Done()
-			// Create order book
-			err = h.orderService.CreateOrderBook(orderId, uint(bookId))
-			if err != nil {
-				errorChan <- err
-				slog.Error("Failed to create order book", "error", err.Error())
-			}
-		}(bookId, &wg)
+	if err := h.orderService.PlaceOrder(&order, orderInput.BookIds, orderInput.CouponCode, orderInput.ShippingQuoteID, display); err != nil {
+		orderPricingError(c, err)
+		return
 	}
 
-	// Wait for all goroutines to finish
-	wg.Wait()
-	close(errorChan)
+	slog.Info("Order created successfully", "order_id", order.ID, "coupon", order.CouponCode)
+	c.JSON(http.StatusOK, order)
+}
 
-	var orderBookErrors []error
+// QuoteOrder prices a cart with an optional shipping quote and coupon without
+// placing the order
+func (h *OrderHandler) QuoteOrder(c *gin.Context) {
+	var input struct {
+		BookIds         []uint `json:"book_ids"`
+		ShippingQuoteID string `json:"shipping_quote_id"`
+		CouponCode      string `json:"coupon_code"`
+		Currency        string `json:"currency"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
 
-	for err := range errorChan {
-		orderBookErrors = append(orderBookErrors, err)
+	display, ok := displayRate(c, h.currencyService, input.Currency)
+	if !ok {
+		return
 	}
 
-	// Check for errors in creating order books
-	if len(orderBookErrors) > 0 {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Some order books could not be created", "details": orderBookErrors})
+	pricing, err := h.orderService.QuoteOrder(c.GetUint("userId"), input.BookIds, input.ShippingQuoteID, input.CouponCode, display)
+	if err != nil {
+		orderPricingError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, order)
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": pricing})
+}
+
+// orderPricingError answers 422 when the cart, shipping quote or coupon cannot
+// be used
+func orderPricingError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrEmptyOrder), errors.Is(err, services.ErrOrderBookUnavailable),
+		errors.Is(err, services.ErrShippingQuoteRequired), errors.Is(err, services.ErrInvalidShippingQuote),
+		errors.Is(err, services.ErrShippingQuoteExpired), errors.Is(err, services.ErrNegativeShippingCost),
+		errors.Is(err, services.ErrInvalidCoupon), errors.Is(err, services.ErrCouponInactive),
+		errors.Is(err, services.ErrCouponNotStarted), errors.Is(err, services.ErrCouponExpired),
+		errors.Is(err, services.ErrCouponMinSubtotal), errors.Is(err, services.ErrCouponNotApplicable),
+		errors.Is(err, repositories.ErrCouponUsedUp), errors.Is(err, repositories.ErrCouponUserLimit):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "status": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+	}
 }
 
 func (h *OrderHandler) GetOrderById(c *gin.Context) {
@@ -159,3 +174,60 @@ func (h *OrderHandler) GetAllOrders(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"data": orders, "page": page, "page_size": page_size, "total_items": totalItems, "total_pages": totalPages, "status": true})
 }
+
+// GetInvoice downloads the PDF invoice of a paid order, customers can only
+// get their own
+func (h *OrderHandler) GetInvoice(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	invoice, pdf, err := h.invoiceService.InvoicePDF(id, c.GetUint("userId"), c.GetBool("isAdmin"))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found", "status": false})
+		case errors.Is(err, services.ErrOrderNotPaid):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": false})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", invoice.Number+".pdf"))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// UpdateOrderStatus moves an order to its next status (admin)
+func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order id", "status": false})
+		return
+	}
+
+	var input struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	order, err := h.orderService.UpdateOrderStatus(uint(id), input.Status)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found", "status": false})
+		case errors.Is(err, services.ErrInvalidOrderTransition), errors.Is(err, repositories.ErrOrderStatusChanged):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": false})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Order status updated successfully", "data": order})
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PriceHandler struct {
+	priceService *services.PriceService
+}
+
+func NewPriceHandler(service *services.PriceService) *PriceHandler {
+	return &PriceHandler{priceService: service}
+}
+
+// GetPriceRules lists the scheduled sales. Query: status to filter
+func (h *PriceHandler) GetPriceRules(c *gin.Context) {
+	page, pageSize, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	rules, total, errs, err := h.priceService.GetPriceRules(c.Query("status"), page, pageSize)
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status", "errors": errs, "status": false})
+		return
+	}
+	if err != nil {
+		priceError(c, err)
+		return
+	}
+
+	totalItems, totalPages := utils.CalculatePagination(total, page, pageSize)
+	c.JSON(http.StatusOK, gin.H{"data": rules, "page": page, "page_size": pageSize, "total_items": totalItems, "total_pages": totalPages, "status": true})
+}
+
+// GetPriceRule returns a rule with the books it has on sale
+func (h *PriceHandler) GetPriceRule(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	rule, err := h.priceService.GetPriceRule(id)
+	if err != nil {
+		priceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": rule})
+}
+
+func (h *PriceHandler) CreatePriceRule(c *gin.Context) {
+	var input services.PriceRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	rule, errs, err := h.priceService.CreatePriceRule(&input, c.GetUint("userId"))
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
+	if err != nil {
+		priceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"status": true, "message": "Price rule scheduled successfully", "data": rule})
+}
+
+// UpdatePriceRule changes a rule that has not started yet
+func (h *PriceHandler) UpdatePriceRule(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input services.PriceRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	rule, errs, err := h.priceService.UpdatePriceRule(id, &input)
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
+	if err != nil {
+		priceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Price rule updated successfully", "data": rule})
+}
+
+// CancelPriceRule calls off a rule, an active sale ends right away
+func (h *PriceHandler) CancelPriceRule(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	rule, err := h.priceService.CancelPriceRule(id)
+	if err != nil {
+		priceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Price rule cancelled successfully", "data": rule})
+}
+
+func (h *PriceHandler) GetPriceHistory(c *gin.Context) {
+	bookID, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+	page, pageSize, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	changes, total, err := h.priceService.GetPriceHistory(bookID, page, pageSize)
+	if err != nil {
+		priceError(c, err)
+		return
+	}
+
+	totalItems, totalPages := utils.CalculatePagination(total, page, pageSize)
+	c.JSON(http.StatusOK, gin.H{"data": changes, "page": page, "page_size": pageSize, "total_items": totalItems, "total_pages": totalPages, "status": true})
+}
+
+func priceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book or price rule not found", "status": false})
+	case errors.Is(err, repositories.ErrPriceRuleStatusChanged), errors.Is(err, services.ErrPriceRuleFinished):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+	}
+}
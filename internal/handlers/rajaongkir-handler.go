@@ -1,129 +1,133 @@
 package handlers
 
 import (
-	"encoding/json"
-	"io"
+	"errors"
 	"net/http"
-	"strings"
 
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/rajaongkir"
 	"github.com/gin-gonic/gin"
 )
 
 type RajaOngkirHandler struct {
-	apiKey string
+	shippingService *services.ShippingService
 }
 
-const api_url = "https://api.rajaongkir.com/starter"
-
-func NewRajaOngkirHandler(apiKey string) *RajaOngkirHandler {
-	return &RajaOngkirHandler{apiKey: apiKey}
+func NewRajaOngkirHandler(shippingService *services.ShippingService) *RajaOngkirHandler {
+	return &RajaOngkirHandler{shippingService: shippingService}
 }
 
+// GetProvinces answers from the cache, stale is true when RajaOngkir could
+// not be reached to refresh it
 func (h *RajaOngkirHandler) GetProvinces(c *gin.Context) {
-	req, err := http.NewRequest("GET", api_url+"/province", nil)
-
+	provinces, err := h.shippingService.GetProvinces(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		rajaOngkirError(c, err)
 		return
 	}
 
-	req.Header.Set("key", h.apiKey)
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	defer resp.Body.Close()
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": provinces.Items, "fetched_at": provinces.FetchedAt, "stale": provinces.Stale})
+}
 
-	body, err := io.ReadAll(resp.Body)
+func (h *RajaOngkirHandler) GetCities(c *gin.Context) {
+	cities, err := h.shippingService.GetCities(c.Request.Context(), c.Param("province_id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		rajaOngkirError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, result)
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": cities.Items, "fetched_at": cities.FetchedAt, "stale": cities.Stale})
 }
 
-func (h *RajaOngkirHandler) GetCities(c *gin.Context) {
-	provinceID := c.Param("province_id")
-	req, err := http.NewRequest("GET", api_url+"/city?province="+provinceID, nil)
-
+// RefreshRegions fetches the provinces and cities now instead of waiting for
+// the cache to expire
+func (h *RajaOngkirHandler) RefreshRegions(c *gin.Context) {
+	report, err := h.shippingService.RefreshRegions(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		rajaOngkirError(c, err)
 		return
 	}
 
-	req.Header.Set("key", h.apiKey)
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": report})
+}
+
+// GetCosts lists the services of a courier between two cities. Form or JSON:
+// origin and destination city IDs, weight in grams and courier
+func (h *RajaOngkirHandler) GetCosts(c *gin.Context) {
+	var input struct {
+		Origin      string `form:"origin" json:"origin"`
+		Destination string `form:"destination" json:"destination"`
+		Weight      int    `form:"weight" json:"weight"`
+		Courier     string `form:"courier" json:"courier"`
+	}
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
 		return
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if input.Origin == "" || input.Destination == "" || input.Weight <= 0 || input.Courier == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "All fields are required", "status": false})
 		return
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	costs, err := h.shippingService.GetCosts(c.Request.Context(), rajaongkir.CostRequest{
+		Origin:      input.Origin,
+		Destination: input.Destination,
+		Weight:      input.Weight,
+		Courier:     input.Courier,
+	})
+	if err != nil {
+		rajaOngkirError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, result)
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": costs})
 }
 
-func (h *RajaOngkirHandler) GetCosts(c *gin.Context) {
-	origin := c.PostForm("origin")
-	destination := c.PostForm("destination")
-	weight := c.PostForm("weight")
-	courier := c.PostForm("courier")
-
-	if origin == "" || destination == "" || weight == "" || courier == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "All fields are required"})
-		return
+// QuoteShipping quotes the services of a courier for a cart, from the
+// warehouse to the destination city. Orders are placed with the ID of one
+func (h *RajaOngkirHandler) QuoteShipping(c *gin.Context) {
+	var input struct {
+		BookIds     []uint `json:"book_ids"`
+		Destination string `json:"destination"` // city ID
+		Courier     string `json:"courier"`
 	}
-
-	payload := strings.NewReader("origin=" + origin + "&destination=" + destination + "&weight=" + weight + "&courier=" + courier)
-	req, err := http.NewRequest("POST", api_url+"/cost", payload)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
 		return
 	}
-
-	req.Header.Set("key", h.apiKey)
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if input.Destination == "" || input.Courier == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Destination and courier are required", "status": false})
 		return
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	quotes, err := h.shippingService.QuoteShipping(c.Request.Context(), c.GetUint("userId"), input.BookIds, input.Destination, input.Courier)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch {
+		case errors.Is(err, services.ErrEmptyOrder), errors.Is(err, services.ErrOrderBookUnavailable),
+			errors.Is(err, services.ErrUnknownDestination), errors.Is(err, services.ErrNoShippingService):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "status": false})
+		case errors.Is(err, services.ErrShippingOriginUnset):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "status": false})
+		default:
+			rajaOngkirError(c, err)
+		}
 		return
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": quotes})
+}
 
-	c.JSON(http.StatusOK, result)
+// rajaOngkirError answers 400 for requests RajaOngkir rejects and a gateway
+// error when it cannot serve them
+func rajaOngkirError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, rajaongkir.ErrBadRequest), errors.Is(err, rajaongkir.ErrUnsupportedCourier):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+	case errors.Is(err, rajaongkir.ErrTrackingUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "status": false})
+	case errors.Is(err, rajaongkir.ErrQuotaExceeded), errors.Is(err, rajaongkir.ErrInvalidKey), errors.Is(err, rajaongkir.ErrUnavailable):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "status": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+	}
 }
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RecommendationHandler struct {
+	recommendationService *services.RecommendationService
+	currencyService       *services.CurrencyService
+}
+
+func NewRecommendationHandler(service *services.RecommendationService, currencyService *services.CurrencyService) *RecommendationHandler {
+	return &RecommendationHandler{recommendationService: service, currencyService: currencyService}
+}
+
+// HomeBooks returns a page of bestsellers and a page of recommendations,
+// personalised when the request is authenticated. The totals are those of
+// the longer list, so clients can page until both run out
+func (h *RecommendationHandler) HomeBooks(c *gin.Context) {
+	page, pageSize, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	display, ok := displayRate(c, h.currencyService, "")
+	if !ok {
+		return
+	}
+
+	bestsellers, err := h.recommendationService.GetBestsellers(page, pageSize)
+	if err != nil {
+		recommendationError(c, err)
+		return
+	}
+	recommended, err := h.recommendationService.GetRecommendations(c.GetUint("userId"), page, pageSize)
+	if err != nil {
+		recommendationError(c, err)
+		return
+	}
+	topSellers := displayBooks(bestsellers.Books, display)
+	recommendedBooks := displayBooks(recommended.Books, display)
+
+	totalItems, totalPages := utils.CalculatePagination(max(bestsellers.Total, recommended.Total), page, pageSize)
+	c.JSON(http.StatusOK, gin.H{"topSellerBooks": topSellers, "recommendedBooks": recommendedBooks, "page": page, "page_size": pageSize, "total_items": totalItems, "total_pages": totalPages, "status": true})
+}
+
+func (h *RecommendationHandler) GetBestsellers(c *gin.Context) {
+	page, pageSize, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	books, err := h.recommendationService.GetBestsellers(page, pageSize)
+	if err != nil {
+		recommendationError(c, err)
+		return
+	}
+	h.bookPageResponse(c, books, page, pageSize)
+}
+
+// GetAlsoBought lists what customers who bought the book also bought
+func (h *RecommendationHandler) GetAlsoBought(c *gin.Context) {
+	bookID, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+	page, pageSize, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	books, err := h.recommendationService.GetAlsoBought(bookID, page, pageSize)
+	if err != nil {
+		recommendationError(c, err)
+		return
+	}
+	h.bookPageResponse(c, books, page, pageSize)
+}
+
+// GetRelatedBooks lists books in the same category or by the same author
+func (h *RecommendationHandler) GetRelatedBooks(c *gin.Context) {
+	bookID, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+	page, pageSize, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	books, err := h.recommendationService.GetRelatedBooks(bookID, page, pageSize)
+	if err != nil {
+		recommendationError(c, err)
+		return
+	}
+	h.bookPageResponse(c, books, page, pageSize)
+}
+
+func (h *RecommendationHandler) GetRecommendations(c *gin.Context) {
+	page, pageSize, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	books, err := h.recommendationService.GetRecommendations(c.GetUint("userId"), page, pageSize)
+	if err != nil {
+		recommendationError(c, err)
+		return
+	}
+	h.bookPageResponse(c, books, page, pageSize)
+}
+
+// bookPageResponse answers with the page of books in the display currency
+func (h *RecommendationHandler) bookPageResponse(c *gin.Context, books *services.BookPage, page, pageSize int) {
+	display, ok := displayRate(c, h.currencyService, "")
+	if !ok {
+		return
+	}
+
+	totalItems, totalPages := utils.CalculatePagination(books.Total, page, pageSize)
+	c.JSON(http.StatusOK, gin.H{"data": displayBooks(books.Books, display), "page": page, "page_size": pageSize, "total_items": totalItems, "total_pages": totalPages, "status": true})
+}
+
+func recommendationError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found", "status": false})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+}
+
+// displayBooks adds the display prices to a copy of the books, which may be
+// shared with the ranking cache
+func displayBooks(books []models.Book, display *models.ExchangeRate) []models.Book {
+	if display == nil {
+		return books
+	}
+	books = append([]models.Book(nil), books...)
+	services.SetDisplayPrices(books, display)
+	return books
+}
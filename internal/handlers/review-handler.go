@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ReviewHandler struct {
+	reviewService *services.ReviewService
+}
+
+func NewReviewHandler(service *services.ReviewService) *ReviewHandler {
+	return &ReviewHandler{reviewService: service}
+}
+
+// GetBookReviews lists the published reviews of a book. Query: sort=newest
+// (default), helpful, rating_high or rating_low
+func (h *ReviewHandler) GetBookReviews(c *gin.Context) {
+	bookID, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+	page, pageSize, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	sort := c.DefaultQuery("sort", "newest")
+	if _, ok := repositories.ReviewSortOrders[sort]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort", "status": false})
+		return
+	}
+
+	reviews, total, err := h.reviewService.GetReviewsForBook(bookID, sort, page, pageSize)
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+
+	totalItems, totalPages := utils.CalculatePagination(total, page, pageSize)
+	c.JSON(http.StatusOK, gin.H{"data": reviews, "page": page, "page_size": pageSize, "total_items": totalItems, "total_pages": totalPages, "status": true})
+}
+
+func (h *ReviewHandler) CreateReview(c *gin.Context) {
+	bookID, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input services.ReviewInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	userID := c.GetUint("userId")
+	review, errs, err := h.reviewService.CreateReview(bookID, userID, reviewerName(c), &input)
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"status": true, "message": "Review submitted and waiting for moderation", "data": review})
+}
+
+func (h *ReviewHandler) UpdateReview(c *gin.Context) {
+	id, ok := uintParam(c, "review_id")
+	if !ok {
+		return
+	}
+
+	var input services.ReviewInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	review, errs, err := h.reviewService.UpdateReview(id, c.GetUint("userId"), &input)
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Review updated and waiting for moderation", "data": review})
+}
+
+func (h *ReviewHandler) DeleteReview(c *gin.Context) {
+	id, ok := uintParam(c, "review_id")
+	if !ok {
+		return
+	}
+
+	if err := h.reviewService.DeleteReview(id, c.GetUint("userId"), c.GetBool("isAdmin")); err != nil {
+		reviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Review deleted successfully"})
+}
+
+// GetReviews is the moderation queue (admin). Query: status, default pending
+func (h *ReviewHandler) GetReviews(c *gin.Context) {
+	page, pageSize, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	reviews, total, err := h.reviewService.GetReviewsByStatus(c.DefaultQuery("status", models.ReviewPending), page, pageSize)
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+
+	totalItems, totalPages := utils.CalculatePagination(total, page, pageSize)
+	c.JSON(http.StatusOK, gin.H{"data": reviews, "page": page, "page_size": pageSize, "total_items": totalItems, "total_pages": totalPages, "status": true})
+}
+
+func (h *ReviewHandler) ModerateReview(c *gin.Context) {
+	id, ok := uintParam(c, "review_id")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	review, errs, err := h.reviewService.ModerateReview(id, input.Status)
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Review moderated successfully", "data": review})
+}
+
+func (h *ReviewHandler) VoteHelpful(c *gin.Context) {
+	id, ok := uintParam(c, "review_id")
+	if !ok {
+		return
+	}
+
+	if err := h.reviewService.VoteHelpful(id, c.GetUint("userId")); err != nil {
+		reviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Marked as helpful"})
+}
+
+func (h *ReviewHandler) RemoveHelpfulVote(c *gin.Context) {
+	id, ok := uintParam(c, "review_id")
+	if !ok {
+		return
+	}
+
+	if err := h.reviewService.RemoveHelpfulVote(id, c.GetUint("userId")); err != nil {
+		reviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Helpful vote removed"})
+}
+
+func reviewError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book or review not found", "status": false})
+	case errors.Is(err, services.ErrReviewNotAllowed), errors.Is(err, services.ErrReviewForbidden), errors.Is(err, services.ErrOwnReviewVote):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "status": false})
+	case errors.Is(err, repositories.ErrReviewExists), errors.Is(err, repositories.ErrAlreadyVoted), errors.Is(err, services.ErrReviewNotApproved):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+	}
+}
+
+// reviewerName is the display name stored with a review
+func reviewerName(c *gin.Context) string {
+	if info, ok := c.Get("info"); ok {
+		if name, ok := info.(map[string]interface{})["name"].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+func uintParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// pageParams reads page and page_size with the same limits as the book list
+func pageParams(c *gin.Context) (int, int, bool) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number", "status": false})
+		return 0, 0, false
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page size", "status": false})
+		return 0, 0, false
+	}
+	return page, pageSize, true
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ShipmentHandler struct {
+	shipmentService *services.ShipmentService
+}
+
+func NewShipmentHandler(service *services.ShipmentService) *ShipmentHandler {
+	return &ShipmentHandler{shipmentService: service}
+}
+
+// SetShipment records the courier and waybill of an order's parcel (admin)
+func (h *ShipmentHandler) SetShipment(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input services.ShipmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	shipment, errs, err := h.shipmentService.SetShipment(id, &input)
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
+	if err != nil {
+		shipmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Shipment saved successfully", "data": shipment})
+}
+
+// GetTracking shows where the order's parcel is, customers can only track
+// their own orders
+func (h *ShipmentHandler) GetTracking(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	shipment, stale, err := h.shipmentService.TrackShipment(c.Request.Context(), id, c.GetUint("userId"), c.GetBool("isAdmin"))
+	if err != nil {
+		shipmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": shipment, "stale": stale})
+}
+
+func shipmentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found", "status": false})
+	case errors.Is(err, services.ErrNoShipment):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "status": false})
+	case errors.Is(err, services.ErrOrderNotShippable), errors.Is(err, services.ErrInvalidOrderTransition),
+		errors.Is(err, repositories.ErrOrderStatusChanged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": false})
+	default:
+		rajaOngkirError(c, err)
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TaxHandler struct {
+	taxService *services.TaxService
+}
+
+func NewTaxHandler(service *services.TaxService) *TaxHandler {
+	return &TaxHandler{taxService: service}
+}
+
+// GetTaxRates lists the categories with their own tax rate along with the
+// default tax every other category pays
+func (h *TaxHandler) GetTaxRates(c *gin.Context) {
+	rates, err := h.taxService.GetTaxRates()
+	if err != nil {
+		taxError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "default": h.taxService.Policy(), "data": rates})
+}
+
+func (h *TaxHandler) CreateTaxRate(c *gin.Context) {
+	var input services.TaxRateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	rate, errs, err := h.taxService.CreateTaxRate(&input)
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
+	if err != nil {
+		taxError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"status": true, "message": "Tax rate created successfully", "data": rate})
+}
+
+func (h *TaxHandler) UpdateTaxRate(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input services.TaxRateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	rate, errs, err := h.taxService.UpdateTaxRate(id, &input)
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
+	if err != nil {
+		taxError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Tax rate updated successfully", "data": rate})
+}
+
+func (h *TaxHandler) DeleteTaxRate(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.taxService.DeleteTaxRate(id); err != nil {
+		taxError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Tax rate deleted successfully"})
+}
+
+// GetReports sums up the tax of sold orders per rate. Query: from and to as
+// YYYY-MM-DD, both inclusive, default the last 30 days
+func (h *TaxHandler) GetReports(c *gin.Context) {
+	from, to, ok := reportRange(c)
+	if !ok {
+		return
+	}
+
+	reports, err := h.taxService.GetReports(from, to.AddDate(0, 0, 1))
+	if err != nil {
+		taxError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": reports, "from": from.Format(time.DateOnly), "to": to.Format(time.DateOnly)})
+}
+
+func taxError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tax rate not found", "status": false})
+	case errors.Is(err, repositories.ErrTaxRateExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+	}
+}
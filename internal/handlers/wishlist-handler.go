@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type WishlistHandler struct {
+	wishlistService *services.WishlistService
+}
+
+func NewWishlistHandler(service *services.WishlistService) *WishlistHandler {
+	return &WishlistHandler{wishlistService: service}
+}
+
+func (h *WishlistHandler) GetWishlists(c *gin.Context) {
+	wishlists, err := h.wishlistService.GetWishlists(c.GetUint("userId"))
+	if err != nil {
+		wishlistError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": wishlists})
+}
+
+func (h *WishlistHandler) GetWishlist(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	wishlist, err := h.wishlistService.GetWishlist(id, c.GetUint("userId"))
+	if err != nil {
+		wishlistError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": wishlist})
+}
+
+// GetSharedWishlist shows a list to anyone who has its share link
+func (h *WishlistHandler) GetSharedWishlist(c *gin.Context) {
+	wishlist, err := h.wishlistService.GetSharedWishlist(c.Param("token"))
+	if err != nil {
+		wishlistError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "data": wishlist})
+}
+
+func (h *WishlistHandler) CreateWishlist(c *gin.Context) {
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	wishlist, errs, err := h.wishlistService.CreateWishlist(c.GetUint("userId"), input.Name)
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
+	if err != nil {
+		wishlistError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"status": true, "message": "Wishlist created successfully", "data": wishlist})
+}
+
+// UpdateWishlist renames a list and turns its share link on or off
+// ({"shared": true})
+func (h *WishlistHandler) UpdateWishlist(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input services.WishlistUpdate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	wishlist, errs, err := h.wishlistService.UpdateWishlist(id, c.GetUint("userId"), &input)
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "errors": errs, "status": false})
+		return
+	}
+	if err != nil {
+		wishlistError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Wishlist updated successfully", "data": wishlist})
+}
+
+func (h *WishlistHandler) DeleteWishlist(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.wishlistService.DeleteWishlist(id, c.GetUint("userId")); err != nil {
+		wishlistError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Wishlist deleted successfully"})
+}
+
+// AddItem saves a book on the list in the path, or on the default list when
+// the route has no list id
+func (h *WishlistHandler) AddItem(c *gin.Context) {
+	var wishlistID uint
+	if c.Param("id") != "" {
+		id, ok := uintParam(c, "id")
+		if !ok {
+			return
+		}
+		wishlistID = id
+	}
+
+	var input struct {
+		BookID uint `json:"book_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "status": false})
+		return
+	}
+
+	item, err := h.wishlistService.AddItem(c.GetUint("userId"), wishlistID, input.BookID)
+	if err != nil {
+		wishlistError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"status": true, "message": "Book added to wishlist", "data": item})
+}
+
+func (h *WishlistHandler) RemoveItem(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+	bookID, ok := uintParam(c, "book_id")
+	if !ok {
+		return
+	}
+
+	if err := h.wishlistService.RemoveItem(c.GetUint("userId"), id, bookID); err != nil {
+		wishlistError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "message": "Book removed from wishlist"})
+}
+
+func wishlistError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist or book not found", "status": false})
+	case errors.Is(err, services.ErrTooManyWishlists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": false})
+	}
+}
@@ -0,0 +1,215 @@
+// Package invoice renders the PDF invoices of paid orders
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/go-pdf/fpdf"
+)
+
+// Store is the seller shown at the top of every invoice
+type Store struct {
+	Name    string
+	Address string
+	Email   string
+	Phone   string
+	TaxID   string // NPWP, shown when set
+}
+
+// Document is what goes on an invoice: the order with its books and
+// shipping, and the prices the books were ordered at by book ID. Prices is
+// empty for orders placed before they were kept per book, the lines then go
+// without a price
+type Document struct {
+	Invoice *models.Invoice
+	Order   *models.Order
+	Prices  map[uint]money.Money
+}
+
+const (
+	pageWidth = 180 // A4 less the margins, in mm
+	lineH     = 5
+)
+
+// Render writes the document as an A4 PDF. Core fonts are used, so text is
+// limited to Windows-1252
+func Render(w io.Writer, store Store, doc *Document) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetTitle("Invoice "+doc.Invoice.Number, true)
+	pdf.SetAuthor(store.Name, true)
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.AddPage()
+
+	order := doc.Order
+
+	// Seller on the left, invoice details on the right
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(110, 8, tr(store.Name), "", 0, "L", false, 0, "")
+	pdf.CellFormat(70, 8, "INVOICE", "", 1, "R", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	details := [][2]string{
+		{"Invoice no.", doc.Invoice.Number},
+		{"Date", doc.Invoice.IssuedAt.Format("2 January 2006")},
+		{"Order", "#" + strconv.FormatUint(uint64(order.ID), 10)},
+		{"Status", "PAID"},
+	}
+	seller := append(strings.Split(store.Address, "\n"), store.Email, store.Phone)
+	if store.TaxID != "" {
+		seller = append(seller, "NPWP "+store.TaxID)
+	}
+	for i := 0; i < len(seller) || i < len(details); i++ {
+		left, label, value := "", "", ""
+		if i < len(seller) {
+			left = seller[i]
+		}
+		if i < len(details) {
+			label, value = details[i][0], details[i][1]
+		}
+		pdf.CellFormat(110, lineH, tr(strings.TrimSpace(left)), "", 0, "L", false, 0, "")
+		pdf.CellFormat(30, lineH, label, "", 0, "L", false, 0, "")
+		pdf.CellFormat(40, lineH, tr(value), "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	// Customer and shipping
+	address := joinNonEmpty(", ", order.Address.City, order.Address.State, order.Address.Province, order.Address.Zipcode)
+	shipping := joinNonEmpty(" ", strings.ToUpper(order.Shipping.ShippingType), order.Shipping.ShippingService)
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(90, lineH, "Bill to", "", 0, "L", false, 0, "")
+	pdf.CellFormat(90, lineH, "Ship to", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	for _, row := range [][2]string{
+		{order.Name, order.Name},
+		{order.Email, address},
+		{order.Phone, shipping},
+	} {
+		pdf.CellFormat(90, lineH, tr(row[0]), "", 0, "L", false, 0, "")
+		pdf.CellFormat(90, lineH, tr(row[1]), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	// Books
+	columns := []struct {
+		title string
+		width float64
+		align string
+	}{{"No", 10, "C"}, {"Book", 105, "L"}, {"ISBN", 35, "L"}, {"Price", 30, "R"}}
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetFillColor(235, 235, 235)
+	for _, column := range columns {
+		pdf.CellFormat(column.width, 7, column.title, "B", 0, column.align, true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Helvetica", "", 9)
+	for i, book := range order.Books {
+		price := "-"
+		if amount, ok := doc.Prices[book.ID]; ok {
+			price = Amount(amount)
+		}
+		title := book.Title
+		if book.Author != "" {
+			title += " - " + book.Author
+		}
+		lines := pdf.SplitLines([]byte(tr(title)), columns[1].width-2)
+		height := float64(len(lines)) * lineH
+		if _, pageHeight := pdf.GetPageSize(); pdf.GetY()+height > pageHeight-15 {
+			pdf.AddPage()
+		}
+		pdf.CellFormat(columns[0].width, height, strconv.Itoa(i+1), "B", 0, "C", false, 0, "")
+		x, y := pdf.GetXY()
+		pdf.MultiCell(columns[1].width, lineH, string(bytes.Join(lines, []byte("\n"))), "B", "L", false)
+		pdf.SetXY(x+columns[1].width, y)
+		pdf.CellFormat(columns[2].width, height, book.ISBN, "B", 0, "L", false, 0, "")
+		pdf.CellFormat(columns[3].width, height, price, "B", 1, "R", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	// Totals
+	total := func(label, value string, bold bool) {
+		style := ""
+		if bold {
+			style = "B"
+		}
+		pdf.SetFont("Helvetica", style, 9)
+		pdf.CellFormat(pageWidth-40, lineH+1, tr(label), "", 0, "R", false, 0, "")
+		pdf.CellFormat(40, lineH+1, tr(value), "", 1, "R", false, 0, "")
+	}
+	total("Subtotal", Amount(order.Subtotal), false)
+	if order.Discount.IsPositive() {
+		total(joinNonEmpty(" ", "Discount", order.CouponCode), "-"+Amount(order.Discount), false)
+	}
+	total(joinNonEmpty(" ", "Shipping", shipping), Amount(order.Shipping.ShippingCost), false)
+	if order.TaxMode == models.TaxExclusive {
+		for _, tax := range order.Taxes {
+			total(fmt.Sprintf("%s %s%% of %s", tax.Name, percent(tax.Percent), Amount(tax.Base)), Amount(tax.Tax), false)
+		}
+	}
+	total("Total", Amount(order.TotalPrice), true)
+	if order.TaxMode != models.TaxExclusive {
+		for _, tax := range order.Taxes {
+			total(fmt.Sprintf("Includes %s %s%% of %s", tax.Name, percent(tax.Percent), Amount(tax.Base)), Amount(tax.Tax), false)
+		}
+	}
+	if order.DisplayCurrency != "" && order.DisplayCurrency != order.Currency {
+		rate := fmt.Sprintf("Paid in %s, shown in %s at 1 %s = %s", order.Currency, order.DisplayCurrency, order.DisplayCurrency,
+			Amount(money.FromMajor(1, order.DisplayCurrency).Convert(order.Currency, order.ExchangeRate)))
+		total(rate, Amount(order.DisplayTotal()), false)
+	}
+
+	pdf.Ln(8)
+	pdf.SetFont("Helvetica", "I", 8)
+	pdf.MultiCell(pageWidth, 4, tr("Thank you for shopping at "+store.Name+". This invoice is proof of payment."), "", "C", false)
+
+	return pdf.Output(w)
+}
+
+// Amount formats money the Indonesian way, e.g. Rp99.000 or USD 6,09
+func Amount(m money.Money) string {
+	sign := ""
+	if m.IsNegative() {
+		sign, m = "-", money.New(-m.Amount, m.Currency)
+	}
+
+	whole, fraction, _ := strings.Cut(m.Decimal(), ".")
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte('.')
+		}
+		grouped.WriteRune(digit)
+	}
+	if strings.Trim(fraction, "0") != "" {
+		grouped.WriteString("," + fraction)
+	}
+
+	currency := m.Currency
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	if currency == "IDR" {
+		return sign + "Rp" + grouped.String()
+	}
+	return sign + currency + " " + grouped.String()
+}
+
+func percent(p float64) string {
+	return strings.ReplaceAll(strconv.FormatFloat(p, 'f', -1, 64), ".", ",")
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, sep)
+}
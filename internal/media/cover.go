@@ -0,0 +1,128 @@
+// Package media turns uploaded images into the resized variants we serve
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/disintegration/imaging"
+
+	// Register the WebP decoder so WebP uploads can be processed too
+	_ "golang.org/x/image/webp"
+)
+
+// ErrInvalidImage is returned when the upload cannot be decoded as an image
+var ErrInvalidImage = errors.New("media: file is not a supported image")
+
+const (
+	FormatJPEG = "jpeg"
+	FormatWebP = "webp"
+)
+
+// Size is a named variant, images are scaled down to Width keeping the aspect
+// ratio and never scaled up
+type Size struct {
+	Name  string
+	Width int
+}
+
+var CoverSizes = []Size{
+	{Name: "thumbnail", Width: 160},
+	{Name: "card", Width: 320},
+	{Name: "detail", Width: 800},
+}
+
+// DetailSize is the variant used as the plain cover_image URL
+const DetailSize = "detail"
+
+type Variant struct {
+	Size        string
+	Format      string
+	Key         string
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+var formats = []struct {
+	name        string
+	extension   string
+	contentType string
+}{
+	{FormatJPEG, "jpg", "image/jpeg"},
+	{FormatWebP, "webp", "image/webp"},
+}
+
+// ProcessCover decodes the image, applies the EXIF orientation and encodes
+// every size in JPEG and WebP. Re-encoding drops EXIF and other metadata.
+// Keys are derived from the source bytes, so the same upload always maps to
+// the same keys: covers/<hash>/<size>.<ext>
+func ProcessCover(r io.Reader) ([]Variant, error) {
+	source, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := imaging.Decode(bytes.NewReader(source), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	sum := sha256.Sum256(source)
+	prefix := "covers/" + hex.EncodeToString(sum[:16])
+
+	var variants []Variant
+	for _, size := range CoverSizes {
+		resized := fitWidth(img, size.Width)
+		bounds := resized.Bounds()
+
+		for _, format := range formats {
+			var buf bytes.Buffer
+			if err := encode(&buf, resized, format.name); err != nil {
+				return nil, fmt.Errorf("encoding %s %s: %w", size.Name, format.name, err)
+			}
+
+			variants = append(variants, Variant{
+				Size:        size.Name,
+				Format:      format.name,
+				Key:         fmt.Sprintf("%s/%s.%s", prefix, size.Name, format.extension),
+				ContentType: format.contentType,
+				Width:       bounds.Dx(),
+				Height:      bounds.Dy(),
+				Data:        buf.Bytes(),
+			})
+		}
+	}
+
+	return variants, nil
+}
+
+func fitWidth(img image.Image, width int) image.Image {
+	if img.Bounds().Dx() <= width {
+		return img
+	}
+	return imaging.Resize(img, width, 0, imaging.Lanczos)
+}
+
+func encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case FormatJPEG:
+		// JPEG has no alpha channel, flatten transparent covers onto white
+		bounds := img.Bounds()
+		flat := imaging.Overlay(imaging.New(bounds.Dx(), bounds.Dy(), color.White), img, image.Pt(0, 0), 1.0)
+		return jpeg.Encode(w, flat, &jpeg.Options{Quality: 85})
+	case FormatWebP:
+		// nativewebp is pure Go and only writes lossless WebP
+		return nativewebp.Encode(w, img, nil)
+	}
+	return fmt.Errorf("unsupported format %q", format)
+}
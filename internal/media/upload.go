@@ -0,0 +1,75 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"mime"
+	"slices"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+var (
+	// ErrTooLarge is returned when the upload is over UploadPolicy.MaxBytes
+	ErrTooLarge = errors.New("media: file is too large")
+	// ErrDimensionsTooLarge is returned when the image is wider or taller than allowed
+	ErrDimensionsTooLarge = errors.New("media: image dimensions are too large")
+	// ErrUnsupportedType is returned when the sniffed type is not allowed
+	ErrUnsupportedType = errors.New("media: unsupported file type")
+)
+
+// DefaultAllowedTypes are the image types we can decode and re-encode
+var DefaultAllowedTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+// UploadPolicy limits what may be uploaded as a cover. The type is sniffed
+// from the file's magic bytes, the client's Content-Type and file name are
+// never trusted
+type UploadPolicy struct {
+	MaxBytes     int64
+	MaxWidth     int
+	MaxHeight    int
+	AllowedTypes []string
+}
+
+// Validate reads the upload, up to MaxBytes, and checks its type and
+// dimensions. Dimensions are read from the header only, so oversized images
+// are rejected before they are decoded. It returns the bytes that were read
+func (p UploadPolicy) Validate(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, p.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > p.MaxBytes {
+		return nil, fmt.Errorf("%w, the maximum is %d bytes", ErrTooLarge, p.MaxBytes)
+	}
+
+	detected := mimetype.Detect(data)
+	if !p.allows(detected) {
+		return nil, fmt.Errorf("%w %s, allowed: %v", ErrUnsupportedType, detected.String(), p.AllowedTypes)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if config.Width > p.MaxWidth || config.Height > p.MaxHeight {
+		return nil, fmt.Errorf("%w, %dx%d is over the maximum of %dx%d",
+			ErrDimensionsTooLarge, config.Width, config.Height, p.MaxWidth, p.MaxHeight)
+	}
+
+	return data, nil
+}
+
+func (p UploadPolicy) allows(detected *mimetype.MIME) bool {
+	return slices.ContainsFunc(p.AllowedTypes, detected.Is)
+}
+
+// AllowsType reports whether a declared content type, such as the one a
+// client asks to presign, is on the allow-list
+func (p UploadPolicy) AllowsType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && slices.Contains(p.AllowedTypes, mediaType)
+}
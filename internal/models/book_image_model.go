@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// BookImage is one image in a book's gallery, such as the back cover, the
+// spine or a sample page. Images are processed like covers, ImageURL is the
+// detail JPEG
+type BookImage struct {
+	ID        uint          `json:"id" gorm:"primarykey"`
+	BookID    uint          `json:"book_id" gorm:"not null;index"`
+	Position  int           `json:"position" gorm:"not null"`
+	AltText   string        `json:"alt_text" gorm:"type:varchar(255)"`
+	IsPrimary bool          `json:"is_primary" gorm:"not null"` // at most one per book, leads the gallery
+	ImageURL  string        `json:"image_url" gorm:"type:varchar(255);not null"`
+	Images    CoverImageSet `json:"images" gorm:"type:text;serializer:json"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// URLs lists the image and all of its variants
+func (i *BookImage) URLs() []string {
+	return append(i.Images.URLs(), i.ImageURL)
+}
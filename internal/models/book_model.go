@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/febriaricandra/book-shop/pkg/money"
 	"gorm.io/gorm"
 )
 
@@ -13,16 +14,73 @@ type BaseModel struct {
 	DeletedAt gorm.DeletedAt `json:"deleted_at"`
 }
 
+const (
+	BookInStock     = "in_stock"
+	BookOutOfStock  = "out_of_stock"
+	BookUnavailable = "unavailable" // withdrawn by the publisher
+)
+
+// ImageURLs holds the URL of each encoding of one image size
+type ImageURLs struct {
+	JPEG string `json:"jpeg"`
+	WebP string `json:"webp"`
+}
+
+// CoverImageSet maps a size name (thumbnail, card, detail) to its URLs
+type CoverImageSet map[string]ImageURLs
+
+// URLs lists every URL in the set
+func (set CoverImageSet) URLs() []string {
+	var urls []string
+	for _, image := range set {
+		for _, url := range []string{image.JPEG, image.WebP} {
+			if url != "" {
+				urls = append(urls, url)
+			}
+		}
+	}
+	return urls
+}
+
 type Book struct {
 	BaseModel
-	Title       string  `json:"title" gorm:"type:varchar(255);not null"`
-	Description string  `json:"description" gorm:"type:text;not null"`
-	Category    string  `json:"category" gorm:"type:varchar(255);not null"`
-	Trending    bool    `json:"trending" gorm:"not null"`
-	CoverImage  string  `json:"cover_image" gorm:"type:varchar(255);not null"`
-	OldPrice    float64 `json:"old_price" gorm:"not null"`
-	NewPrice    float64 `json:"new_price" gorm:"not null"`
-	Weight      int64   `json:"weight" gorm:"not null"`
+	ISBN         string        `json:"isbn" gorm:"column:isbn;type:varchar(20);index"`
+	Title        string        `json:"title" gorm:"type:varchar(255);not null"`
+	Author       string        `json:"author" gorm:"type:varchar(255)"`
+	Description  string        `json:"description" gorm:"type:text;not null"`
+	Category     string        `json:"category" gorm:"type:varchar(255);not null"`
+	Trending     bool          `json:"trending" gorm:"not null"`
+	CoverImage   string        `json:"cover_image" gorm:"type:varchar(255);not null"`
+	CoverImages  CoverImageSet `json:"cover_images" gorm:"type:text;serializer:json"`
+	OldPrice     money.Money   `json:"old_price" gorm:"not null"`
+	NewPrice     money.Money   `json:"new_price" gorm:"not null"`
+	Weight       int64         `json:"weight" gorm:"not null"`
+	PageCount    int           `json:"page_count"`
+	Publisher    string        `json:"publisher" gorm:"type:varchar(255)"`
+	Series       string        `json:"series" gorm:"type:varchar(255);index"`
+	Availability string        `json:"availability" gorm:"type:varchar(20);not null;default:in_stock"` // one of BookInStock, BookOutOfStock, BookUnavailable
+	ArchivedAt   *time.Time    `json:"archived_at" gorm:"index"`                                       // hidden from the storefront while open orders reference it
+	Version      uint          `json:"version" gorm:"not null;default:1"`                              // bumped on every update for optimistic locking
+
+	// Aggregates of approved reviews, maintained by the review repository
+	RatingAverage float64 `json:"rating_average" gorm:"not null;default:0;index"`
+	RatingCount   int     `json:"rating_count" gorm:"not null;default:0"`
+	RatingTotal   int     `json:"-" gorm:"not null;default:0"`
+
+	Images []BookImage `json:"images,omitempty" gorm:"foreignKey:BookID"` // gallery, only loaded for the book detail
+
+	LowestPrice30d *money.Money      `json:"lowest_price_30d,omitempty" gorm:"-"` // lowest price of the 30 days before the current price, set for the storefront
+	PriceSource    PriceChangeSource `json:"-" gorm:"-"`                          // why the price changes on UpdateBook
+	DisplayPrice   *DisplayPrice     `json:"display_price,omitempty" gorm:"-"`    // prices in the currency the customer asked for
 
 	//Orders []Order `gorm:"many2many:order_books;"` // many-to-many relationship
 }
+
+// CoverURLs lists the cover and all of its variants
+func (b *Book) CoverURLs() []string {
+	urls := b.CoverImages.URLs()
+	if b.CoverImage != "" {
+		urls = append(urls, b.CoverImage)
+	}
+	return urls
+}
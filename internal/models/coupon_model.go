@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/febriaricandra/book-shop/pkg/money"
+)
+
+const (
+	CouponPercentage   = "percentage"
+	CouponFixed        = "fixed"
+	CouponFreeShipping = "free_shipping"
+)
+
+// Coupon is a discount code customers enter at checkout. Limits of zero mean
+// unlimited, and a coupon without categories or books applies to every book
+type Coupon struct {
+	BaseModel
+	Code         string      `json:"code" gorm:"type:varchar(50);not null;uniqueIndex"` // stored upper case
+	Description  string      `json:"description" gorm:"type:varchar(255)"`
+	Type         string      `json:"type" gorm:"type:varchar(20);not null"`  // one of CouponPercentage, CouponFixed, CouponFreeShipping
+	PercentOff   float64     `json:"percent_off" gorm:"not null;default:0"`  // for percentage coupons
+	AmountOff    money.Money `json:"amount_off" gorm:"not null;default:0"`   // for fixed coupons
+	MaxDiscount  money.Money `json:"max_discount" gorm:"not null;default:0"` // caps a percentage discount
+	MinSubtotal  money.Money `json:"min_subtotal" gorm:"not null;default:0"`
+	StartsAt     *time.Time  `json:"starts_at"`
+	EndsAt       *time.Time  `json:"ends_at"`
+	UsageLimit   int         `json:"usage_limit" gorm:"not null;default:0"`
+	PerUserLimit int         `json:"per_user_limit" gorm:"not null;default:0"`
+	UsedCount    int         `json:"used_count" gorm:"not null;default:0"` // maintained by the order repository
+	Categories   []string    `json:"categories" gorm:"type:text;serializer:json"`
+	BookIDs      []uint      `json:"book_ids" gorm:"type:text;serializer:json"`
+	Active       bool        `json:"active" gorm:"not null"` // always written, a default would turn false into true on create
+}
+
+// CouponRedemption records the coupon used on an order. It is removed when
+// the order is cancelled so the use counts towards the limits again
+type CouponRedemption struct {
+	ID        uint        `json:"id" gorm:"primarykey"`
+	CouponID  uint        `json:"coupon_id" gorm:"not null;index:idx_coupon_redemptions_user"`
+	UserID    uint        `json:"user_id" gorm:"not null;index:idx_coupon_redemptions_user"`
+	OrderID   uint        `json:"order_id" gorm:"not null;uniqueIndex"`
+	Discount  money.Money `json:"discount" gorm:"not null"`
+	CreatedAt time.Time   `json:"created_at"`
+}
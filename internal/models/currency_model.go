@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/febriaricandra/book-shop/pkg/money"
+)
+
+// ExchangeRate is the price of one unit of a foreign currency in the shop
+// currency, e.g. 16250 for USD. Prices are shown in it, orders are still
+// paid in the shop currency
+type ExchangeRate struct {
+	Currency  string    `json:"currency" gorm:"type:varchar(3);primarykey"`
+	Rate      float64   `json:"rate" gorm:"not null;default:0"`
+	Manual    bool      `json:"manual" gorm:"not null"` // set by an admin, the rate provider leaves it alone
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Convert turns an amount in the shop currency into the rate's currency
+func (r *ExchangeRate) Convert(amount money.Money) money.Money {
+	return amount.Convert(r.Currency, 1/r.Rate)
+}
+
+// DisplayPrice is a book's prices in the currency the customer asked for
+type DisplayPrice struct {
+	Currency       string       `json:"currency"`
+	Rate           float64      `json:"rate"`
+	OldPrice       money.Money  `json:"old_price"`
+	NewPrice       money.Money  `json:"new_price"`
+	LowestPrice30d *money.Money `json:"lowest_price_30d,omitempty"`
+}
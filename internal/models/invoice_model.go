@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Invoice is issued once an order is paid. Sequence numbers have no gaps and
+// invoices are never deleted, so a number is never given out twice. The PDF
+// is rendered once when the invoice is issued and kept as it was, later edits
+// to the order, its books or the seller do not change it
+type Invoice struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	Number    string     `json:"number" gorm:"type:varchar(30);not null;uniqueIndex"`
+	Sequence  uint       `json:"sequence" gorm:"not null;uniqueIndex"`
+	OrderID   uint       `json:"order_id" gorm:"not null;uniqueIndex"`
+	IssuedAt  time.Time  `json:"issued_at" gorm:"not null"`
+	EmailedAt *time.Time `json:"emailed_at"`
+	PDF       []byte     `json:"-"`
+}
+
+// InvoiceCounter holds the last invoice sequence number, its single row is
+// locked while an invoice is issued
+type InvoiceCounter struct {
+	ID   uint `gorm:"primarykey"`
+	Last uint `gorm:"not null;default:0"`
+}
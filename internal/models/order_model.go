@@ -1,30 +1,88 @@
 package models
 
+import (
+	"time"
+
+	"github.com/febriaricandra/book-shop/pkg/money"
+)
+
 type Address struct {
+	CityID   string `json:"city_id" gorm:"type:varchar(10)"` // RajaOngkir city the order ships to
 	City     string `json:"city" gorm:"type:varchar(255);not null"`
 	Province string `json:"province" gorm:"type:varchar(255)"`
 	State    string `json:"state" gorm:"type:varchar(255)"`
 	Zipcode  string `json:"zipcode" gorm:"type:varchar(255)"`
 }
 
+// Shipping is the courier service of an order, taken from the shipping
+// quote the customer accepted
 type Shipping struct {
-	ShippingType    string `json:"shipping_type" gorm:"type:varchar(255);not null"`
-	ShippingService string `json:"shipping_service" gorm:"type:varchar(255);not null"`
-	ShippingCost    int    `json:"shipping_cost" gorm:"type:int;not null"`
+	ShippingType    string      `json:"shipping_type" gorm:"type:varchar(255);not null"` // courier code, e.g. jne
+	ShippingService string      `json:"shipping_service" gorm:"type:varchar(255);not null"`
+	ShippingCost    money.Money `json:"shipping_cost" gorm:"not null"`
+	ShippingWeight  int64       `json:"shipping_weight" gorm:"not null;default:0"` // grams the cost was quoted for
+	ShippingETD     string      `json:"shipping_etd" gorm:"type:varchar(20)"`      // estimated days in transit, e.g. "2-3"
+}
+
+// ShippingPolicy is how shipping is quoted: from the warehouse's RajaOngkir
+// city, with books without a weight counted at DefaultWeight grams. Quotes
+// are signed with QuoteSecret and can be ordered with for QuoteTTL
+type ShippingPolicy struct {
+	Origin        string
+	DefaultWeight int64
+	QuoteTTL      time.Duration
+	QuoteSecret   []byte
 }
 
+const (
+	OrderPending   = "pending"
+	OrderPaid      = "paid"
+	OrderShipped   = "shipped"
+	OrderDelivered = "delivered"
+	OrderCancelled = "cancelled"
+)
+
+// OpenOrderStatuses are the statuses of orders that are not finished yet
+var OpenOrderStatuses = []string{OrderPending, OrderPaid, OrderShipped}
+
+// SoldOrderStatuses are the statuses of orders that count as a sale
+var SoldOrderStatuses = []string{OrderPaid, OrderShipped, OrderDelivered}
+
 type Order struct {
 	BaseModel
-	Name       string  `json:"name" gorm:"type:varchar(255);not null"`
-	Email      string  `json:"email" gorm:"type:varchar(255);not null"`
-	Address    Address `json:"address" gorm:"embedded"`
-	Phone      string  `json:"phone" gorm:"type:varchar(20);not null"`
-	TotalPrice float64 `json:"total_price" gorm:"column:total_price;not null"`
-	UserId     uint    `json:"user_id" gorm:"column:user_id;not null"`
+	Name       string      `json:"name" gorm:"type:varchar(255);not null"`
+	Email      string      `json:"email" gorm:"type:varchar(255);not null"`
+	Address    Address     `json:"address" gorm:"embedded"`
+	Phone      string      `json:"phone" gorm:"type:varchar(20);not null"`
+	Subtotal   money.Money `json:"subtotal" gorm:"not null;default:0"`
+	Discount   money.Money `json:"discount" gorm:"not null;default:0"` // taken off by CouponCode, shipping included
+	CouponCode string      `json:"coupon_code,omitempty" gorm:"type:varchar(50)"`
+	Tax        money.Money `json:"tax" gorm:"not null;default:0"`                               // sum of Taxes
+	TaxMode    string      `json:"tax_mode" gorm:"type:varchar(10);not null;default:inclusive"` // whether the book prices included the tax
+	TotalPrice money.Money `json:"total_price" gorm:"column:total_price;not null"`              // subtotal plus shipping cost minus discount, plus the tax when exclusive
+	Currency   string      `json:"currency" gorm:"type:varchar(3);not null;default:IDR"`        // the order is paid in this currency
+
+	// The currency the customer saw prices in and what one unit of it cost in
+	// Currency when they ordered, Currency at rate 1 when none was chosen
+	DisplayCurrency string  `json:"display_currency" gorm:"type:varchar(3);not null;default:IDR"`
+	ExchangeRate    float64 `json:"exchange_rate" gorm:"not null;default:1"`
+
+	UserId uint   `json:"user_id" gorm:"column:user_id;not null"`
+	Status string `json:"status" gorm:"type:varchar(20);not null;default:pending;index"`
+
+	Books    []Book     `json:"books" gorm:"many2many:order_books;"` // many-to-many relationship
+	Taxes    []OrderTax `json:"taxes" gorm:"foreignKey:OrderID"`
+	User     User       `json:"user" gorm:"foreignKey:user_id"`
+	Shipping Shipping   `json:"shipping" gorm:"embedded"`
+}
 
-	Books    []Book   `json:"books" gorm:"many2many:order_books;"` // many-to-many relationship
-	User     User     `json:"user" gorm:"foreignKey:user_id"`
-	Shipping Shipping `json:"shipping" gorm:"embedded"`
+// DisplayTotal is the total in the display currency at the recorded rate
+func (o *Order) DisplayTotal() money.Money {
+	if o.DisplayCurrency == "" || o.DisplayCurrency == o.Currency || o.ExchangeRate <= 0 {
+		return o.TotalPrice
+	}
+	rate := ExchangeRate{Currency: o.DisplayCurrency, Rate: o.ExchangeRate}
+	return rate.Convert(o.TotalPrice)
 }
 
 func (o *Order) TableName() string {
@@ -33,8 +91,9 @@ func (o *Order) TableName() string {
 
 type OrderBook struct {
 	BaseModel
-	OrderID uint `json:"order_id" gorm:"column:order_id;not null"`
-	BookID  uint `json:"book_id" gorm:"column:book_id;not null"`
+	OrderID uint        `json:"order_id" gorm:"column:order_id;not null"`
+	BookID  uint        `json:"book_id" gorm:"column:book_id;not null"`
+	Price   money.Money `json:"price" gorm:"not null;default:0"` // what the book cost when ordered, zero on orders placed before it was kept
 }
 
 func (ob *OrderBook) TableName() string {
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	"github.com/febriaricandra/book-shop/pkg/money"
+)
+
+const (
+	PriceRuleScheduled = "scheduled"
+	PriceRuleActive    = "active"
+	PriceRuleEnded     = "ended"
+	PriceRuleCancelled = "cancelled"
+)
+
+const (
+	PriceReasonCreated   = "created" // the first price of a new book, OldPrice is zero
+	PriceReasonManual    = "manual"
+	PriceReasonImport    = "import"
+	PriceReasonRuleStart = "rule_start"
+	PriceReasonRuleEnd   = "rule_end"
+)
+
+// PriceRule puts a book, or every book of a category, on sale between
+// StartsAt and EndsAt, at SalePrice or PercentOff the regular price
+type PriceRule struct {
+	ID         uint        `json:"id" gorm:"primarykey"`
+	Name       string      `json:"name" gorm:"type:varchar(255);not null"`
+	BookID     *uint       `json:"book_id" gorm:"index"`
+	Category   string      `json:"category,omitempty" gorm:"type:varchar(255)"`
+	SalePrice  money.Money `json:"sale_price" gorm:"not null;default:0"`
+	PercentOff float64     `json:"percent_off" gorm:"not null;default:0"`
+	StartsAt   time.Time   `json:"starts_at" gorm:"not null;index"`
+	EndsAt     time.Time   `json:"ends_at" gorm:"not null;index"`
+	Status     string      `json:"status" gorm:"type:varchar(20);not null;default:scheduled;index"` // one of PriceRuleScheduled, PriceRuleActive, PriceRuleEnded, PriceRuleCancelled
+	CreatedBy  uint        `json:"created_by" gorm:"not null"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+
+	Books []PriceRuleBook `json:"books,omitempty" gorm:"foreignKey:PriceRuleID"` // books on sale while the rule is active
+}
+
+// PriceRuleBook is a book on sale by an active rule and the price to go
+// back to. A book is on at most one sale at a time
+type PriceRuleBook struct {
+	ID           uint        `json:"id" gorm:"primarykey"`
+	PriceRuleID  uint        `json:"price_rule_id" gorm:"not null;index"`
+	BookID       uint        `json:"book_id" gorm:"not null;uniqueIndex"`
+	RegularPrice money.Money `json:"regular_price" gorm:"not null"`
+	SalePrice    money.Money `json:"sale_price" gorm:"not null"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+// PriceChange is an entry of a book's price history
+type PriceChange struct {
+	ID          uint        `json:"id" gorm:"primarykey"`
+	BookID      uint        `json:"book_id" gorm:"not null;index:idx_price_changes_book"`
+	OldPrice    money.Money `json:"old_price" gorm:"not null"`
+	NewPrice    money.Money `json:"new_price" gorm:"not null"`
+	Reason      string      `json:"reason" gorm:"type:varchar(20);not null"` // one of the PriceReason constants
+	UserID      *uint       `json:"user_id"`                                 // nil for imports and rules
+	PriceRuleID *uint       `json:"price_rule_id"`
+	CreatedAt   time.Time   `json:"created_at" gorm:"index:idx_price_changes_book"`
+}
+
+// PriceChangeSource says who changed a book's price and why, UpdateBook
+// records it in the price history when the price changed
+type PriceChangeSource struct {
+	Reason      string
+	UserID      *uint
+	PriceRuleID *uint
+}
+
+// SalePriceFor is the rule's price for a book at the regular price, rounded
+// to whole rupiah
+func (r *PriceRule) SalePriceFor(regular money.Money) money.Money {
+	if r.PercentOff > 0 {
+		return regular.Percent(100 - r.PercentOff)
+	}
+	return r.SalePrice
+}
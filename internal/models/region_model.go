@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// RegionCache keeps a list fetched from RajaOngkir, such as the provinces,
+// as JSON so it survives restarts and can be served when RajaOngkir is down
+type RegionCache struct {
+	Key       string    `json:"key" gorm:"column:cache_key;type:varchar(50);primarykey"`
+	Data      string    `json:"-" gorm:"type:mediumtext;not null"`
+	FetchedAt time.Time `json:"fetched_at" gorm:"not null"`
+}
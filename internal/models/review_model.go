@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// Review is a customer's rating of a book they received. Only approved
+// reviews are public and counted in the book's rating
+type Review struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	BookID       uint      `json:"book_id" gorm:"not null;uniqueIndex:idx_reviews_book_user"`
+	UserID       uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_reviews_book_user"` // one review per user per book
+	Reviewer     string    `json:"reviewer" gorm:"type:varchar(255);not null"`
+	Rating       int       `json:"rating" gorm:"not null"`
+	Title        string    `json:"title" gorm:"type:varchar(255);not null"`
+	Body         string    `json:"body" gorm:"type:text;not null"`
+	Status       string    `json:"status" gorm:"type:varchar(20);not null;default:pending;index"` // one of ReviewPending, ReviewApproved, ReviewRejected
+	HelpfulCount int       `json:"helpful_count" gorm:"not null;default:0"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ReviewVote records that a user found a review helpful
+type ReviewVote struct {
+	ReviewID  uint      `json:"review_id" gorm:"primaryKey;autoIncrement:false"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt time.Time `json:"created_at"`
+}
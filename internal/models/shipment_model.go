@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Shipment is the parcel of an order, entered by warehouse staff once it is
+// handed to the courier. Manifest keeps the last tracking answer so customers
+// can be served without asking the courier every time
+type Shipment struct {
+	ID          uint            `json:"id" gorm:"primarykey"`
+	OrderID     uint            `json:"order_id" gorm:"not null;uniqueIndex"`
+	Courier     string          `json:"courier" gorm:"type:varchar(20);not null"` // courier code, e.g. jne
+	Service     string          `json:"service" gorm:"type:varchar(50)"`
+	Waybill     string          `json:"waybill" gorm:"type:varchar(50);not null"`
+	Status      string          `json:"status" gorm:"type:varchar(50)"` // as the courier reports it, e.g. ON PROCESS
+	Receiver    string          `json:"receiver,omitempty" gorm:"type:varchar(255)"`
+	DeliveredAt *time.Time      `json:"delivered_at"`
+	Manifest    []ManifestEntry `json:"manifest" gorm:"type:text;serializer:json"`
+	TrackedAt   *time.Time      `json:"tracked_at" gorm:"index"` // last time the courier was asked, nil before the first time
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// ManifestEntry is one step of a parcel's journey, e.g. arriving at a hub
+type ManifestEntry struct {
+	Code        string    `json:"code"`
+	Description string    `json:"description"`
+	City        string    `json:"city"`
+	Time        time.Time `json:"time"`
+}
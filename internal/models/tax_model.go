@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/febriaricandra/book-shop/pkg/money"
+)
+
+const (
+	TaxInclusive = "inclusive" // book prices include the tax
+	TaxExclusive = "exclusive" // the tax is added to the book prices
+)
+
+// TaxPolicy is the shop's tax setup: the default rate, e.g. PPN at 11%, and
+// whether book prices include it
+type TaxPolicy struct {
+	Mode    string  `json:"mode"`    // TaxInclusive or TaxExclusive
+	Name    string  `json:"name"`    // shown on tax lines, e.g. PPN
+	Percent float64 `json:"percent"` // default rate for categories without their own
+}
+
+// TaxRate overrides the default rate for the books of a category, a rate of
+// zero makes them exempt
+type TaxRate struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	Category  string    `json:"category" gorm:"type:varchar(255);not null;uniqueIndex"`
+	Name      string    `json:"name" gorm:"type:varchar(50);not null"`
+	Percent   float64   `json:"percent" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrderTax is the tax on the books of an order taxed at one rate. Base is
+// the amount taxed, without the tax and after the discount
+type OrderTax struct {
+	ID      uint        `json:"id" gorm:"primarykey"`
+	OrderID uint        `json:"order_id" gorm:"not null;index"`
+	Name    string      `json:"name" gorm:"type:varchar(50);not null"`
+	Percent float64     `json:"percent" gorm:"not null"`
+	Base    money.Money `json:"base" gorm:"not null"`
+	Tax     money.Money `json:"tax" gorm:"not null"`
+}
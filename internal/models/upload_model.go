@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// CoverUpload is a presigned direct-to-bucket upload that has not been
+// confirmed yet. The row is removed once the cover is attached to its book,
+// rows that outlive ExpiresAt are garbage collected with their object
+type CoverUpload struct {
+	ID            string    `json:"id" gorm:"type:varchar(36);primarykey"`
+	BookID        uint      `json:"book_id" gorm:"not null;index"`
+	Key           string    `json:"key" gorm:"type:varchar(255);not null"`
+	ContentType   string    `json:"content_type" gorm:"type:varchar(100);not null"`
+	ContentLength int64     `json:"content_length" gorm:"not null"`
+	ExpiresAt     time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -8,4 +8,5 @@ type User struct {
 	Name     string `json:"name" gorm:"not null"`
 	Password string `json:"-" gorm:"not null"`
 	IsAdmin  bool   `json:"is_admin"`
+	Currency string `json:"currency" gorm:"type:varchar(3)"` // preferred display currency, empty for the shop currency
 }
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/febriaricandra/book-shop/pkg/money"
+)
+
+// Wishlist is a named list of books a user saved for later. A list with a
+// ShareToken can be viewed by anyone holding the link
+type Wishlist struct {
+	ID         uint           `json:"id" gorm:"primarykey"`
+	UserID     uint           `json:"user_id" gorm:"not null;index"`
+	Name       string         `json:"name" gorm:"type:varchar(100);not null"`
+	IsDefault  bool           `json:"is_default" gorm:"not null"`
+	ShareToken *string        `json:"share_token" gorm:"type:varchar(64);uniqueIndex"`
+	ShareURL   string         `json:"share_url,omitempty" gorm:"-"`
+	Items      []WishlistItem `json:"items,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// WishlistItem remembers the price and availability the user last saw, so the
+// notifier only reports changes once
+type WishlistItem struct {
+	ID               uint        `json:"id" gorm:"primarykey"`
+	WishlistID       uint        `json:"wishlist_id" gorm:"not null;uniqueIndex:idx_wishlist_items_book"`
+	BookID           uint        `json:"book_id" gorm:"not null;uniqueIndex:idx_wishlist_items_book;index"`
+	SeenPrice        money.Money `json:"-" gorm:"not null"`
+	SeenAvailability string      `json:"-" gorm:"type:varchar(20);not null"`
+	Book             Book        `json:"book"`
+	Wishlist         *Wishlist   `json:"-"`
+	CreatedAt        time.Time   `json:"created_at"`
+}
@@ -1,19 +1,38 @@
 package repositories
 
 import (
+	"errors"
 	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/pkg/money"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrVersionConflict is returned when a book changed since it was read
+var ErrVersionConflict = errors.New("book was modified by someone else, reload and try again")
+
 type BookRepository interface {
 	CreateBook(book *models.Book) error
 	GetBookById(bookId uint) (*models.Book, error)
-	GetAllBooks(page, pageSize int) ([]models.Book, int, error)
+	GetBookWithImages(bookId uint, includeArchived bool) (*models.Book, error)
+	GetBookByISBN(isbn string) (*models.Book, error)
+	GetBooksByIds(bookIds []uint) ([]models.Book, error)
+	GetAllBooks(page, pageSize int, sort string) ([]models.Book, int, error)
 	UpdateBook(book *models.Book) error
 	DeleteBook(bookId uint) error
-	GetHomeBooks(page, pageSize int) ([]models.Book, []models.Book, int, error)
+	ArchiveBook(bookId uint) error
+	RestoreBook(bookId uint) error
+	GetDeletedBooks(page, pageSize int) ([]models.Book, int, error)
+	HasOpenOrders(bookId uint) (bool, error)
+	FindBooksInBatches(batchSize int, fn func(books []models.Book) error) error
+	IsCoverReferenced(url string) (bool, error)
+	FindCoverURLs(fn func(url string)) error
+	GetLowestPrices(bookIds []uint, window time.Duration) (map[uint]money.Money, error)
+	GetPriceHistory(bookId uint, page, pageSize int) ([]models.PriceChange, int, error)
 }
 
 type bookRepository struct {
@@ -24,8 +43,21 @@ func NewBookRepository(db *gorm.DB) BookRepository {
 	return &bookRepository{db}
 }
 
+// CreateBook saves a new book and starts its price history with its first
+// price
 func (r *bookRepository) CreateBook(book *models.Book) error {
-	return r.db.Create(book).Error
+	// MySQL cannot return column defaults, so set the first version ourselves
+	if book.Version == 0 {
+		book.Version = 1
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(book).Error; err != nil {
+			return err
+		}
+		source := book.PriceSource
+		source.Reason = models.PriceReasonCreated
+		return recordPriceChange(tx, book.ID, money.Money{}, book.NewPrice, source)
+	})
 }
 
 func (r *bookRepository) GetBookById(bookId uint) (*models.Book, error) {
@@ -35,17 +67,57 @@ func (r *bookRepository) GetBookById(bookId uint) (*models.Book, error) {
 	return &book, err
 }
 
-func (r *bookRepository) GetAllBooks(page, pageSize int) ([]models.Book, int, error) {
+// GetBookWithImages loads the book together with its gallery in order.
+// Archived books are only found with includeArchived
+func (r *bookRepository) GetBookWithImages(bookId uint, includeArchived bool) (*models.Book, error) {
+	var book models.Book
+
+	query := r.db
+	if !includeArchived {
+		query = query.Scopes(storefront)
+	}
+	err := query.Preload("Images", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position, id")
+	}).First(&book, bookId).Error
+	return &book, err
+}
+
+func (r *bookRepository) GetBookByISBN(isbn string) (*models.Book, error) {
+	var book models.Book
+
+	err := r.db.Where("isbn = ?", isbn).First(&book).Error
+	return &book, err
+}
+
+// GetBooksByIds loads the storefront books with the given ids, missing and
+// archived ones are left out
+func (r *bookRepository) GetBooksByIds(bookIds []uint) ([]models.Book, error) {
+	var books []models.Book
+
+	err := r.db.Scopes(storefront).Where("id IN ?", bookIds).Order("id").Find(&books).Error
+	return books, err
+}
+
+// BookSortOrders are the orders GetAllBooks accepts besides the default ""
+var BookSortOrders = map[string]string{
+	"rating": "rating_average DESC, rating_count DESC, id",
+}
+
+func (r *bookRepository) GetAllBooks(page, pageSize int, sort string) ([]models.Book, int, error) {
 	var books []models.Book
 	var totalBook int64
 
-	err := r.db.Offset((page - 1) * pageSize).Limit(pageSize).Find(&books).Error
+	query := r.db.Scopes(storefront)
+	if order, ok := BookSortOrders[sort]; ok {
+		query = query.Order(order)
+	}
+	err := query.Offset((page - 1) * pageSize).Limit(pageSize).Find(&books).Error
 	if err != nil {
 		slog.Error("Error getting all books", "error", err.Error())
 		return nil, 0, err
 	}
 
-	err = r.db.Model(&models.Book{}).Count(&totalBook).Error
+	err = r.db.Model(&models.Book{}).Scopes(storefront).Count(&totalBook).Error
 	if err != nil {
 
 		slog.Error("Error getting total books", "error", err.Error())
@@ -55,48 +127,231 @@ func (r *bookRepository) GetAllBooks(page, pageSize int) ([]models.Book, int, er
 	return books, int(totalBook), nil
 }
 
+// bookReadOnlyColumns are never written by UpdateBook, the rating aggregates
+// are kept by the review repository and must not be overwritten by a stale read
+var bookReadOnlyColumns = []string{"created_at", "rating_average", "rating_count", "rating_total", clause.Associations}
+
+// UpdateBook saves every field only if nobody bumped the version since the
+// book was read, then increments it. A price change is recorded in the price
+// history with book.PriceSource
 func (r *bookRepository) UpdateBook(book *models.Book) error {
-	return r.db.Save(book).Error
+	readVersion := book.Version
+	book.Version++
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var before models.Book
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "new_price").
+			Where("id = ?", book.ID).Limit(1).Find(&before).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(book).Where("version = ?", readVersion).Select("*").Omit(bookReadOnlyColumns...).Updates(book)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+
+		if before.NewPrice.Cmp(book.NewPrice) == 0 {
+			return nil
+		}
+		return recordPriceChange(tx, book.ID, before.NewPrice, book.NewPrice, book.PriceSource)
+	})
+	if err != nil {
+		book.Version = readVersion
+	}
+	return err
 }
 
 func (r *bookRepository) DeleteBook(bookId uint) error {
 	return r.db.Delete(&models.Book{}, bookId).Error
 }
 
-func (r *bookRepository) GetHomeBooks(page, pageSize int) ([]models.Book, []models.Book, int, error) {
-	var topSellerBooks []models.Book
-	var recommendedBooks []models.Book
+func (r *bookRepository) ArchiveBook(bookId uint) error {
+	return r.db.Model(&models.Book{}).Where("id = ?", bookId).
+		Updates(map[string]interface{}{"archived_at": time.Now(), "version": gorm.Expr("version + 1")}).Error
+}
+
+// RestoreBook brings back a soft deleted or archived book
+func (r *bookRepository) RestoreBook(bookId uint) error {
+	result := r.db.Unscoped().Model(&models.Book{}).Where("id = ?", bookId).
+		Updates(map[string]interface{}{"deleted_at": nil, "archived_at": nil, "version": gorm.Expr("version + 1")})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *bookRepository) GetDeletedBooks(page, pageSize int) ([]models.Book, int, error) {
+	var books []models.Book
 	var total int64
 
-	offset := (page - 1) * pageSize
-	err := r.db.Where("trending = ?", true).Offset(offset).Limit(pageSize).Find(&topSellerBooks).Error
+	err := r.db.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&books).Error
 	if err != nil {
-		slog.Error("Error getting top seller books", "error", err.Error())
-		return nil, nil, 0, err
+		slog.Error("Error getting deleted books", "error", err.Error())
+		return nil, 0, err
 	}
 
-	err = r.db.Model(&models.Book{}).Count(&total).Error
+	err = r.db.Unscoped().Model(&models.Book{}).Where("deleted_at IS NOT NULL").Count(&total).Error
 	if err != nil {
-		slog.Error("Error getting total books", "error", err.Error())
-		return nil, nil, 0, err
+		slog.Error("Error counting deleted books", "error", err.Error())
+		return nil, 0, err
 	}
-	if len(topSellerBooks) > 0 {
-		// Get recommended books except top seller books
-		ids := make([]uint, len(topSellerBooks))
-		for i, book := range topSellerBooks {
-			ids[i] = book.ID
+
+	return books, int(total), nil
+}
+
+func (r *bookRepository) HasOpenOrders(bookId uint) (bool, error) {
+	var count int64
+
+	err := r.db.Model(&models.OrderBook{}).
+		Joins("JOIN orders ON orders.id = order_books.order_id AND orders.deleted_at IS NULL").
+		Where("order_books.book_id = ? AND orders.status IN ?", bookId, models.OpenOrderStatuses).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *bookRepository) FindBooksInBatches(batchSize int, fn func(books []models.Book) error) error {
+	var books []models.Book
+
+	return r.db.Order("id").FindInBatches(&books, batchSize, func(tx *gorm.DB, batch int) error {
+		return fn(books)
+	}).Error
+}
+
+// IsCoverReferenced reports whether any book, deleted ones included since
+// they can be restored, or any gallery image still uses the URL
+func (r *bookRepository) IsCoverReferenced(url string) (bool, error) {
+	var books, images int64
+	pattern := "%" + likeEscaper.Replace(`"`+url+`"`) + "%"
+	err := r.db.Unscoped().Model(&models.Book{}).
+		Where("cover_image = ? OR cover_images LIKE ?", url, pattern).
+		Count(&books).Error
+	if err != nil || books > 0 {
+		return books > 0, err
+	}
+
+	err = r.db.Model(&models.BookImage{}).
+		Where("image_url = ? OR images LIKE ?", url, pattern).
+		Count(&images).Error
+	return images > 0, err
+}
+
+// FindCoverURLs calls fn with every cover URL of every book, deleted ones
+// included, and every gallery image URL
+func (r *bookRepository) FindCoverURLs(fn func(url string)) error {
+	var books []models.Book
+
+	err := r.db.Unscoped().Select("id", "cover_image", "cover_images").Order("id").
+		FindInBatches(&books, 500, func(tx *gorm.DB, batch int) error {
+			for i := range books {
+				for _, url := range books[i].CoverURLs() {
+					fn(url)
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	var images []models.BookImage
+	return r.db.Select("id", "image_url", "images").Order("id").
+		FindInBatches(&images, 500, func(tx *gorm.DB, batch int) error {
+			for i := range images {
+				for _, url := range images[i].URLs() {
+					fn(url)
+				}
+			}
+			return nil
+		}).Error
+}
+
+// GetLowestPrices returns the lowest price each book had in the window
+// before its current price took effect. The current price itself does not
+// count, books without an earlier price are left out
+func (r *bookRepository) GetLowestPrices(bookIds []uint, window time.Duration) (map[uint]money.Money, error) {
+	// The last change set the current price
+	var current []models.PriceChange
+	err := r.db.Select("id", "book_id", "created_at").
+		Where("id IN (?)", r.db.Model(&models.PriceChange{}).Select("MAX(id)").Where("book_id IN ?", bookIds).Group("book_id")).
+		Find(&current).Error
+	if err != nil || len(current) == 0 {
+		return map[uint]money.Money{}, err
+	}
+
+	effectiveAt := make(map[uint]time.Time, len(current))
+	since := current[0].CreatedAt
+	for _, change := range current {
+		effectiveAt[change.BookID] = change.CreatedAt
+		if change.CreatedAt.Before(since) {
+			since = change.CreatedAt
 		}
-		err = r.db.Where("trending = ? AND id NOT IN (?)", false, ids).Find(&recommendedBooks).Error
-		if err != nil {
-			slog.Error("Error getting recommended books", "error", err.Error())
-			return topSellerBooks, nil, int(total), err
+	}
+
+	// Every price in the window was replaced by a change up to the current
+	// one, so the old prices of those changes are the prices it had
+	var changes []models.PriceChange
+	err = r.db.Select("book_id", "old_price", "created_at").
+		Where("book_id IN ? AND created_at > ? AND reason <> ?", bookIds, since.Add(-window), models.PriceReasonCreated).
+		Find(&changes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	lowest := make(map[uint]money.Money, len(current))
+	for _, change := range changes {
+		at := effectiveAt[change.BookID]
+		if !change.CreatedAt.After(at.Add(-window)) || change.CreatedAt.After(at) {
+			continue
+		}
+		if price, ok := lowest[change.BookID]; ok {
+			lowest[change.BookID] = money.Min(price, change.OldPrice)
+		} else {
+			lowest[change.BookID] = change.OldPrice
 		}
-		return topSellerBooks, recommendedBooks, int(total), nil
 	}
-	err = r.db.Where("trending = ?", false).Find(&recommendedBooks).Error
+	return lowest, nil
+}
+
+// GetPriceHistory lists the price changes of a book, newest first
+func (r *bookRepository) GetPriceHistory(bookId uint, page, pageSize int) ([]models.PriceChange, int, error) {
+	var changes []models.PriceChange
+	var total int64
+
+	err := r.db.Model(&models.PriceChange{}).Where("book_id = ?", bookId).Count(&total).Error
 	if err != nil {
-		slog.Error("Error getting recommended books", "error", err.Error())
-		return nil, recommendedBooks, int(total), err
+		return nil, 0, err
+	}
+	err = r.db.Where("book_id = ?", bookId).Order("created_at DESC, id DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&changes).Error
+	return changes, int(total), err
+}
+
+// recordPriceChange adds an entry to the book's price history
+func recordPriceChange(tx *gorm.DB, bookId uint, oldPrice, newPrice money.Money, source models.PriceChangeSource) error {
+	if source.Reason == "" {
+		source.Reason = models.PriceReasonManual
 	}
-	return topSellerBooks, recommendedBooks, int(total), nil
+	return tx.Create(&models.PriceChange{
+		BookID:      bookId,
+		OldPrice:    oldPrice,
+		NewPrice:    newPrice,
+		Reason:      source.Reason,
+		UserID:      source.UserID,
+		PriceRuleID: source.PriceRuleID,
+	}).Error
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// storefront hides archived books from public listings
+func storefront(db *gorm.DB) *gorm.DB {
+	return db.Where("archived_at IS NULL")
 }
@@ -0,0 +1,136 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"gorm.io/gorm"
+)
+
+// ErrCouponExists is returned when the code is taken, by deleted coupons too
+var ErrCouponExists = errors.New("a coupon with this code already exists")
+
+// CouponReport sums up the redemptions of one coupon
+type CouponReport struct {
+	CouponID    uint        `json:"coupon_id"`
+	Code        string      `json:"code"`
+	Redemptions int         `json:"redemptions"`
+	Customers   int         `json:"customers"`
+	Discount    money.Money `json:"discount"`
+	Revenue     money.Money `json:"revenue"` // total price of the orders, after the discount
+}
+
+type CouponRepository interface {
+	CreateCoupon(coupon *models.Coupon) error
+	GetCoupons(page, pageSize int) ([]models.Coupon, int, error)
+	GetCoupon(id uint) (*models.Coupon, error)
+	GetCouponByCode(code string) (*models.Coupon, error)
+	UpdateCoupon(coupon *models.Coupon) error
+	DeleteCoupon(id uint) error
+	CountUserRedemptions(couponId, userId uint) (int, error)
+	GetRedemptions(couponId uint, page, pageSize int) ([]models.CouponRedemption, int, error)
+	GetCouponReports(from, to time.Time) ([]CouponReport, error)
+}
+
+type couponRepository struct {
+	db *gorm.DB
+}
+
+func NewCouponRepository(db *gorm.DB) CouponRepository {
+	return &couponRepository{db}
+}
+
+func (r *couponRepository) CreateCoupon(coupon *models.Coupon) error {
+	var count int64
+	err := r.db.Unscoped().Model(&models.Coupon{}).Where("code = ?", coupon.Code).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCouponExists
+	}
+	return r.db.Create(coupon).Error
+}
+
+func (r *couponRepository) GetCoupons(page, pageSize int) ([]models.Coupon, int, error) {
+	var coupons []models.Coupon
+	var total int64
+
+	if err := r.db.Model(&models.Coupon{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := r.db.Order("created_at DESC, id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&coupons).Error
+	return coupons, int(total), err
+}
+
+func (r *couponRepository) GetCoupon(id uint) (*models.Coupon, error) {
+	var coupon models.Coupon
+
+	err := r.db.First(&coupon, id).Error
+	return &coupon, err
+}
+
+func (r *couponRepository) GetCouponByCode(code string) (*models.Coupon, error) {
+	var coupon models.Coupon
+
+	err := r.db.Where("code = ?", code).First(&coupon).Error
+	return &coupon, err
+}
+
+// UpdateCoupon saves the coupon except its code and use count, a renamed
+// code would break the redemption history
+func (r *couponRepository) UpdateCoupon(coupon *models.Coupon) error {
+	return r.db.Model(coupon).Select("*").Omit("code", "used_count", "created_at").Updates(coupon).Error
+}
+
+// DeleteCoupon soft deletes the coupon so reports keep its redemptions
+func (r *couponRepository) DeleteCoupon(id uint) error {
+	result := r.db.Delete(&models.Coupon{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *couponRepository) CountUserRedemptions(couponId, userId uint) (int, error) {
+	var count int64
+
+	err := r.db.Model(&models.CouponRedemption{}).Where("coupon_id = ? AND user_id = ?", couponId, userId).Count(&count).Error
+	return int(count), err
+}
+
+func (r *couponRepository) GetRedemptions(couponId uint, page, pageSize int) ([]models.CouponRedemption, int, error) {
+	var redemptions []models.CouponRedemption
+	var total int64
+
+	err := r.db.Model(&models.CouponRedemption{}).Where("coupon_id = ?", couponId).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = r.db.Where("coupon_id = ?", couponId).Order("created_at DESC, id DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&redemptions).Error
+	return redemptions, int(total), err
+}
+
+// GetCouponReports sums up the redemptions made in [from, to) per coupon,
+// deleted coupons included, most redeemed first
+func (r *couponRepository) GetCouponReports(from, to time.Time) ([]CouponReport, error) {
+	var reports []CouponReport
+
+	err := r.db.Table("coupon_redemptions").
+		Select("coupons.id AS coupon_id, coupons.code, COUNT(*) AS redemptions, "+
+			"COUNT(DISTINCT coupon_redemptions.user_id) AS customers, "+
+			"SUM(coupon_redemptions.discount) AS discount, SUM(orders.total_price) AS revenue").
+		Joins("JOIN coupons ON coupons.id = coupon_redemptions.coupon_id").
+		Joins("JOIN orders ON orders.id = coupon_redemptions.order_id").
+		Where("coupon_redemptions.created_at >= ? AND coupon_redemptions.created_at < ?", from, to).
+		Group("coupons.id, coupons.code").
+		Order("redemptions DESC, coupons.id").
+		Scan(&reports).Error
+	return reports, err
+}
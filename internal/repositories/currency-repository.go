@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"github.com/febriaricandra/book-shop/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CurrencyRepository interface {
+	GetRates() ([]models.ExchangeRate, error)
+	GetRate(currency string) (*models.ExchangeRate, error)
+	SaveRate(rate *models.ExchangeRate) error
+	DeleteRate(currency string) error
+	GetAutomaticRates() ([]models.ExchangeRate, error)
+	UpdateAutomaticRate(currency string, rate float64) (bool, error)
+}
+
+type currencyRepository struct {
+	db *gorm.DB
+}
+
+func NewCurrencyRepository(db *gorm.DB) CurrencyRepository {
+	return &currencyRepository{db}
+}
+
+func (r *currencyRepository) GetRates() ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	err := r.db.Order("currency").Find(&rates).Error
+	return rates, err
+}
+
+func (r *currencyRepository) GetRate(currency string) (*models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	err := r.db.Where("currency = ?", currency).First(&rate).Error
+	return &rate, err
+}
+
+// SaveRate creates the rate or replaces the one of the same currency
+func (r *currencyRepository) SaveRate(rate *models.ExchangeRate) error {
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(rate).Error
+}
+
+func (r *currencyRepository) DeleteRate(currency string) error {
+	result := r.db.Where("currency = ?", currency).Delete(&models.ExchangeRate{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAutomaticRates lists the rates the rate provider keeps up to date
+func (r *currencyRepository) GetAutomaticRates() ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	err := r.db.Where("manual = ?", false).Order("currency").Find(&rates).Error
+	return rates, err
+}
+
+// UpdateAutomaticRate stores a fetched rate unless an admin took the currency
+// over in the meantime, and reports whether it did
+func (r *currencyRepository) UpdateAutomaticRate(currency string, rate float64) (bool, error) {
+	result := r.db.Model(&models.ExchangeRate{}).Where("currency = ? AND manual = ?", currency, false).Update("rate", rate)
+	return result.RowsAffected > 0, result.Error
+}
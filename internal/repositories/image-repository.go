@@ -0,0 +1,179 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrImageOrderMismatch is returned when a reorder does not list exactly the
+// book's images
+var ErrImageOrderMismatch = errors.New("image_ids must list every image of the book exactly once")
+
+type ImageRepository interface {
+	CreateImage(image *models.BookImage) error
+	GetImages(bookId uint) ([]models.BookImage, error)
+	GetImage(bookId, imageId uint) (*models.BookImage, error)
+	CountImages(bookId uint) (int, error)
+	UpdateImage(image *models.BookImage) error
+	DeleteImage(image *models.BookImage) error
+	ReorderImages(bookId uint, imageIds []uint) error
+}
+
+type imageRepository struct {
+	db *gorm.DB
+}
+
+func NewImageRepository(db *gorm.DB) ImageRepository {
+	return &imageRepository{db}
+}
+
+// CreateImage appends the image to the end of the gallery. The first image of
+// a book becomes the primary one
+func (r *imageRepository) CreateImage(image *models.BookImage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var last struct {
+			Count    int64
+			Position int
+		}
+		err := tx.Model(&models.BookImage{}).Where("book_id = ?", image.BookID).
+			Select("COUNT(*) AS count, COALESCE(MAX(position), 0) AS position").Scan(&last).Error
+		if err != nil {
+			return err
+		}
+
+		image.Position = last.Position + 1
+		if last.Count == 0 {
+			image.IsPrimary = true
+		}
+		if image.IsPrimary {
+			if err := clearPrimary(tx, image.BookID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(image).Error
+	})
+}
+
+func (r *imageRepository) GetImages(bookId uint) ([]models.BookImage, error) {
+	var images []models.BookImage
+	err := r.db.Where("book_id = ?", bookId).Order("position, id").Find(&images).Error
+	return images, err
+}
+
+func (r *imageRepository) GetImage(bookId, imageId uint) (*models.BookImage, error) {
+	var image models.BookImage
+	err := r.db.Where("book_id = ?", bookId).First(&image, imageId).Error
+	return &image, err
+}
+
+func (r *imageRepository) CountImages(bookId uint) (int, error) {
+	var count int64
+	err := r.db.Model(&models.BookImage{}).Where("book_id = ?", bookId).Count(&count).Error
+	return int(count), err
+}
+
+// UpdateImage saves the alt text and primary flag, marking an image primary
+// unmarks the book's other images. Unmarking the primary image hands the flag
+// to the next image in the gallery, an only image stays primary
+func (r *imageRepository) UpdateImage(image *models.BookImage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if image.IsPrimary {
+			if err := clearPrimary(tx, image.BookID); err != nil {
+				return err
+			}
+			return tx.Model(image).Select("alt_text", "is_primary").Updates(image).Error
+		}
+
+		var stored models.BookImage
+		if err := tx.Select("is_primary").First(&stored, image.ID).Error; err != nil {
+			return err
+		}
+		if !stored.IsPrimary {
+			return tx.Model(image).Select("alt_text", "is_primary").Updates(image).Error
+		}
+
+		next, err := nextImage(tx, image.BookID, image.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			image.IsPrimary = true
+			return tx.Model(image).Select("alt_text").Updates(image).Error
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(image).Select("alt_text", "is_primary").Updates(image).Error; err != nil {
+			return err
+		}
+		return tx.Model(next).Update("is_primary", true).Error
+	})
+}
+
+// DeleteImage removes the image, when it was the primary one the next image
+// in the gallery takes over
+func (r *imageRepository) DeleteImage(image *models.BookImage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(image).Error; err != nil {
+			return err
+		}
+		if !image.IsPrimary {
+			return nil
+		}
+
+		next, err := nextImage(tx, image.BookID, image.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(next).Update("is_primary", true).Error
+	})
+}
+
+// ReorderImages sets the gallery order, imageIds must hold every image of the
+// book exactly once
+func (r *imageRepository) ReorderImages(bookId uint, imageIds []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var existing []uint
+		if err := tx.Model(&models.BookImage{}).Where("book_id = ?", bookId).Pluck("id", &existing).Error; err != nil {
+			return err
+		}
+
+		wanted := map[uint]bool{}
+		for _, id := range imageIds {
+			wanted[id] = true
+		}
+		if len(wanted) != len(imageIds) || len(existing) != len(imageIds) {
+			return ErrImageOrderMismatch
+		}
+		for _, id := range existing {
+			if !wanted[id] {
+				return ErrImageOrderMismatch
+			}
+		}
+
+		for position, id := range imageIds {
+			err := tx.Model(&models.BookImage{}).Where("id = ?", id).Update("position", position+1).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// nextImage is the first image of the gallery other than imageId
+func nextImage(tx *gorm.DB, bookId, imageId uint) (*models.BookImage, error) {
+	var next models.BookImage
+	err := tx.Where("book_id = ? AND id <> ?", bookId, imageId).Order("position, id").First(&next).Error
+	if err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+func clearPrimary(tx *gorm.DB, bookId uint) error {
+	return tx.Model(&models.BookImage{}).Where("book_id = ? AND is_primary = ?", bookId, true).
+		Update("is_primary", false).Error
+}
@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type InvoiceRepository interface {
+	GetInvoiceByOrder(orderId uint) (*models.Invoice, error)
+	IssueInvoice(orderId uint, prefix string, issuedAt time.Time, render func(*models.Invoice) ([]byte, error)) (*models.Invoice, error)
+	SaveInvoicePDF(id uint, pdf []byte) error
+	MarkInvoiceEmailed(id uint, at time.Time) error
+}
+
+type invoiceRepository struct {
+	db *gorm.DB
+}
+
+func NewInvoiceRepository(db *gorm.DB) InvoiceRepository {
+	return &invoiceRepository{db}
+}
+
+func (r *invoiceRepository) GetInvoiceByOrder(orderId uint) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := r.db.Where("order_id = ?", orderId).First(&invoice).Error
+	return &invoice, err
+}
+
+// IssueInvoice gives the order the next invoice number, or returns its
+// invoice when it already has one. The new invoice is rendered by render and
+// saved with its PDF. The counter stays locked until then, so a failed issue
+// or render rolls the number back and leaves no gap
+func (r *invoiceRepository) IssueInvoice(orderId uint, prefix string, issuedAt time.Time, render func(*models.Invoice) ([]byte, error)) (*models.Invoice, error) {
+	var invoice models.Invoice
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		counter := models.InvoiceCounter{ID: 1}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&counter).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&counter, 1).Error; err != nil {
+			return err
+		}
+
+		err := tx.Where("order_id = ?", orderId).First(&invoice).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		counter.Last++
+		invoice = models.Invoice{
+			Number:   fmt.Sprintf("%s%06d", prefix, counter.Last),
+			Sequence: counter.Last,
+			OrderID:  orderId,
+			IssuedAt: issuedAt,
+		}
+		pdf, err := render(&invoice)
+		if err != nil {
+			return err
+		}
+		invoice.PDF = pdf
+		if err := tx.Create(&invoice).Error; err != nil {
+			return err
+		}
+		return tx.Model(&counter).Update("last", counter.Last).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// SaveInvoicePDF keeps the PDF of an invoice issued before PDFs were kept
+func (r *invoiceRepository) SaveInvoicePDF(id uint, pdf []byte) error {
+	return r.db.Model(&models.Invoice{}).Where("id = ? AND pdf IS NULL", id).Update("pdf", pdf).Error
+}
+
+func (r *invoiceRepository) MarkInvoiceEmailed(id uint, at time.Time) error {
+	return r.db.Model(&models.Invoice{}).Where("id = ?", id).Update("emailed_at", at).Error
+}
@@ -1,20 +1,35 @@
 package repositories
 
 import (
+	"errors"
 	"log/slog"
 
 	"github.com/febriaricandra/book-shop/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrOrderStatusChanged is returned when the status moved on since it was read
+	ErrOrderStatusChanged = errors.New("order status was changed by someone else, reload and try again")
+	// ErrCouponUsedUp is returned when the coupon reached its usage limit
+	ErrCouponUsedUp = errors.New("coupon has been used up")
+	// ErrCouponUserLimit is returned when the user used the coupon as often as allowed
+	ErrCouponUserLimit = errors.New("you have already used this coupon")
 )
 
 type OrderRepository interface {
 	CreateOrder(order *models.Order) (uint, error)
+	PlaceOrder(order *models.Order, orderBooks []models.OrderBook, redemption *models.CouponRedemption) error
 	GetOrderById(id uint) (*models.Order, error)
+	GetOrderBooks(orderId uint) ([]models.OrderBook, error)
 	GetAllOrders(page, pageSize int) ([]models.Order, int, error)
 	UpdateOrder(order *models.Order) error
 	DeleteOrder(id uint) error
 	CreateOrderBook(uint, uint) error
 	GetOrdersForUser(uint) ([]models.Order, error)
+	UpdateOrderStatus(id uint, from, to string) error
+	HasDeliveredBook(userId, bookId uint) (bool, error)
 }
 
 type orderRepository struct {
@@ -32,17 +47,84 @@ func (r *orderRepository) CreateOrder(order *models.Order) (uint, error) {
 	return order.ID, nil
 }
 
+// PlaceOrder saves the order with its books, its tax lines and, when a coupon is redeemed,
+// the redemption in one transaction. Coupon limits are checked again with
+// the coupon locked so concurrent checkouts cannot exceed them
+func (r *orderRepository) PlaceOrder(order *models.Order, orderBooks []models.OrderBook, redemption *models.CouponRedemption) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if redemption != nil {
+			var coupon models.Coupon
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, redemption.CouponID).Error
+			if err != nil {
+				return err
+			}
+			if coupon.UsageLimit > 0 && coupon.UsedCount >= coupon.UsageLimit {
+				return ErrCouponUsedUp
+			}
+			if coupon.PerUserLimit > 0 {
+				var used int64
+				err := tx.Model(&models.CouponRedemption{}).
+					Where("coupon_id = ? AND user_id = ?", coupon.ID, redemption.UserID).Count(&used).Error
+				if err != nil {
+					return err
+				}
+				if int(used) >= coupon.PerUserLimit {
+					return ErrCouponUserLimit
+				}
+			}
+		}
+
+		if err := tx.Omit(clause.Associations).Create(order).Error; err != nil {
+			return err
+		}
+
+		for i := range orderBooks {
+			orderBooks[i].OrderID = order.ID
+		}
+		if err := tx.Create(&orderBooks).Error; err != nil {
+			return err
+		}
+
+		for i := range order.Taxes {
+			order.Taxes[i].OrderID = order.ID
+		}
+		if len(order.Taxes) > 0 {
+			if err := tx.Create(&order.Taxes).Error; err != nil {
+				return err
+			}
+		}
+
+		if redemption == nil {
+			return nil
+		}
+		redemption.OrderID = order.ID
+		if err := tx.Create(redemption).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Coupon{}).Where("id = ?", redemption.CouponID).
+			Update("used_count", gorm.Expr("used_count + 1")).Error
+	})
+}
+
 func (r *orderRepository) GetOrderById(id uint) (*models.Order, error) {
 	var order models.Order
-	err := r.db.Preload("Books").First(&order, id).Error
+	err := r.db.Preload("Books", withDeletedBooks).Preload("Taxes").First(&order, id).Error
 	return &order, err
 }
 
+// GetOrderBooks lists the books of the order with the prices they were
+// ordered at
+func (r *orderRepository) GetOrderBooks(orderId uint) ([]models.OrderBook, error) {
+	var orderBooks []models.OrderBook
+	err := r.db.Where("order_id = ?", orderId).Order("id").Find(&orderBooks).Error
+	return orderBooks, err
+}
+
 func (r *orderRepository) GetAllOrders(page, pageSize int) ([]models.Order, int, error) {
 	var orders []models.Order
 	var totalOrders int64
 
-	err := r.db.Preload("Books").Preload("User").Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&orders).Error
+	err := r.db.Preload("Books", withDeletedBooks).Preload("Taxes").Preload("User").Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&orders).Error
 	if err != nil {
 		return nil, 0, err
 	}
@@ -75,6 +157,51 @@ func (r *orderRepository) CreateOrderBook(orderId uint, bookId uint) error {
 
 func (r *orderRepository) GetOrdersForUser(userId uint) ([]models.Order, error) {
 	var orders []models.Order
-	err := r.db.Where("user_id = ?", userId).Preload("Books").Order("created_at DESC").Preload("User").Find(&orders).Error
+	err := r.db.Where("user_id = ?", userId).Preload("Books", withDeletedBooks).Preload("Taxes").Order("created_at DESC").Preload("User").Find(&orders).Error
 	return orders, err
 }
+
+// UpdateOrderStatus moves the order from one status to the next, failing if
+// the status is no longer from. Cancelling gives back the coupon it used
+func (r *orderRepository) UpdateOrderStatus(id uint, from, to string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Order{}).Where("id = ? AND status = ?", id, from).Update("status", to)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrderStatusChanged
+		}
+		if to != models.OrderCancelled {
+			return nil
+		}
+
+		var redemption models.CouponRedemption
+		err := tx.Where("order_id = ?", id).Limit(1).Find(&redemption).Error
+		if err != nil || redemption.ID == 0 {
+			return err
+		}
+		if err := tx.Delete(&redemption).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Coupon{}).Unscoped().Where("id = ? AND used_count > 0", redemption.CouponID).
+			Update("used_count", gorm.Expr("used_count - 1")).Error
+	})
+}
+
+// HasDeliveredBook reports whether the user received the book in any order
+func (r *orderRepository) HasDeliveredBook(userId, bookId uint) (bool, error) {
+	var count int64
+
+	err := r.db.Model(&models.OrderBook{}).
+		Joins("JOIN orders ON orders.id = order_books.order_id AND orders.deleted_at IS NULL").
+		Where("orders.user_id = ? AND order_books.book_id = ? AND orders.status = ?", userId, bookId, models.OrderDelivered).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// withDeletedBooks keeps deleted and archived books visible on the orders that
+// bought them
+func withDeletedBooks(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
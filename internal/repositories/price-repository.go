@@ -0,0 +1,209 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrPriceRuleStatusChanged is returned when the rule moved on since it was read
+var ErrPriceRuleStatusChanged = errors.New("price rule status was changed, reload and try again")
+
+type PriceRepository interface {
+	CreatePriceRule(rule *models.PriceRule) error
+	GetPriceRules(status string, page, pageSize int) ([]models.PriceRule, int, error)
+	GetPriceRule(id uint) (*models.PriceRule, error)
+	UpdatePriceRule(rule *models.PriceRule) error
+	SetPriceRuleStatus(id uint, from, to string) error
+	GetRulesToStart(now time.Time) ([]models.PriceRule, error)
+	GetRulesToEnd(now time.Time) ([]models.PriceRule, error)
+	EndMissedRules(now time.Time) (int, error)
+	FindRuleBookIds(rule *models.PriceRule) ([]uint, error)
+	StartSale(rule *models.PriceRule, bookId uint) (bool, error)
+	EndSale(ruleBook *models.PriceRuleBook) (bool, error)
+}
+
+type priceRepository struct {
+	db *gorm.DB
+}
+
+func NewPriceRepository(db *gorm.DB) PriceRepository {
+	return &priceRepository{db}
+}
+
+func (r *priceRepository) CreatePriceRule(rule *models.PriceRule) error {
+	return r.db.Omit(clause.Associations).Create(rule).Error
+}
+
+// GetPriceRules lists the rules, starting soonest first, status "" lists all
+func (r *priceRepository) GetPriceRules(status string, page, pageSize int) ([]models.PriceRule, int, error) {
+	var rules []models.PriceRule
+	var total int64
+
+	filtered := func() *gorm.DB {
+		query := r.db.Model(&models.PriceRule{})
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+		return query
+	}
+	if err := filtered().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := filtered().Order("starts_at DESC, id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&rules).Error
+	return rules, int(total), err
+}
+
+// GetPriceRule loads the rule with the books it currently has on sale
+func (r *priceRepository) GetPriceRule(id uint) (*models.PriceRule, error) {
+	var rule models.PriceRule
+
+	err := r.db.Preload("Books", func(db *gorm.DB) *gorm.DB {
+		return db.Order("book_id")
+	}).First(&rule, id).Error
+	return &rule, err
+}
+
+// UpdatePriceRule saves the terms of a rule that has not started yet
+func (r *priceRepository) UpdatePriceRule(rule *models.PriceRule) error {
+	result := r.db.Model(rule).Where("status = ?", models.PriceRuleScheduled).
+		Select("name", "book_id", "category", "sale_price", "percent_off", "starts_at", "ends_at").Updates(rule)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPriceRuleStatusChanged
+	}
+	return nil
+}
+
+func (r *priceRepository) SetPriceRuleStatus(id uint, from, to string) error {
+	result := r.db.Model(&models.PriceRule{}).Where("id = ? AND status = ?", id, from).Update("status", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPriceRuleStatusChanged
+	}
+	return nil
+}
+
+// GetRulesToStart lists the scheduled rules whose window is open
+func (r *priceRepository) GetRulesToStart(now time.Time) ([]models.PriceRule, error) {
+	var rules []models.PriceRule
+
+	err := r.db.Where("status = ? AND starts_at <= ? AND ends_at > ?", models.PriceRuleScheduled, now, now).
+		Order("starts_at, id").Find(&rules).Error
+	return rules, err
+}
+
+// GetRulesToEnd lists the active rules whose window closed, with their books
+func (r *priceRepository) GetRulesToEnd(now time.Time) ([]models.PriceRule, error) {
+	var rules []models.PriceRule
+
+	err := r.db.Preload("Books").Where("status = ? AND ends_at <= ?", models.PriceRuleActive, now).
+		Order("ends_at, id").Find(&rules).Error
+	return rules, err
+}
+
+// EndMissedRules ends the scheduled rules whose whole window passed, e.g.
+// while the server was down, without putting anything on sale
+func (r *priceRepository) EndMissedRules(now time.Time) (int, error) {
+	result := r.db.Model(&models.PriceRule{}).Where("status = ? AND ends_at <= ?", models.PriceRuleScheduled, now).
+		Update("status", models.PriceRuleEnded)
+	return int(result.RowsAffected), result.Error
+}
+
+// FindRuleBookIds lists the books a rule puts on sale, leaving out archived
+// and withdrawn books
+func (r *priceRepository) FindRuleBookIds(rule *models.PriceRule) ([]uint, error) {
+	var ids []uint
+
+	query := r.db.Model(&models.Book{}).Scopes(storefront).Where("availability <> ?", models.BookUnavailable)
+	if rule.BookID != nil {
+		query = query.Where("id = ?", *rule.BookID)
+	} else {
+		query = query.Where("category = ?", rule.Category)
+	}
+	err := query.Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// StartSale puts the book on sale at the rule's price. It reports false when
+// the book is already on another sale or the rule would not lower its price
+func (r *priceRepository) StartSale(rule *models.PriceRule, bookId uint) (bool, error) {
+	started := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		book, err := lockBookPrice(tx, bookId)
+		if err != nil {
+			return err
+		}
+
+		var onSale int64
+		if err := tx.Model(&models.PriceRuleBook{}).Where("book_id = ?", bookId).Count(&onSale).Error; err != nil {
+			return err
+		}
+		salePrice := rule.SalePriceFor(book.NewPrice)
+		if onSale > 0 || !salePrice.Less(book.NewPrice) || salePrice.IsNegative() {
+			return nil
+		}
+
+		ruleBook := &models.PriceRuleBook{PriceRuleID: rule.ID, BookID: bookId, RegularPrice: book.NewPrice, SalePrice: salePrice}
+		if err := tx.Create(ruleBook).Error; err != nil {
+			return err
+		}
+		source := models.PriceChangeSource{Reason: models.PriceReasonRuleStart, PriceRuleID: &rule.ID}
+		if err := setBookPrice(tx, book, salePrice, source); err != nil {
+			return err
+		}
+		started = true
+		return nil
+	})
+	return started, err
+}
+
+// EndSale takes the book off sale and restores its regular price, unless
+// the price was changed by hand during the sale. It reports whether the
+// price was restored
+func (r *priceRepository) EndSale(ruleBook *models.PriceRuleBook) (bool, error) {
+	restored := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		book, err := lockBookPrice(tx, ruleBook.BookID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err == nil && book.NewPrice.Cmp(ruleBook.SalePrice) == 0 {
+			source := models.PriceChangeSource{Reason: models.PriceReasonRuleEnd, PriceRuleID: &ruleBook.PriceRuleID}
+			if err := setBookPrice(tx, book, ruleBook.RegularPrice, source); err != nil {
+				return err
+			}
+			restored = true
+		}
+		return tx.Delete(ruleBook).Error
+	})
+	return restored, err
+}
+
+// lockBookPrice reads the price of a book, deleted ones included so their
+// price can still be restored, and locks it until the transaction ends
+func lockBookPrice(tx *gorm.DB, bookId uint) (*models.Book, error) {
+	var book models.Book
+	err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "new_price").First(&book, bookId).Error
+	return &book, err
+}
+
+// setBookPrice changes the price of a locked book, bumping its version so
+// editors holding a stale copy get a conflict, and records the change
+func setBookPrice(tx *gorm.DB, book *models.Book, price money.Money, source models.PriceChangeSource) error {
+	err := tx.Unscoped().Model(&models.Book{}).Where("id = ?", book.ID).
+		Updates(map[string]interface{}{"new_price": price, "version": gorm.Expr("version + 1")}).Error
+	if err != nil {
+		return err
+	}
+	return recordPriceChange(tx, book.ID, book.NewPrice, price, source)
+}
@@ -0,0 +1,144 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RecommendationRepository ranks books by what customers actually bought.
+// Only paid, shipped and delivered orders count as sales, and unavailable
+// books are never recommended
+type RecommendationRepository interface {
+	GetBestsellers(since time.Time, page, pageSize int) ([]models.Book, int, error)
+	GetAlsoBought(bookId uint, page, pageSize int) ([]models.Book, int, error)
+	GetRecommendedForUser(userId uint, page, pageSize int) ([]models.Book, int, error)
+	GetTrendingBooks(page, pageSize int) ([]models.Book, int, error)
+	GetRelatedBooks(book *models.Book, page, pageSize int) ([]models.Book, int, error)
+}
+
+type recommendationRepository struct {
+	db *gorm.DB
+}
+
+func NewRecommendationRepository(db *gorm.DB) RecommendationRepository {
+	return &recommendationRepository{db}
+}
+
+// GetBestsellers ranks books by the orders they were in since the given time
+func (r *recommendationRepository) GetBestsellers(since time.Time, page, pageSize int) ([]models.Book, int, error) {
+	sales := r.db.Model(&models.OrderBook{}).
+		Select("order_books.book_id, COUNT(DISTINCT order_books.order_id) AS score").
+		Joins("JOIN orders ON orders.id = order_books.order_id AND orders.deleted_at IS NULL").
+		Where("orders.status IN ? AND orders.created_at >= ?", models.SoldOrderStatuses, since).
+		Group("order_books.book_id")
+
+	return r.rankedBooks(sales, page, pageSize)
+}
+
+// GetAlsoBought ranks the books that were in the same orders as the book
+func (r *recommendationRepository) GetAlsoBought(bookId uint, page, pageSize int) ([]models.Book, int, error) {
+	return r.rankedBooks(r.coPurchased([]uint{bookId}), page, pageSize)
+}
+
+// GetRecommendedForUser ranks the books bought together with the books in
+// the user's orders, leaving out the books they already ordered
+func (r *recommendationRepository) GetRecommendedForUser(userId uint, page, pageSize int) ([]models.Book, int, error) {
+	ordered := r.db.Model(&models.OrderBook{}).
+		Select("order_books.book_id").
+		Joins("JOIN orders ON orders.id = order_books.order_id AND orders.deleted_at IS NULL").
+		Where("orders.user_id = ? AND orders.status <> ?", userId, models.OrderCancelled)
+
+	return r.rankedBooks(r.coPurchased(ordered), page, pageSize)
+}
+
+// GetTrendingBooks lists the books the shop marked as trending
+func (r *recommendationRepository) GetTrendingBooks(page, pageSize int) ([]models.Book, int, error) {
+	var books []models.Book
+	var total int64
+
+	trending := func() *gorm.DB {
+		return r.db.Model(&models.Book{}).Scopes(storefront, recommendable).Where("trending = ?", true)
+	}
+	if err := trending().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := trending().Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&books).Error
+	return books, int(total), err
+}
+
+// GetRelatedBooks lists the books in the same series or category or by the
+// same author, most often bought together with the book first. Without sales,
+// books in the same series come first, then those sharing both category and
+// author, then the best rated
+func (r *recommendationRepository) GetRelatedBooks(book *models.Book, page, pageSize int) ([]models.Book, int, error) {
+	var books []models.Book
+	var total int64
+
+	related := func() *gorm.DB {
+		return r.db.Model(&models.Book{}).Scopes(storefront, recommendable).
+			Where("books.id <> ?", book.ID).
+			Where("books.category = ? OR (books.author <> '' AND books.author = ?) OR (books.series <> '' AND books.series = ?)",
+				book.Category, book.Author, book.Series)
+	}
+	if err := related().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if total == 0 {
+		return []models.Book{}, 0, nil
+	}
+
+	err := related().Select("books.*").
+		Joins("LEFT JOIN (?) AS scores ON scores.book_id = books.id", r.coPurchased([]uint{book.ID})).
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL: "COALESCE(scores.score, 0) DESC, (books.series <> '' AND books.series = ?) DESC, " +
+				"(books.category = ?) + (books.author <> '' AND books.author = ?) DESC, " +
+				"books.rating_average DESC, books.rating_count DESC, books.id",
+			Vars:               []interface{}{book.Series, book.Category, book.Author},
+			WithoutParentheses: true,
+		}}).
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&books).Error
+	return books, int(total), err
+}
+
+// coPurchased scores the books in the same sold orders as the given books,
+// which is either a list of ids or a subquery selecting them. The given books
+// themselves are left out
+func (r *recommendationRepository) coPurchased(bookIds interface{}) *gorm.DB {
+	return r.db.Table("order_books AS bought").
+		Select("other.book_id, COUNT(DISTINCT other.order_id) AS score").
+		Joins("JOIN orders ON orders.id = bought.order_id AND orders.deleted_at IS NULL").
+		Joins("JOIN order_books AS other ON other.order_id = bought.order_id AND other.deleted_at IS NULL").
+		Where("bought.deleted_at IS NULL AND orders.status IN ?", models.SoldOrderStatuses).
+		Where("bought.book_id IN (?) AND other.book_id NOT IN (?)", bookIds, bookIds).
+		Group("other.book_id")
+}
+
+// rankedBooks pages through the storefront books in scores, a subquery of
+// book_id and score, highest score first and then by id so pages are stable
+func (r *recommendationRepository) rankedBooks(scores *gorm.DB, page, pageSize int) ([]models.Book, int, error) {
+	var books []models.Book
+	var total int64
+
+	ranked := func() *gorm.DB {
+		return r.db.Model(&models.Book{}).Scopes(storefront, recommendable).
+			Joins("JOIN (?) AS scores ON scores.book_id = books.id", scores)
+	}
+	if err := ranked().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if total == 0 {
+		return []models.Book{}, 0, nil
+	}
+
+	err := ranked().Select("books.*").Order("scores.score DESC, books.id").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&books).Error
+	return books, int(total), err
+}
+
+// recommendable leaves out books the publisher withdrew
+func recommendable(db *gorm.DB) *gorm.DB {
+	return db.Where("books.availability <> ?", models.BookUnavailable)
+}
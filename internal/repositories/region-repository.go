@@ -0,0 +1,31 @@
+package repositories
+
+import (
+	"github.com/febriaricandra/book-shop/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RegionRepository interface {
+	GetRegionCache(key string) (*models.RegionCache, error)
+	SaveRegionCache(cache *models.RegionCache) error
+}
+
+type regionRepository struct {
+	db *gorm.DB
+}
+
+func NewRegionRepository(db *gorm.DB) RegionRepository {
+	return &regionRepository{db}
+}
+
+func (r *regionRepository) GetRegionCache(key string) (*models.RegionCache, error) {
+	var cache models.RegionCache
+	err := r.db.Where("cache_key = ?", key).First(&cache).Error
+	return &cache, err
+}
+
+// SaveRegionCache creates the list or replaces the one of the same key
+func (r *regionRepository) SaveRegionCache(cache *models.RegionCache) error {
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(cache).Error
+}
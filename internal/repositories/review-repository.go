@@ -0,0 +1,212 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrReviewExists = errors.New("you have already reviewed this book")
+	ErrAlreadyVoted = errors.New("you have already marked this review as helpful")
+)
+
+// ReviewSortOrders are the orders GetReviewsForBook accepts
+var ReviewSortOrders = map[string]string{
+	"newest":      "created_at DESC, id DESC",
+	"helpful":     "helpful_count DESC, created_at DESC, id DESC",
+	"rating_high": "rating DESC, created_at DESC, id DESC",
+	"rating_low":  "rating ASC, created_at DESC, id DESC",
+}
+
+type ReviewRepository interface {
+	CreateReview(review *models.Review) error
+	GetReview(id uint) (*models.Review, error)
+	GetReviewsForBook(bookId uint, sort string, page, pageSize int) ([]models.Review, int, error)
+	GetReviewsByStatus(status string, page, pageSize int) ([]models.Review, int, error)
+	UpdateReview(review *models.Review) error
+	SetReviewStatus(id uint, status string) (*models.Review, error)
+	DeleteReview(id uint) error
+	AddVote(reviewId, userId uint) error
+	RemoveVote(reviewId, userId uint) error
+}
+
+type reviewRepository struct {
+	db *gorm.DB
+}
+
+func NewReviewRepository(db *gorm.DB) ReviewRepository {
+	return &reviewRepository{db}
+}
+
+func (r *reviewRepository) CreateReview(review *models.Review) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&models.Review{}).Where("book_id = ? AND user_id = ?", review.BookID, review.UserID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrReviewExists
+		}
+
+		if err := tx.Create(review).Error; err != nil {
+			return err
+		}
+		return applyRating(tx, review.BookID, nil, review)
+	})
+}
+
+func (r *reviewRepository) GetReview(id uint) (*models.Review, error) {
+	var review models.Review
+	err := r.db.First(&review, id).Error
+	return &review, err
+}
+
+// GetReviewsForBook pages through the approved reviews of a book, sort is a
+// key of ReviewSortOrders
+func (r *reviewRepository) GetReviewsForBook(bookId uint, sort string, page, pageSize int) ([]models.Review, int, error) {
+	var reviews []models.Review
+	var total int64
+
+	approved := r.db.Model(&models.Review{}).Where("book_id = ? AND status = ?", bookId, models.ReviewApproved)
+	if err := approved.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := r.db.Where("book_id = ? AND status = ?", bookId, models.ReviewApproved).
+		Order(ReviewSortOrders[sort]).Offset((page - 1) * pageSize).Limit(pageSize).Find(&reviews).Error
+	return reviews, int(total), err
+}
+
+// GetReviewsByStatus is the moderation queue, oldest first
+func (r *reviewRepository) GetReviewsByStatus(status string, page, pageSize int) ([]models.Review, int, error) {
+	var reviews []models.Review
+	var total int64
+
+	if err := r.db.Model(&models.Review{}).Where("status = ?", status).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := r.db.Where("status = ?", status).Order("created_at, id").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&reviews).Error
+	return reviews, int(total), err
+}
+
+// UpdateReview saves the rating, text and status, adjusting the book's rating
+// by the difference
+func (r *reviewRepository) UpdateReview(review *models.Review) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		before, err := lockReview(tx, review.ID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(review).Select("rating", "title", "body", "status").Updates(review).Error
+		if err != nil {
+			return err
+		}
+		return applyRating(tx, review.BookID, before, review)
+	})
+}
+
+func (r *reviewRepository) SetReviewStatus(id uint, status string) (*models.Review, error) {
+	var review *models.Review
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		before, err := lockReview(tx, id)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.Status = status
+		if err := tx.Model(&after).Update("status", status).Error; err != nil {
+			return err
+		}
+		review = &after
+		return applyRating(tx, after.BookID, before, &after)
+	})
+	return review, err
+}
+
+func (r *reviewRepository) DeleteReview(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		before, err := lockReview(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("review_id = ?", id).Delete(&models.ReviewVote{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(before).Error; err != nil {
+			return err
+		}
+		return applyRating(tx, before.BookID, before, nil)
+	})
+}
+
+func (r *reviewRepository) AddVote(reviewId, userId uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&models.ReviewVote{}).Where("review_id = ? AND user_id = ?", reviewId, userId).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyVoted
+		}
+
+		if err := tx.Create(&models.ReviewVote{ReviewID: reviewId, UserID: userId}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Review{}).Where("id = ?", reviewId).
+			UpdateColumn("helpful_count", gorm.Expr("helpful_count + 1")).Error
+	})
+}
+
+// RemoveVote takes back a helpful vote, removing a vote that was never cast
+// is not an error
+func (r *reviewRepository) RemoveVote(reviewId, userId uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("review_id = ? AND user_id = ?", reviewId, userId).Delete(&models.ReviewVote{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&models.Review{}).Where("id = ?", reviewId).
+			UpdateColumn("helpful_count", gorm.Expr("helpful_count - 1")).Error
+	})
+}
+
+func lockReview(tx *gorm.DB, id uint) (*models.Review, error) {
+	var review models.Review
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&review, id).Error
+	return &review, err
+}
+
+// ratingContribution is what a review adds to its book's rating aggregates,
+// only approved reviews count
+func ratingContribution(review *models.Review) (total, count int) {
+	if review == nil || review.Status != models.ReviewApproved {
+		return 0, 0
+	}
+	return review.Rating, 1
+}
+
+// applyRating moves the book's aggregates from the review's old state to its
+// new one, either may be nil for a created or deleted review
+func applyRating(tx *gorm.DB, bookId uint, before, after *models.Review) error {
+	oldTotal, oldCount := ratingContribution(before)
+	newTotal, newCount := ratingContribution(after)
+	if oldTotal == newTotal && oldCount == newCount {
+		return nil
+	}
+
+	// MySQL evaluates the assignments left to right, so the average is taken
+	// from the updated total and count
+	return tx.Exec(`UPDATE books SET rating_total = rating_total + ?, rating_count = rating_count + ?,
+		rating_average = IF(rating_count > 0, rating_total / rating_count, 0) WHERE id = ?`,
+		newTotal-oldTotal, newCount-oldCount, bookId).Error
+}
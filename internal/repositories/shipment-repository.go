@@ -0,0 +1,44 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"gorm.io/gorm"
+)
+
+type ShipmentRepository interface {
+	GetShipmentByOrder(orderId uint) (*models.Shipment, error)
+	SaveShipment(shipment *models.Shipment) error
+	GetShipmentsToTrack(trackedBefore time.Time, limit int) ([]models.Shipment, error)
+}
+
+type shipmentRepository struct {
+	db *gorm.DB
+}
+
+func NewShipmentRepository(db *gorm.DB) ShipmentRepository {
+	return &shipmentRepository{db}
+}
+
+func (r *shipmentRepository) GetShipmentByOrder(orderId uint) (*models.Shipment, error) {
+	var shipment models.Shipment
+	err := r.db.Where("order_id = ?", orderId).First(&shipment).Error
+	return &shipment, err
+}
+
+// SaveShipment creates the shipment or updates it when it has an ID
+func (r *shipmentRepository) SaveShipment(shipment *models.Shipment) error {
+	return r.db.Save(shipment).Error
+}
+
+// GetShipmentsToTrack lists the undelivered shipments of shipped orders that
+// were last tracked before trackedBefore, least recently tracked first
+func (r *shipmentRepository) GetShipmentsToTrack(trackedBefore time.Time, limit int) ([]models.Shipment, error) {
+	var shipments []models.Shipment
+	err := r.db.Joins("JOIN orders ON orders.id = shipments.order_id AND orders.deleted_at IS NULL").
+		Where("orders.status = ? AND shipments.delivered_at IS NULL", models.OrderShipped).
+		Where("shipments.tracked_at IS NULL OR shipments.tracked_at < ?", trackedBefore).
+		Order("shipments.tracked_at").Limit(limit).Find(&shipments).Error
+	return shipments, err
+}
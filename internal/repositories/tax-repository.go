@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"gorm.io/gorm"
+)
+
+// ErrTaxRateExists is returned when the category already has its own rate
+var ErrTaxRateExists = errors.New("this category already has a tax rate")
+
+// TaxReport sums up the tax charged at one rate
+type TaxReport struct {
+	Name    string      `json:"name"`
+	Percent float64     `json:"percent"`
+	Orders  int         `json:"orders"`
+	Base    money.Money `json:"base"`
+	Tax     money.Money `json:"tax"`
+}
+
+type TaxRepository interface {
+	GetTaxRates() ([]models.TaxRate, error)
+	GetTaxRate(id uint) (*models.TaxRate, error)
+	CreateTaxRate(rate *models.TaxRate) error
+	UpdateTaxRate(rate *models.TaxRate) error
+	DeleteTaxRate(id uint) error
+	GetTaxReports(from, to time.Time) ([]TaxReport, error)
+}
+
+type taxRepository struct {
+	db *gorm.DB
+}
+
+func NewTaxRepository(db *gorm.DB) TaxRepository {
+	return &taxRepository{db}
+}
+
+func (r *taxRepository) GetTaxRates() ([]models.TaxRate, error) {
+	var rates []models.TaxRate
+	err := r.db.Order("category").Find(&rates).Error
+	return rates, err
+}
+
+func (r *taxRepository) GetTaxRate(id uint) (*models.TaxRate, error) {
+	var rate models.TaxRate
+	err := r.db.First(&rate, id).Error
+	return &rate, err
+}
+
+func (r *taxRepository) CreateTaxRate(rate *models.TaxRate) error {
+	if err := r.checkCategory(rate); err != nil {
+		return err
+	}
+	return r.db.Create(rate).Error
+}
+
+func (r *taxRepository) UpdateTaxRate(rate *models.TaxRate) error {
+	if err := r.checkCategory(rate); err != nil {
+		return err
+	}
+	return r.db.Save(rate).Error
+}
+
+func (r *taxRepository) DeleteTaxRate(id uint) error {
+	result := r.db.Delete(&models.TaxRate{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// checkCategory fails when another rate is set for the rate's category
+func (r *taxRepository) checkCategory(rate *models.TaxRate) error {
+	var count int64
+	err := r.db.Model(&models.TaxRate{}).Where("category = ? AND id <> ?", rate.Category, rate.ID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrTaxRateExists
+	}
+	return nil
+}
+
+// GetTaxReports sums up the tax of the orders sold in [from, to) per tax
+// name and rate, highest rate first
+func (r *taxRepository) GetTaxReports(from, to time.Time) ([]TaxReport, error) {
+	var reports []TaxReport
+
+	err := r.db.Table("order_taxes").
+		Select("order_taxes.name, order_taxes.percent, COUNT(DISTINCT order_taxes.order_id) AS orders, "+
+			"SUM(order_taxes.base) AS base, SUM(order_taxes.tax) AS tax").
+		Joins("JOIN orders ON orders.id = order_taxes.order_id AND orders.deleted_at IS NULL").
+		Where("orders.status IN ? AND orders.created_at >= ? AND orders.created_at < ?", models.SoldOrderStatuses, from, to).
+		Group("order_taxes.name, order_taxes.percent").
+		Order("order_taxes.percent DESC, order_taxes.name").
+		Scan(&reports).Error
+	return reports, err
+}
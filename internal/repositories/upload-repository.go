@@ -0,0 +1,47 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"gorm.io/gorm"
+)
+
+type UploadRepository interface {
+	CreateUpload(upload *models.CoverUpload) error
+	GetUpload(id string) (*models.CoverUpload, error)
+	DeleteUpload(id string) error
+	GetExpiredUploads(now time.Time, limit int) ([]models.CoverUpload, error)
+}
+
+type uploadRepository struct {
+	db *gorm.DB
+}
+
+func NewUploadRepository(db *gorm.DB) UploadRepository {
+	return &uploadRepository{db}
+}
+
+func (r *uploadRepository) CreateUpload(upload *models.CoverUpload) error {
+	return r.db.Create(upload).Error
+}
+
+func (r *uploadRepository) GetUpload(id string) (*models.CoverUpload, error) {
+	var upload models.CoverUpload
+	err := r.db.Where("id = ?", id).First(&upload).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &upload, nil
+}
+
+func (r *uploadRepository) DeleteUpload(id string) error {
+	return r.db.Where("id = ?", id).Delete(&models.CoverUpload{}).Error
+}
+
+func (r *uploadRepository) GetExpiredUploads(now time.Time, limit int) ([]models.CoverUpload, error) {
+	var uploads []models.CoverUpload
+	err := r.db.Where("expires_at < ?", now).Order("expires_at").Limit(limit).Find(&uploads).Error
+	return uploads, err
+}
@@ -9,6 +9,8 @@ type UserRepository interface {
 	CreateUser(user *models.User) error
 	GetUserById(id uint) (*models.User, error)
 	GetUserByEmail(email string) (*models.User, error)
+	UpdateUserCurrency(id uint, currency string) error
+	ClearCurrency(currency string) error
 }
 
 type userRepository struct {
@@ -38,3 +40,13 @@ func (r *userRepository) GetUserByEmail(email string) (*models.User, error) {
 	err := r.db.Where("email = ?", email).First(&user).Error
 	return &user, err
 }
+
+func (r *userRepository) UpdateUserCurrency(id uint, currency string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("currency", currency).Error
+}
+
+// ClearCurrency moves the users who chose the currency back to the shop
+// currency
+func (r *userRepository) ClearCurrency(currency string) error {
+	return r.db.Model(&models.User{}).Where("currency = ?", currency).Update("currency", "").Error
+}
@@ -0,0 +1,131 @@
+package repositories
+
+import (
+	"github.com/febriaricandra/book-shop/internal/models"
+	"gorm.io/gorm"
+)
+
+type WishlistRepository interface {
+	CreateWishlist(wishlist *models.Wishlist) error
+	GetWishlists(userId uint) ([]models.Wishlist, error)
+	GetWishlist(id uint) (*models.Wishlist, error)
+	GetDefaultWishlist(userId uint) (*models.Wishlist, error)
+	GetWishlistByToken(token string) (*models.Wishlist, error)
+	CountWishlists(userId uint) (int, error)
+	UpdateWishlist(wishlist *models.Wishlist) error
+	DeleteWishlist(id uint) error
+	AddItem(item *models.WishlistItem) error
+	RemoveItem(wishlistId, bookId uint) error
+	FindChangedItems(afterId uint, limit int) ([]models.WishlistItem, error)
+	MarkItemSeen(item *models.WishlistItem) error
+}
+
+type wishlistRepository struct {
+	db *gorm.DB
+}
+
+func NewWishlistRepository(db *gorm.DB) WishlistRepository {
+	return &wishlistRepository{db}
+}
+
+func (r *wishlistRepository) CreateWishlist(wishlist *models.Wishlist) error {
+	return r.db.Create(wishlist).Error
+}
+
+func (r *wishlistRepository) GetWishlists(userId uint) ([]models.Wishlist, error) {
+	var wishlists []models.Wishlist
+	err := r.db.Where("user_id = ?", userId).Scopes(withWishlistItems).
+		Order("is_default DESC, created_at, id").Find(&wishlists).Error
+	return wishlists, err
+}
+
+func (r *wishlistRepository) GetWishlist(id uint) (*models.Wishlist, error) {
+	var wishlist models.Wishlist
+	err := r.db.Scopes(withWishlistItems).First(&wishlist, id).Error
+	return &wishlist, err
+}
+
+func (r *wishlistRepository) GetDefaultWishlist(userId uint) (*models.Wishlist, error) {
+	var wishlist models.Wishlist
+	err := r.db.Where("user_id = ? AND is_default = ?", userId, true).First(&wishlist).Error
+	return &wishlist, err
+}
+
+func (r *wishlistRepository) GetWishlistByToken(token string) (*models.Wishlist, error) {
+	var wishlist models.Wishlist
+	err := r.db.Where("share_token = ?", token).Scopes(withWishlistItems).First(&wishlist).Error
+	return &wishlist, err
+}
+
+func (r *wishlistRepository) CountWishlists(userId uint) (int, error) {
+	var count int64
+	err := r.db.Model(&models.Wishlist{}).Where("user_id = ?", userId).Count(&count).Error
+	return int(count), err
+}
+
+func (r *wishlistRepository) UpdateWishlist(wishlist *models.Wishlist) error {
+	return r.db.Model(wishlist).Select("name", "share_token").Updates(wishlist).Error
+}
+
+func (r *wishlistRepository) DeleteWishlist(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("wishlist_id = ?", id).Delete(&models.WishlistItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Wishlist{}, id).Error
+	})
+}
+
+// AddItem saves the book on the list, adding a book twice is a no-op
+func (r *wishlistRepository) AddItem(item *models.WishlistItem) error {
+	var existing models.WishlistItem
+	err := r.db.Where("wishlist_id = ? AND book_id = ?", item.WishlistID, item.BookID).Limit(1).Find(&existing).Error
+	if err != nil {
+		return err
+	}
+	if existing.ID != 0 {
+		*item = existing
+		return nil
+	}
+	return r.db.Omit("Book", "Wishlist").Create(item).Error
+}
+
+func (r *wishlistRepository) RemoveItem(wishlistId, bookId uint) error {
+	result := r.db.Where("wishlist_id = ? AND book_id = ?", wishlistId, bookId).Delete(&models.WishlistItem{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// FindChangedItems returns items whose book's price or availability differs
+// from what the user last saw, in id order after afterId. Hidden books are
+// skipped until they come back
+func (r *wishlistRepository) FindChangedItems(afterId uint, limit int) ([]models.WishlistItem, error) {
+	var items []models.WishlistItem
+	err := r.db.Joins("JOIN books ON books.id = wishlist_items.book_id AND books.deleted_at IS NULL AND books.archived_at IS NULL").
+		Where("wishlist_items.id > ?", afterId).
+		Where("books.new_price <> wishlist_items.seen_price OR books.availability <> wishlist_items.seen_availability").
+		Preload("Book").Preload("Wishlist").
+		Order("wishlist_items.id").Limit(limit).Find(&items).Error
+	return items, err
+}
+
+// MarkItemSeen records the book's current price and availability on the item
+func (r *wishlistRepository) MarkItemSeen(item *models.WishlistItem) error {
+	return r.db.Model(&models.WishlistItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+		"seen_price":        item.Book.NewPrice,
+		"seen_availability": item.Book.Availability,
+	}).Error
+}
+
+// withWishlistItems loads the items newest first with their books, deleted
+// books included so the list still shows what was saved
+func withWishlistItems(db *gorm.DB) *gorm.DB {
+	return db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at DESC, id DESC")
+	}).Preload("Items.Book", withDeletedBooks)
+}
@@ -11,9 +11,8 @@ func BookRouter(router *gin.Engine, h *handlers.BookHandler) {
 	//public route v1
 	public := router.Group("/api")
 	{
-		public.GET("/books", h.GetBooks)
-		public.GET("/books/:id", h.GetBookById)
-		public.GET("/books/home", h.HomeBooks)
+		public.GET("/books", middlewares.OptionalAuthMiddleware(), h.GetBooks)
+		public.GET("/books/:id", middlewares.OptionalAuthMiddleware(), h.GetBookById)
 	}
 
 	//private route v1
@@ -22,6 +21,94 @@ func BookRouter(router *gin.Engine, h *handlers.BookHandler) {
 	{
 		private.POST("/books", middlewares.AdminMiddleware(), h.CreateBook)
 		private.PUT("/books/:id", middlewares.AdminMiddleware(), h.UpdateBook)
+		private.PATCH("/books/:id", middlewares.AdminMiddleware(), h.PatchBook)
+		private.DELETE("/books/:id", middlewares.AdminMiddleware(), h.DeleteBook)
+		private.GET("/books/deleted", middlewares.AdminMiddleware(), h.GetDeletedBooks)
+		private.POST("/books/:id/restore", middlewares.AdminMiddleware(), h.RestoreBook)
+		private.POST("/books/metadata", middlewares.AdminMiddleware(), h.ImportMetadata)
+		private.POST("/books/:id/cover/presign", middlewares.AdminMiddleware(), h.PresignCover)
+		private.POST("/books/:id/cover/confirm", middlewares.AdminMiddleware(), h.ConfirmCover)
+	}
+}
+
+func CatalogRouter(router *gin.Engine, h *handlers.CatalogHandler) {
+	private := router.Group("/api")
+	private.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	{
+		private.POST("/books/import", h.ImportCatalog)
+		private.GET("/books/import/:job_id", h.GetImportJob)
+		private.GET("/books/export", h.ExportCatalog)
+	}
+}
+
+func GalleryRouter(router *gin.Engine, h *handlers.GalleryHandler) {
+	public := router.Group("/api")
+	{
+		public.GET("/books/:id/images", h.GetImages)
+	}
+
+	private := router.Group("/api")
+	private.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	{
+		private.POST("/books/:id/images", h.AddImage)
+		private.PUT("/books/:id/images/order", h.ReorderImages)
+		private.PATCH("/books/:id/images/:image_id", h.UpdateImage)
+		private.DELETE("/books/:id/images/:image_id", h.DeleteImage)
+	}
+}
+
+func ReviewRouter(router *gin.Engine, h *handlers.ReviewHandler) {
+	public := router.Group("/api")
+	{
+		public.GET("/books/:id/reviews", h.GetBookReviews)
+	}
+
+	private := router.Group("/api")
+	private.Use(middlewares.AuthMiddleware())
+	{
+		private.POST("/books/:id/reviews", h.CreateReview)
+		private.PUT("/reviews/:review_id", h.UpdateReview)
+		private.DELETE("/reviews/:review_id", h.DeleteReview)
+		private.POST("/reviews/:review_id/helpful", h.VoteHelpful)
+		private.DELETE("/reviews/:review_id/helpful", h.RemoveHelpfulVote)
+		private.GET("/reviews", middlewares.AdminMiddleware(), h.GetReviews)
+		private.PATCH("/reviews/:review_id/status", middlewares.AdminMiddleware(), h.ModerateReview)
+	}
+}
+
+func RecommendationRouter(router *gin.Engine, h *handlers.RecommendationHandler) {
+	public := router.Group("/api")
+	{
+		public.GET("/books/home", middlewares.OptionalAuthMiddleware(), h.HomeBooks)
+		public.GET("/books/bestsellers", middlewares.OptionalAuthMiddleware(), h.GetBestsellers)
+		public.GET("/books/:id/also-bought", middlewares.OptionalAuthMiddleware(), h.GetAlsoBought)
+		public.GET("/books/:id/related", middlewares.OptionalAuthMiddleware(), h.GetRelatedBooks)
+	}
+
+	private := router.Group("/api")
+	private.Use(middlewares.AuthMiddleware())
+	{
+		private.GET("/recommendations", h.GetRecommendations)
+	}
+}
+
+func WishlistRouter(router *gin.Engine, h *handlers.WishlistHandler) {
+	public := router.Group("/api")
+	{
+		public.GET("/shared/wishlists/:token", h.GetSharedWishlist)
+	}
+
+	private := router.Group("/api")
+	private.Use(middlewares.AuthMiddleware())
+	{
+		private.GET("/wishlists", h.GetWishlists)
+		private.POST("/wishlists", h.CreateWishlist)
+		private.POST("/wishlists/items", h.AddItem)
+		private.GET("/wishlists/:id", h.GetWishlist)
+		private.PATCH("/wishlists/:id", h.UpdateWishlist)
+		private.DELETE("/wishlists/:id", h.DeleteWishlist)
+		private.POST("/wishlists/:id/items", h.AddItem)
+		private.DELETE("/wishlists/:id/items/:book_id", h.RemoveItem)
 	}
 }
 
@@ -45,9 +132,60 @@ func OrderRouter(router *gin.Engine, h *handlers.OrderHandler) {
 	private.Use(middlewares.AuthMiddleware())
 	{
 		private.POST("/orders", h.CreateOrder)
+		private.POST("/orders/quote", h.QuoteOrder)
 		private.GET("/orders/:id", h.GetOrderById)
+		private.GET("/orders/:id/invoice.pdf", h.GetInvoice)
 		private.GET("/user-orders", h.GetOrdersForUser)
 		private.GET("/orders", h.GetAllOrders)
+		private.PATCH("/orders/:id/status", middlewares.AdminMiddleware(), h.UpdateOrderStatus)
+	}
+}
+
+func ShipmentRouter(router *gin.Engine, h *handlers.ShipmentHandler) {
+	private := router.Group("/api")
+	private.Use(middlewares.AuthMiddleware())
+	{
+		private.GET("/orders/:id/tracking", h.GetTracking)
+		private.PUT("/orders/:id/shipment", middlewares.AdminMiddleware(), h.SetShipment)
+	}
+}
+
+func CouponRouter(router *gin.Engine, h *handlers.CouponHandler) {
+	private := router.Group("/api")
+	private.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	{
+		private.GET("/coupons", h.GetCoupons)
+		private.POST("/coupons", h.CreateCoupon)
+		private.GET("/coupons/report", h.GetReports)
+		private.GET("/coupons/:id", h.GetCoupon)
+		private.PUT("/coupons/:id", h.UpdateCoupon)
+		private.DELETE("/coupons/:id", h.DeleteCoupon)
+		private.GET("/coupons/:id/redemptions", h.GetRedemptions)
+	}
+}
+
+func TaxRouter(router *gin.Engine, h *handlers.TaxHandler) {
+	private := router.Group("/api")
+	private.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	{
+		private.GET("/tax-rates", h.GetTaxRates)
+		private.POST("/tax-rates", h.CreateTaxRate)
+		private.PUT("/tax-rates/:id", h.UpdateTaxRate)
+		private.DELETE("/tax-rates/:id", h.DeleteTaxRate)
+		private.GET("/taxes/report", h.GetReports)
+	}
+}
+
+func PriceRouter(router *gin.Engine, h *handlers.PriceHandler) {
+	private := router.Group("/api")
+	private.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	{
+		private.GET("/price-rules", h.GetPriceRules)
+		private.POST("/price-rules", h.CreatePriceRule)
+		private.GET("/price-rules/:id", h.GetPriceRule)
+		private.PUT("/price-rules/:id", h.UpdatePriceRule)
+		private.DELETE("/price-rules/:id", h.CancelPriceRule)
+		private.GET("/books/:id/price-history", h.GetPriceHistory)
 	}
 }
 
@@ -58,5 +196,23 @@ func RajaOngkirRouter(router *gin.Engine, h *handlers.RajaOngkirHandler) {
 		private.GET("/provinces", h.GetProvinces)
 		private.GET("/cities/:province_id", h.GetCities)
 		private.POST("/cost", h.GetCosts)
+		private.POST("/shipping/quote", h.QuoteShipping)
+		private.POST("/regions/refresh", middlewares.AdminMiddleware(), h.RefreshRegions)
+	}
+}
+
+func CurrencyRouter(router *gin.Engine, h *handlers.CurrencyHandler) {
+	public := router.Group("/api")
+	{
+		public.GET("/exchange-rates", h.GetRates)
+	}
+
+	private := router.Group("/api")
+	private.Use(middlewares.AuthMiddleware())
+	{
+		private.PUT("/profile/currency", h.SetUserCurrency)
+		private.POST("/exchange-rates/refresh", middlewares.AdminMiddleware(), h.RefreshRates)
+		private.PUT("/exchange-rates/:currency", middlewares.AdminMiddleware(), h.SetRate)
+		private.DELETE("/exchange-rates/:currency", middlewares.AdminMiddleware(), h.DeleteRate)
 	}
 }
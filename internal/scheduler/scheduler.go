@@ -0,0 +1,42 @@
+// Package scheduler runs background maintenance jobs inside the API process
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Job is one run of a background task
+type Job func(ctx context.Context) error
+
+// Every runs job once per interval until ctx is cancelled. Runs never
+// overlap, a failed run is logged and retried on the next tick
+func Every(ctx context.Context, name string, interval time.Duration, job Job) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run(ctx, name, job)
+		}
+	}
+}
+
+func run(ctx context.Context, name string, job Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Scheduled job panicked", "job", name, "panic", r)
+		}
+	}()
+
+	start := time.Now()
+	if err := job(ctx); err != nil {
+		slog.Error("Scheduled job failed", "job", name, "error", err)
+		return
+	}
+	slog.Info("Scheduled job finished", "job", name, "duration", time.Since(start))
+}
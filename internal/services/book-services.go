@@ -1,8 +1,12 @@
 package services
 
 import (
+	"strings"
+
 	"github.com/febriaricandra/book-shop/internal/models"
 	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/febriaricandra/book-shop/pkg/openlibrary"
 )
 
 type BookService struct {
@@ -21,18 +25,222 @@ func (s *BookService) GetBookById(id uint) (*models.Book, error) {
 	return s.bookRepo.GetBookById(id)
 }
 
-func (s *BookService) GetAllBooks(page, pageSize int) ([]models.Book, int, error) {
-	return s.bookRepo.GetAllBooks(page, pageSize)
+// GetBookWithImages loads the book detail including its gallery and lowest
+// recent price. Archived books are hidden from the storefront, only admins
+// see them
+func (s *BookService) GetBookWithImages(id uint, admin bool) (*models.Book, error) {
+	book, err := s.bookRepo.GetBookWithImages(id, admin)
+	if err != nil {
+		return nil, err
+	}
+
+	books := []models.Book{*book}
+	if err := s.setLowestPrices(books); err != nil {
+		return nil, err
+	}
+	return &books[0], nil
+}
+
+// GetAllBooks lists the storefront, sort is "" or a key of
+// repositories.BookSortOrders
+func (s *BookService) GetAllBooks(page, pageSize int, sort string) ([]models.Book, int, error) {
+	books, total, err := s.bookRepo.GetAllBooks(page, pageSize, sort)
+	if err != nil {
+		return nil, 0, err
+	}
+	return books, total, s.setLowestPrices(books)
+}
+
+// setLowestPrices sets the lowest price of the LowestPriceWindow before the
+// current price took effect on each book, which is the current price when
+// there was no earlier one
+func (s *BookService) setLowestPrices(books []models.Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(books))
+	for i := range books {
+		ids[i] = books[i].ID
+	}
+	lowest, err := s.bookRepo.GetLowestPrices(ids, LowestPriceWindow)
+	if err != nil {
+		return err
+	}
+
+	for i := range books {
+		price := books[i].NewPrice
+		if historic, ok := lowest[books[i].ID]; ok {
+			price = historic
+		}
+		books[i].LowestPrice30d = &price
+	}
+	return nil
 }
 
 func (s *BookService) UpdateBook(book *models.Book) error {
 	return s.bookRepo.UpdateBook(book)
 }
 
-func (s *BookService) DeleteBook(id uint) error {
-	return s.bookRepo.DeleteBook(id)
+// DeleteBook soft deletes the book, or archives it when open orders still
+// reference it. The returned flag tells which one happened
+func (s *BookService) DeleteBook(id uint) (bool, error) {
+	if _, err := s.bookRepo.GetBookById(id); err != nil {
+		return false, err
+	}
+
+	hasOpenOrders, err := s.bookRepo.HasOpenOrders(id)
+	if err != nil {
+		return false, err
+	}
+	if hasOpenOrders {
+		return true, s.bookRepo.ArchiveBook(id)
+	}
+
+	return false, s.bookRepo.DeleteBook(id)
+}
+
+func (s *BookService) RestoreBook(id uint) error {
+	return s.bookRepo.RestoreBook(id)
+}
+
+func (s *BookService) GetDeletedBooks(page, pageSize int) ([]models.Book, int, error) {
+	return s.bookRepo.GetDeletedBooks(page, pageSize)
 }
 
-func (s *BookService) GetHomeBooks(page, pageSize int) ([]models.Book, []models.Book, int, error) {
-	return s.bookRepo.GetHomeBooks(page, pageSize)
+// ManualPriceChange is the price history source of an edit by an admin
+func ManualPriceChange(userID uint) models.PriceChangeSource {
+	return models.PriceChangeSource{Reason: models.PriceReasonManual, UserID: &userID}
+}
+
+// FieldErrors maps a JSON field name to what is wrong with it
+type FieldErrors map[string]string
+
+// BookPatch holds the fields of a partial update, nil means unchanged
+type BookPatch struct {
+	ISBN         *string      `json:"isbn"`
+	Title        *string      `json:"title"`
+	Author       *string      `json:"author"`
+	Description  *string      `json:"description"`
+	Category     *string      `json:"category"`
+	Trending     *bool        `json:"trending"`
+	OldPrice     *money.Money `json:"old_price"`
+	NewPrice     *money.Money `json:"new_price"`
+	Weight       *int64       `json:"weight"`
+	PageCount    *int         `json:"page_count"`
+	Publisher    *string      `json:"publisher"`
+	Series       *string      `json:"series"`
+	Availability *string      `json:"availability"`
+}
+
+// Apply copies the changed fields onto the book
+func (p *BookPatch) Apply(book *models.Book) {
+	if p.ISBN != nil {
+		book.ISBN = openlibrary.NormalizeISBN(*p.ISBN)
+	}
+	if p.Title != nil {
+		book.Title = strings.TrimSpace(*p.Title)
+	}
+	if p.Author != nil {
+		book.Author = strings.TrimSpace(*p.Author)
+	}
+	if p.Description != nil {
+		book.Description = *p.Description
+	}
+	if p.Category != nil {
+		book.Category = strings.TrimSpace(*p.Category)
+	}
+	if p.Trending != nil {
+		book.Trending = *p.Trending
+	}
+	if p.OldPrice != nil {
+		book.OldPrice = *p.OldPrice
+	}
+	if p.NewPrice != nil {
+		book.NewPrice = *p.NewPrice
+	}
+	if p.Weight != nil {
+		book.Weight = *p.Weight
+	}
+	if p.PageCount != nil {
+		book.PageCount = *p.PageCount
+	}
+	if p.Publisher != nil {
+		book.Publisher = strings.TrimSpace(*p.Publisher)
+	}
+	if p.Series != nil {
+		book.Series = strings.TrimSpace(*p.Series)
+	}
+	if p.Availability != nil {
+		book.Availability = *p.Availability
+	}
+}
+
+// ValidateBook checks a complete book before it is saved
+func ValidateBook(book *models.Book) FieldErrors {
+	errs := FieldErrors{}
+
+	if book.Title == "" {
+		errs["title"] = "must not be empty"
+	} else if len(book.Title) > 255 {
+		errs["title"] = "must be at most 255 characters"
+	}
+	if book.Category == "" {
+		errs["category"] = "must not be empty"
+	} else if len(book.Category) > 255 {
+		errs["category"] = "must be at most 255 characters"
+	}
+	if len(book.Author) > 255 {
+		errs["author"] = "must be at most 255 characters"
+	}
+	if len(book.Publisher) > 255 {
+		errs["publisher"] = "must be at most 255 characters"
+	}
+	if len(book.Series) > 255 {
+		errs["series"] = "must be at most 255 characters"
+	}
+	if len(book.ISBN) > 20 {
+		errs["isbn"] = "must be at most 20 characters"
+	}
+	if book.OldPrice.IsNegative() {
+		errs["old_price"] = "must not be negative"
+	}
+	if book.NewPrice.IsNegative() {
+		errs["new_price"] = "must not be negative"
+	}
+	if book.Weight < 0 {
+		errs["weight"] = "must not be negative"
+	}
+	if book.PageCount < 0 {
+		errs["page_count"] = "must not be negative"
+	}
+	if book.Availability != "" && !validAvailability[book.Availability] {
+		errs["availability"] = "must be in_stock, out_of_stock or unavailable"
+	}
+
+	return errs
+}
+
+// PatchBook applies a partial update by the user when the stored version
+// still matches expectedVersion. A zero expectedVersion skips the check
+// (If-Match: *)
+func (s *BookService) PatchBook(id, expectedVersion, userID uint, patch *BookPatch) (*models.Book, FieldErrors, error) {
+	book, err := s.bookRepo.GetBookById(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if expectedVersion != 0 && book.Version != expectedVersion {
+		return nil, nil, repositories.ErrVersionConflict
+	}
+
+	patch.Apply(book)
+	book.PriceSource = ManualPriceChange(userID)
+	if errs := ValidateBook(book); len(errs) > 0 {
+		return nil, errs, nil
+	}
+
+	if err := s.bookRepo.UpdateBook(book); err != nil {
+		return nil, nil, err
+	}
+	return book, nil, nil
 }
@@ -0,0 +1,638 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/febriaricandra/book-shop/pkg/openlibrary"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	CatalogFormatCSV  = "csv"
+	CatalogFormatJSON = "json"
+	CatalogFormatONIX = "onix"
+)
+
+// CatalogColumns is the column order used by CSV export and expected by import
+var CatalogColumns = []string{
+	"id", "isbn", "title", "author", "description", "category", "trending",
+	"cover_image", "old_price", "new_price", "weight", "page_count", "publisher",
+	"availability", "series",
+}
+
+// CatalogRow is one book in an import or export file. Fields records which
+// columns were present so an upsert only touches what the file provides
+type CatalogRow struct {
+	Line         int             `json:"-"`
+	Fields       map[string]bool `json:"-"`
+	ID           uint            `json:"id"`
+	ISBN         string          `json:"isbn"`
+	Title        string          `json:"title"`
+	Author       string          `json:"author"`
+	Description  string          `json:"description"`
+	Category     string          `json:"category"`
+	Trending     bool            `json:"trending"`
+	CoverImage   string          `json:"cover_image"`
+	OldPrice     money.Money     `json:"old_price"`
+	NewPrice     money.Money     `json:"new_price"`
+	Weight       int64           `json:"weight"`
+	PageCount    int             `json:"page_count"`
+	Publisher    string          `json:"publisher"`
+	Availability string          `json:"availability"`
+	Series       string          `json:"series"`
+}
+
+// RowError reports a problem with one row, Line is the CSV line number or
+// the 1-based position in a JSON array
+type RowError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type ImportReport struct {
+	DryRun  bool       `json:"dry_run"`
+	Total   int        `json:"total"`
+	Created int        `json:"created"`
+	Updated int        `json:"updated"`
+	Failed  int        `json:"failed"`
+	Errors  []RowError `json:"errors"`
+}
+
+const (
+	ImportJobRunning   = "running"
+	ImportJobCompleted = "completed"
+)
+
+// importJobTTL is how long the report of a finished import can be fetched
+const importJobTTL = 24 * time.Hour
+
+// ImportJob tracks an asynchronous import. Jobs live in memory only, they are
+// lost when the process restarts and dropped importJobTTL after finishing
+type ImportJob struct {
+	ID         string        `json:"id"`
+	Status     string        `json:"status"`
+	Total      int           `json:"total"`
+	Processed  int64         `json:"processed"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Report     *ImportReport `json:"report,omitempty"`
+}
+
+type CatalogService struct {
+	bookRepo repositories.BookRepository
+	// sender is the name put in the header of exported ONIX messages
+	sender string
+
+	mu   sync.RWMutex
+	jobs map[string]*ImportJob
+}
+
+func NewCatalogService(repo repositories.BookRepository, sender string) *CatalogService {
+	return &CatalogService{bookRepo: repo, sender: sender, jobs: make(map[string]*ImportJob)}
+}
+
+// ParseCatalog reads every row of a CSV, JSON or ONIX catalog. Rows that cannot be
+// parsed are reported as RowError and left out of the returned rows
+func ParseCatalog(format string, r io.Reader) ([]CatalogRow, []RowError, error) {
+	switch format {
+	case CatalogFormatCSV:
+		return parseCatalogCSV(r)
+	case CatalogFormatJSON:
+		return parseCatalogJSON(r)
+	case CatalogFormatONIX, "xml":
+		return parseCatalogONIX(r)
+	}
+	return nil, nil, fmt.Errorf("unsupported catalog format %q", format)
+}
+
+func parseCatalogCSV(r io.Reader) ([]CatalogRow, []RowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading csv header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+	}
+
+	var rows []CatalogRow
+	var rowErrors []RowError
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rowErrors = append(rowErrors, RowError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+				continue
+			}
+			return nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		values := make(map[string]string, len(header))
+		for i, column := range header {
+			if i < len(record) {
+				values[column] = strings.TrimSpace(record[i])
+			}
+		}
+
+		row, errs := catalogRowFromStrings(line, values)
+		if len(errs) > 0 {
+			rowErrors = append(rowErrors, errs...)
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, rowErrors, nil
+}
+
+// blankKeepsColumns are the numeric and yes/no columns, an empty cell in them
+// leaves the book's value unchanged instead of setting it to zero
+var blankKeepsColumns = map[string]bool{
+	"id": true, "trending": true, "old_price": true, "new_price": true, "weight": true, "page_count": true,
+}
+
+func catalogRowFromStrings(line int, values map[string]string) (CatalogRow, []RowError) {
+	row := CatalogRow{Line: line, Fields: make(map[string]bool)}
+	var errs []RowError
+
+	for _, column := range CatalogColumns {
+		value, ok := values[column]
+		if !ok || (value == "" && blankKeepsColumns[column]) {
+			continue
+		}
+
+		var err error
+		switch column {
+		case "id":
+			var id uint64
+			id, err = strconv.ParseUint(value, 10, 32)
+			row.ID = uint(id)
+		case "isbn":
+			row.ISBN = openlibrary.NormalizeISBN(value)
+		case "title":
+			row.Title = value
+		case "author":
+			row.Author = value
+		case "description":
+			row.Description = value
+		case "category":
+			row.Category = value
+		case "trending":
+			row.Trending, err = strconv.ParseBool(value)
+		case "cover_image":
+			row.CoverImage = value
+		case "old_price":
+			row.OldPrice, err = money.Parse(value, money.DefaultCurrency)
+		case "new_price":
+			row.NewPrice, err = money.Parse(value, money.DefaultCurrency)
+		case "weight":
+			row.Weight, err = strconv.ParseInt(value, 10, 64)
+		case "page_count":
+			row.PageCount, err = strconv.Atoi(value)
+		case "publisher":
+			row.Publisher = value
+		case "availability":
+			row.Availability = value
+		case "series":
+			row.Series = value
+		}
+
+		if err != nil {
+			errs = append(errs, RowError{Line: line, Field: column, Message: fmt.Sprintf("invalid value %q", value)})
+			continue
+		}
+		if column != "id" {
+			row.Fields[column] = true
+		}
+	}
+
+	return row, errs
+}
+
+func parseCatalogJSON(r io.Reader) ([]CatalogRow, []RowError, error) {
+	decoder := json.NewDecoder(r)
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading json: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, nil, errors.New("json catalog must be an array of books")
+	}
+
+	var rows []CatalogRow
+	var rowErrors []RowError
+	for line := 1; decoder.More(); line++ {
+		var raw map[string]json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				rowErrors = append(rowErrors, RowError{Line: line, Message: "row must be an object"})
+				continue
+			}
+			return nil, nil, fmt.Errorf("reading json row %d: %w", line, err)
+		}
+
+		row, errs := catalogRowFromJSON(line, raw)
+		if len(errs) > 0 {
+			rowErrors = append(rowErrors, errs...)
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, rowErrors, nil
+}
+
+func catalogRowFromJSON(line int, raw map[string]json.RawMessage) (CatalogRow, []RowError) {
+	row := CatalogRow{Line: line, Fields: make(map[string]bool)}
+	var errs []RowError
+
+	targets := map[string]interface{}{
+		"id":           &row.ID,
+		"isbn":         &row.ISBN,
+		"title":        &row.Title,
+		"author":       &row.Author,
+		"description":  &row.Description,
+		"category":     &row.Category,
+		"trending":     &row.Trending,
+		"cover_image":  &row.CoverImage,
+		"old_price":    &row.OldPrice,
+		"new_price":    &row.NewPrice,
+		"weight":       &row.Weight,
+		"page_count":   &row.PageCount,
+		"publisher":    &row.Publisher,
+		"availability": &row.Availability,
+		"series":       &row.Series,
+	}
+
+	values := make(map[string]json.RawMessage, len(raw))
+	for column, value := range raw {
+		values[strings.ToLower(column)] = value
+	}
+
+	for _, column := range CatalogColumns {
+		value, ok := values[column]
+		if !ok || string(value) == "null" {
+			continue
+		}
+		if err := json.Unmarshal(value, targets[column]); err != nil {
+			errs = append(errs, RowError{Line: line, Field: column, Message: fmt.Sprintf("invalid value %s", value)})
+			continue
+		}
+		if column != "id" {
+			row.Fields[column] = true
+		}
+	}
+	row.ISBN = openlibrary.NormalizeISBN(row.ISBN)
+
+	return row, errs
+}
+
+// Validate checks the book the row makes of existing, nil for a new book,
+// with the same rules as the book form
+func (row *CatalogRow) Validate(existing *models.Book) []RowError {
+	var book models.Book
+	if existing != nil {
+		book = *existing
+	}
+	row.Apply(&book)
+
+	fieldErrs := ValidateBook(&book)
+	fields := make([]string, 0, len(fieldErrs))
+	for field := range fieldErrs {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+
+	var errs []RowError
+	for _, field := range fields {
+		errs = append(errs, RowError{Line: row.Line, Field: field, Message: fieldErrs[field]})
+	}
+	return errs
+}
+
+var validAvailability = map[string]bool{
+	models.BookInStock:     true,
+	models.BookOutOfStock:  true,
+	models.BookUnavailable: true,
+}
+
+// Apply copies the fields present in the row onto the book
+func (row *CatalogRow) Apply(book *models.Book) {
+	if row.Fields["isbn"] {
+		book.ISBN = row.ISBN
+	}
+	if row.Fields["title"] {
+		book.Title = row.Title
+	}
+	if row.Fields["author"] {
+		book.Author = row.Author
+	}
+	if row.Fields["description"] {
+		book.Description = row.Description
+	}
+	if row.Fields["category"] {
+		book.Category = row.Category
+	}
+	if row.Fields["trending"] {
+		book.Trending = row.Trending
+	}
+	if row.Fields["cover_image"] {
+		book.CoverImage = row.CoverImage
+	}
+	if row.Fields["old_price"] {
+		book.OldPrice = row.OldPrice
+	}
+	if row.Fields["new_price"] {
+		book.NewPrice = row.NewPrice
+	}
+	if row.Fields["weight"] {
+		book.Weight = row.Weight
+	}
+	if row.Fields["page_count"] {
+		book.PageCount = row.PageCount
+	}
+	if row.Fields["publisher"] {
+		book.Publisher = row.Publisher
+	}
+	if row.Fields["availability"] {
+		book.Availability = row.Availability
+	}
+	if row.Fields["series"] {
+		book.Series = row.Series
+	}
+}
+
+// Import upserts every row by ID, then by ISBN. With dryRun nothing is
+// written but the report shows what would be created, updated or rejected
+func (s *CatalogService) Import(rows []CatalogRow, parseErrors []RowError, dryRun bool, progress func()) *ImportReport {
+	report := &ImportReport{DryRun: dryRun, Total: len(rows) + countLines(parseErrors), Errors: parseErrors}
+	report.Failed = countLines(parseErrors)
+
+	for i := range rows {
+		row := &rows[i]
+		created, errs := s.upsertRow(row, dryRun)
+		if len(errs) > 0 {
+			report.Failed++
+			report.Errors = append(report.Errors, errs...)
+		} else if created {
+			report.Created++
+		} else {
+			report.Updated++
+		}
+
+		if progress != nil {
+			progress()
+		}
+	}
+
+	return report
+}
+
+func (s *CatalogService) upsertRow(row *CatalogRow, dryRun bool) (bool, []RowError) {
+	book, err := s.findExisting(row)
+	if err != nil {
+		return false, []RowError{{Line: row.Line, Message: err.Error()}}
+	}
+
+	isNew := book == nil
+	if errs := row.Validate(book); len(errs) > 0 {
+		return false, errs
+	}
+	if isNew {
+		book = &models.Book{}
+	}
+	row.Apply(book)
+
+	if dryRun {
+		return isNew, nil
+	}
+
+	if isNew {
+		err = s.bookRepo.CreateBook(book)
+	} else {
+		book.PriceSource = models.PriceChangeSource{Reason: models.PriceReasonImport}
+		err = s.bookRepo.UpdateBook(book)
+	}
+	if err != nil {
+		slog.Error("Error importing catalog row", "line", row.Line, "error", err)
+		return false, []RowError{{Line: row.Line, Message: err.Error()}}
+	}
+
+	return isNew, nil
+}
+
+// findExisting returns nil without error when the row describes a new book
+func (s *CatalogService) findExisting(row *CatalogRow) (*models.Book, error) {
+	if row.ID > 0 {
+		book, err := s.bookRepo.GetBookById(row.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("book with id %d not found", row.ID)
+		}
+		return book, err
+	}
+
+	if row.ISBN != "" {
+		book, err := s.bookRepo.GetBookByISBN(row.ISBN)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return book, err
+	}
+
+	return nil, nil
+}
+
+// StartImport runs the import in the background and returns the job to poll
+func (s *CatalogService) StartImport(rows []CatalogRow, parseErrors []RowError, dryRun bool) *ImportJob {
+	job := &ImportJob{
+		ID:        uuid.New().String(),
+		Status:    ImportJobRunning,
+		Total:     len(rows),
+		StartedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	s.pruneJobs(job.StartedAt)
+	s.jobs[job.ID] = job
+	s.mu.Unlock()
+
+	go func() {
+		report := s.Import(rows, parseErrors, dryRun, func() {
+			atomic.AddInt64(&job.Processed, 1)
+		})
+
+		finishedAt := time.Now()
+		s.mu.Lock()
+		job.Status = ImportJobCompleted
+		job.FinishedAt = &finishedAt
+		job.Report = report
+		s.mu.Unlock()
+
+		slog.Info("Catalog import finished", "job_id", job.ID, "created", report.Created, "updated", report.Updated, "failed", report.Failed)
+	}()
+
+	return job
+}
+
+// pruneJobs drops the jobs that finished more than importJobTTL ago, s.mu
+// must be held
+func (s *CatalogService) pruneJobs(now time.Time) {
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > importJobTTL {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// GetImportJob returns a snapshot of the job so callers never race the worker
+func (s *CatalogService) GetImportJob(id string) (*ImportJob, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, false
+	}
+
+	snapshot := *job
+	snapshot.Processed = atomic.LoadInt64(&job.Processed)
+	return &snapshot, true
+}
+
+// Export streams the whole catalog in batches so memory stays flat
+func (s *CatalogService) Export(format string, w io.Writer) error {
+	switch format {
+	case CatalogFormatCSV:
+		return s.exportCSV(w)
+	case CatalogFormatJSON:
+		return s.exportJSON(w)
+	case CatalogFormatONIX:
+		return s.exportONIX(w)
+	}
+	return fmt.Errorf("unsupported catalog format %q", format)
+}
+
+func (s *CatalogService) exportCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(CatalogColumns); err != nil {
+		return err
+	}
+
+	err := s.bookRepo.FindBooksInBatches(500, func(books []models.Book) error {
+		for _, book := range books {
+			record := []string{
+				strconv.FormatUint(uint64(book.ID), 10),
+				book.ISBN,
+				book.Title,
+				book.Author,
+				book.Description,
+				book.Category,
+				strconv.FormatBool(book.Trending),
+				book.CoverImage,
+				book.OldPrice.String(),
+				book.NewPrice.String(),
+				strconv.FormatInt(book.Weight, 10),
+				strconv.Itoa(book.PageCount),
+				book.Publisher,
+				book.Availability,
+				book.Series,
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (s *CatalogService) exportJSON(w io.Writer) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	first := true
+	err := s.bookRepo.FindBooksInBatches(500, func(books []models.Book) error {
+		for _, book := range books {
+			if !first {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			first = false
+
+			if err := encoder.Encode(CatalogRowFromBook(&book)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]\n")
+	return err
+}
+
+func CatalogRowFromBook(book *models.Book) CatalogRow {
+	return CatalogRow{
+		ID:           book.ID,
+		ISBN:         book.ISBN,
+		Title:        book.Title,
+		Author:       book.Author,
+		Description:  book.Description,
+		Category:     book.Category,
+		Trending:     book.Trending,
+		CoverImage:   book.CoverImage,
+		OldPrice:     book.OldPrice,
+		NewPrice:     book.NewPrice,
+		Weight:       book.Weight,
+		PageCount:    book.PageCount,
+		Publisher:    book.Publisher,
+		Availability: book.Availability,
+		Series:       book.Series,
+	}
+}
+
+// countLines counts distinct lines so a row with several bad fields fails once
+func countLines(rowErrors []RowError) int {
+	lines := make(map[int]bool)
+	for _, rowError := range rowErrors {
+		lines[rowError.Line] = true
+	}
+	return len(lines)
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/pkg/money"
+)
+
+var (
+	ErrCouponInactive      = errors.New("coupon is not active")
+	ErrCouponNotStarted    = errors.New("coupon is not valid yet")
+	ErrCouponExpired       = errors.New("coupon has expired")
+	ErrCouponMinSubtotal   = errors.New("order subtotal is below the coupon minimum")
+	ErrCouponNotApplicable = errors.New("coupon does not apply to these books")
+)
+
+var validCouponTypes = map[string]bool{
+	models.CouponPercentage:   true,
+	models.CouponFixed:        true,
+	models.CouponFreeShipping: true,
+}
+
+// NormalizeCouponCode makes codes case insensitive
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CouponInput is what admins send to create or replace a coupon
+type CouponInput struct {
+	Code         string      `json:"code"`
+	Description  string      `json:"description"`
+	Type         string      `json:"type"`
+	PercentOff   float64     `json:"percent_off"`
+	AmountOff    money.Money `json:"amount_off"`
+	MaxDiscount  money.Money `json:"max_discount"`
+	MinSubtotal  money.Money `json:"min_subtotal"`
+	StartsAt     *time.Time  `json:"starts_at"`
+	EndsAt       *time.Time  `json:"ends_at"`
+	UsageLimit   int         `json:"usage_limit"`
+	PerUserLimit int         `json:"per_user_limit"`
+	Categories   []string    `json:"categories"`
+	BookIDs      []uint      `json:"book_ids"`
+	Active       *bool       `json:"active"`
+}
+
+// Validate normalises the input and reports what is wrong with it
+func (in *CouponInput) Validate() FieldErrors {
+	errs := FieldErrors{}
+
+	in.Code = NormalizeCouponCode(in.Code)
+	in.Description = strings.TrimSpace(in.Description)
+	for i := range in.Categories {
+		in.Categories[i] = strings.TrimSpace(in.Categories[i])
+	}
+
+	if in.Code == "" {
+		errs["code"] = "is required"
+	} else if len(in.Code) > 50 || strings.ContainsAny(in.Code, " \t\n") {
+		errs["code"] = "must be at most 50 characters without spaces"
+	}
+	if len(in.Description) > 255 {
+		errs["description"] = "must be at most 255 characters"
+	}
+	switch {
+	case !validCouponTypes[in.Type]:
+		errs["type"] = "must be percentage, fixed or free_shipping"
+	case in.Type == models.CouponPercentage && (in.PercentOff <= 0 || in.PercentOff > 100):
+		errs["percent_off"] = "must be a percentage between 0 and 100"
+	case in.Type == models.CouponFixed && !in.AmountOff.IsPositive():
+		errs["amount_off"] = "must be positive"
+	}
+	if in.MaxDiscount.IsNegative() {
+		errs["max_discount"] = "must not be negative"
+	}
+	if in.MinSubtotal.IsNegative() {
+		errs["min_subtotal"] = "must not be negative"
+	}
+	if in.StartsAt != nil && in.EndsAt != nil && !in.EndsAt.After(*in.StartsAt) {
+		errs["ends_at"] = "must be after starts_at"
+	}
+	if in.UsageLimit < 0 {
+		errs["usage_limit"] = "must not be negative"
+	}
+	if in.PerUserLimit < 0 {
+		errs["per_user_limit"] = "must not be negative"
+	}
+
+	return errs
+}
+
+// Apply copies the input onto the coupon, active defaults to true
+func (in *CouponInput) Apply(coupon *models.Coupon) {
+	coupon.Code = in.Code
+	coupon.Description = in.Description
+	coupon.Type = in.Type
+	coupon.PercentOff, coupon.AmountOff = 0, money.Money{}
+	switch in.Type {
+	case models.CouponPercentage:
+		coupon.PercentOff = in.PercentOff
+	case models.CouponFixed:
+		coupon.AmountOff = in.AmountOff
+	}
+	coupon.MaxDiscount = in.MaxDiscount
+	coupon.MinSubtotal = in.MinSubtotal
+	coupon.StartsAt = in.StartsAt
+	coupon.EndsAt = in.EndsAt
+	coupon.UsageLimit = in.UsageLimit
+	coupon.PerUserLimit = in.PerUserLimit
+	coupon.Categories = in.Categories
+	coupon.BookIDs = in.BookIDs
+	coupon.Active = in.Active == nil || *in.Active
+}
+
+// CouponDiscount works out what the coupon takes off an order of the books
+// with the given shipping cost at time now. Percentage and fixed coupons
+// only discount the books they apply to, free shipping needs at least one of
+// them in the order. Usage limits are checked separately
+func CouponDiscount(coupon *models.Coupon, books []models.Book, shippingCost money.Money, now time.Time) (money.Money, error) {
+	if !coupon.Active {
+		return money.Money{}, ErrCouponInactive
+	}
+	if coupon.StartsAt != nil && now.Before(*coupon.StartsAt) {
+		return money.Money{}, ErrCouponNotStarted
+	}
+	if coupon.EndsAt != nil && !now.Before(*coupon.EndsAt) {
+		return money.Money{}, ErrCouponExpired
+	}
+
+	var subtotal, eligible money.Money
+	applies := false
+	for i := range books {
+		subtotal = subtotal.Add(books[i].NewPrice)
+		if couponAppliesTo(coupon, &books[i]) {
+			eligible = eligible.Add(books[i].NewPrice)
+			applies = true
+		}
+	}
+	if subtotal.Less(coupon.MinSubtotal) {
+		return money.Money{}, ErrCouponMinSubtotal
+	}
+	if !applies {
+		return money.Money{}, ErrCouponNotApplicable
+	}
+
+	var discount money.Money
+	switch coupon.Type {
+	case models.CouponPercentage:
+		discount = eligible.Percent(coupon.PercentOff)
+		if coupon.MaxDiscount.IsPositive() {
+			discount = money.Min(discount, coupon.MaxDiscount)
+		}
+	case models.CouponFixed:
+		discount = money.Min(coupon.AmountOff, eligible)
+	case models.CouponFreeShipping:
+		discount = shippingCost
+	}
+	return discount, nil
+}
+
+func couponAppliesTo(coupon *models.Coupon, book *models.Book) bool {
+	if len(coupon.Categories) == 0 && len(coupon.BookIDs) == 0 {
+		return true
+	}
+	for _, id := range coupon.BookIDs {
+		if id == book.ID {
+			return true
+		}
+	}
+	for _, category := range coupon.Categories {
+		if strings.EqualFold(category, book.Category) {
+			return true
+		}
+	}
+	return false
+}
+
+type CouponService struct {
+	couponRepo repositories.CouponRepository
+}
+
+func NewCouponService(repo repositories.CouponRepository) *CouponService {
+	return &CouponService{couponRepo: repo}
+}
+
+func (s *CouponService) GetCoupons(page, pageSize int) ([]models.Coupon, int, error) {
+	return s.couponRepo.GetCoupons(page, pageSize)
+}
+
+func (s *CouponService) GetCoupon(id uint) (*models.Coupon, error) {
+	return s.couponRepo.GetCoupon(id)
+}
+
+func (s *CouponService) CreateCoupon(input *CouponInput) (*models.Coupon, FieldErrors, error) {
+	if errs := input.Validate(); len(errs) > 0 {
+		return nil, errs, nil
+	}
+
+	coupon := &models.Coupon{}
+	input.Apply(coupon)
+	if err := s.couponRepo.CreateCoupon(coupon); err != nil {
+		return nil, nil, err
+	}
+	return coupon, nil, nil
+}
+
+// UpdateCoupon replaces the coupon's terms, the code cannot change
+func (s *CouponService) UpdateCoupon(id uint, input *CouponInput) (*models.Coupon, FieldErrors, error) {
+	coupon, err := s.couponRepo.GetCoupon(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	input.Code = coupon.Code
+	if errs := input.Validate(); len(errs) > 0 {
+		return nil, errs, nil
+	}
+
+	input.Apply(coupon)
+	if err := s.couponRepo.UpdateCoupon(coupon); err != nil {
+		return nil, nil, err
+	}
+	return coupon, nil, nil
+}
+
+func (s *CouponService) DeleteCoupon(id uint) error {
+	return s.couponRepo.DeleteCoupon(id)
+}
+
+func (s *CouponService) GetRedemptions(couponID uint, page, pageSize int) ([]models.CouponRedemption, int, error) {
+	if _, err := s.couponRepo.GetCoupon(couponID); err != nil {
+		return nil, 0, err
+	}
+	return s.couponRepo.GetRedemptions(couponID, page, pageSize)
+}
+
+func (s *CouponService) GetReports(from, to time.Time) ([]repositories.CouponReport, error) {
+	return s.couponRepo.GetCouponReports(from, to)
+}
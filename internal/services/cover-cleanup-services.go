@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/febriaricandra/book-shop/pkg/storage"
+)
+
+// reconcileGracePeriod protects objects uploaded by requests that have not
+// saved their book yet
+const reconcileGracePeriod = time.Hour
+
+// ReleaseCovers deletes the objects behind covers that were replaced or never
+// saved. Covers are keyed by content, so an object another book still uses is
+// kept. Failures are only logged, ReconcileCovers picks up whatever is left
+func (s *CoverService) ReleaseCovers(ctx context.Context, urls ...string) {
+	seen := map[string]bool{}
+	for _, url := range urls {
+		key, ok := s.store.KeyForURL(url)
+		if !ok || seen[key] {
+			// Not ours, e.g. a cover_image imported as an external URL
+			continue
+		}
+		seen[key] = true
+
+		referenced, err := s.bookRepo.IsCoverReferenced(url)
+		if err != nil {
+			slog.Error("Error checking cover references", "key", key, "error", err)
+			continue
+		}
+		if referenced {
+			continue
+		}
+
+		if err := s.store.Delete(ctx, key); err != nil {
+			slog.Error("Error deleting released cover", "key", key, "error", err)
+		}
+	}
+}
+
+type ReconcileReport struct {
+	DryRun     bool     `json:"dry_run"`
+	Scanned    int      `json:"scanned"`
+	Referenced int      `json:"referenced"`
+	Recent     int      `json:"recent"`
+	Orphaned   []string `json:"orphaned"`
+	Deleted    int      `json:"deleted"`
+	Errors     []string `json:"errors"`
+}
+
+// ReconcileCovers lists the bucket and deletes every object no book refers
+// to. Pending direct uploads and objects younger than an hour are left alone
+func (s *CoverService) ReconcileCovers(ctx context.Context, dryRun bool) (*ReconcileReport, error) {
+	report := &ReconcileReport{DryRun: dryRun, Orphaned: []string{}}
+
+	// Collect the references first, anything saved after this is recent
+	referenced := map[string]bool{}
+	err := s.bookRepo.FindCoverURLs(func(url string) {
+		if key, ok := s.store.KeyForURL(url); ok {
+			referenced[key] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-reconcileGracePeriod)
+	err = s.store.List(ctx, "", func(object storage.ObjectInfo) error {
+		report.Scanned++
+		switch {
+		case strings.HasPrefix(object.Key, coverUploadPrefix):
+			// Owned by CollectExpiredUploads
+		case referenced[object.Key]:
+			report.Referenced++
+		case object.LastModified.After(cutoff):
+			report.Recent++
+		default:
+			report.Orphaned = append(report.Orphaned, object.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	for _, key := range report.Orphaned {
+		if err := s.store.Delete(ctx, key); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		report.Deleted++
+	}
+	return report, nil
+}
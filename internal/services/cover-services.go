@@ -0,0 +1,141 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/media"
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/pkg/storage"
+)
+
+type CoverService struct {
+	bookRepo   repositories.BookRepository
+	uploadRepo repositories.UploadRepository
+	store      storage.ObjectStore
+	policy     media.UploadPolicy
+	httpClient *http.Client
+}
+
+func NewCoverService(repo repositories.BookRepository, uploadRepo repositories.UploadRepository, store storage.ObjectStore, policy media.UploadPolicy) *CoverService {
+	return &CoverService{bookRepo: repo, uploadRepo: uploadRepo, store: store, policy: policy, httpClient: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Policy returns the limits every cover is validated against
+func (s *CoverService) Policy() media.UploadPolicy {
+	return s.policy
+}
+
+// StoreCover validates an uploaded cover, processes it into every size and
+// format, uploads them and returns the detail JPEG URL along with the full set
+func (s *CoverService) StoreCover(ctx context.Context, r io.Reader) (string, models.CoverImageSet, error) {
+	data, err := s.policy.Validate(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	variants, err := media.ProcessCover(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, err
+	}
+
+	images := models.CoverImageSet{}
+	var written []string
+	for _, variant := range variants {
+		if err := s.store.Put(ctx, variant.Key, bytes.NewReader(variant.Data), variant.ContentType); err != nil {
+			// Nothing refers to the variants written so far, ReleaseCovers
+			// keeps those another book already uses for the same image
+			s.ReleaseCovers(context.WithoutCancel(ctx), written...)
+			return "", nil, fmt.Errorf("uploading %s: %w", variant.Key, err)
+		}
+		written = append(written, s.store.PublicURL(variant.Key))
+
+		urls := images[variant.Size]
+		switch variant.Format {
+		case media.FormatJPEG:
+			urls.JPEG = s.store.PublicURL(variant.Key)
+		case media.FormatWebP:
+			urls.WebP = s.store.PublicURL(variant.Key)
+		}
+		images[variant.Size] = urls
+	}
+
+	return images[media.DetailSize].JPEG, images, nil
+}
+
+type BackfillReport struct {
+	DryRun    bool     `json:"dry_run"`
+	Scanned   int      `json:"scanned"`
+	Processed int      `json:"processed"`
+	Failed    int      `json:"failed"`
+	Errors    []string `json:"errors"`
+}
+
+// BackfillCovers processes the cover of every book that has no variants yet
+// by downloading its current cover_image URL
+func (s *CoverService) BackfillCovers(ctx context.Context, dryRun bool) (*BackfillReport, error) {
+	report := &BackfillReport{DryRun: dryRun}
+
+	err := s.bookRepo.FindBooksInBatches(100, func(books []models.Book) error {
+		for i := range books {
+			book := &books[i]
+			report.Scanned++
+			if len(book.CoverImages) > 0 || book.CoverImage == "" {
+				continue
+			}
+			if dryRun {
+				report.Processed++
+				continue
+			}
+
+			if err := s.backfillBook(ctx, book); err != nil {
+				slog.Error("Error backfilling cover", "book_id", book.ID, "error", err)
+				report.Failed++
+				report.Errors = append(report.Errors, fmt.Sprintf("book %d: %v", book.ID, err))
+				continue
+			}
+			report.Processed++
+		}
+		return ctx.Err()
+	})
+
+	return report, err
+}
+
+func (s *CoverService) backfillBook(ctx context.Context, book *models.Book) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, book.CoverImage, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading cover: unexpected status %d", resp.StatusCode)
+	}
+
+	coverURL, images, err := s.StoreCover(ctx, resp.Body)
+	if err != nil {
+		return err
+	}
+
+	replaced := book.CoverURLs()
+	book.CoverImage = coverURL
+	book.CoverImages = images
+	if err := s.bookRepo.UpdateBook(book); err != nil {
+		s.ReleaseCovers(ctx, book.CoverURLs()...)
+		return err
+	}
+	s.ReleaseCovers(ctx, replaced...)
+	return nil
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/media"
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/pkg/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// coverPresignExpiry is how long the client has to start the PUT
+	coverPresignExpiry = 15 * time.Minute
+	// coverUploadTTL is how long an upload may wait for its confirm before it
+	// is garbage collected
+	coverUploadTTL = time.Hour
+	// coverUploadPrefix keeps unprocessed uploads apart from served covers
+	coverUploadPrefix = "incoming/"
+)
+
+var (
+	ErrUploadNotFound   = errors.New("upload not found")
+	ErrUploadExpired    = errors.New("upload has expired, request a new upload URL")
+	ErrUploadIncomplete = errors.New("the file has not been uploaded yet")
+	ErrUploadMismatch   = errors.New("the uploaded file does not match the requested size")
+)
+
+// PresignedCoverUpload tells the client where to PUT the cover and which
+// upload_id to confirm afterwards
+type PresignedCoverUpload struct {
+	UploadID string `json:"upload_id"`
+	*storage.PresignedRequest
+}
+
+// PresignCover reserves a direct-to-bucket upload for the book's cover. The
+// content type and length are signed, so the bucket rejects anything else
+func (s *CoverService) PresignCover(ctx context.Context, bookID uint, contentType string, contentLength int64) (*PresignedCoverUpload, error) {
+	if !s.policy.AllowsType(contentType) {
+		return nil, fmt.Errorf("%w %s, allowed: %v", media.ErrUnsupportedType, contentType, s.policy.AllowedTypes)
+	}
+	if contentLength <= 0 || contentLength > s.policy.MaxBytes {
+		return nil, fmt.Errorf("%w, the maximum is %d bytes", media.ErrTooLarge, s.policy.MaxBytes)
+	}
+	if _, err := s.bookRepo.GetBookById(bookID); err != nil {
+		return nil, err
+	}
+
+	upload := &models.CoverUpload{
+		ID:            uuid.New().String(),
+		BookID:        bookID,
+		ContentType:   contentType,
+		ContentLength: contentLength,
+		ExpiresAt:     time.Now().Add(coverUploadTTL),
+	}
+	upload.Key = coverUploadPrefix + upload.ID
+
+	signed, err := s.store.Presign(ctx, storage.PresignRequest{
+		Method:        http.MethodPut,
+		Key:           upload.Key,
+		ContentType:   contentType,
+		ContentLength: contentLength,
+		Expires:       coverPresignExpiry,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.uploadRepo.CreateUpload(upload); err != nil {
+		return nil, err
+	}
+
+	return &PresignedCoverUpload{UploadID: upload.ID, PresignedRequest: signed}, nil
+}
+
+// ConfirmCover checks the uploaded object, validates and processes it like a
+// regular upload and attaches the variants to the book
+func (s *CoverService) ConfirmCover(ctx context.Context, bookID uint, uploadID string) (*models.Book, error) {
+	upload, err := s.uploadRepo.GetUpload(uploadID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && upload.BookID != bookID) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+
+	body, info, err := s.store.Get(ctx, upload.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrUploadIncomplete
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	// Backends that cannot sign the length, or a swapped object, are caught here
+	if info.Size != upload.ContentLength {
+		return nil, ErrUploadMismatch
+	}
+
+	book, err := s.bookRepo.GetBookById(bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	replaced := book.CoverURLs()
+	book.CoverImage, book.CoverImages, err = s.StoreCover(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.bookRepo.UpdateBook(book); err != nil {
+		s.ReleaseCovers(ctx, book.CoverURLs()...)
+		return nil, err
+	}
+	s.ReleaseCovers(ctx, replaced...)
+
+	// The cover is attached, a leftover upload is collected later anyway
+	if err := s.discardUpload(ctx, upload); err != nil {
+		slog.Error("Error discarding confirmed upload", "upload_id", upload.ID, "error", err)
+	}
+
+	return book, nil
+}
+
+// CollectExpiredUploads deletes uploads that were never confirmed, together
+// with whatever the client managed to put in the bucket
+func (s *CoverService) CollectExpiredUploads(ctx context.Context) (int, error) {
+	collected := 0
+	for {
+		uploads, err := s.uploadRepo.GetExpiredUploads(time.Now(), 100)
+		if err != nil || len(uploads) == 0 {
+			return collected, err
+		}
+
+		for i := range uploads {
+			if err := s.discardUpload(ctx, &uploads[i]); err != nil {
+				return collected, err
+			}
+			collected++
+		}
+	}
+}
+
+func (s *CoverService) discardUpload(ctx context.Context, upload *models.CoverUpload) error {
+	if err := s.store.Delete(ctx, upload.Key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return s.uploadRepo.DeleteUpload(upload.ID)
+}
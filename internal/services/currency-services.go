@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/pkg/exchangerate"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnsupportedCurrency = errors.New("prices are not available in this currency")
+	ErrNoRateProvider      = errors.New("no exchange rate provider is configured")
+)
+
+// NormalizeCurrency makes currency codes case insensitive
+func NormalizeCurrency(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidCurrencyCode reports whether code looks like an ISO 4217 code
+func ValidCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// SetDisplayPrice adds the book's prices in the rate's currency, a nil rate
+// leaves them in the shop currency
+func SetDisplayPrice(book *models.Book, rate *models.ExchangeRate) {
+	if rate == nil {
+		return
+	}
+
+	display := &models.DisplayPrice{
+		Currency: rate.Currency,
+		Rate:     rate.Rate,
+		OldPrice: rate.Convert(book.OldPrice),
+		NewPrice: rate.Convert(book.NewPrice),
+	}
+	if book.LowestPrice30d != nil {
+		lowest := rate.Convert(*book.LowestPrice30d)
+		display.LowestPrice30d = &lowest
+	}
+	book.DisplayPrice = display
+}
+
+func SetDisplayPrices(books []models.Book, rate *models.ExchangeRate) {
+	for i := range books {
+		SetDisplayPrice(&books[i], rate)
+	}
+}
+
+// RateInput is what admins send to set a currency's rate, either a fixed
+// rate or automatic to follow the rate provider
+type RateInput struct {
+	Rate      float64 `json:"rate"`
+	Automatic bool    `json:"automatic"`
+}
+
+// RateRefreshReport sums up a refresh of the automatic rates
+type RateRefreshReport struct {
+	Updated int `json:"updated"`
+}
+
+type CurrencyService struct {
+	currencyRepo repositories.CurrencyRepository
+	userRepo     repositories.UserRepository
+	provider     exchangerate.Provider // nil when rates are only set by hand
+}
+
+func NewCurrencyService(currencyRepo repositories.CurrencyRepository, userRepo repositories.UserRepository, provider exchangerate.Provider) *CurrencyService {
+	return &CurrencyService{currencyRepo: currencyRepo, userRepo: userRepo, provider: provider}
+}
+
+func (s *CurrencyService) GetRates() ([]models.ExchangeRate, error) {
+	return s.currencyRepo.GetRates()
+}
+
+// SetRate fixes the currency's rate, or hands it to the rate provider. An
+// automatic rate is fetched before it is saved, so the currency is never
+// offered without a rate
+func (s *CurrencyService) SetRate(ctx context.Context, currency string, input *RateInput) (*models.ExchangeRate, FieldErrors, error) {
+	currency = NormalizeCurrency(currency)
+	errs := FieldErrors{}
+	switch {
+	case !ValidCurrencyCode(currency):
+		errs["currency"] = "must be a three letter ISO 4217 code"
+	case currency == money.DefaultCurrency:
+		errs["currency"] = "is the shop currency"
+	}
+	if !input.Automatic && input.Rate <= 0 {
+		errs["rate"] = "must be positive"
+	}
+	if len(errs) > 0 {
+		return nil, errs, nil
+	}
+
+	if input.Automatic && s.provider == nil {
+		return nil, nil, ErrNoRateProvider
+	}
+
+	rate := &models.ExchangeRate{Currency: currency, Rate: input.Rate, Manual: !input.Automatic}
+	if input.Automatic {
+		fetched, err := s.provider.Rates(ctx, money.DefaultCurrency, []string{currency})
+		if err != nil {
+			return nil, nil, err
+		}
+		if fetched[currency] <= 0 {
+			return nil, nil, fmt.Errorf("%w %s", exchangerate.ErrMissingRate, currency)
+		}
+		rate.Rate = 1 / fetched[currency]
+	}
+	if err := s.currencyRepo.SaveRate(rate); err != nil {
+		return nil, nil, err
+	}
+	return rate, nil, nil
+}
+
+// DeleteRate stops offering the currency, users who chose it see prices in
+// the shop currency again
+func (s *CurrencyService) DeleteRate(currency string) error {
+	currency = NormalizeCurrency(currency)
+	if err := s.currencyRepo.DeleteRate(currency); err != nil {
+		return err
+	}
+	return s.userRepo.ClearCurrency(currency)
+}
+
+// RefreshRates fetches the automatic rates from the rate provider
+func (s *CurrencyService) RefreshRates(ctx context.Context) (*RateRefreshReport, error) {
+	if s.provider == nil {
+		return nil, ErrNoRateProvider
+	}
+
+	automatic, err := s.currencyRepo.GetAutomaticRates()
+	if err != nil || len(automatic) == 0 {
+		return &RateRefreshReport{}, err
+	}
+	currencies := make([]string, len(automatic))
+	for i := range automatic {
+		currencies[i] = automatic[i].Currency
+	}
+
+	fetched, err := s.provider.Rates(ctx, money.DefaultCurrency, currencies)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RateRefreshReport{}
+	for _, currency := range currencies {
+		// The provider quotes what one unit of the shop currency buys, rates
+		// are kept the other way around
+		updated, err := s.currencyRepo.UpdateAutomaticRate(currency, 1/fetched[currency])
+		if err != nil {
+			return report, err
+		}
+		if updated {
+			report.Updated++
+		}
+	}
+	slog.Info("Refreshed exchange rates", "updated", report.Updated)
+	return report, nil
+}
+
+// DisplayRate picks the currency to show prices in: the one requested, else
+// the user's setting. It is nil for the shop currency. Only a requested
+// currency without a rate is an error, a saved one falls back to the shop
+// currency
+func (s *CurrencyService) DisplayRate(requested string, userID uint) (*models.ExchangeRate, error) {
+	currency := NormalizeCurrency(requested)
+	saved := false
+	if currency == "" && userID != 0 {
+		user, err := s.userRepo.GetUserById(userID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if user != nil {
+			currency, saved = user.Currency, true
+		}
+	}
+	if currency == "" || currency == money.DefaultCurrency {
+		return nil, nil
+	}
+
+	rate, err := s.currencyRepo.GetRate(currency)
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && rate.Rate <= 0 {
+		if saved {
+			return nil, nil
+		}
+		return nil, ErrUnsupportedCurrency
+	}
+	return rate, err
+}
+
+// SetUserCurrency saves the user's display currency, empty for the shop
+// currency
+func (s *CurrencyService) SetUserCurrency(userID uint, currency string) error {
+	currency = NormalizeCurrency(currency)
+	if currency == money.DefaultCurrency {
+		currency = ""
+	}
+	if currency != "" {
+		if _, err := s.DisplayRate(currency, 0); err != nil {
+			return err
+		}
+	}
+	return s.userRepo.UpdateUserCurrency(userID, currency)
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+)
+
+// MaxBookImages caps the gallery of a single book
+const MaxBookImages = 20
+
+var ErrGalleryFull = fmt.Errorf("a book can have at most %d images", MaxBookImages)
+
+type GalleryService struct {
+	imageRepo repositories.ImageRepository
+	bookRepo  repositories.BookRepository
+	covers    *CoverService
+}
+
+func NewGalleryService(imageRepo repositories.ImageRepository, bookRepo repositories.BookRepository, covers *CoverService) *GalleryService {
+	return &GalleryService{imageRepo: imageRepo, bookRepo: bookRepo, covers: covers}
+}
+
+// ImagePatch holds the editable fields of a gallery image, nil means unchanged
+type ImagePatch struct {
+	AltText   *string `json:"alt_text"`
+	IsPrimary *bool   `json:"is_primary"`
+}
+
+func (s *GalleryService) GetImages(bookID uint) ([]models.BookImage, error) {
+	if _, err := s.bookRepo.GetBookById(bookID); err != nil {
+		return nil, err
+	}
+	return s.imageRepo.GetImages(bookID)
+}
+
+// AddImage validates and processes the upload through the cover pipeline and
+// appends it to the book's gallery
+func (s *GalleryService) AddImage(ctx context.Context, bookID uint, r io.Reader, altText string, isPrimary bool) (*models.BookImage, error) {
+	if _, err := s.bookRepo.GetBookById(bookID); err != nil {
+		return nil, err
+	}
+	count, err := s.imageRepo.CountImages(bookID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= MaxBookImages {
+		return nil, ErrGalleryFull
+	}
+
+	image := &models.BookImage{BookID: bookID, AltText: altText, IsPrimary: isPrimary}
+	image.ImageURL, image.Images, err = s.covers.StoreCover(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.imageRepo.CreateImage(image); err != nil {
+		s.covers.ReleaseCovers(ctx, image.URLs()...)
+		return nil, err
+	}
+	return image, nil
+}
+
+func (s *GalleryService) UpdateImage(bookID, imageID uint, patch *ImagePatch) (*models.BookImage, error) {
+	image, err := s.imageRepo.GetImage(bookID, imageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.AltText != nil {
+		image.AltText = *patch.AltText
+	}
+	if patch.IsPrimary != nil {
+		image.IsPrimary = *patch.IsPrimary
+	}
+	if err := s.imageRepo.UpdateImage(image); err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+// ReorderImages sets the gallery order and returns the reordered gallery
+func (s *GalleryService) ReorderImages(bookID uint, imageIDs []uint) ([]models.BookImage, error) {
+	if err := s.imageRepo.ReorderImages(bookID, imageIDs); err != nil {
+		return nil, err
+	}
+	return s.imageRepo.GetImages(bookID)
+}
+
+// DeleteImage removes the image and its objects, unless the same file is
+// still used elsewhere
+func (s *GalleryService) DeleteImage(ctx context.Context, bookID, imageID uint) error {
+	image, err := s.imageRepo.GetImage(bookID, imageID)
+	if err != nil {
+		return err
+	}
+	if err := s.imageRepo.DeleteImage(image); err != nil {
+		return err
+	}
+
+	s.covers.ReleaseCovers(ctx, image.URLs()...)
+	return nil
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/invoice"
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/pkg/mail"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"gorm.io/gorm"
+)
+
+var ErrOrderNotPaid = errors.New("invoices are only issued for paid orders")
+
+type InvoiceService struct {
+	invoiceRepo repositories.InvoiceRepository
+	orderRepo   repositories.OrderRepository
+	mailer      mail.Sender
+	store       invoice.Store
+	prefix      string // put before the sequence number, e.g. INV-
+}
+
+func NewInvoiceService(invoiceRepo repositories.InvoiceRepository, orderRepo repositories.OrderRepository, mailer mail.Sender, store invoice.Store, prefix string) *InvoiceService {
+	return &InvoiceService{invoiceRepo: invoiceRepo, orderRepo: orderRepo, mailer: mailer, store: store, prefix: prefix}
+}
+
+// IssueInvoice gives a paid order the next invoice number, or returns the
+// invoice it already has
+func (s *InvoiceService) IssueInvoice(order *models.Order) (*models.Invoice, error) {
+	if !slices.Contains(models.SoldOrderStatuses, order.Status) {
+		return nil, ErrOrderNotPaid
+	}
+
+	inv, err := s.invoiceRepo.GetInvoiceByOrder(order.ID)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return inv, err
+	}
+	prices, err := s.prices(order)
+	if err != nil {
+		return nil, err
+	}
+	return s.invoiceRepo.IssueInvoice(order.ID, s.prefix, time.Now(), func(inv *models.Invoice) ([]byte, error) {
+		return s.render(inv, order, prices)
+	})
+}
+
+// InvoicePDF returns the order's invoice as it was issued, issuing it first
+// for orders paid before invoices were issued. Customers only get their own
+// orders
+func (s *InvoiceService) InvoicePDF(orderID, userID uint, admin bool) (*models.Invoice, []byte, error) {
+	order, err := s.orderRepo.GetOrderById(orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !admin && order.UserId != userID {
+		return nil, nil, gorm.ErrRecordNotFound
+	}
+
+	inv, err := s.IssueInvoice(order)
+	if err != nil {
+		return nil, nil, err
+	}
+	pdf, err := s.pdf(inv, order)
+	return inv, pdf, err
+}
+
+// SendInvoice emails the paid order's invoice to the customer
+func (s *InvoiceService) SendInvoice(ctx context.Context, order *models.Order) error {
+	inv, err := s.IssueInvoice(order)
+	if err != nil {
+		return err
+	}
+	pdf, err := s.pdf(inv, order)
+	if err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s,\n\nThank you for your payment. ", order.Name)
+	fmt.Fprintf(&body, "Your invoice %s for order #%d over %s is attached.\n", inv.Number, order.ID, invoice.Amount(order.TotalPrice))
+	fmt.Fprintf(&body, "\nHappy reading,\n%s\n", s.store.Name)
+
+	err = s.mailer.Send(ctx, &mail.Message{
+		To:      []string{order.Email},
+		Subject: fmt.Sprintf("Invoice %s from %s", inv.Number, s.store.Name),
+		Text:    body.String(),
+		Attachments: []mail.Attachment{
+			{Filename: inv.Number + ".pdf", ContentType: "application/pdf", Data: pdf},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return s.invoiceRepo.MarkInvoiceEmailed(inv.ID, time.Now())
+}
+
+// pdf returns the PDF kept with the invoice. Invoices issued before PDFs were
+// kept are rendered now and keep that PDF from then on
+func (s *InvoiceService) pdf(inv *models.Invoice, order *models.Order) ([]byte, error) {
+	if len(inv.PDF) > 0 {
+		return inv.PDF, nil
+	}
+	prices, err := s.prices(order)
+	if err != nil {
+		return nil, err
+	}
+	pdf, err := s.render(inv, order, prices)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.invoiceRepo.SaveInvoicePDF(inv.ID, pdf); err != nil {
+		return nil, err
+	}
+	inv.PDF = pdf
+	return pdf, nil
+}
+
+// prices returns the prices the order's books were ordered at by book ID
+func (s *InvoiceService) prices(order *models.Order) (map[uint]money.Money, error) {
+	orderBooks, err := s.orderRepo.GetOrderBooks(order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := map[uint]money.Money{}
+	var sum money.Money
+	for _, orderBook := range orderBooks {
+		prices[orderBook.BookID] = orderBook.Price
+		sum = sum.Add(orderBook.Price)
+	}
+	// Orders placed before the prices were kept per book have none
+	if sum.Cmp(order.Subtotal) != 0 {
+		return nil, nil
+	}
+	return prices, nil
+}
+
+func (s *InvoiceService) render(inv *models.Invoice, order *models.Order, prices map[uint]money.Money) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := invoice.Render(&buf, s.store, &invoice.Document{Invoice: inv, Order: order, Prices: prices}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,438 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/febriaricandra/book-shop/pkg/onix"
+	"github.com/febriaricandra/book-shop/pkg/openlibrary"
+)
+
+// parseCatalogONIX maps each ONIX Product onto a CatalogRow, Line is the
+// 1-based position of the Product in the message
+func parseCatalogONIX(r io.Reader) ([]CatalogRow, []RowError, error) {
+	reader := onix.NewReader(r)
+
+	var rows []CatalogRow
+	var rowErrors []RowError
+	for line := 1; ; line++ {
+		product, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading onix product %d: %w", line, err)
+		}
+
+		row, errs := catalogRowFromProduct(line, product)
+		if len(errs) > 0 {
+			rowErrors = append(rowErrors, errs...)
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, rowErrors, nil
+}
+
+func catalogRowFromProduct(line int, product *onix.Product) (CatalogRow, []RowError) {
+	row := CatalogRow{Line: line, Fields: make(map[string]bool)}
+	var errs []RowError
+	set := func(field string) { row.Fields[field] = true }
+
+	for _, identifier := range product.ProductIdentifiers {
+		if identifier.ProductIDType == onix.ProductIDISBN13 {
+			row.ISBN = openlibrary.NormalizeISBN(identifier.IDValue)
+			set("isbn")
+		}
+	}
+
+	detail := product.DescriptiveDetail
+	for _, titleDetail := range detail.TitleDetails {
+		if titleDetail.TitleType != onix.TitleDistinctive {
+			continue
+		}
+		for _, element := range titleDetail.TitleElements {
+			if element.TitleElementLevel != onix.TitleLevelProduct {
+				continue
+			}
+			row.Title = element.Title()
+			if element.Subtitle != "" {
+				row.Title = fmt.Sprintf("%s: %s", row.Title, strings.TrimSpace(element.Subtitle))
+			}
+			set("title")
+		}
+	}
+
+	// The series is the publisher collection, its title may also be given as
+	// a collection level element of the product title
+	for _, collection := range detail.Collections {
+		if collection.CollectionType != onix.CollectionPublisher {
+			continue
+		}
+		if series := collectionTitle(collection.TitleDetails); series != "" {
+			row.Series = series
+			set("series")
+		}
+	}
+	if !row.Fields["series"] {
+		if series := collectionTitle(detail.TitleDetails); series != "" {
+			row.Series = series
+			set("series")
+		}
+	}
+
+	if authors := contributorNames(detail.Contributors); len(authors) > 0 {
+		row.Author = strings.Join(authors, ", ")
+		set("author")
+	}
+
+	for _, extent := range detail.Extents {
+		if extent.ExtentType == onix.ExtentMainContentPages && extent.ExtentUnit == onix.ExtentUnitPages {
+			pages, err := strconv.Atoi(strings.TrimSpace(extent.ExtentValue))
+			if err != nil {
+				errs = append(errs, RowError{Line: line, Field: "page_count", Message: fmt.Sprintf("invalid value %q", extent.ExtentValue)})
+				continue
+			}
+			row.PageCount = pages
+			set("page_count")
+		}
+	}
+
+	for _, measure := range detail.Measures {
+		if measure.MeasureType != onix.MeasureUnitWeight {
+			continue
+		}
+		grams, err := weightInGrams(measure.Measurement, measure.MeasureUnitCode)
+		if err != nil {
+			errs = append(errs, RowError{Line: line, Field: "weight", Message: err.Error()})
+			continue
+		}
+		row.Weight = grams
+		set("weight")
+	}
+
+	if category := mainSubject(detail.Subjects); category != "" {
+		row.Category = category
+		set("category")
+	}
+
+	if product.CollateralDetail != nil {
+		for _, text := range product.CollateralDetail.TextContents {
+			if text.TextType == onix.TextDescription {
+				row.Description = strings.TrimSpace(text.Text)
+				set("description")
+			}
+		}
+		for _, resource := range product.CollateralDetail.SupportingResources {
+			if resource.ResourceContentType != onix.ResourceFrontCover || resource.ResourceMode != onix.ResourceModeImage {
+				continue
+			}
+			for _, version := range resource.ResourceVersions {
+				if version.ResourceForm == onix.ResourceFormLink && version.ResourceLink != "" {
+					row.CoverImage = strings.TrimSpace(version.ResourceLink)
+					set("cover_image")
+				}
+			}
+		}
+	}
+
+	if product.PublishingDetail != nil {
+		for _, publisher := range product.PublishingDetail.Publishers {
+			if publisher.PublishingRole == onix.PublishingRolePublisher {
+				row.Publisher = strings.TrimSpace(publisher.PublisherName)
+				set("publisher")
+			}
+		}
+	}
+
+	if len(product.ProductSupply) > 0 && len(product.ProductSupply[0].SupplyDetails) > 0 {
+		supply := product.ProductSupply[0].SupplyDetails[0]
+		if supply.ProductAvailability != "" {
+			row.Availability = availabilityFromONIX(supply.ProductAvailability)
+			set("availability")
+		}
+
+		if price, ok := catalogPrice(supply.Prices); ok {
+			amount, err := money.Parse(price.PriceAmount, money.DefaultCurrency)
+			if err != nil {
+				errs = append(errs, RowError{Line: line, Field: "new_price", Message: fmt.Sprintf("invalid value %q", price.PriceAmount)})
+			} else {
+				// ONIX carries a single list price, it becomes both prices
+				row.OldPrice, row.NewPrice = amount, amount
+				set("old_price")
+				set("new_price")
+			}
+		}
+	}
+
+	if product.NotificationType == onix.NotificationDelete {
+		row.Availability = models.BookUnavailable
+		set("availability")
+	}
+
+	return row, errs
+}
+
+// contributorNames returns the authors in sequence order, or every
+// contributor when the record has no author role
+func contributorNames(contributors []onix.Contributor) []string {
+	sorted := make([]onix.Contributor, len(contributors))
+	copy(sorted, contributors)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, _ := strconv.Atoi(sorted[i].SequenceNumber)
+		b, _ := strconv.Atoi(sorted[j].SequenceNumber)
+		return a < b
+	})
+
+	var authors, others []string
+	for _, contributor := range sorted {
+		name := contributor.Name()
+		if name == "" {
+			continue
+		}
+		isAuthor := false
+		for _, role := range contributor.ContributorRoles {
+			if role == onix.ContributorAuthor {
+				isAuthor = true
+			}
+		}
+		if isAuthor {
+			authors = append(authors, name)
+		} else {
+			others = append(others, name)
+		}
+	}
+
+	if len(authors) > 0 {
+		return authors
+	}
+	return others
+}
+
+// collectionTitle is the distinctive collection level title, if any
+func collectionTitle(titleDetails []onix.TitleDetail) string {
+	for _, titleDetail := range titleDetails {
+		if titleDetail.TitleType != onix.TitleDistinctive {
+			continue
+		}
+		for _, element := range titleDetail.TitleElements {
+			if element.TitleElementLevel == onix.TitleLevelCollection {
+				return element.Title()
+			}
+		}
+	}
+	return ""
+}
+
+// mainSubject prefers the subject flagged MainSubject and its heading text
+// over a bare subject code
+func mainSubject(subjects []onix.Subject) string {
+	var fallback string
+	for _, subject := range subjects {
+		label := strings.TrimSpace(subject.SubjectHeadingText)
+		if label == "" {
+			label = strings.TrimSpace(subject.SubjectCode)
+		}
+		if label == "" {
+			continue
+		}
+		if subject.MainSubject != nil {
+			return label
+		}
+		if fallback == "" {
+			fallback = label
+		}
+	}
+	return fallback
+}
+
+func weightInGrams(measurement, unit string) (int64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(measurement), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", measurement)
+	}
+
+	factors := map[string]float64{"gr": 1, "kg": 1000, "oz": 28.3495, "lb": 453.592}
+	factor, ok := factors[strings.ToLower(unit)]
+	if !ok {
+		return 0, fmt.Errorf("unsupported weight unit %q", unit)
+	}
+	return int64(value*factor + 0.5), nil
+}
+
+func availabilityFromONIX(code string) string {
+	switch {
+	case code >= "20" && code < "30":
+		return models.BookInStock
+	case code >= "30" && code < "40":
+		return models.BookOutOfStock
+	}
+	return models.BookUnavailable
+}
+
+func availabilityToONIX(availability string) string {
+	switch availability {
+	case models.BookOutOfStock:
+		return onix.AvailabilityOutOfStock
+	case models.BookUnavailable:
+		return onix.AvailabilityWithdrawn
+	}
+	return onix.AvailabilityInStock
+}
+
+// catalogPrice picks the consumer price in the shop currency, preferring
+// the tax inclusive RRP
+func catalogPrice(prices []onix.Price) (onix.Price, bool) {
+	var found *onix.Price
+	for i := range prices {
+		price := &prices[i]
+		if price.CurrencyCode != "" && price.CurrencyCode != money.DefaultCurrency {
+			continue
+		}
+		if price.PriceType == onix.PriceRRPIncludingTax {
+			return *price, true
+		}
+		if found == nil {
+			found = price
+		}
+	}
+	if found == nil {
+		return onix.Price{}, false
+	}
+	return *found, true
+}
+
+func (s *CatalogService) exportONIX(w io.Writer) error {
+	writer, err := onix.NewWriter(w, onix.Header{
+		SenderName:   s.sender,
+		SentDateTime: time.Now().Format("20060102T1504-0700"),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.bookRepo.FindBooksInBatches(500, func(books []models.Book) error {
+		for i := range books {
+			if err := writer.WriteProduct(ProductFromBook(&books[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+// ProductFromBook builds the ONIX Product record we syndicate for a book
+func ProductFromBook(book *models.Book) *onix.Product {
+	product := &onix.Product{
+		RecordReference:  fmt.Sprintf("book-%d", book.ID),
+		NotificationType: onix.NotificationConfirmed,
+		ProductIdentifiers: []onix.ProductIdentifier{
+			{ProductIDType: onix.ProductIDProprietary, IDValue: strconv.FormatUint(uint64(book.ID), 10)},
+		},
+		DescriptiveDetail: onix.DescriptiveDetail{
+			ProductComposition: "00",
+			ProductForm:        "BA",
+			TitleDetails: []onix.TitleDetail{{
+				TitleType:     onix.TitleDistinctive,
+				TitleElements: []onix.TitleElement{{TitleElementLevel: onix.TitleLevelProduct, TitleText: book.Title}},
+			}},
+		},
+	}
+
+	if len(book.ISBN) == 13 {
+		product.ProductIdentifiers = append(product.ProductIdentifiers, onix.ProductIdentifier{ProductIDType: onix.ProductIDISBN13, IDValue: book.ISBN})
+	}
+
+	detail := &product.DescriptiveDetail
+	if book.Series != "" {
+		detail.Collections = append(detail.Collections, onix.Collection{
+			CollectionType: onix.CollectionPublisher,
+			TitleDetails: []onix.TitleDetail{{
+				TitleType:     onix.TitleDistinctive,
+				TitleElements: []onix.TitleElement{{TitleElementLevel: onix.TitleLevelCollection, TitleText: book.Series}},
+			}},
+		})
+	}
+	if book.Weight > 0 {
+		detail.Measures = append(detail.Measures, onix.Measure{
+			MeasureType:     onix.MeasureUnitWeight,
+			Measurement:     strconv.FormatInt(book.Weight, 10),
+			MeasureUnitCode: "gr",
+		})
+	}
+	if book.Author != "" {
+		for i, name := range strings.Split(book.Author, ",") {
+			detail.Contributors = append(detail.Contributors, onix.Contributor{
+				SequenceNumber:   strconv.Itoa(i + 1),
+				ContributorRoles: []string{onix.ContributorAuthor},
+				PersonName:       strings.TrimSpace(name),
+			})
+		}
+	}
+	if book.PageCount > 0 {
+		detail.Extents = append(detail.Extents, onix.Extent{
+			ExtentType:  onix.ExtentMainContentPages,
+			ExtentValue: strconv.Itoa(book.PageCount),
+			ExtentUnit:  onix.ExtentUnitPages,
+		})
+	}
+	if book.Category != "" {
+		detail.Subjects = append(detail.Subjects, onix.Subject{
+			MainSubject:             &struct{}{},
+			SubjectSchemeIdentifier: onix.SubjectKeywords,
+			SubjectHeadingText:      book.Category,
+		})
+	}
+
+	collateral := &onix.CollateralDetail{}
+	if book.Description != "" {
+		collateral.TextContents = append(collateral.TextContents, onix.TextContent{
+			TextType:        onix.TextDescription,
+			ContentAudience: "00",
+			Text:            book.Description,
+		})
+	}
+	if book.CoverImage != "" {
+		collateral.SupportingResources = append(collateral.SupportingResources, onix.SupportingResource{
+			ResourceContentType: onix.ResourceFrontCover,
+			ContentAudience:     "00",
+			ResourceMode:        onix.ResourceModeImage,
+			ResourceVersions:    []onix.ResourceVersion{{ResourceForm: onix.ResourceFormLink, ResourceLink: book.CoverImage}},
+		})
+	}
+	if len(collateral.TextContents) > 0 || len(collateral.SupportingResources) > 0 {
+		product.CollateralDetail = collateral
+	}
+
+	if book.Publisher != "" {
+		product.PublishingDetail = &onix.PublishingDetail{
+			Publishers: []onix.Publisher{{PublishingRole: onix.PublishingRolePublisher, PublisherName: book.Publisher}},
+		}
+	}
+
+	product.ProductSupply = []onix.ProductSupply{{
+		SupplyDetails: []onix.SupplyDetail{{
+			Supplier:            onix.Supplier{SupplierRole: onix.SupplierUnspecified},
+			ProductAvailability: availabilityToONIX(book.Availability),
+			Prices: []onix.Price{{
+				PriceType:    onix.PriceRRPIncludingTax,
+				PriceAmount:  book.NewPrice.Decimal(),
+				CurrencyCode: money.DefaultCurrency,
+			}},
+		}},
+	}}
+
+	return product
+}
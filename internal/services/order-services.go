@@ -1,16 +1,273 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
 	"github.com/febriaricandra/book-shop/internal/models"
 	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidOrderTransition = errors.New("invalid order status transition")
+	ErrEmptyOrder             = errors.New("an order needs at least one book")
+	ErrOrderBookUnavailable   = errors.New("some books do not exist or can no longer be ordered")
+	ErrInvalidCoupon          = errors.New("coupon code is not valid")
+	ErrNegativeShippingCost   = errors.New("shipping cost must not be negative")
 )
 
+// orderTransitions lists the statuses an order may move to from each status,
+// delivered and cancelled orders are final
+var orderTransitions = map[string][]string{
+	models.OrderPending: {models.OrderPaid, models.OrderCancelled},
+	models.OrderPaid:    {models.OrderShipped, models.OrderCancelled},
+	models.OrderShipped: {models.OrderDelivered},
+}
+
+// CanTransitionOrder reports whether an order may move from one status to another
+func CanTransitionOrder(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
 type OrderService struct {
-	orderRepo repositories.OrderRepository
+	orderRepo  repositories.OrderRepository
+	bookRepo   repositories.BookRepository
+	couponRepo repositories.CouponRepository
+	taxRepo    repositories.TaxRepository
+	taxPolicy  models.TaxPolicy
+	shipping   *ShippingService
+	invoices   *InvoiceService
+}
+
+func NewOrderService(repo repositories.OrderRepository, bookRepo repositories.BookRepository, couponRepo repositories.CouponRepository, taxRepo repositories.TaxRepository, taxPolicy models.TaxPolicy, shipping *ShippingService, invoices *InvoiceService) *OrderService {
+	return &OrderService{orderRepo: repo, bookRepo: bookRepo, couponRepo: couponRepo, taxRepo: taxRepo, taxPolicy: taxPolicy, shipping: shipping, invoices: invoices}
+}
+
+// OrderPricing is how the total of an order is made up, in the shop
+// currency, with the total in the customer's display currency
+type OrderPricing struct {
+	Subtotal        money.Money       `json:"subtotal"`
+	ShippingCost    money.Money       `json:"shipping_cost"`
+	Discount        money.Money       `json:"discount"`
+	CouponCode      string            `json:"coupon_code,omitempty"`
+	Tax             money.Money       `json:"tax"`
+	TaxMode         string            `json:"tax_mode"`
+	Taxes           []models.OrderTax `json:"taxes"`
+	Total           money.Money       `json:"total"`
+	Currency        string            `json:"currency"`
+	DisplayCurrency string            `json:"display_currency"`
+	ExchangeRate    float64           `json:"exchange_rate"`
+	DisplayTotal    money.Money       `json:"display_total"`
+}
+
+// setDisplay converts the total at the display rate, nil for the shop
+// currency
+func (p *OrderPricing) setDisplay(display *models.ExchangeRate) {
+	p.Currency = money.DefaultCurrency
+	p.DisplayCurrency, p.ExchangeRate, p.DisplayTotal = money.DefaultCurrency, 1, p.Total
+	if display != nil {
+		p.DisplayCurrency, p.ExchangeRate, p.DisplayTotal = display.Currency, display.Rate, display.Convert(p.Total)
+	}
+}
+
+// QuoteOrder prices the books with the shipping quote, if any, and applies the
+// coupon without placing the order, e.g. when a coupon is entered at checkout
+func (s *OrderService) QuoteOrder(userID uint, bookIDs []uint, shippingQuoteID string, couponCode string, display *models.ExchangeRate) (*OrderPricing, error) {
+	var shippingCost money.Money
+	if shippingQuoteID != "" {
+		quote, err := s.shipping.VerifyQuote(shippingQuoteID, userID, bookIDs)
+		if err != nil {
+			return nil, err
+		}
+		shippingCost = quote.Cost
+	}
+
+	pricing, _, _, err := s.priceOrder(userID, bookIDs, shippingCost, couponCode)
+	if err != nil {
+		return nil, err
+	}
+	pricing.setDisplay(display)
+	return pricing, nil
+}
+
+// PlaceOrder prices the order from the current book prices, the shipping
+// quote and the coupon, then saves it with its books and the display
+// currency's rate. The shipping and destination city come from the quote,
+// whatever the client sent
+func (s *OrderService) PlaceOrder(order *models.Order, bookIDs []uint, couponCode string, shippingQuoteID string, display *models.ExchangeRate) error {
+	quote, err := s.shipping.VerifyQuote(shippingQuoteID, order.UserId, bookIDs)
+	if err != nil {
+		return err
+	}
+	order.Shipping = models.Shipping{
+		ShippingType:    quote.Courier,
+		ShippingService: quote.Service,
+		ShippingCost:    quote.Cost,
+		ShippingWeight:  quote.Weight,
+		ShippingETD:     quote.ETD,
+	}
+	order.Address.CityID = quote.Destination
+	order.Address.City = quote.City
+	order.Address.Province = quote.Province
+
+	pricing, books, coupon, err := s.priceOrder(order.UserId, bookIDs, quote.Cost, couponCode)
+	if err != nil {
+		return err
+	}
+
+	order.Subtotal = pricing.Subtotal
+	order.Discount = pricing.Discount
+	order.CouponCode = pricing.CouponCode
+	order.Tax = pricing.Tax
+	order.TaxMode = pricing.TaxMode
+	order.Taxes = pricing.Taxes
+	order.TotalPrice = pricing.Total
+	pricing.setDisplay(display)
+	order.Currency = pricing.Currency
+	order.DisplayCurrency = pricing.DisplayCurrency
+	order.ExchangeRate = pricing.ExchangeRate
+
+	orderBooks := make([]models.OrderBook, len(books))
+	for i := range books {
+		orderBooks[i] = models.OrderBook{BookID: books[i].ID, Price: books[i].NewPrice}
+	}
+
+	var redemption *models.CouponRedemption
+	if coupon != nil {
+		redemption = &models.CouponRedemption{CouponID: coupon.ID, UserID: order.UserId, Discount: pricing.Discount}
+	}
+	if err := s.orderRepo.PlaceOrder(order, orderBooks, redemption); err != nil {
+		return err
+	}
+	order.Books = books
+	return nil
 }
 
-func NewOrderService(repo repositories.OrderRepository) *OrderService {
-	return &OrderService{orderRepo: repo}
+func (s *OrderService) priceOrder(userID uint, bookIDs []uint, shippingCost money.Money, couponCode string) (*OrderPricing, []models.Book, *models.Coupon, error) {
+	if shippingCost.IsNegative() {
+		return nil, nil, nil, ErrNegativeShippingCost
+	}
+
+	// An order holds each book once
+	seen := map[uint]bool{}
+	ids := make([]uint, 0, len(bookIDs))
+	for _, id := range bookIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil, nil, ErrEmptyOrder
+	}
+
+	books, err := s.bookRepo.GetBooksByIds(ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(books) != len(ids) {
+		return nil, nil, nil, ErrOrderBookUnavailable
+	}
+
+	pricing := &OrderPricing{ShippingCost: shippingCost}
+	for i := range books {
+		if books[i].Availability == models.BookUnavailable {
+			return nil, nil, nil, ErrOrderBookUnavailable
+		}
+		pricing.Subtotal = pricing.Subtotal.Add(books[i].NewPrice)
+	}
+
+	var coupon *models.Coupon
+	if code := NormalizeCouponCode(couponCode); code != "" {
+		coupon, err = s.couponRepo.GetCouponByCode(code)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil, ErrInvalidCoupon
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		pricing.Discount, err = CouponDiscount(coupon, books, shippingCost, time.Now())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if err := s.checkCouponLimits(coupon, userID); err != nil {
+			return nil, nil, nil, err
+		}
+		pricing.CouponCode = coupon.Code
+	}
+
+	if err := s.taxOrder(pricing, books, coupon); err != nil {
+		return nil, nil, nil, err
+	}
+
+	pricing.Total = pricing.Subtotal.Add(pricing.ShippingCost).Sub(pricing.Discount)
+	if pricing.TaxMode == models.TaxExclusive {
+		pricing.Total = pricing.Total.Add(pricing.Tax)
+	}
+	return pricing, books, coupon, nil
+}
+
+// taxOrder adds the tax lines of the books after the coupon's discount, spread
+// over the books it applies to. Shipping is not taxed, so free shipping does
+// not change the tax
+func (s *OrderService) taxOrder(pricing *OrderPricing, books []models.Book, coupon *models.Coupon) error {
+	rates, err := s.taxRepo.GetTaxRates()
+	if err != nil {
+		return err
+	}
+
+	var discounted []int
+	var amounts []money.Money
+	items := make([]TaxableItem, len(books))
+	for i := range books {
+		items[i] = TaxableItem{Category: books[i].Category, Amount: books[i].NewPrice}
+		if coupon != nil && coupon.Type != models.CouponFreeShipping && couponAppliesTo(coupon, &books[i]) {
+			discounted = append(discounted, i)
+			amounts = append(amounts, books[i].NewPrice)
+		}
+	}
+	for j, amount := range SpreadDiscount(amounts, pricing.Discount) {
+		items[discounted[j]].Amount = amount
+	}
+
+	pricing.TaxMode = s.taxPolicy.Mode
+	pricing.Taxes = ComputeTaxes(items, s.taxPolicy, rates)
+	pricing.Tax = money.Money{}
+	for i := range pricing.Taxes {
+		pricing.Tax = pricing.Tax.Add(pricing.Taxes[i].Tax)
+	}
+	return nil
+}
+
+// checkCouponLimits tells early when a coupon is used up, the order
+// repository checks again when the order is placed
+func (s *OrderService) checkCouponLimits(coupon *models.Coupon, userID uint) error {
+	if coupon.UsageLimit > 0 && coupon.UsedCount >= coupon.UsageLimit {
+		return repositories.ErrCouponUsedUp
+	}
+	if coupon.PerUserLimit == 0 {
+		return nil
+	}
+
+	used, err := s.couponRepo.CountUserRedemptions(coupon.ID, userID)
+	if err != nil {
+		return err
+	}
+	if used >= coupon.PerUserLimit {
+		return repositories.ErrCouponUserLimit
+	}
+	return nil
 }
 
 func (s *OrderService) CreateOrder(order *models.Order) (uint, error) {
@@ -40,3 +297,42 @@ func (s *OrderService) CreateOrderBook(orderId uint, bookId uint) error {
 func (s *OrderService) GetOrdersForUser(userId uint) ([]models.Order, error) {
 	return s.orderRepo.GetOrdersForUser(userId)
 }
+
+// UpdateOrderStatus moves the order along its lifecycle, e.g. to delivered
+// once the courier confirms it. Paid orders are invoiced
+func (s *OrderService) UpdateOrderStatus(id uint, status string) (*models.Order, error) {
+	order, err := s.orderRepo.GetOrderById(id)
+	if err != nil {
+		return nil, err
+	}
+	if !CanTransitionOrder(order.Status, status) {
+		return nil, fmt.Errorf("%w from %s to %s", ErrInvalidOrderTransition, order.Status, status)
+	}
+
+	if err := s.orderRepo.UpdateOrderStatus(id, order.Status, status); err != nil {
+		return nil, err
+	}
+	order.Status = status
+	if status == models.OrderPaid {
+		s.invoicePaidOrder(order)
+	}
+	return order, nil
+}
+
+// invoicePaidOrder numbers the order's invoice right away and emails it in
+// the background. Failures are only logged, the invoice is issued when it is
+// downloaded if it was not before
+func (s *OrderService) invoicePaidOrder(order *models.Order) {
+	if _, err := s.invoices.IssueInvoice(order); err != nil {
+		slog.Error("Failed to issue invoice", "order_id", order.ID, "error", err)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := s.invoices.SendInvoice(ctx, order); err != nil {
+			slog.Error("Failed to email invoice", "order_id", order.ID, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/pkg/money"
+)
+
+// LowestPriceWindow is how far back the lowest price shown next to a book
+// looks, consumer rules require 30 days before a discount
+const LowestPriceWindow = 30 * 24 * time.Hour
+
+var ErrPriceRuleFinished = errors.New("price rule has already ended or was cancelled")
+
+var validPriceRuleStatuses = map[string]bool{
+	models.PriceRuleScheduled: true,
+	models.PriceRuleActive:    true,
+	models.PriceRuleEnded:     true,
+	models.PriceRuleCancelled: true,
+}
+
+// PriceRuleInput is what admins send to schedule a sale, for either a book
+// or a category, at either a sale price or a percentage off
+type PriceRuleInput struct {
+	Name       string      `json:"name"`
+	BookID     *uint       `json:"book_id"`
+	Category   string      `json:"category"`
+	SalePrice  money.Money `json:"sale_price"`
+	PercentOff float64     `json:"percent_off"`
+	StartsAt   time.Time   `json:"starts_at"`
+	EndsAt     time.Time   `json:"ends_at"`
+}
+
+// Validate normalises the input and reports what is wrong with it, now is
+// the time the rule is saved
+func (in *PriceRuleInput) Validate(now time.Time) FieldErrors {
+	errs := FieldErrors{}
+
+	in.Name = strings.TrimSpace(in.Name)
+	in.Category = strings.TrimSpace(in.Category)
+
+	if in.Name == "" {
+		errs["name"] = "is required"
+	} else if len(in.Name) > 255 {
+		errs["name"] = "must be at most 255 characters"
+	}
+	if (in.BookID == nil) == (in.Category == "") {
+		errs["book_id"] = "set either book_id or category"
+	}
+	switch {
+	case in.SalePrice.IsPositive() == (in.PercentOff > 0):
+		errs["sale_price"] = "set either sale_price or percent_off"
+	case in.SalePrice.IsNegative():
+		errs["sale_price"] = "must not be negative"
+	case in.PercentOff < 0 || in.PercentOff >= 100:
+		errs["percent_off"] = "must be between 0 and 100"
+	}
+	if in.StartsAt.IsZero() {
+		errs["starts_at"] = "is required"
+	}
+	if !in.EndsAt.After(in.StartsAt) {
+		errs["ends_at"] = "must be after starts_at"
+	} else if !in.EndsAt.After(now) {
+		errs["ends_at"] = "must be in the future"
+	}
+
+	return errs
+}
+
+func (in *PriceRuleInput) apply(rule *models.PriceRule) {
+	rule.Name = in.Name
+	rule.BookID = in.BookID
+	rule.Category = in.Category
+	rule.SalePrice = in.SalePrice
+	rule.PercentOff = in.PercentOff
+	rule.StartsAt = in.StartsAt
+	rule.EndsAt = in.EndsAt
+}
+
+type PriceService struct {
+	priceRepo repositories.PriceRepository
+	bookRepo  repositories.BookRepository
+}
+
+func NewPriceService(priceRepo repositories.PriceRepository, bookRepo repositories.BookRepository) *PriceService {
+	return &PriceService{priceRepo: priceRepo, bookRepo: bookRepo}
+}
+
+func (s *PriceService) GetPriceRules(status string, page, pageSize int) ([]models.PriceRule, int, FieldErrors, error) {
+	if status != "" && !validPriceRuleStatuses[status] {
+		return nil, 0, FieldErrors{"status": "must be scheduled, active, ended or cancelled"}, nil
+	}
+	rules, total, err := s.priceRepo.GetPriceRules(status, page, pageSize)
+	return rules, total, nil, err
+}
+
+func (s *PriceService) GetPriceRule(id uint) (*models.PriceRule, error) {
+	return s.priceRepo.GetPriceRule(id)
+}
+
+func (s *PriceService) CreatePriceRule(input *PriceRuleInput, userID uint) (*models.PriceRule, FieldErrors, error) {
+	if errs, err := s.validate(input); len(errs) > 0 || err != nil {
+		return nil, errs, err
+	}
+
+	rule := &models.PriceRule{Status: models.PriceRuleScheduled, CreatedBy: userID}
+	input.apply(rule)
+	if err := s.priceRepo.CreatePriceRule(rule); err != nil {
+		return nil, nil, err
+	}
+	return rule, nil, nil
+}
+
+// UpdatePriceRule changes a rule that has not started yet
+func (s *PriceService) UpdatePriceRule(id uint, input *PriceRuleInput) (*models.PriceRule, FieldErrors, error) {
+	rule, err := s.priceRepo.GetPriceRule(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rule.Status != models.PriceRuleScheduled {
+		return nil, nil, repositories.ErrPriceRuleStatusChanged
+	}
+	if errs, err := s.validate(input); len(errs) > 0 || err != nil {
+		return nil, errs, err
+	}
+
+	input.apply(rule)
+	if err := s.priceRepo.UpdatePriceRule(rule); err != nil {
+		return nil, nil, err
+	}
+	return rule, nil, nil
+}
+
+func (s *PriceService) validate(input *PriceRuleInput) (FieldErrors, error) {
+	if errs := input.Validate(time.Now()); len(errs) > 0 {
+		return errs, nil
+	}
+	if input.BookID != nil {
+		if _, err := s.bookRepo.GetBookById(*input.BookID); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// CancelPriceRule calls off a scheduled rule, or stops an active one and
+// restores the regular prices right away
+func (s *PriceService) CancelPriceRule(id uint) (*models.PriceRule, error) {
+	rule, err := s.priceRepo.GetPriceRule(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch rule.Status {
+	case models.PriceRuleScheduled:
+	case models.PriceRuleActive:
+		if _, err := s.endSales(rule); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrPriceRuleFinished
+	}
+
+	if err := s.priceRepo.SetPriceRuleStatus(id, rule.Status, models.PriceRuleCancelled); err != nil {
+		return nil, err
+	}
+	rule.Status = models.PriceRuleCancelled
+	rule.Books = nil
+	return rule, nil
+}
+
+// PriceRuleReport counts what ApplyPriceRules did
+type PriceRuleReport struct {
+	Started  int `json:"started"`
+	Ended    int `json:"ended"`
+	OnSale   int `json:"on_sale"`
+	Restored int `json:"restored"`
+}
+
+// ApplyPriceRules starts the rules whose window opened and ends the ones
+// whose window closed. A book already on another sale, or which the rule
+// would not make cheaper, keeps its price. Books added to a category after
+// its rule started are not put on sale
+func (s *PriceService) ApplyPriceRules(ctx context.Context) (*PriceRuleReport, error) {
+	report := &PriceRuleReport{}
+	now := time.Now()
+
+	// End first so books come off a finished sale before the next one starts
+	ending, err := s.priceRepo.GetRulesToEnd(now)
+	if err != nil {
+		return report, err
+	}
+	for i := range ending {
+		restored, err := s.endSales(&ending[i])
+		report.Restored += restored
+		if err != nil {
+			return report, err
+		}
+		if err := s.priceRepo.SetPriceRuleStatus(ending[i].ID, models.PriceRuleActive, models.PriceRuleEnded); err != nil {
+			return report, err
+		}
+		report.Ended++
+	}
+
+	missed, err := s.priceRepo.EndMissedRules(now)
+	if err != nil {
+		return report, err
+	}
+	if missed > 0 {
+		slog.Warn("Ended price rules that never started", "count", missed)
+	}
+
+	starting, err := s.priceRepo.GetRulesToStart(now)
+	if err != nil {
+		return report, err
+	}
+	for i := range starting {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		rule := &starting[i]
+		bookIds, err := s.priceRepo.FindRuleBookIds(rule)
+		if err != nil {
+			return report, err
+		}
+		for _, bookId := range bookIds {
+			started, err := s.priceRepo.StartSale(rule, bookId)
+			if err != nil {
+				return report, err
+			}
+			if started {
+				report.OnSale++
+			}
+		}
+
+		if err := s.priceRepo.SetPriceRuleStatus(rule.ID, models.PriceRuleScheduled, models.PriceRuleActive); err != nil {
+			return report, err
+		}
+		report.Started++
+	}
+
+	return report, nil
+}
+
+func (s *PriceService) endSales(rule *models.PriceRule) (int, error) {
+	restored := 0
+	for i := range rule.Books {
+		ok, err := s.priceRepo.EndSale(&rule.Books[i])
+		if err != nil {
+			return restored, err
+		}
+		if ok {
+			restored++
+		}
+	}
+	return restored, nil
+}
+
+// GetPriceHistory lists who changed the book's price, when and why
+func (s *PriceService) GetPriceHistory(bookID uint, page, pageSize int) ([]models.PriceChange, int, error) {
+	if _, err := s.bookRepo.GetBookById(bookID); err != nil {
+		return nil, 0, err
+	}
+	return s.bookRepo.GetPriceHistory(bookID, page, pageSize)
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/pkg/cache"
+)
+
+// BookPage is one page of a ranked list of books and the size of the list
+type BookPage struct {
+	Books []models.Book
+	Total int
+}
+
+type rankingKey struct {
+	list     string
+	id       uint
+	page     int
+	pageSize int
+}
+
+// RecommendationService serves bestsellers and recommendations computed from
+// orders. Rankings are cached, so a sale shows up after at most the cache TTL
+type RecommendationService struct {
+	recommendationRepo repositories.RecommendationRepository
+	bookRepo           repositories.BookRepository
+	bestsellerWindow   time.Duration
+	rankings           *cache.TTL[rankingKey, BookPage]
+}
+
+func NewRecommendationService(recommendationRepo repositories.RecommendationRepository, bookRepo repositories.BookRepository, bestsellerWindow, cacheTTL time.Duration) *RecommendationService {
+	return &RecommendationService{
+		recommendationRepo: recommendationRepo,
+		bookRepo:           bookRepo,
+		bestsellerWindow:   bestsellerWindow,
+		rankings:           cache.NewTTL[rankingKey, BookPage](cacheTTL),
+	}
+}
+
+// GetBestsellers ranks books by sales over the bestseller window. A shop
+// without sales in the window shows its trending books instead
+func (s *RecommendationService) GetBestsellers(page, pageSize int) (*BookPage, error) {
+	return s.ranking(rankingKey{"bestsellers", 0, page, pageSize}, func() (*BookPage, error) {
+		since := time.Now().Add(-s.bestsellerWindow).Truncate(time.Hour)
+		return s.withTrendingFallback(page, pageSize, func() ([]models.Book, int, error) {
+			return s.recommendationRepo.GetBestsellers(since, page, pageSize)
+		})
+	})
+}
+
+// GetAlsoBought lists what customers who bought the book also bought
+func (s *RecommendationService) GetAlsoBought(bookID uint, page, pageSize int) (*BookPage, error) {
+	if _, err := s.bookRepo.GetBookById(bookID); err != nil {
+		return nil, err
+	}
+
+	return s.ranking(rankingKey{"also-bought", bookID, page, pageSize}, func() (*BookPage, error) {
+		books, total, err := s.recommendationRepo.GetAlsoBought(bookID, page, pageSize)
+		return &BookPage{Books: books, Total: total}, err
+	})
+}
+
+// GetRelatedBooks lists books like the given one for its detail page
+func (s *RecommendationService) GetRelatedBooks(bookID uint, page, pageSize int) (*BookPage, error) {
+	book, err := s.bookRepo.GetBookById(bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ranking(rankingKey{"related", bookID, page, pageSize}, func() (*BookPage, error) {
+		books, total, err := s.recommendationRepo.GetRelatedBooks(book, page, pageSize)
+		return &BookPage{Books: books, Total: total}, err
+	})
+}
+
+// GetRecommendations personalises from the user's orders. Guests, userID 0,
+// and customers without orders to go on get the trending books
+func (s *RecommendationService) GetRecommendations(userID uint, page, pageSize int) (*BookPage, error) {
+	return s.ranking(rankingKey{"recommended", userID, page, pageSize}, func() (*BookPage, error) {
+		return s.withTrendingFallback(page, pageSize, func() ([]models.Book, int, error) {
+			if userID == 0 {
+				return nil, 0, nil
+			}
+			return s.recommendationRepo.GetRecommendedForUser(userID, page, pageSize)
+		})
+	})
+}
+
+func (s *RecommendationService) ranking(key rankingKey, load func() (*BookPage, error)) (*BookPage, error) {
+	page, err := s.rankings.GetOrLoad(key, func() (BookPage, error) {
+		page, err := load()
+		if err != nil {
+			return BookPage{}, err
+		}
+		return *page, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (s *RecommendationService) withTrendingFallback(page, pageSize int, rank func() ([]models.Book, int, error)) (*BookPage, error) {
+	books, total, err := rank()
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		books, total, err = s.recommendationRepo.GetTrendingBooks(page, pageSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &BookPage{Books: books, Total: total}, nil
+}
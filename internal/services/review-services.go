@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+)
+
+var (
+	ErrReviewNotAllowed  = errors.New("only customers who received this book can review it")
+	ErrReviewForbidden   = errors.New("you can only change your own review")
+	ErrOwnReviewVote     = errors.New("you cannot vote on your own review")
+	ErrReviewNotApproved = errors.New("review is not published")
+)
+
+// ReviewInput is what a customer writes
+type ReviewInput struct {
+	Rating int    `json:"rating"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+}
+
+// Validate trims the text and reports fields that cannot be saved
+func (in *ReviewInput) Validate() FieldErrors {
+	errs := FieldErrors{}
+	in.Title = strings.TrimSpace(in.Title)
+	in.Body = strings.TrimSpace(in.Body)
+
+	if in.Rating < 1 || in.Rating > 5 {
+		errs["rating"] = "must be between 1 and 5"
+	}
+	if in.Title == "" {
+		errs["title"] = "is required"
+	} else if len(in.Title) > 255 {
+		errs["title"] = "must be at most 255 characters"
+	}
+	if in.Body == "" {
+		errs["body"] = "is required"
+	} else if len(in.Body) > 5000 {
+		errs["body"] = "must be at most 5000 characters"
+	}
+	return errs
+}
+
+var validReviewStatus = map[string]bool{
+	models.ReviewPending:  true,
+	models.ReviewApproved: true,
+	models.ReviewRejected: true,
+}
+
+type ReviewService struct {
+	reviewRepo repositories.ReviewRepository
+	orderRepo  repositories.OrderRepository
+	bookRepo   repositories.BookRepository
+}
+
+func NewReviewService(reviewRepo repositories.ReviewRepository, orderRepo repositories.OrderRepository, bookRepo repositories.BookRepository) *ReviewService {
+	return &ReviewService{reviewRepo: reviewRepo, orderRepo: orderRepo, bookRepo: bookRepo}
+}
+
+// CreateReview saves a pending review, the user must have a delivered order
+// containing the book
+func (s *ReviewService) CreateReview(bookID, userID uint, reviewer string, input *ReviewInput) (*models.Review, FieldErrors, error) {
+	if errs := input.Validate(); len(errs) > 0 {
+		return nil, errs, nil
+	}
+	if _, err := s.bookRepo.GetBookById(bookID); err != nil {
+		return nil, nil, err
+	}
+
+	delivered, err := s.orderRepo.HasDeliveredBook(userID, bookID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !delivered {
+		return nil, nil, ErrReviewNotAllowed
+	}
+
+	review := &models.Review{
+		BookID:   bookID,
+		UserID:   userID,
+		Reviewer: reviewer,
+		Rating:   input.Rating,
+		Title:    input.Title,
+		Body:     input.Body,
+		Status:   models.ReviewPending,
+	}
+	if err := s.reviewRepo.CreateReview(review); err != nil {
+		return nil, nil, err
+	}
+	return review, nil, nil
+}
+
+// UpdateReview lets the author rewrite their review, which sends it back to
+// moderation
+func (s *ReviewService) UpdateReview(id, userID uint, input *ReviewInput) (*models.Review, FieldErrors, error) {
+	if errs := input.Validate(); len(errs) > 0 {
+		return nil, errs, nil
+	}
+
+	review, err := s.reviewRepo.GetReview(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if review.UserID != userID {
+		return nil, nil, ErrReviewForbidden
+	}
+
+	review.Rating = input.Rating
+	review.Title = input.Title
+	review.Body = input.Body
+	review.Status = models.ReviewPending
+	if err := s.reviewRepo.UpdateReview(review); err != nil {
+		return nil, nil, err
+	}
+	return review, nil, nil
+}
+
+// DeleteReview removes a review, admins may delete any review
+func (s *ReviewService) DeleteReview(id, userID uint, isAdmin bool) error {
+	review, err := s.reviewRepo.GetReview(id)
+	if err != nil {
+		return err
+	}
+	if review.UserID != userID && !isAdmin {
+		return ErrReviewForbidden
+	}
+	return s.reviewRepo.DeleteReview(id)
+}
+
+// GetReviewsForBook pages through a book's published reviews
+func (s *ReviewService) GetReviewsForBook(bookID uint, sort string, page, pageSize int) ([]models.Review, int, error) {
+	if _, err := s.bookRepo.GetBookById(bookID); err != nil {
+		return nil, 0, err
+	}
+	return s.reviewRepo.GetReviewsForBook(bookID, sort, page, pageSize)
+}
+
+func (s *ReviewService) GetReviewsByStatus(status string, page, pageSize int) ([]models.Review, int, error) {
+	return s.reviewRepo.GetReviewsByStatus(status, page, pageSize)
+}
+
+// ModerateReview approves, rejects or requeues a review
+func (s *ReviewService) ModerateReview(id uint, status string) (*models.Review, FieldErrors, error) {
+	if !validReviewStatus[status] {
+		return nil, FieldErrors{"status": "must be pending, approved or rejected"}, nil
+	}
+	review, err := s.reviewRepo.SetReviewStatus(id, status)
+	return review, nil, err
+}
+
+// VoteHelpful records a helpful vote on a published review
+func (s *ReviewService) VoteHelpful(id, userID uint) error {
+	review, err := s.reviewRepo.GetReview(id)
+	if err != nil {
+		return err
+	}
+	if review.Status != models.ReviewApproved {
+		return ErrReviewNotApproved
+	}
+	if review.UserID == userID {
+		return ErrOwnReviewVote
+	}
+	return s.reviewRepo.AddVote(id, userID)
+}
+
+func (s *ReviewService) RemoveHelpfulVote(id, userID uint) error {
+	if _, err := s.reviewRepo.GetReview(id); err != nil {
+		return err
+	}
+	return s.reviewRepo.RemoveVote(id, userID)
+}
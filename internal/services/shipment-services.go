@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/pkg/rajaongkir"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOrderNotShippable = errors.New("only paid or shipped orders can be given a shipment")
+	ErrNoShipment        = errors.New("the order has not been shipped yet")
+)
+
+// trackBatchSize is how many shipments one scheduled run tracks at most, to
+// spread the courier lookups over the runs
+const trackBatchSize = 50
+
+// ShipmentInput is the parcel warehouse staff handed to the courier. Courier
+// and service default to the ones the order was quoted with
+type ShipmentInput struct {
+	Courier string `json:"courier"`
+	Service string `json:"service"`
+	Waybill string `json:"waybill"`
+}
+
+// Validate normalises the input and reports what is wrong with it
+func (in *ShipmentInput) Validate(order *models.Order) FieldErrors {
+	errs := FieldErrors{}
+
+	in.Courier = strings.ToLower(strings.TrimSpace(in.Courier))
+	in.Service = strings.TrimSpace(in.Service)
+	in.Waybill = strings.TrimSpace(in.Waybill)
+	if in.Courier == "" {
+		in.Courier = order.Shipping.ShippingType
+	}
+	if in.Service == "" {
+		in.Service = order.Shipping.ShippingService
+	}
+
+	if in.Courier == "" {
+		errs["courier"] = "is required"
+	} else if len(in.Courier) > 20 {
+		errs["courier"] = "must be at most 20 characters"
+	}
+	if len(in.Service) > 50 {
+		errs["service"] = "must be at most 50 characters"
+	}
+	if in.Waybill == "" {
+		errs["waybill"] = "is required"
+	} else if len(in.Waybill) > 50 {
+		errs["waybill"] = "must be at most 50 characters"
+	}
+
+	return errs
+}
+
+// TrackingReport sums up a scheduled tracking run
+type TrackingReport struct {
+	Tracked   int
+	Delivered int
+	Failed    int
+}
+
+// ShipmentService records the parcels of orders and tracks them through
+// RajaOngkir. Answers are kept for cacheTTL, delivered parcels are not
+// tracked again
+type ShipmentService struct {
+	shipmentRepo repositories.ShipmentRepository
+	orderRepo    repositories.OrderRepository
+	orders       *OrderService
+	api          rajaongkir.API
+	cacheTTL     time.Duration
+}
+
+func NewShipmentService(shipmentRepo repositories.ShipmentRepository, orderRepo repositories.OrderRepository, orders *OrderService, api rajaongkir.API, cacheTTL time.Duration) *ShipmentService {
+	return &ShipmentService{shipmentRepo: shipmentRepo, orderRepo: orderRepo, orders: orders, api: api, cacheTTL: cacheTTL}
+}
+
+// SetShipment records the parcel of a paid or shipped order and moves paid
+// orders to shipped. A new waybill number starts tracking over
+func (s *ShipmentService) SetShipment(orderID uint, input *ShipmentInput) (*models.Shipment, FieldErrors, error) {
+	order, err := s.orderRepo.GetOrderById(orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if order.Status != models.OrderPaid && order.Status != models.OrderShipped {
+		return nil, nil, ErrOrderNotShippable
+	}
+	if errs := input.Validate(order); len(errs) > 0 {
+		return nil, errs, nil
+	}
+
+	shipment, err := s.shipmentRepo.GetShipmentByOrder(orderID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+	if shipment.Waybill != input.Waybill || shipment.Courier != input.Courier {
+		*shipment = models.Shipment{ID: shipment.ID, OrderID: orderID, CreatedAt: shipment.CreatedAt}
+	}
+	shipment.Courier, shipment.Service, shipment.Waybill = input.Courier, input.Service, input.Waybill
+	if err := s.shipmentRepo.SaveShipment(shipment); err != nil {
+		return nil, nil, err
+	}
+
+	if order.Status == models.OrderPaid {
+		if _, err := s.orders.UpdateOrderStatus(orderID, models.OrderShipped); err != nil {
+			return nil, nil, err
+		}
+	}
+	return shipment, nil, nil
+}
+
+// TrackShipment returns the order's shipment with where the parcel is,
+// customers can only track their own orders. Stale is true when the courier
+// could not be asked and the last answer is served instead
+func (s *ShipmentService) TrackShipment(ctx context.Context, orderID, userID uint, admin bool) (*models.Shipment, bool, error) {
+	order, err := s.orderRepo.GetOrderById(orderID)
+	if err != nil {
+		return nil, false, err
+	}
+	if !admin && order.UserId != userID {
+		return nil, false, gorm.ErrRecordNotFound
+	}
+
+	shipment, err := s.shipmentRepo.GetShipmentByOrder(orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, ErrNoShipment
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := s.track(ctx, shipment, order.Status); err != nil {
+		if shipment.TrackedAt == nil {
+			return nil, false, err
+		}
+		slog.Warn("Tracking unavailable, serving the last manifest", "order_id", orderID, "waybill", shipment.Waybill, "error", err)
+		return shipment, true, nil
+	}
+	return shipment, false, nil
+}
+
+// TrackShipments asks the couriers about the parcels of shipped orders not
+// tracked for a while, so orders are delivered without customers looking
+func (s *ShipmentService) TrackShipments(ctx context.Context) (TrackingReport, error) {
+	var report TrackingReport
+	shipments, err := s.shipmentRepo.GetShipmentsToTrack(time.Now().Add(-s.cacheTTL), trackBatchSize)
+	if err != nil {
+		return report, err
+	}
+
+	for i := range shipments {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if err := s.track(ctx, &shipments[i], models.OrderShipped); err != nil {
+			slog.Error("Failed to track shipment", "order_id", shipments[i].OrderID, "waybill", shipments[i].Waybill, "error", err)
+			report.Failed++
+			continue
+		}
+		report.Tracked++
+		if shipments[i].DeliveredAt != nil {
+			report.Delivered++
+		}
+	}
+	return report, nil
+}
+
+// track refreshes the shipment from the courier unless it was tracked within
+// the cache TTL or is delivered, and delivers the shipped order once the
+// courier does
+func (s *ShipmentService) track(ctx context.Context, shipment *models.Shipment, orderStatus string) error {
+	now := time.Now()
+	fresh := shipment.TrackedAt != nil && now.Sub(*shipment.TrackedAt) < s.cacheTTL
+	if shipment.DeliveredAt == nil && !fresh {
+		waybill, err := s.api.Waybill(ctx, shipment.Waybill, shipment.Courier)
+		if err != nil {
+			return err
+		}
+
+		shipment.Status = waybill.Status
+		shipment.Receiver = waybill.Receiver
+		shipment.Manifest = make([]models.ManifestEntry, len(waybill.Manifest))
+		for i, entry := range waybill.Manifest {
+			shipment.Manifest[i] = models.ManifestEntry{Code: entry.Code, Description: entry.Description, City: entry.City, Time: entry.Time}
+		}
+		shipment.TrackedAt = &now
+		if waybill.Delivered {
+			deliveredAt := waybill.DeliveredAt
+			if deliveredAt.IsZero() {
+				deliveredAt = now
+			}
+			shipment.DeliveredAt = &deliveredAt
+		}
+		if err := s.shipmentRepo.SaveShipment(shipment); err != nil {
+			return err
+		}
+	}
+
+	// A failed move is only logged, the next look at the shipment tries again
+	if shipment.DeliveredAt != nil && orderStatus == models.OrderShipped {
+		if _, err := s.orders.UpdateOrderStatus(shipment.OrderID, models.OrderDelivered); err != nil && !errors.Is(err, repositories.ErrOrderStatusChanged) {
+			slog.Error("Failed to mark order delivered", "order_id", shipment.OrderID, "error", err)
+		}
+	}
+	return nil
+}
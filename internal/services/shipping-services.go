@@ -0,0 +1,498 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/febriaricandra/book-shop/pkg/rajaongkir"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrShippingOriginUnset   = errors.New("the warehouse city to ship from is not configured")
+	ErrUnknownDestination    = errors.New("destination city is not known to RajaOngkir")
+	ErrShippingQuoteRequired = errors.New("a shipping quote is required")
+	ErrInvalidShippingQuote  = errors.New("shipping quote is not valid for this order")
+	ErrShippingQuoteExpired  = errors.New("shipping quote has expired, ask for a new one")
+	ErrNoShippingService     = errors.New("the courier does not ship to this city")
+)
+
+const (
+	// shippingQuoteAudience keeps quotes and access tokens, which may share a
+	// secret, from being taken for one another
+	shippingQuoteAudience = "shipping-quote"
+
+	provincesKey = "provinces"
+	citiesKey    = "cities"
+
+	// regionRetryDelay is how long stale lists are served after RajaOngkir
+	// failed before it is asked again
+	regionRetryDelay = time.Minute
+
+	// regionFetchTimeout bounds a region fetch, which outlives the request
+	// that started it so the requests waiting on it get the list
+	regionFetchTimeout = 30 * time.Second
+)
+
+// RegionList is a cached list of provinces or cities. Stale is set when it
+// is older than the cache allows because RajaOngkir could not be reached
+type RegionList[T any] struct {
+	Items     []T
+	FetchedAt time.Time
+	Stale     bool
+}
+
+// RegionRefreshReport sums up a forced refresh of the region lists
+type RegionRefreshReport struct {
+	Provinces int `json:"provinces"`
+	Cities    int `json:"cities"`
+}
+
+type regionEntry struct {
+	items     any // []rajaongkir.Province or []rajaongkir.City
+	fetchedAt time.Time
+	failedAt  time.Time // last failed refresh, to not ask again right away
+}
+
+// regionFetch is a fetch of one region list in flight, requests for the same
+// list wait for it instead of asking RajaOngkir again
+type regionFetch struct {
+	force bool
+	done  chan struct{} // closed once list and err are set
+	list  any           // *RegionList[rajaongkir.Province] or *RegionList[rajaongkir.City]
+	err   error
+}
+
+// ShippingService answers shipping questions through RajaOngkir. Provinces
+// and cities rarely change, so they are cached for cacheTTL and, with a
+// region repository, kept in the database across restarts
+type ShippingService struct {
+	api        rajaongkir.API
+	regionRepo repositories.RegionRepository // nil to only cache in memory
+	bookRepo   repositories.BookRepository
+	cacheTTL   time.Duration
+	policy     models.ShippingPolicy
+
+	mu      sync.Mutex // guards regions and fetches
+	regions map[string]*regionEntry
+	fetches map[string]*regionFetch
+}
+
+func NewShippingService(api rajaongkir.API, regionRepo repositories.RegionRepository, bookRepo repositories.BookRepository, cacheTTL time.Duration, policy models.ShippingPolicy) *ShippingService {
+	return &ShippingService{api: api, regionRepo: regionRepo, bookRepo: bookRepo, cacheTTL: cacheTTL, policy: policy, regions: map[string]*regionEntry{}, fetches: map[string]*regionFetch{}}
+}
+
+// ShippingQuote is what a courier service charges to ship books to a city.
+// ID is signed by the shop, orders are placed with it so the client cannot
+// choose its own shipping cost
+type ShippingQuote struct {
+	ID          string      `json:"id"`
+	Courier     string      `json:"courier"`
+	CourierName string      `json:"courier_name"`
+	Service     string      `json:"service"`
+	Description string      `json:"description"`
+	Cost        money.Money `json:"cost"`
+	ETD         string      `json:"etd"`
+	Weight      int64       `json:"weight"` // grams
+	Destination string      `json:"destination"`
+	City        string      `json:"city"`
+	Province    string      `json:"province"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+}
+
+// shippingQuoteClaims is the content of a quote ID, bound to the customer and
+// the exact books it was asked for
+type shippingQuoteClaims struct {
+	jwt.RegisteredClaims
+	UserID      uint        `json:"user_id"`
+	BookIDs     []uint      `json:"book_ids"`
+	Destination string      `json:"destination"`
+	City        string      `json:"city"`
+	Province    string      `json:"province"`
+	Weight      int64       `json:"weight"`
+	Courier     string      `json:"courier"`
+	Service     string      `json:"service"`
+	Cost        money.Money `json:"cost"`
+	ETD         string      `json:"etd"`
+}
+
+// QuoteShipping loads the books and quotes every service of the courier to
+// ship them from the warehouse to the destination city
+func (s *ShippingService) QuoteShipping(ctx context.Context, userID uint, bookIDs []uint, destination, courier string) ([]ShippingQuote, error) {
+	ids := uniqueIDs(bookIDs)
+	if len(ids) == 0 {
+		return nil, ErrEmptyOrder
+	}
+	books, err := s.bookRepo.GetBooksByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(books) != len(ids) {
+		return nil, ErrOrderBookUnavailable
+	}
+	for i := range books {
+		if books[i].Availability == models.BookUnavailable {
+			return nil, ErrOrderBookUnavailable
+		}
+	}
+
+	return s.QuoteBooks(ctx, userID, books, destination, courier)
+}
+
+// QuoteBooks quotes shipping the books, which must be orderable, see
+// QuoteShipping
+func (s *ShippingService) QuoteBooks(ctx context.Context, userID uint, books []models.Book, destination, courier string) ([]ShippingQuote, error) {
+	if s.policy.Origin == "" {
+		return nil, ErrShippingOriginUnset
+	}
+	city, err := s.findCity(ctx, destination)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(books))
+	for i := range books {
+		ids[i] = books[i].ID
+	}
+	ids = uniqueIDs(ids)
+	weight := ShippingWeight(books, s.policy.DefaultWeight)
+
+	costs, err := s.api.Costs(ctx, rajaongkir.CostRequest{
+		Origin:      s.policy.Origin,
+		Destination: city.ID,
+		Weight:      int(weight),
+		Courier:     courier,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.policy.QuoteTTL)
+	quotes := make([]ShippingQuote, 0, len(costs))
+	for _, cost := range costs {
+		// Never offer a service that would pay the customer for shipping
+		if cost.Value.IsNegative() {
+			continue
+		}
+		claims := shippingQuoteClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   strconv.FormatUint(uint64(userID), 10),
+				Audience:  jwt.ClaimStrings{shippingQuoteAudience},
+				ExpiresAt: jwt.NewNumericDate(expiresAt),
+				IssuedAt:  jwt.NewNumericDate(now),
+				ID:        uuid.New().String(),
+			},
+			UserID:      userID,
+			BookIDs:     ids,
+			Destination: city.ID,
+			City:        city.Name,
+			Province:    city.Province,
+			Weight:      weight,
+			Courier:     cost.Courier,
+			Service:     cost.Service,
+			Cost:        cost.Value,
+			ETD:         cost.ETD,
+		}
+		id, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.policy.QuoteSecret)
+		if err != nil {
+			return nil, err
+		}
+
+		quotes = append(quotes, ShippingQuote{
+			ID:          id,
+			Courier:     cost.Courier,
+			CourierName: cost.CourierName,
+			Service:     cost.Service,
+			Description: cost.Description,
+			Cost:        cost.Value,
+			ETD:         cost.ETD,
+			Weight:      weight,
+			Destination: city.ID,
+			City:        city.Name,
+			Province:    city.Province,
+			ExpiresAt:   expiresAt,
+		})
+	}
+	if len(quotes) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoShippingService, courier)
+	}
+	return quotes, nil
+}
+
+// VerifyQuote checks that the quote ID was issued by the shop to the user for
+// exactly these books and has not expired
+func (s *ShippingService) VerifyQuote(id string, userID uint, bookIDs []uint) (*ShippingQuote, error) {
+	if id == "" {
+		return nil, ErrShippingQuoteRequired
+	}
+
+	var claims shippingQuoteClaims
+	_, err := jwt.ParseWithClaims(id, &claims, func(token *jwt.Token) (interface{}, error) {
+		return s.policy.QuoteSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(shippingQuoteAudience), jwt.WithExpirationRequired())
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrShippingQuoteExpired
+	}
+	if err != nil {
+		return nil, ErrInvalidShippingQuote
+	}
+	if claims.UserID != userID || !slices.Equal(claims.BookIDs, uniqueIDs(bookIDs)) {
+		return nil, ErrInvalidShippingQuote
+	}
+
+	return &ShippingQuote{
+		ID:          id,
+		Courier:     claims.Courier,
+		Service:     claims.Service,
+		Cost:        claims.Cost,
+		ETD:         claims.ETD,
+		Weight:      claims.Weight,
+		Destination: claims.Destination,
+		City:        claims.City,
+		Province:    claims.Province,
+		ExpiresAt:   claims.ExpiresAt.Time,
+	}, nil
+}
+
+// ShippingWeight is the weight of the books in grams, books without one
+// count as defaultWeight. Couriers do not quote nothing, so it is at least a
+// gram
+func ShippingWeight(books []models.Book, defaultWeight int64) int64 {
+	var weight int64
+	for i := range books {
+		if books[i].Weight > 0 {
+			weight += books[i].Weight
+		} else {
+			weight += defaultWeight
+		}
+	}
+	return max(weight, 1)
+}
+
+// findCity looks the city up in the cached city list
+func (s *ShippingService) findCity(ctx context.Context, id string) (*rajaongkir.City, error) {
+	cities, err := cachedRegions(ctx, s, citiesKey, false, s.fetchCities)
+	if err != nil {
+		return nil, err
+	}
+	for i := range cities.Items {
+		if cities.Items[i].ID == id {
+			return &cities.Items[i], nil
+		}
+	}
+	return nil, ErrUnknownDestination
+}
+
+// uniqueIDs sorts the ids and drops repeats, an order holds each book once
+func uniqueIDs(ids []uint) []uint {
+	sorted := slices.Clone(ids)
+	slices.Sort(sorted)
+	return slices.Compact(sorted)
+}
+
+func (s *ShippingService) GetProvinces(ctx context.Context) (*RegionList[rajaongkir.Province], error) {
+	return cachedRegions(ctx, s, provincesKey, false, s.api.Provinces)
+}
+
+// GetCities lists the cities of a province. Every city is fetched at once so
+// a single request fills the cache for all provinces
+func (s *ShippingService) GetCities(ctx context.Context, provinceID string) (*RegionList[rajaongkir.City], error) {
+	all, err := cachedRegions(ctx, s, citiesKey, false, s.fetchCities)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &RegionList[rajaongkir.City]{Items: []rajaongkir.City{}, FetchedAt: all.FetchedAt, Stale: all.Stale}
+	for _, city := range all.Items {
+		if city.ProvinceID == provinceID {
+			list.Items = append(list.Items, city)
+		}
+	}
+	return list, nil
+}
+
+// RefreshRegions fetches the provinces and cities again, whatever their age
+func (s *ShippingService) RefreshRegions(ctx context.Context) (*RegionRefreshReport, error) {
+	provinces, err := cachedRegions(ctx, s, provincesKey, true, s.api.Provinces)
+	if err != nil {
+		return nil, err
+	}
+	cities, err := cachedRegions(ctx, s, citiesKey, true, s.fetchCities)
+	if err != nil {
+		return nil, err
+	}
+	return &RegionRefreshReport{Provinces: len(provinces.Items), Cities: len(cities.Items)}, nil
+}
+
+func (s *ShippingService) fetchCities(ctx context.Context) ([]rajaongkir.City, error) {
+	return s.api.Cities(ctx, "")
+}
+
+// GetCosts asks RajaOngkir for the services of a courier between two cities
+func (s *ShippingService) GetCosts(ctx context.Context, req rajaongkir.CostRequest) ([]rajaongkir.Cost, error) {
+	return s.api.Costs(ctx, req)
+}
+
+// cachedRegions returns the list under key, fetching it when it is missing,
+// older than the cache TTL or force is set. When fetching fails the last list
+// is served as stale, unless the refresh was forced. Only one fetch per key
+// runs at a time and the lock is not held while it does
+func cachedRegions[T any](ctx context.Context, s *ShippingService, key string, force bool, fetch func(context.Context) ([]T, error)) (*RegionList[T], error) {
+	for {
+		s.mu.Lock()
+		if entry := s.regions[key]; entry != nil && !force {
+			if list, ok := usableRegions[T](entry, s.cacheTTL, time.Now()); ok {
+				s.mu.Unlock()
+				return list, nil
+			}
+		}
+
+		call := s.fetches[key]
+		if call == nil {
+			call = &regionFetch{force: force, done: make(chan struct{})}
+			s.fetches[key] = call
+			go s.runRegionFetch(call, key, func(ctx context.Context) (any, error) {
+				return fetchRegions(ctx, s, key, force, fetch)
+			})
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// A forced refresh does not take the list of a fetch that may have
+		// been served from the cache
+		if force && !call.force {
+			continue
+		}
+		if call.err != nil {
+			return nil, call.err
+		}
+		return call.list.(*RegionList[T]), nil
+	}
+}
+
+// runRegionFetch runs the fetch apart from the request that started it, so
+// the other requests waiting on it still get the list when that one is gone
+func (s *ShippingService) runRegionFetch(call *regionFetch, key string, fetch func(context.Context) (any, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), regionFetchTimeout)
+	defer cancel()
+
+	call.list, call.err = fetch(ctx)
+
+	s.mu.Lock()
+	delete(s.fetches, key)
+	s.mu.Unlock()
+	close(call.done)
+}
+
+// fetchRegions loads the list from the database the first time and asks
+// RajaOngkir when that is missing or too old. It runs without the lock, the
+// cache is only updated under it
+func fetchRegions[T any](ctx context.Context, s *ShippingService, key string, force bool, fetch func(context.Context) ([]T, error)) (*RegionList[T], error) {
+	s.mu.Lock()
+	entry := s.regions[key]
+	s.mu.Unlock()
+	if entry == nil {
+		entry = s.loadRegions(key, func(data string) (any, error) {
+			var items []T
+			err := json.Unmarshal([]byte(data), &items)
+			return items, err
+		})
+		if entry != nil {
+			s.mu.Lock()
+			s.regions[key] = entry
+			s.mu.Unlock()
+		}
+	}
+
+	now := time.Now()
+	if entry != nil && !force {
+		if list, ok := usableRegions[T](entry, s.cacheTTL, now); ok {
+			return list, nil
+		}
+	}
+
+	items, err := fetch(ctx)
+	if err != nil {
+		if entry == nil || force {
+			return nil, err
+		}
+		slog.Warn("RajaOngkir unavailable, serving stale list", "key", key, "fetched_at", entry.fetchedAt, "error", err)
+		s.mu.Lock()
+		entry.failedAt = now
+		s.mu.Unlock()
+		return &RegionList[T]{Items: entry.items.([]T), FetchedAt: entry.fetchedAt, Stale: true}, nil
+	}
+	if items == nil {
+		items = []T{}
+	}
+
+	s.mu.Lock()
+	s.regions[key] = &regionEntry{items: items, fetchedAt: now}
+	s.mu.Unlock()
+	s.saveRegions(key, items, now)
+	return &RegionList[T]{Items: items, FetchedAt: now}, nil
+}
+
+// usableRegions serves the entry while it is fresh, or stale while RajaOngkir
+// is not asked again after a failure
+func usableRegions[T any](entry *regionEntry, ttl time.Duration, now time.Time) (*RegionList[T], bool) {
+	fresh := now.Sub(entry.fetchedAt) < ttl
+	if !fresh && now.Sub(entry.failedAt) >= regionRetryDelay {
+		return nil, false
+	}
+	return &RegionList[T]{Items: entry.items.([]T), FetchedAt: entry.fetchedAt, Stale: !fresh}, true
+}
+
+// loadRegions reads the list kept in the database, if any
+func (s *ShippingService) loadRegions(key string, decode func(string) (any, error)) *regionEntry {
+	if s.regionRepo == nil {
+		return nil
+	}
+
+	cache, err := s.regionRepo.GetRegionCache(key)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to load cached regions", "key", key, "error", err)
+		}
+		return nil
+	}
+	items, err := decode(cache.Data)
+	if err != nil {
+		slog.Error("Failed to decode cached regions", "key", key, "error", err)
+		return nil
+	}
+	return &regionEntry{items: items, fetchedAt: cache.FetchedAt}
+}
+
+// saveRegions keeps the list in the database, failures only cost a fetch
+// after the next restart
+func (s *ShippingService) saveRegions(key string, items any, fetchedAt time.Time) {
+	if s.regionRepo == nil {
+		return
+	}
+
+	data, err := json.Marshal(items)
+	if err == nil {
+		err = s.regionRepo.SaveRegionCache(&models.RegionCache{Key: key, Data: string(data), FetchedAt: fetchedAt})
+	}
+	if err != nil {
+		slog.Error("Failed to save cached regions", "key", key, "error", err)
+	}
+}
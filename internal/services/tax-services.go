@@ -0,0 +1,171 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/pkg/money"
+)
+
+// TaxableItem is an amount of an order taxed at the rate of its category
+type TaxableItem struct {
+	Category string
+	Amount   money.Money
+}
+
+// SpreadDiscount takes discount off the amounts in proportion to them, the
+// last amount takes the rounding difference so the result adds up exactly
+func SpreadDiscount(amounts []money.Money, discount money.Money) []money.Money {
+	spread := make([]money.Money, len(amounts))
+	copy(spread, amounts)
+	total := money.Sum(amounts...)
+	if !discount.IsPositive() || !total.IsPositive() {
+		return spread
+	}
+	discount = money.Min(discount, total)
+
+	left := discount
+	for i := range amounts {
+		share := left
+		if i < len(amounts)-1 {
+			share = money.New(int64(float64(discount.Amount)*float64(amounts[i].Amount)/float64(total.Amount)), discount.Currency)
+		}
+		spread[i] = amounts[i].Sub(share)
+		left = left.Sub(share)
+	}
+	return spread
+}
+
+// ComputeTaxes works out the tax lines of the items, one per tax name and
+// rate, highest rate first. Items of categories without their own rate are
+// taxed at the policy's. When prices include the tax it is taken out of the
+// amounts, else it is charged on top of them
+func ComputeTaxes(items []TaxableItem, policy models.TaxPolicy, rates []models.TaxRate) []models.OrderTax {
+	type key struct {
+		name    string
+		percent float64
+	}
+	var keys []key
+	amounts := map[key]money.Money{}
+	for _, item := range items {
+		k := key{policy.Name, policy.Percent}
+		for i := range rates {
+			if strings.EqualFold(rates[i].Category, item.Category) {
+				k = key{rates[i].Name, rates[i].Percent}
+				break
+			}
+		}
+		if _, ok := amounts[k]; !ok {
+			keys = append(keys, k)
+		}
+		amounts[k] = amounts[k].Add(item.Amount)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].percent != keys[j].percent {
+			return keys[i].percent > keys[j].percent
+		}
+		return keys[i].name < keys[j].name
+	})
+
+	taxes := make([]models.OrderTax, len(keys))
+	for i, k := range keys {
+		amount := amounts[k]
+		line := models.OrderTax{Name: k.name, Percent: k.percent, Base: amount, Tax: amount.Percent(k.percent)}
+		if policy.Mode == models.TaxInclusive {
+			line.Tax = amount.Ratio(k.percent, 100+k.percent)
+			line.Base = amount.Sub(line.Tax)
+		}
+		taxes[i] = line
+	}
+	return taxes
+}
+
+// TaxRateInput is what admins send to set a category's tax rate
+type TaxRateInput struct {
+	Category string  `json:"category"`
+	Name     string  `json:"name"`
+	Percent  float64 `json:"percent"`
+}
+
+// Validate normalises the input and reports what is wrong with it, the name
+// defaults to the policy's
+func (in *TaxRateInput) Validate(policy models.TaxPolicy) FieldErrors {
+	errs := FieldErrors{}
+
+	in.Category = strings.TrimSpace(in.Category)
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		in.Name = policy.Name
+	}
+
+	if in.Category == "" {
+		errs["category"] = "is required"
+	} else if len(in.Category) > 255 {
+		errs["category"] = "must be at most 255 characters"
+	}
+	if len(in.Name) > 50 {
+		errs["name"] = "must be at most 50 characters"
+	}
+	if in.Percent < 0 || in.Percent > 100 {
+		errs["percent"] = "must be a percentage between 0 and 100"
+	}
+
+	return errs
+}
+
+type TaxService struct {
+	taxRepo repositories.TaxRepository
+	policy  models.TaxPolicy
+}
+
+func NewTaxService(repo repositories.TaxRepository, policy models.TaxPolicy) *TaxService {
+	return &TaxService{taxRepo: repo, policy: policy}
+}
+
+// Policy is the default tax, applied to categories without their own rate
+func (s *TaxService) Policy() models.TaxPolicy {
+	return s.policy
+}
+
+func (s *TaxService) GetTaxRates() ([]models.TaxRate, error) {
+	return s.taxRepo.GetTaxRates()
+}
+
+func (s *TaxService) CreateTaxRate(input *TaxRateInput) (*models.TaxRate, FieldErrors, error) {
+	if errs := input.Validate(s.policy); len(errs) > 0 {
+		return nil, errs, nil
+	}
+
+	rate := &models.TaxRate{Category: input.Category, Name: input.Name, Percent: input.Percent}
+	if err := s.taxRepo.CreateTaxRate(rate); err != nil {
+		return nil, nil, err
+	}
+	return rate, nil, nil
+}
+
+func (s *TaxService) UpdateTaxRate(id uint, input *TaxRateInput) (*models.TaxRate, FieldErrors, error) {
+	rate, err := s.taxRepo.GetTaxRate(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if errs := input.Validate(s.policy); len(errs) > 0 {
+		return nil, errs, nil
+	}
+
+	rate.Category, rate.Name, rate.Percent = input.Category, input.Name, input.Percent
+	if err := s.taxRepo.UpdateTaxRate(rate); err != nil {
+		return nil, nil, err
+	}
+	return rate, nil, nil
+}
+
+func (s *TaxService) DeleteTaxRate(id uint) error {
+	return s.taxRepo.DeleteTaxRate(id)
+}
+
+func (s *TaxService) GetReports(from, to time.Time) ([]repositories.TaxReport, error) {
+	return s.taxRepo.GetTaxReports(from, to)
+}
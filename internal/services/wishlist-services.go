@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/pkg/mail"
+	"gorm.io/gorm"
+)
+
+// MaxWishlists caps the named lists of a single user
+const MaxWishlists = 20
+
+// defaultWishlistName names the list created when a user saves their first book
+const defaultWishlistName = "Wishlist"
+
+var ErrTooManyWishlists = fmt.Errorf("a user can have at most %d wishlists", MaxWishlists)
+
+type WishlistService struct {
+	wishlistRepo  repositories.WishlistRepository
+	bookRepo      repositories.BookRepository
+	userRepo      repositories.UserRepository
+	mailer        mail.Sender
+	storeName     string
+	storefrontURL string
+}
+
+func NewWishlistService(wishlistRepo repositories.WishlistRepository, bookRepo repositories.BookRepository, userRepo repositories.UserRepository, mailer mail.Sender, storeName, storefrontURL string) *WishlistService {
+	return &WishlistService{
+		wishlistRepo:  wishlistRepo,
+		bookRepo:      bookRepo,
+		userRepo:      userRepo,
+		mailer:        mailer,
+		storeName:     storeName,
+		storefrontURL: storefrontURL,
+	}
+}
+
+// WishlistUpdate holds the editable fields of a list, nil means unchanged
+type WishlistUpdate struct {
+	Name   *string `json:"name"`
+	Shared *bool   `json:"shared"`
+}
+
+func validateWishlistName(name string) FieldErrors {
+	if name == "" {
+		return FieldErrors{"name": "is required"}
+	}
+	if len(name) > 100 {
+		return FieldErrors{"name": "must be at most 100 characters"}
+	}
+	return nil
+}
+
+func (s *WishlistService) GetWishlists(userID uint) ([]models.Wishlist, error) {
+	wishlists, err := s.wishlistRepo.GetWishlists(userID)
+	for i := range wishlists {
+		s.setShareURL(&wishlists[i])
+	}
+	return wishlists, err
+}
+
+// GetWishlist returns one of the user's lists, other users' lists are not found
+func (s *WishlistService) GetWishlist(id, userID uint) (*models.Wishlist, error) {
+	wishlist, err := s.wishlistRepo.GetWishlist(id)
+	if err != nil {
+		return nil, err
+	}
+	if wishlist.UserID != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	s.setShareURL(wishlist)
+	return wishlist, nil
+}
+
+// GetSharedWishlist is the public view of a list shared by link
+func (s *WishlistService) GetSharedWishlist(token string) (*models.Wishlist, error) {
+	wishlist, err := s.wishlistRepo.GetWishlistByToken(token)
+	if err != nil {
+		return nil, err
+	}
+	s.setShareURL(wishlist)
+	return wishlist, nil
+}
+
+func (s *WishlistService) CreateWishlist(userID uint, name string) (*models.Wishlist, FieldErrors, error) {
+	name = strings.TrimSpace(name)
+	if errs := validateWishlistName(name); len(errs) > 0 {
+		return nil, errs, nil
+	}
+
+	count, err := s.wishlistRepo.CountWishlists(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if count >= MaxWishlists {
+		return nil, nil, ErrTooManyWishlists
+	}
+
+	wishlist := &models.Wishlist{UserID: userID, Name: name, IsDefault: count == 0}
+	if err := s.wishlistRepo.CreateWishlist(wishlist); err != nil {
+		return nil, nil, err
+	}
+	return wishlist, nil, nil
+}
+
+// UpdateWishlist renames the list or turns its public link on and off.
+// Sharing again after turning it off issues a new link
+func (s *WishlistService) UpdateWishlist(id, userID uint, update *WishlistUpdate) (*models.Wishlist, FieldErrors, error) {
+	wishlist, err := s.GetWishlist(id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if errs := validateWishlistName(name); len(errs) > 0 {
+			return nil, errs, nil
+		}
+		wishlist.Name = name
+	}
+	if update.Shared != nil {
+		switch {
+		case *update.Shared && wishlist.ShareToken == nil:
+			token, err := newShareToken()
+			if err != nil {
+				return nil, nil, err
+			}
+			wishlist.ShareToken = &token
+		case !*update.Shared:
+			wishlist.ShareToken = nil
+		}
+	}
+
+	if err := s.wishlistRepo.UpdateWishlist(wishlist); err != nil {
+		return nil, nil, err
+	}
+	wishlist.ShareURL = ""
+	s.setShareURL(wishlist)
+	return wishlist, nil, nil
+}
+
+func (s *WishlistService) DeleteWishlist(id, userID uint) error {
+	if _, err := s.GetWishlist(id, userID); err != nil {
+		return err
+	}
+	return s.wishlistRepo.DeleteWishlist(id)
+}
+
+// AddItem saves a book on one of the user's lists, wishlistID 0 means the
+// default list, which is created on first use
+func (s *WishlistService) AddItem(userID, wishlistID, bookID uint) (*models.WishlistItem, error) {
+	var wishlist *models.Wishlist
+	var err error
+	if wishlistID == 0 {
+		wishlist, err = s.defaultWishlist(userID)
+	} else {
+		wishlist, err = s.GetWishlist(wishlistID, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	book, err := s.bookRepo.GetBookById(bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &models.WishlistItem{
+		WishlistID:       wishlist.ID,
+		BookID:           book.ID,
+		SeenPrice:        book.NewPrice,
+		SeenAvailability: book.Availability,
+	}
+	if err := s.wishlistRepo.AddItem(item); err != nil {
+		return nil, err
+	}
+	item.Book = *book
+	return item, nil
+}
+
+func (s *WishlistService) RemoveItem(userID, wishlistID, bookID uint) error {
+	if _, err := s.GetWishlist(wishlistID, userID); err != nil {
+		return err
+	}
+	return s.wishlistRepo.RemoveItem(wishlistID, bookID)
+}
+
+func (s *WishlistService) defaultWishlist(userID uint) (*models.Wishlist, error) {
+	wishlist, err := s.wishlistRepo.GetDefaultWishlist(userID)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return wishlist, err
+	}
+
+	wishlist = &models.Wishlist{UserID: userID, Name: defaultWishlistName, IsDefault: true}
+	return wishlist, s.wishlistRepo.CreateWishlist(wishlist)
+}
+
+func (s *WishlistService) setShareURL(wishlist *models.Wishlist) {
+	if wishlist.ShareToken != nil {
+		wishlist.ShareURL = fmt.Sprintf("%s/wishlists/shared/%s", s.storefrontURL, *wishlist.ShareToken)
+	}
+}
+
+func newShareToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// WishlistChange is what happened to a wishlisted book since the user last
+// heard about it
+type WishlistChange struct {
+	PriceDrop   bool
+	BackInStock bool
+}
+
+// DetectWishlistChange compares the item's book with what the user last saw
+func DetectWishlistChange(item *models.WishlistItem) WishlistChange {
+	return WishlistChange{
+		PriceDrop:   item.Book.NewPrice.Less(item.SeenPrice),
+		BackInStock: item.SeenAvailability != models.BookInStock && item.Book.Availability == models.BookInStock,
+	}
+}
+
+type WishlistNotifyReport struct {
+	Checked int `json:"checked"`
+	Emails  int `json:"emails"`
+	Failed  int `json:"failed"`
+}
+
+// NotifyChanges mails every user whose wishlisted books dropped in price or
+// came back in stock, one email per user per batch. Items are marked seen
+// once the user was told, or right away when nothing worth telling happened,
+// e.g. a price increase. Failed emails are retried on the next run
+func (s *WishlistService) NotifyChanges(ctx context.Context) (*WishlistNotifyReport, error) {
+	report := &WishlistNotifyReport{}
+	var afterID uint
+
+	for {
+		items, err := s.wishlistRepo.FindChangedItems(afterID, 500)
+		if err != nil || len(items) == 0 {
+			return report, err
+		}
+		afterID = items[len(items)-1].ID
+		report.Checked += len(items)
+
+		pending := map[uint][]*models.WishlistItem{}
+		for i := range items {
+			item := &items[i]
+			change := DetectWishlistChange(item)
+			if !change.PriceDrop && !change.BackInStock {
+				if err := s.wishlistRepo.MarkItemSeen(item); err != nil {
+					return report, err
+				}
+				continue
+			}
+			pending[item.Wishlist.UserID] = append(pending[item.Wishlist.UserID], item)
+		}
+
+		for userID, userItems := range pending {
+			if err := s.notifyUser(ctx, userID, userItems); err != nil {
+				slog.Error("Error sending wishlist notification", "user_id", userID, "error", err)
+				report.Failed++
+				continue
+			}
+			report.Emails++
+
+			for _, item := range userItems {
+				if err := s.wishlistRepo.MarkItemSeen(item); err != nil {
+					return report, err
+				}
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+	}
+}
+
+func (s *WishlistService) notifyUser(ctx context.Context, userID uint, items []*models.WishlistItem) error {
+	user, err := s.userRepo.GetUserById(userID)
+	if err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s,\n\nGood news about books on your wishlist:\n\n", user.Name)
+
+	// A book can be on several of the user's lists, mention it once
+	mentioned := map[uint]bool{}
+	for _, item := range items {
+		if mentioned[item.BookID] {
+			continue
+		}
+		mentioned[item.BookID] = true
+
+		change := DetectWishlistChange(item)
+		fmt.Fprintf(&body, "- %s", item.Book.Title)
+		if change.PriceDrop {
+			fmt.Fprintf(&body, ": now %s, was %s", item.Book.NewPrice, item.SeenPrice)
+		}
+		if change.BackInStock {
+			body.WriteString(" is back in stock")
+		}
+		fmt.Fprintf(&body, "\n  %s/books/%d\n", s.storefrontURL, item.BookID)
+	}
+	fmt.Fprintf(&body, "\nHappy reading,\n%s\n", s.storeName)
+
+	return s.mailer.Send(ctx, &mail.Message{
+		To:      []string{user.Email},
+		Subject: fmt.Sprintf("Books on your wishlist at %s", s.storeName),
+		Text:    body.String(),
+	})
+}
@@ -0,0 +1,81 @@
+// Package cache is a small in-memory cache whose entries expire after a fixed
+// time to live
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// TTL caches values for ttl. It is safe for concurrent use. Expired entries
+// are dropped when they are read or when the cache is swept on Set
+type TTL[K comparable, V any] struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	entries   map[K]entry[V]
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+func NewTTL[K comparable, V any](ttl time.Duration) *TTL[K, V] {
+	return &TTL[K, V]{ttl: ttl, entries: map[K]entry[V]{}, now: time.Now}
+}
+
+// SetClock replaces time.Now, so tests can expire entries without waiting
+func (c *TTL[K, V]) SetClock(now func() time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Get returns the cached value, if any and not expired
+func (c *TTL[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || !c.now().Before(e.expiresAt) {
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (c *TTL[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	// Drop expired entries now and then so keys that are never read again
+	// do not pile up
+	if now.After(c.nextSweep) {
+		for k, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+	c.entries[key] = entry[V]{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+// GetOrLoad returns the cached value or calls load and caches its result.
+// Errors are not cached
+func (c *TTL[K, V]) GetOrLoad(key K, load func() (V, error)) (V, error) {
+	if value, ok := c.Get(key); ok {
+		return value, nil
+	}
+
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+	c.Set(key, value)
+	return value, nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/pkg/money"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -63,8 +64,8 @@ func DatabaseSeeding() {
 			Category:    "Novel",
 			Trending:    true,
 			CoverImage:  "https://images-na.ssl-images-amazon.com/images/I/51Zymoq7UnL._AC_SY400_.jpg",
-			OldPrice:    10.99,
-			NewPrice:    9.99,
+			OldPrice:    money.New(1099, money.DefaultCurrency),
+			NewPrice:    money.New(999, money.DefaultCurrency),
 		},
 		{
 			Title:       "To Kill a Mockingbird",
@@ -72,8 +73,8 @@ func DatabaseSeeding() {
 			Category:    "Novel",
 			Trending:    true,
 			CoverImage:  "https://images-na.ssl-images-amazon.com/images/I/51Zymoq7UnL._AC_SY400_.jpg",
-			OldPrice:    10.99,
-			NewPrice:    9.99,
+			OldPrice:    money.New(1099, money.DefaultCurrency),
+			NewPrice:    money.New(999, money.DefaultCurrency),
 		},
 	}
 
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"gorm.io/gorm"
+)
+
+// moneyColumns are the columns that held prices as DOUBLE, or whole rupiah
+// as INT for the shipping cost, before amounts became minor units
+var moneyColumns = map[string][]string{
+	"books":              {"old_price", "new_price"},
+	"orders":             {"shipping_cost", "subtotal", "discount", "total_price"},
+	"coupons":            {"max_discount", "min_subtotal"},
+	"coupon_redemptions": {"discount"},
+	"price_rules":        {"sale_price"},
+	"price_rule_books":   {"regular_price", "sale_price"},
+	"price_changes":      {"old_price", "new_price"},
+	"wishlist_items":     {"seen_price"},
+}
+
+// MigrateMoneyColumns converts the old price columns to BIGINT minor units of
+// money.DefaultCurrency and splits the coupon value into percent_off and
+// amount_off. It runs before AutoMigrate and skips what is converted already,
+// so it is safe to run again after a failure. Amounts with more fraction
+// digits than the currency has are refused instead of rounded
+func MigrateMoneyColumns() error {
+	if err := splitCouponValue(DB); err != nil {
+		return fmt.Errorf("coupons.value: %w", err)
+	}
+	for table, columns := range moneyColumns {
+		for _, column := range columns {
+			if err := convertToMinorUnits(DB, table, column); err != nil {
+				return fmt.Errorf("%s.%s: %w", table, column, err)
+			}
+		}
+	}
+	return nil
+}
+
+func columnType(db *gorm.DB, table, column string) (string, error) {
+	var dataType string
+	err := db.Raw("SELECT DATA_TYPE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?", table, column).
+		Scan(&dataType).Error
+	return strings.ToLower(dataType), err
+}
+
+// minorUnits is the SQL expression of the column in minor units
+func minorUnits(column string) string {
+	factor := 1
+	for i := 0; i < money.Exponent(money.DefaultCurrency); i++ {
+		factor *= 10
+	}
+	return fmt.Sprintf("ROUND(CAST(`%s` AS DECIMAL(30,4)) * %d)", column, factor)
+}
+
+// checkLossless fails when a value of the column has more fraction digits
+// than the currency. The stored value itself is compared, a cast to a fixed
+// number of decimals would round away the digits it looks for
+func checkLossless(db *gorm.DB, table, column, where string) error {
+	exp := money.Exponent(money.DefaultCurrency)
+	var lossy int64
+	err := db.Table(table).
+		Where(fmt.Sprintf("`%s` <> ROUND(`%s`, %d)", column, column, exp)).
+		Where(where).Count(&lossy).Error
+	if err != nil {
+		return err
+	}
+	if lossy > 0 {
+		return fmt.Errorf("%d amounts have more than %d decimals, fix them before migrating", lossy, exp)
+	}
+	return nil
+}
+
+func convertToMinorUnits(db *gorm.DB, table, column string) error {
+	dataType, err := columnType(db, table, column)
+	if err != nil || dataType == "" || dataType == "bigint" {
+		return err
+	}
+	if err := checkLossless(db, table, column, "1 = 1"); err != nil {
+		return err
+	}
+
+	minor := column + "_minor"
+	if minorType, err := columnType(db, table, minor); err != nil {
+		return err
+	} else if minorType == "" {
+		err := db.Exec(fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` BIGINT NOT NULL DEFAULT 0", table, minor)).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	err = db.Exec(fmt.Sprintf("UPDATE `%s` SET `%s` = %s", table, minor, minorUnits(column))).Error
+	if err != nil {
+		return err
+	}
+	err = db.Exec(fmt.Sprintf("ALTER TABLE `%s` DROP COLUMN `%s`, CHANGE `%s` `%s` BIGINT NOT NULL DEFAULT 0", table, column, minor, column)).Error
+	if err != nil {
+		return err
+	}
+	slog.Info("Converted money column to minor units", "table", table, "column", column)
+	return nil
+}
+
+// splitCouponValue moves the value of percentage coupons to percent_off and
+// of fixed coupons to amount_off, in minor units
+func splitCouponValue(db *gorm.DB) error {
+	dataType, err := columnType(db, "coupons", "value")
+	if err != nil || dataType == "" {
+		return err
+	}
+	if err := checkLossless(db, "coupons", "value", "type = 'fixed'"); err != nil {
+		return err
+	}
+
+	added := map[string]string{"percent_off": "DOUBLE", "amount_off": "BIGINT"}
+	for column, sqlType := range added {
+		existing, err := columnType(db, "coupons", column)
+		if err != nil {
+			return err
+		}
+		if existing != "" {
+			continue
+		}
+		err = db.Exec(fmt.Sprintf("ALTER TABLE `coupons` ADD COLUMN `%s` %s NOT NULL DEFAULT 0", column, sqlType)).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	err = db.Exec(fmt.Sprintf("UPDATE `coupons` SET `percent_off` = IF(type = 'percentage', `value`, 0), `amount_off` = IF(type = 'fixed', %s, 0)", minorUnits("value"))).Error
+	if err != nil {
+		return err
+	}
+	if err := db.Exec("ALTER TABLE `coupons` DROP COLUMN `value`").Error; err != nil {
+		return err
+	}
+	slog.Info("Split coupon value into percent_off and amount_off")
+	return nil
+}
@@ -0,0 +1,73 @@
+// Package exchangerate fetches currency exchange rates from an HTTP API
+package exchangerate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrMissingRate is returned when the API has no rate for a currency asked for
+var ErrMissingRate = errors.New("exchangerate: no rate for currency")
+
+// Provider supplies the latest rates, as units of each currency one unit of
+// base buys
+type Provider interface {
+	Rates(ctx context.Context, base string, currencies []string) (map[string]float64, error)
+}
+
+// Client reads rates from an API answering {"rates": {"USD": 0.000061}} for
+// a base currency, such as open.er-api.com. URL contains {base}, e.g.
+// https://open.er-api.com/v6/latest/{base}
+type Client struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+func NewClient(url string) *Client {
+	return &Client{URL: url, HTTPClient: &http.Client{Timeout: 15 * time.Second}}
+}
+
+type ratesResponse struct {
+	Rates map[string]float64 `json:"rates"`
+}
+
+func (c *Client) Rates(ctx context.Context, base string, currencies []string) (map[string]float64, error) {
+	url := strings.ReplaceAll(c.URL, "{base}", base)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("exchangerate: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var body ratesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("exchangerate: decoding rates: %w", err)
+	}
+
+	rates := make(map[string]float64, len(currencies))
+	for _, currency := range currencies {
+		rate, ok := body.Rates[currency]
+		if !ok || rate <= 0 {
+			return nil, fmt.Errorf("%w %s", ErrMissingRate, currency)
+		}
+		rates[currency] = rate
+	}
+	return rates, nil
+}
@@ -0,0 +1,324 @@
+// Package money represents amounts as integer minor units of an ISO 4217
+// currency so prices add up exactly. The database stores the minor units in
+// the shop currency, JSON carries the amount as a decimal number of major
+// units, e.g. 99000.5 for Rp99.000,50
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the shop currency, amounts read from the database and
+// decoded from JSON are in it
+const DefaultCurrency = "IDR"
+
+var (
+	// ErrInvalidAmount is returned for amounts that are not a decimal number
+	// with at most as many fraction digits as the currency has
+	ErrInvalidAmount = errors.New("invalid money amount")
+	// ErrCurrencyMismatch is the panic value of arithmetic on two currencies
+	ErrCurrencyMismatch = errors.New("money amounts have different currencies")
+)
+
+// exponents are the ISO 4217 minor unit digits of the currencies the shop
+// knows, any other currency is assumed to have 2
+var exponents = map[string]int{
+	"IDR": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+}
+
+// Exponent is the number of fraction digits of the currency
+func Exponent(currency string) int {
+	if exp, ok := exponents[currency]; ok {
+		return exp
+	}
+	return 2
+}
+
+func scale(currency string) int64 {
+	s := int64(1)
+	for i := 0; i < Exponent(currency); i++ {
+		s *= 10
+	}
+	return s
+}
+
+// Money is an amount in minor units, e.g. sen for IDR. The zero value is
+// zero in no particular currency and combines with any currency
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// New is amount minor units of the currency
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// FromMajor is a whole number of major units of the currency
+func FromMajor(major int64, currency string) Money {
+	return Money{Amount: major * scale(currency), Currency: currency}
+}
+
+// IDR is a whole number of rupiah
+func IDR(rupiah int64) Money {
+	return FromMajor(rupiah, "IDR")
+}
+
+// Parse reads a decimal amount of major units such as "99000" or "-12.50"
+// exactly, rejecting more fraction digits than the currency has
+func Parse(s, currency string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	exp := Exponent(currency)
+	if whole == "" && fraction == "" || len(fraction) > exp || !digits(whole) || !digits(fraction) {
+		return Money{}, fmt.Errorf("%w %q", ErrInvalidAmount, s)
+	}
+
+	fraction += strings.Repeat("0", exp-len(fraction))
+	minor, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w %q", ErrInvalidAmount, s)
+	}
+	if negative {
+		minor = -minor
+	}
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Decimal formats the amount in major units with all fraction digits of the
+// currency, e.g. "99000.50"
+func (m Money) Decimal() string {
+	exp := Exponent(m.currency())
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+	s := strconv.FormatUint(absUint(amount), 10)
+	if exp == 0 {
+		return sign + s
+	}
+	if len(s) <= exp {
+		s = strings.Repeat("0", exp-len(s)+1) + s
+	}
+	return sign + s[:len(s)-exp] + "." + s[len(s)-exp:]
+}
+
+func absUint(amount int64) uint64 {
+	if amount < 0 {
+		return uint64(-(amount + 1)) + 1
+	}
+	return uint64(amount)
+}
+
+// String formats the amount in major units without trailing fraction zeros,
+// e.g. "99000" or "9.5"
+func (m Money) String() string {
+	s := m.Decimal()
+	if strings.Contains(s, ".") {
+		s = strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// Major is the amount in major units, rounded towards zero
+func (m Money) Major() int64 {
+	return m.Amount / scale(m.currency())
+}
+
+func (m Money) currency() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+// common is the currency of an operation on m and o, panicking when they
+// differ
+func (m Money) common(o Money) string {
+	switch {
+	case m.Currency == o.Currency || o.Currency == "":
+		return m.Currency
+	case m.Currency == "":
+		return o.Currency
+	}
+	panic(fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency))
+}
+
+func (m Money) Add(o Money) Money {
+	return Money{Amount: m.Amount + o.Amount, Currency: m.common(o)}
+}
+
+func (m Money) Sub(o Money) Money {
+	return Money{Amount: m.Amount - o.Amount, Currency: m.common(o)}
+}
+
+// Mul multiplies the amount by a whole number, e.g. a quantity
+func (m Money) Mul(n int64) Money {
+	return Money{Amount: m.Amount * n, Currency: m.Currency}
+}
+
+// Percent is percent of the amount, rounded half away from zero to a whole
+// major unit
+func (m Money) Percent(percent float64) Money {
+	return m.Ratio(percent, 100)
+}
+
+// Ratio is numerator/denominator of the amount, rounded half away from zero
+// to a whole major unit, e.g. Ratio(11, 111) for the tax included in a price
+func (m Money) Ratio(numerator, denominator float64) Money {
+	s := float64(scale(m.currency()))
+	major := math.Round(float64(m.Amount) * numerator / denominator / s)
+	return Money{Amount: int64(major) * int64(s), Currency: m.Currency}
+}
+
+// Convert changes the amount to another currency at rate, the number of
+// major units of currency one major unit of m is worth, rounded half away
+// from zero to the minor unit
+func (m Money) Convert(currency string, rate float64) Money {
+	major := float64(m.Amount) / float64(scale(m.currency())) * rate
+	return Money{Amount: int64(math.Round(major * float64(scale(currency)))), Currency: currency}
+}
+
+// Cmp is -1, 0 or 1 as m is less than, equal to or more than o
+func (m Money) Cmp(o Money) int {
+	m.common(o)
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	}
+	return 0
+}
+
+func (m Money) Less(o Money) bool {
+	return m.Cmp(o) < 0
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+// Min is the smaller of a and b
+func Min(a, b Money) Money {
+	if b.Less(a) {
+		return b
+	}
+	return a
+}
+
+// Sum adds up the amounts
+func Sum(amounts ...Money) Money {
+	var total Money
+	for _, amount := range amounts {
+		total = total.Add(amount)
+	}
+	return total
+}
+
+// MarshalJSON writes the amount as a number of major units, as String
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads a number or a numeric string of major units of
+// DefaultCurrency. Invalid amounts are reported as a *json.UnmarshalTypeError
+// like any other mistyped field
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	kind := "string"
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		kind = "number"
+		var number json.Number
+		if err := json.Unmarshal(data, &number); err != nil {
+			return &json.UnmarshalTypeError{Value: string(data), Type: reflect.TypeOf(*m)}
+		}
+		s = number.String()
+	}
+	parsed, err := Parse(s, DefaultCurrency)
+	if err != nil {
+		return &json.UnmarshalTypeError{Value: kind + " " + s, Type: reflect.TypeOf(*m)}
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores the minor units, only amounts in DefaultCurrency can be stored
+func (m Money) Value() (driver.Value, error) {
+	if m.Currency != "" && m.Currency != DefaultCurrency {
+		return nil, fmt.Errorf("%w: cannot store %s amounts", ErrCurrencyMismatch, m.Currency)
+	}
+	return m.Amount, nil
+}
+
+// Scan reads minor units of DefaultCurrency, including the decimal results
+// of SUM and friends
+func (m *Money) Scan(src interface{}) error {
+	var amount int64
+	switch v := src.(type) {
+	case nil:
+	case int64:
+		amount = v
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+	*m = Money{Amount: amount, Currency: DefaultCurrency}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	whole, fraction, _ := strings.Cut(s, ".")
+	if strings.Trim(fraction, "0") != "" {
+		return fmt.Errorf("money: %q is not a whole number of minor units", s)
+	}
+	amount, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return fmt.Errorf("money: %w", err)
+	}
+	*m = Money{Amount: amount, Currency: DefaultCurrency}
+	return nil
+}
+
+// GormDataType stores money as BIGINT
+func (Money) GormDataType() string {
+	return "bigint"
+}
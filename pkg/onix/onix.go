@@ -0,0 +1,287 @@
+// Package onix reads and writes ONIX for Books 3.0 messages using reference
+// tag names. Only the blocks the shop needs are modelled, everything else in
+// a Product record is skipped on read
+package onix
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	Namespace = "http://ns.editeur.org/onix/3.0/reference"
+	Release   = "3.0"
+)
+
+// Code list values used by the mapping, see the EDItEUR ONIX code lists
+const (
+	NotificationConfirmed = "03" // List 1
+	NotificationDelete    = "05"
+
+	ProductIDProprietary = "01" // List 5
+	ProductIDISBN13      = "15"
+
+	TitleDistinctive = "01" // List 15
+
+	TitleLevelProduct    = "01" // List 149
+	TitleLevelCollection = "02"
+
+	CollectionPublisher = "10" // List 148
+
+	ContributorAuthor = "A01" // List 17
+
+	ExtentMainContentPages = "00" // List 23
+	ExtentUnitPages        = "03" // List 24
+
+	MeasureUnitWeight = "08" // List 48
+
+	SubjectKeywords = "20" // List 26
+
+	TextDescription = "03" // List 153
+
+	ResourceFrontCover = "01" // List 158
+	ResourceModeImage  = "03" // List 159
+	ResourceFormLink   = "02" // List 161
+
+	PublishingRolePublisher = "01" // List 45
+
+	SupplierUnspecified = "00" // List 93
+
+	AvailabilityInStock    = "21" // List 65
+	AvailabilityOutOfStock = "31"
+	AvailabilityWithdrawn  = "40"
+
+	PriceRRPIncludingTax = "02" // List 58
+)
+
+type Message struct {
+	XMLName  xml.Name  `xml:"ONIXMessage"`
+	Release  string    `xml:"release,attr"`
+	Header   Header    `xml:"Header"`
+	Products []Product `xml:"Product"`
+}
+
+type Header struct {
+	SenderName   string `xml:"Sender>SenderName"`
+	SentDateTime string `xml:"SentDateTime"`
+}
+
+type Product struct {
+	RecordReference    string              `xml:"RecordReference"`
+	NotificationType   string              `xml:"NotificationType"`
+	ProductIdentifiers []ProductIdentifier `xml:"ProductIdentifier"`
+	DescriptiveDetail  DescriptiveDetail   `xml:"DescriptiveDetail"`
+	CollateralDetail   *CollateralDetail   `xml:"CollateralDetail,omitempty"`
+	PublishingDetail   *PublishingDetail   `xml:"PublishingDetail,omitempty"`
+	ProductSupply      []ProductSupply     `xml:"ProductSupply"`
+}
+
+type ProductIdentifier struct {
+	ProductIDType string `xml:"ProductIDType"`
+	IDValue       string `xml:"IDValue"`
+}
+
+type DescriptiveDetail struct {
+	ProductComposition string        `xml:"ProductComposition"`
+	ProductForm        string        `xml:"ProductForm"`
+	Measures           []Measure     `xml:"Measure"`
+	Collections        []Collection  `xml:"Collection"`
+	TitleDetails       []TitleDetail `xml:"TitleDetail"`
+	Contributors       []Contributor `xml:"Contributor"`
+	Extents            []Extent      `xml:"Extent"`
+	Subjects           []Subject     `xml:"Subject"`
+}
+
+type Measure struct {
+	MeasureType     string `xml:"MeasureType"`
+	Measurement     string `xml:"Measurement"`
+	MeasureUnitCode string `xml:"MeasureUnitCode"`
+}
+
+// Collection is the series a product belongs to
+type Collection struct {
+	CollectionType string        `xml:"CollectionType"`
+	TitleDetails   []TitleDetail `xml:"TitleDetail"`
+}
+
+type TitleDetail struct {
+	TitleType     string         `xml:"TitleType"`
+	TitleElements []TitleElement `xml:"TitleElement"`
+}
+
+type TitleElement struct {
+	TitleElementLevel  string `xml:"TitleElementLevel"`
+	TitlePrefix        string `xml:"TitlePrefix,omitempty"`
+	TitleWithoutPrefix string `xml:"TitleWithoutPrefix,omitempty"`
+	TitleText          string `xml:"TitleText,omitempty"`
+	Subtitle           string `xml:"Subtitle,omitempty"`
+}
+
+// Title joins the prefix form ("The" + "Great Gatsby") when TitleText is absent
+func (t TitleElement) Title() string {
+	if t.TitleText != "" {
+		return strings.TrimSpace(t.TitleText)
+	}
+	return strings.TrimSpace(strings.TrimSpace(t.TitlePrefix) + " " + strings.TrimSpace(t.TitleWithoutPrefix))
+}
+
+type Contributor struct {
+	SequenceNumber   string   `xml:"SequenceNumber,omitempty"`
+	ContributorRoles []string `xml:"ContributorRole"`
+	PersonName       string   `xml:"PersonName,omitempty"`
+	CorporateName    string   `xml:"CorporateName,omitempty"`
+}
+
+// Name returns the person or corporate name, whichever is present
+func (c Contributor) Name() string {
+	if c.PersonName != "" {
+		return strings.TrimSpace(c.PersonName)
+	}
+	return strings.TrimSpace(c.CorporateName)
+}
+
+type Extent struct {
+	ExtentType  string `xml:"ExtentType"`
+	ExtentValue string `xml:"ExtentValue"`
+	ExtentUnit  string `xml:"ExtentUnit"`
+}
+
+type Subject struct {
+	MainSubject             *struct{} `xml:"MainSubject,omitempty"`
+	SubjectSchemeIdentifier string    `xml:"SubjectSchemeIdentifier"`
+	SubjectCode             string    `xml:"SubjectCode,omitempty"`
+	SubjectHeadingText      string    `xml:"SubjectHeadingText,omitempty"`
+}
+
+type CollateralDetail struct {
+	TextContents        []TextContent        `xml:"TextContent"`
+	SupportingResources []SupportingResource `xml:"SupportingResource"`
+}
+
+type TextContent struct {
+	TextType        string `xml:"TextType"`
+	ContentAudience string `xml:"ContentAudience"`
+	Text            string `xml:"Text"`
+}
+
+type SupportingResource struct {
+	ResourceContentType string            `xml:"ResourceContentType"`
+	ContentAudience     string            `xml:"ContentAudience"`
+	ResourceMode        string            `xml:"ResourceMode"`
+	ResourceVersions    []ResourceVersion `xml:"ResourceVersion"`
+}
+
+type ResourceVersion struct {
+	ResourceForm string `xml:"ResourceForm"`
+	ResourceLink string `xml:"ResourceLink"`
+}
+
+type PublishingDetail struct {
+	Publishers []Publisher `xml:"Publisher"`
+}
+
+type Publisher struct {
+	PublishingRole string `xml:"PublishingRole"`
+	PublisherName  string `xml:"PublisherName"`
+}
+
+type ProductSupply struct {
+	SupplyDetails []SupplyDetail `xml:"SupplyDetail"`
+}
+
+type SupplyDetail struct {
+	Supplier            Supplier `xml:"Supplier"`
+	ProductAvailability string   `xml:"ProductAvailability"`
+	Prices              []Price  `xml:"Price"`
+}
+
+type Supplier struct {
+	SupplierRole string `xml:"SupplierRole"`
+	SupplierName string `xml:"SupplierName,omitempty"`
+}
+
+type Price struct {
+	PriceType    string `xml:"PriceType"`
+	PriceAmount  string `xml:"PriceAmount"`
+	CurrencyCode string `xml:"CurrencyCode"`
+}
+
+// Reader streams Product records so large feeds are never held in memory
+type Reader struct {
+	decoder *xml.Decoder
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{decoder: xml.NewDecoder(r)}
+}
+
+// Next returns the next Product or io.EOF when the message is exhausted
+func (r *Reader) Next() (*Product, error) {
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local == "product" {
+			return nil, errors.New("onix: short tag messages are not supported, send reference tags")
+		}
+		if start.Name.Local != "Product" {
+			continue
+		}
+
+		var product Product
+		if err := r.decoder.DecodeElement(&product, &start); err != nil {
+			return nil, err
+		}
+		return &product, nil
+	}
+}
+
+// Writer streams an ONIXMessage, call Close to finish the document
+type Writer struct {
+	encoder *xml.Encoder
+	root    xml.StartElement
+}
+
+func NewWriter(w io.Writer, header Header) (*Writer, error) {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return nil, err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	root := xml.StartElement{
+		Name: xml.Name{Local: "ONIXMessage"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "xmlns"}, Value: Namespace},
+			{Name: xml.Name{Local: "release"}, Value: Release},
+		},
+	}
+	if err := encoder.EncodeToken(root); err != nil {
+		return nil, err
+	}
+	if err := encoder.EncodeElement(header, xml.StartElement{Name: xml.Name{Local: "Header"}}); err != nil {
+		return nil, err
+	}
+
+	return &Writer{encoder: encoder, root: root}, nil
+}
+
+func (w *Writer) WriteProduct(product *Product) error {
+	return w.encoder.EncodeElement(product, xml.StartElement{Name: xml.Name{Local: "Product"}})
+}
+
+func (w *Writer) Close() error {
+	if err := w.encoder.EncodeToken(w.root.End()); err != nil {
+		return err
+	}
+	return w.encoder.Flush()
+}
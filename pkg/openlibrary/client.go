@@ -0,0 +1,168 @@
+package openlibrary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when the API has no record for the requested ISBN
+var ErrNotFound = errors.New("openlibrary: isbn not found")
+
+// Client talks to an Open Library compatible HTTP API
+type Client struct {
+	BaseURL    string
+	CoversURL  string
+	HTTPClient *http.Client
+}
+
+// Edition is the subset of an edition record used to draft a book
+type Edition struct {
+	ISBN        string
+	Title       string
+	Subtitle    string
+	Authors     []string
+	Publishers  []string
+	Description string
+	PageCount   int
+	CoverURL    string
+}
+
+func NewClient(baseURL, coversURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		CoversURL:  strings.TrimRight(coversURL, "/"),
+		HTTPClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// textValue accepts both the plain string and the {"type", "value"} forms
+// Open Library uses for free text fields such as description
+type textValue string
+
+func (t *textValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = textValue(s)
+		return nil
+	}
+
+	var typed struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return err
+	}
+	*t = textValue(typed.Value)
+	return nil
+}
+
+type booksResponse map[string]struct {
+	Details struct {
+		Title       string    `json:"title"`
+		Subtitle    string    `json:"subtitle"`
+		Description textValue `json:"description"`
+		PageCount   int       `json:"number_of_pages"`
+		Publishers  []string  `json:"publishers"`
+		Covers      []int64   `json:"covers"`
+		Authors     []struct {
+			Name string `json:"name"`
+		} `json:"authors"`
+	} `json:"details"`
+}
+
+// LookupISBN fetches the edition details for the given ISBN
+func (c *Client) LookupISBN(ctx context.Context, isbn string) (*Edition, error) {
+	isbn = NormalizeISBN(isbn)
+	if isbn == "" {
+		return nil, errors.New("openlibrary: isbn is required")
+	}
+
+	query := url.Values{}
+	query.Set("bibkeys", "ISBN:"+isbn)
+	query.Set("format", "json")
+	query.Set("jscmd", "details")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/books?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("openlibrary: unexpected status %d", resp.StatusCode)
+	}
+
+	var result booksResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	record, ok := result["ISBN:"+isbn]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	details := record.Details
+	edition := &Edition{
+		ISBN:        isbn,
+		Title:       details.Title,
+		Subtitle:    details.Subtitle,
+		Publishers:  details.Publishers,
+		Description: strings.TrimSpace(string(details.Description)),
+		PageCount:   details.PageCount,
+	}
+	for _, author := range details.Authors {
+		edition.Authors = append(edition.Authors, author.Name)
+	}
+
+	if len(details.Covers) > 0 && details.Covers[0] > 0 {
+		edition.CoverURL = fmt.Sprintf("%s/b/id/%d-L.jpg", c.CoversURL, details.Covers[0])
+	} else {
+		edition.CoverURL = fmt.Sprintf("%s/b/isbn/%s-L.jpg?default=false", c.CoversURL, isbn)
+	}
+
+	return edition, nil
+}
+
+// FetchCover downloads the cover image, the caller must close the body
+func (c *Client) FetchCover(ctx context.Context, coverURL string) (io.ReadCloser, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, coverURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, "", ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("openlibrary: unexpected cover status %d", resp.StatusCode)
+	}
+
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+// NormalizeISBN strips hyphens and spaces so "978-0-7432-7356-5" and
+// "9780743273565" address the same record
+func NormalizeISBN(isbn string) string {
+	replacer := strings.NewReplacer("-", "", " ", "")
+	return strings.ToUpper(replacer.Replace(strings.TrimSpace(isbn)))
+}
@@ -0,0 +1,95 @@
+package rajaongkir
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Fake answers from memory, for tests and local development without an API
+// key. Err, when set, is returned by every call
+type Fake struct {
+	ProvinceList []Province
+	CityList     []City
+	CostList     []Cost
+	Waybills     map[string]*Waybill // by waybill number
+	Err          error
+
+	mu       sync.Mutex
+	requests []CostRequest
+	tracked  int
+}
+
+func (f *Fake) Provinces(ctx context.Context) ([]Province, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return f.ProvinceList, nil
+}
+
+func (f *Fake) Cities(ctx context.Context, provinceID string) ([]City, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	var cities []City
+	for _, city := range f.CityList {
+		if provinceID == "" || city.ProvinceID == provinceID {
+			cities = append(cities, city)
+		}
+	}
+	return cities, nil
+}
+
+// Costs returns the costs of the couriers asked for and records the request
+func (f *Fake) Costs(ctx context.Context, req CostRequest) ([]Cost, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	couriers := strings.Split(strings.ToLower(req.Courier), ":")
+	var costs []Cost
+	for _, cost := range f.CostList {
+		for _, courier := range couriers {
+			if cost.Courier == courier {
+				costs = append(costs, cost)
+			}
+		}
+	}
+	return costs, nil
+}
+
+// Requests lists the cost requests made so far
+func (f *Fake) Requests() []CostRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]CostRequest(nil), f.requests...)
+}
+
+// Waybill returns the waybill of that number, unknown numbers are a bad
+// request like on RajaOngkir
+func (f *Fake) Waybill(ctx context.Context, number, courier string) (*Waybill, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tracked++
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	waybill, ok := f.Waybills[number]
+	if !ok || !strings.EqualFold(waybill.Courier, courier) {
+		return nil, &Error{Code: 400, Description: "Invalid waybill", kind: ErrBadRequest}
+	}
+	copied := *waybill
+	return &copied, nil
+}
+
+// Tracked is how many times a waybill was looked up
+func (f *Fake) Tracked() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.tracked
+}
@@ -0,0 +1,433 @@
+// Package rajaongkir talks to the RajaOngkir shipping API for Indonesian
+// provinces, cities and courier rates
+package rajaongkir
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/febriaricandra/book-shop/pkg/money"
+)
+
+var (
+	// ErrInvalidKey is returned when RajaOngkir does not know the API key
+	ErrInvalidKey = errors.New("rajaongkir: invalid api key")
+	// ErrQuotaExceeded is returned when the account used up its daily requests
+	ErrQuotaExceeded = errors.New("rajaongkir: request quota exceeded")
+	// ErrBadRequest is returned when RajaOngkir rejects the parameters, e.g.
+	// an unknown city
+	ErrBadRequest = errors.New("rajaongkir: bad request")
+	// ErrUnavailable is returned when RajaOngkir cannot be reached or fails
+	ErrUnavailable = errors.New("rajaongkir: service unavailable")
+	// ErrUnsupportedCourier is returned for couriers the account tier does not
+	// include
+	ErrUnsupportedCourier = errors.New("rajaongkir: courier not available on this account tier")
+	// ErrTrackingUnavailable is returned for waybill lookups on the starter
+	// tier, which cannot track parcels
+	ErrTrackingUnavailable = errors.New("rajaongkir: waybill tracking not available on this account tier")
+)
+
+// wib is the time zone RajaOngkir reports manifest times in
+var wib = time.FixedZone("WIB", 7*60*60)
+
+// Tier is the RajaOngkir account type, it decides the base URL and couriers
+type Tier string
+
+const (
+	Starter Tier = "starter"
+	Basic   Tier = "basic"
+	Pro     Tier = "pro"
+)
+
+var tierCouriers = map[Tier][]string{
+	Starter: {"jne", "pos", "tiki"},
+	Basic:   {"jne", "pos", "tiki", "pcp", "esl", "rpx"},
+	Pro: {"jne", "pos", "tiki", "rpx", "pandu", "wahana", "sicepat", "jnt", "pahala", "sap", "jet", "indah",
+		"dse", "slis", "first", "ncs", "star", "ninja", "lion", "idl", "rex", "ide", "sentral", "anteraja", "jtl"},
+}
+
+// ParseTier reads a tier name, case insensitive
+func ParseTier(name string) (Tier, error) {
+	tier := Tier(strings.ToLower(strings.TrimSpace(name)))
+	if _, ok := tierCouriers[tier]; !ok {
+		return "", fmt.Errorf("rajaongkir: unknown account tier %q", name)
+	}
+	return tier, nil
+}
+
+// BaseURL is where the tier's API lives
+func (t Tier) BaseURL() string {
+	if t == Pro {
+		return "https://pro.rajaongkir.com/api"
+	}
+	return "https://api.rajaongkir.com/" + string(t)
+}
+
+// Couriers lists the courier codes the tier can quote
+func (t Tier) Couriers() []string {
+	return tierCouriers[t]
+}
+
+// CanTrack reports whether the tier can look waybills up, starter cannot
+func (t Tier) CanTrack() bool {
+	return t != Starter
+}
+
+// SupportsCourier reports whether the tier can quote the courier
+func (t Tier) SupportsCourier(courier string) bool {
+	for _, code := range tierCouriers[t] {
+		if code == courier {
+			return true
+		}
+	}
+	return false
+}
+
+type Province struct {
+	ID   string `json:"province_id"`
+	Name string `json:"province"`
+}
+
+type City struct {
+	ID         string `json:"city_id"`
+	ProvinceID string `json:"province_id"`
+	Province   string `json:"province"`
+	Type       string `json:"type"` // Kabupaten or Kota
+	Name       string `json:"city_name"`
+	PostalCode string `json:"postal_code"`
+}
+
+// CostRequest asks for the rates of a courier between two cities. Weight is
+// in grams
+type CostRequest struct {
+	Origin      string
+	Destination string
+	Weight      int
+	Courier     string
+}
+
+// Cost is one service of a courier, e.g. JNE REG
+type Cost struct {
+	Courier     string      `json:"courier"`
+	CourierName string      `json:"courier_name"`
+	Service     string      `json:"service"`
+	Description string      `json:"description"`
+	Value       money.Money `json:"value"`
+	ETD         string      `json:"etd"` // estimated days in transit, e.g. "2-3"
+	Note        string      `json:"note,omitempty"`
+}
+
+// Waybill is where a parcel is, as reported by its courier
+type Waybill struct {
+	Number      string          `json:"waybill"`
+	Courier     string          `json:"courier"`
+	Service     string          `json:"service"`
+	Status      string          `json:"status"` // e.g. ON PROCESS or DELIVERED
+	Delivered   bool            `json:"delivered"`
+	Receiver    string          `json:"receiver,omitempty"`
+	DeliveredAt time.Time       `json:"delivered_at"`
+	Manifest    []ManifestEntry `json:"manifest"`
+}
+
+// ManifestEntry is one step of a parcel's journey, e.g. arriving at a hub
+type ManifestEntry struct {
+	Code        string    `json:"code"`
+	Description string    `json:"description"`
+	City        string    `json:"city"`
+	Time        time.Time `json:"time"`
+}
+
+// API is what the shop needs from RajaOngkir, Fake stands in for it in tests
+type API interface {
+	Provinces(ctx context.Context) ([]Province, error)
+	Cities(ctx context.Context, provinceID string) ([]City, error)
+	Costs(ctx context.Context, req CostRequest) ([]Cost, error)
+	Waybill(ctx context.Context, number, courier string) (*Waybill, error)
+}
+
+// Error is a failure reported by RajaOngkir, it unwraps to one of the Err
+// values above
+type Error struct {
+	Code        int
+	Description string
+	kind        error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %d %s", e.kind, e.Code, e.Description)
+}
+
+func (e *Error) Unwrap() error {
+	return e.kind
+}
+
+// Client calls the RajaOngkir API of an account
+type Client struct {
+	BaseURL    string
+	APIKey     string
+	Tier       Tier
+	HTTPClient *http.Client
+}
+
+// NewClient calls the tier's API, or baseURL when it is not empty
+func NewClient(apiKey string, tier Tier, baseURL string, timeout time.Duration) *Client {
+	if baseURL == "" {
+		baseURL = tier.BaseURL()
+	}
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		Tier:       tier,
+		HTTPClient: &http.Client{Timeout: timeout},
+	}
+}
+
+type envelope struct {
+	RajaOngkir struct {
+		Status struct {
+			Code        int    `json:"code"`
+			Description string `json:"description"`
+		} `json:"status"`
+		Results json.RawMessage `json:"results"`
+		Result  json.RawMessage `json:"result"` // waybill answers use the singular
+	} `json:"rajaongkir"`
+}
+
+func (c *Client) Provinces(ctx context.Context) ([]Province, error) {
+	var provinces []Province
+	err := c.do(ctx, http.MethodGet, "/province", nil, &provinces)
+	return provinces, err
+}
+
+// Cities lists the cities of the province, or every city when provinceID is
+// empty
+func (c *Client) Cities(ctx context.Context, provinceID string) ([]City, error) {
+	query := url.Values{}
+	if provinceID != "" {
+		query.Set("province", provinceID)
+	}
+
+	var cities []City
+	err := c.do(ctx, http.MethodGet, "/city?"+query.Encode(), nil, &cities)
+	return cities, err
+}
+
+type costResult struct {
+	Code  string `json:"code"`
+	Name  string `json:"name"`
+	Costs []struct {
+		Service     string `json:"service"`
+		Description string `json:"description"`
+		Cost        []struct {
+			Value int64  `json:"value"`
+			ETD   string `json:"etd"`
+			Note  string `json:"note"`
+		} `json:"cost"`
+	} `json:"costs"`
+}
+
+// Costs lists every service of the courier between the cities, several
+// couriers can be joined with colons on the basic and pro tiers
+func (c *Client) Costs(ctx context.Context, req CostRequest) ([]Cost, error) {
+	couriers := strings.Split(strings.ToLower(req.Courier), ":")
+	if len(couriers) > 1 && c.Tier == Starter {
+		return nil, fmt.Errorf("%w: starter accounts quote one courier at a time", ErrUnsupportedCourier)
+	}
+	for _, courier := range couriers {
+		if !c.Tier.SupportsCourier(courier) {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedCourier, courier)
+		}
+	}
+
+	form := url.Values{}
+	form.Set("origin", req.Origin)
+	form.Set("destination", req.Destination)
+	form.Set("weight", strconv.Itoa(req.Weight))
+	form.Set("courier", strings.Join(couriers, ":"))
+	if c.Tier == Pro {
+		form.Set("originType", "city")
+		form.Set("destinationType", "city")
+	}
+
+	var results []costResult
+	if err := c.do(ctx, http.MethodPost, "/cost", form, &results); err != nil {
+		return nil, err
+	}
+
+	var costs []Cost
+	for _, result := range results {
+		for _, service := range result.Costs {
+			for _, cost := range service.Cost {
+				costs = append(costs, Cost{
+					Courier:     result.Code,
+					CourierName: result.Name,
+					Service:     service.Service,
+					Description: service.Description,
+					Value:       money.IDR(cost.Value),
+					ETD:         cost.ETD,
+					Note:        cost.Note,
+				})
+			}
+		}
+	}
+	return costs, nil
+}
+
+type waybillResult struct {
+	Delivered bool `json:"delivered"`
+	Summary   struct {
+		CourierCode   string `json:"courier_code"`
+		WaybillNumber string `json:"waybill_number"`
+		ServiceCode   string `json:"service_code"`
+		Status        string `json:"status"`
+	} `json:"summary"`
+	DeliveryStatus struct {
+		Status      string `json:"status"`
+		PODReceiver string `json:"pod_receiver"`
+		PODDate     string `json:"pod_date"`
+		PODTime     string `json:"pod_time"`
+	} `json:"delivery_status"`
+	Manifest []struct {
+		Code        string `json:"manifest_code"`
+		Description string `json:"manifest_description"`
+		Date        string `json:"manifest_date"`
+		Time        string `json:"manifest_time"`
+		City        string `json:"city_name"`
+	} `json:"manifest"`
+}
+
+// Waybill tracks a parcel by its waybill number, on the basic and pro tiers
+func (c *Client) Waybill(ctx context.Context, number, courier string) (*Waybill, error) {
+	courier = strings.ToLower(courier)
+	if !c.Tier.CanTrack() {
+		return nil, ErrTrackingUnavailable
+	}
+	if !c.Tier.SupportsCourier(courier) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCourier, courier)
+	}
+
+	form := url.Values{}
+	form.Set("waybill", number)
+	form.Set("courier", courier)
+
+	var result waybillResult
+	if err := c.do(ctx, http.MethodPost, "/waybill", form, &result); err != nil {
+		return nil, err
+	}
+
+	waybill := &Waybill{
+		Number:    result.Summary.WaybillNumber,
+		Courier:   result.Summary.CourierCode,
+		Service:   result.Summary.ServiceCode,
+		Status:    result.Summary.Status,
+		Delivered: result.Delivered,
+		Receiver:  result.DeliveryStatus.PODReceiver,
+		Manifest:  make([]ManifestEntry, 0, len(result.Manifest)),
+	}
+	if waybill.Number == "" {
+		waybill.Number = number
+	}
+	if waybill.Courier == "" {
+		waybill.Courier = courier
+	}
+	if result.Delivered {
+		waybill.DeliveredAt = parseWIB(result.DeliveryStatus.PODDate, result.DeliveryStatus.PODTime)
+	}
+	for _, entry := range result.Manifest {
+		waybill.Manifest = append(waybill.Manifest, ManifestEntry{
+			Code:        entry.Code,
+			Description: entry.Description,
+			City:        entry.City,
+			Time:        parseWIB(entry.Date, entry.Time),
+		})
+	}
+	return waybill, nil
+}
+
+// parseWIB reads a RajaOngkir date and time, the time may lack seconds or be
+// missing. Unreadable dates are zero
+func parseWIB(date, clock string) time.Time {
+	value := strings.TrimSpace(date + " " + clock)
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, wib); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// do sends the request, form encoded when form is set, and decodes the
+// results of the answer into out
+func (c *Client) do(ctx context.Context, method, path string, form url.Values, out any) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("key", c.APIKey)
+	req.Header.Set("Accept", "application/json")
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	var answer envelope
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &Error{Code: resp.StatusCode, Description: resp.Status, kind: errorKind(resp.StatusCode, "")}
+		}
+		return fmt.Errorf("%w: decoding response: %w", ErrUnavailable, err)
+	}
+
+	status := answer.RajaOngkir.Status
+	if status.Code == 0 {
+		status.Code = resp.StatusCode
+	}
+	if status.Code != http.StatusOK {
+		return &Error{Code: status.Code, Description: status.Description, kind: errorKind(status.Code, status.Description)}
+	}
+
+	results := answer.RajaOngkir.Results
+	if len(results) == 0 || string(results) == "null" {
+		results = answer.RajaOngkir.Result
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(results, out); err != nil {
+		return fmt.Errorf("%w: decoding results: %w", ErrUnavailable, err)
+	}
+	return nil
+}
+
+// errorKind maps a RajaOngkir status to an error. RajaOngkir answers 400 for
+// most problems, the description tells a bad key or quota apart
+func errorKind(code int, description string) error {
+	description = strings.ToLower(description)
+	switch {
+	case code == http.StatusTooManyRequests || strings.Contains(description, "limit"):
+		return ErrQuotaExceeded
+	case code == http.StatusUnauthorized || code == http.StatusForbidden || strings.Contains(description, "key"):
+		return ErrInvalidKey
+	case code >= 400 && code < 500:
+		return ErrBadRequest
+	default:
+		return ErrUnavailable
+	}
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Store keeps objects in an S3 compatible bucket such as Cloudflare R2
+type S3Store struct {
+	client    *s3.Client
+	presigner *s3.PresignClient
+	bucket    string
+	publicURL string
+}
+
+func NewS3Store(client *s3.Client, bucket, publicURL string) *S3Store {
+	return &S3Store{
+		client:    client,
+		presigner: s3.NewPresignClient(client),
+		bucket:    bucket,
+		publicURL: strings.TrimRight(publicURL, "/"),
+	}
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	// The SDK needs a seekable body to sign the payload, buffer streams such
+	// as HTTP responses
+	if _, ok := body.(io.ReadSeeker); !ok {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType), // Set the Content-Type explicitly
+	})
+	return err
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, err
+	}
+
+	info := &ObjectInfo{
+		Key:         key,
+		ContentType: aws.ToString(out.ContentType),
+		Size:        aws.ToInt64(out.ContentLength),
+	}
+	if out.LastModified != nil {
+		info.LastModified = *out.LastModified
+	}
+	return out.Body, info, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *S3Store) PublicURL(key string) string {
+	return fmt.Sprintf("%s/%s", s.publicURL, key)
+}
+
+func (s *S3Store) KeyForURL(url string) (string, bool) {
+	return keyForURL(s.publicURL, url)
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, object := range page.Contents {
+			info := ObjectInfo{Key: aws.ToString(object.Key), Size: aws.ToInt64(object.Size)}
+			if object.LastModified != nil {
+				info.LastModified = *object.LastModified
+			}
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *S3Store) Presign(ctx context.Context, req PresignRequest) (*PresignedRequest, error) {
+	expires := func(o *s3.PresignOptions) { o.Expires = req.Expires }
+
+	var signed *PresignedRequest
+	switch req.Method {
+	case http.MethodGet:
+		out, err := s.presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(req.Key),
+		}, expires)
+		if err != nil {
+			return nil, err
+		}
+		signed = &PresignedRequest{Method: out.Method, URL: out.URL, Headers: out.SignedHeader}
+	case http.MethodPut:
+		input := &s3.PutObjectInput{
+			Bucket:      aws.String(s.bucket),
+			Key:         aws.String(req.Key),
+			ContentType: aws.String(req.ContentType),
+		}
+		if req.ContentLength > 0 {
+			input.ContentLength = aws.Int64(req.ContentLength)
+		}
+		out, err := s.presigner.PresignPutObject(ctx, input, expires)
+		if err != nil {
+			return nil, err
+		}
+		signed = &PresignedRequest{Method: out.Method, URL: out.URL, Headers: out.SignedHeader}
+	default:
+		return nil, ErrUnsupported
+	}
+
+	signed.ExpiresAt = time.Now().Add(req.Expires)
+	// Host is implied by the URL and browsers refuse to set it
+	signed.Headers.Del("Host")
+	return signed, nil
+}
@@ -0,0 +1,67 @@
+// Package storage hides where uploaded objects such as book covers live, so
+// handlers work the same against R2/S3 and the local disk
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the key does not exist in the store
+	ErrNotFound = errors.New("storage: object not found")
+	// ErrUnsupported is returned by backends that cannot perform an operation
+	ErrUnsupported = errors.New("storage: operation not supported by this backend")
+)
+
+type ObjectStore interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	// Get returns the object body, the caller must close it
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	PublicURL(key string) string
+	// KeyForURL is the inverse of PublicURL, ok is false for URLs that do not
+	// point into this store
+	KeyForURL(url string) (key string, ok bool)
+	// List calls fn for every object whose key starts with prefix
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+	Presign(ctx context.Context, req PresignRequest) (*PresignedRequest, error)
+}
+
+type ObjectInfo struct {
+	Key          string
+	ContentType  string
+	Size         int64
+	LastModified time.Time
+}
+
+// PresignRequest describes a request a client may make without credentials.
+// For PUT, ContentType and ContentLength are part of the signature so the
+// client cannot upload anything else
+type PresignRequest struct {
+	Method        string
+	Key           string
+	ContentType   string
+	ContentLength int64
+	Expires       time.Duration
+}
+
+type PresignedRequest struct {
+	Method    string      `json:"method"`
+	URL       string      `json:"url"`
+	Headers   http.Header `json:"headers"`
+	ExpiresAt time.Time   `json:"expires_at"`
+}
+
+// keyForURL strips the public URL prefix shared by the backends
+func keyForURL(publicURL, url string) (string, bool) {
+	key, ok := strings.CutPrefix(url, publicURL+"/")
+	if !ok || key == "" {
+		return "", false
+	}
+	return key, true
+}
@@ -0,0 +1,125 @@
+package features
+
+import (
+	"testing"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// Feature: Deleting and restoring books
+//
+//	As an admin
+//	I want to remove books without breaking the orders that hold them
+//	So the storefront only shows what can be bought
+//
+//	Scenario: Deleting a book nobody is waiting for
+//		Given a book that was only in a delivered order
+//		When it is deleted
+//		Then it is soft deleted and listed with the deleted books
+//		And restoring it brings it back to the storefront
+//
+//	Scenario: Deleting a book in an open order
+//		Given a book in a pending order
+//		When it is deleted
+//		Then it is archived instead
+//		And edits made against the version before archiving conflict
+//		And the storefront neither lists nor shows it
+//		But admins still see it
+//		And restoring it brings it back to the storefront
+//		And moves it to a new version
+
+func newBookFixture(t *testing.T, orderStatus string) (*gorm.DB, *services.BookService, *models.Book) {
+	db := newTestDB(t)
+	book := &models.Book{Title: "Laskar Pelangi", Category: "Novel", NewPrice: money.IDR(89000)}
+	if err := repositories.NewBookRepository(db).CreateBook(book); err != nil {
+		t.Fatal(err)
+	}
+	order := &models.Order{Name: "Ani", Status: orderStatus, UserId: 1}
+	if err := db.Omit("Books", "Taxes", "User").Create(order).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.OrderBook{OrderID: order.ID, BookID: book.ID, Price: book.NewPrice}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, services.NewBookService(repositories.NewBookRepository(db)), book
+}
+
+func TestDeleteBook(t *testing.T) {
+	// Given a book that was only in a delivered order
+	_, books, book := newBookFixture(t, models.OrderDelivered)
+
+	// When it is deleted
+	archived, err := books.DeleteBook(book.ID)
+
+	// Then it is soft deleted and listed with the deleted books
+	assert.NoError(t, err)
+	assert.False(t, archived)
+	_, err = books.GetBookById(book.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	deleted, total, err := books.GetDeletedBooks(1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	if assert.Len(t, deleted, 1) {
+		assert.Equal(t, book.ID, deleted[0].ID)
+	}
+
+	// And restoring it brings it back to the storefront
+	assert.NoError(t, books.RestoreBook(book.ID))
+	listed, total, err := books.GetAllBooks(1, 10, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Len(t, listed, 1)
+}
+
+func TestDeleteBookInOpenOrder(t *testing.T) {
+	// Given a book in a pending order
+	_, books, book := newBookFixture(t, models.OrderPending)
+
+	// When it is deleted
+	archived, err := books.DeleteBook(book.ID)
+
+	// Then it is archived instead
+	assert.NoError(t, err)
+	assert.True(t, archived)
+	stored, err := books.GetBookById(book.ID)
+	if assert.NoError(t, err) {
+		assert.NotNil(t, stored.ArchivedAt)
+		assert.Equal(t, uint(2), stored.Version)
+	}
+
+	// And edits made against the version before archiving conflict
+	title := "Sang Pemimpi"
+	_, _, err = books.PatchBook(book.ID, 1, 1, &services.BookPatch{Title: &title})
+	assert.ErrorIs(t, err, repositories.ErrVersionConflict)
+
+	// And the storefront neither lists nor shows it
+	_, total, err := books.GetAllBooks(1, 10, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, total)
+	_, err = books.GetBookWithImages(book.ID, false)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// But admins still see it
+	shown, err := books.GetBookWithImages(book.ID, true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Laskar Pelangi", shown.Title)
+	}
+
+	// And restoring it brings it back to the storefront
+	assert.NoError(t, books.RestoreBook(book.ID))
+	restored, err := books.GetBookWithImages(book.ID, false)
+	assert.NoError(t, err)
+
+	// And moves it to a new version
+	if assert.NotNil(t, restored) {
+		assert.Equal(t, uint(3), restored.Version)
+	}
+
+	// And unknown books cannot be restored
+	assert.ErrorIs(t, books.RestoreBook(999), gorm.ErrRecordNotFound)
+}
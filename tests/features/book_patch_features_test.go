@@ -0,0 +1,185 @@
+package features
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/febriaricandra/book-shop/internal/handlers"
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Partial book updates
+//
+//	As an admin
+//	I want to change single fields of a book without resending the rest
+//	So two admins editing the same book do not overwrite each other
+//
+//	Scenario: Patching without If-Match
+//		Given a stored book
+//		When it is patched without an If-Match header
+//		Then the response status code should be 428
+//
+//	Scenario: Patching with the current ETag
+//		Given a stored book and its ETag
+//		When only the price is patched with that ETag
+//		Then the response status code should be 200
+//		And the other fields are left alone
+//		And a new ETag with the next version is returned
+//
+//	Scenario: Patching with a stale ETag
+//		Given a book that was changed after its ETag was read
+//		When it is patched with the old ETag
+//		Then the response status code should be 412
+//		And the current ETag is returned
+//		And nothing is saved
+//
+//	Scenario: Patching with an ETag of another book
+//		Given a stored book
+//		When it is patched with the ETag of another book
+//		Then the response status code should be 412
+//
+//	Scenario: Patching invalid fields
+//		Given a stored book and its ETag
+//		When a field is emptied, made negative or sent with the wrong type
+//		Then the response status code should be 422
+//		And the errors are keyed by the field
+
+func newPatchRouter(t *testing.T) (*gin.Engine, *services.BookService, *models.Book) {
+	gin.SetMode(gin.TestMode)
+	books := services.NewBookService(repositories.NewBookRepository(newTestDB(t)))
+	book := &models.Book{Title: "Bumi Manusia", Author: "Pramoedya Ananta Toer", Category: "Novel", NewPrice: money.IDR(120000), Weight: 450}
+	if err := books.CreateBook(book); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	h := handlers.NewBookHandler(books, nil, nil, nil)
+	router.PATCH("/api/books/:id", func(c *gin.Context) {
+		c.Set("userId", uint(1))
+		c.Set("isAdmin", true)
+	}, h.PatchBook)
+	return router, books, book
+}
+
+func patchBook(router *gin.Engine, id, ifMatch, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, "/api/books/"+id, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPatchBookWithoutIfMatch(t *testing.T) {
+	// Given a stored book
+	router, _, _ := newPatchRouter(t)
+
+	// When it is patched without an If-Match header
+	rr := patchBook(router, "1", "", `{"title":"Anak Semua Bangsa"}`)
+
+	// Then the response status code should be 428
+	assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+}
+
+func TestPatchBookWithCurrentETag(t *testing.T) {
+	// Given a stored book and its ETag
+	router, books, _ := newPatchRouter(t)
+
+	// When only the price is patched with that ETag
+	rr := patchBook(router, "1", `"1-1"`, `{"new_price":99000}`)
+
+	// Then the response status code should be 200
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// And the other fields are left alone
+	stored, err := books.GetBookById(1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, money.IDR(99000), stored.NewPrice)
+		assert.Equal(t, "Bumi Manusia", stored.Title)
+		assert.Equal(t, "Pramoedya Ananta Toer", stored.Author)
+		assert.Equal(t, "Novel", stored.Category)
+		assert.Equal(t, int64(450), stored.Weight)
+	}
+
+	// And a new ETag with the next version is returned
+	assert.Equal(t, `"1-2"`, rr.Header().Get("ETag"))
+}
+
+func TestPatchBookWithStaleETag(t *testing.T) {
+	// Given a book that was changed after its ETag was read
+	router, books, _ := newPatchRouter(t)
+	assert.Equal(t, http.StatusOK, patchBook(router, "1", `"1-1"`, `{"author":"Pram"}`).Code)
+
+	// When it is patched with the old ETag
+	rr := patchBook(router, "1", `"1-1"`, `{"title":"Anak Semua Bangsa"}`)
+
+	// Then the response status code should be 412
+	assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+	// And the current ETag is returned
+	assert.Equal(t, `"1-2"`, rr.Header().Get("ETag"))
+
+	// And nothing is saved
+	stored, err := books.GetBookById(1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Bumi Manusia", stored.Title)
+		assert.Equal(t, "Pram", stored.Author)
+		assert.Equal(t, uint(2), stored.Version)
+	}
+}
+
+func TestPatchBookWithOtherBookETag(t *testing.T) {
+	// Given a stored book
+	router, _, _ := newPatchRouter(t)
+
+	// When it is patched with the ETag of another book
+	rr := patchBook(router, "1", `"2-1"`, `{"title":"Anak Semua Bangsa"}`)
+
+	// Then the response status code should be 412
+	assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+}
+
+func TestPatchBookValidation(t *testing.T) {
+	// Given a stored book and its ETag
+	router, books, _ := newPatchRouter(t)
+
+	cases := []struct {
+		body  string
+		field string
+	}{
+		{`{"title":"  "}`, "title"},
+		{`{"new_price":-1}`, "new_price"},
+		{`{"weight":-5}`, "weight"},
+		{`{"availability":"soon"}`, "availability"},
+		{`{"page_count":"many"}`, "page_count"},
+	}
+	for _, tc := range cases {
+		// When a field is emptied, made negative or sent with the wrong type
+		rr := patchBook(router, "1", `"1-1"`, tc.body)
+
+		// Then the response status code should be 422
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, tc.body)
+
+		// And the errors are keyed by the field
+		var response struct {
+			Errors map[string]string `json:"errors"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Contains(t, response.Errors, tc.field, tc.body)
+	}
+
+	stored, err := books.GetBookById(1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint(1), stored.Version)
+	}
+}
@@ -0,0 +1,151 @@
+package features
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Bulk catalog import
+//
+//	As an admin
+//	I want to upload a supplier catalog as CSV or JSON
+//	So I do not have to create thousands of books one by one
+//
+//	Scenario: Parsing a CSV catalog with a bad row
+//		Given a CSV catalog with a valid row and a row with an unparsable price
+//		When the catalog is parsed
+//		Then the valid row is returned with the columns it provides
+//		And the bad row is reported with its line number and field
+//
+//	Scenario: Parsing a JSON catalog with a bad row
+//		Given a JSON catalog where one book has a string weight
+//		When the catalog is parsed
+//		Then the bad row is reported with its position and field
+//
+//	Scenario: Upserting only the columns present
+//		Given an existing book
+//		When a row without a description is applied
+//		Then the description is kept
+//
+//	Scenario: Leaving numeric cells empty
+//		Given an existing book with prices, weight and page count
+//		When a row with every numeric cell empty is applied
+//		Then none of them change
+//
+//	Scenario: Validating rows like the book form
+//		Given a new book row with a 256 character title and no category
+//		And a row that empties an existing book's category
+//		When the rows are validated
+//		Then they fail with the book form's messages
+
+func TestParseCatalogCSV(t *testing.T) {
+	// Given a CSV catalog with a valid row and a row with an unparsable price
+	csv := "isbn,title,category,new_price\n" +
+		"978-0-7432-7356-5,The Great Gatsby,Novel,9.99\n" +
+		"9780061120084,To Kill a Mockingbird,Novel,abc\n"
+
+	// When the catalog is parsed
+	rows, rowErrors, err := services.ParseCatalog(services.CatalogFormatCSV, strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Then the valid row is returned with the columns it provides
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "9780743273565", rows[0].ISBN)
+	assert.Equal(t, money.New(999, "IDR"), rows[0].NewPrice)
+	assert.True(t, rows[0].Fields["new_price"])
+	assert.False(t, rows[0].Fields["description"])
+	assert.Empty(t, rows[0].Validate(nil))
+
+	// And the bad row is reported with its line number and field
+	assert.Equal(t, []services.RowError{{Line: 3, Field: "new_price", Message: `invalid value "abc"`}}, rowErrors)
+}
+
+func TestParseCatalogJSON(t *testing.T) {
+	// Given a JSON catalog where one book has a string weight
+	json := `[
+		{"title": "The Great Gatsby", "category": "Novel", "weight": 300},
+		{"title": "To Kill a Mockingbird", "category": "Novel", "weight": "heavy"}
+	]`
+
+	// When the catalog is parsed
+	rows, rowErrors, err := services.ParseCatalog(services.CatalogFormatJSON, strings.NewReader(json))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Then the bad row is reported with its position and field
+	assert.Len(t, rows, 1)
+	assert.Equal(t, int64(300), rows[0].Weight)
+	assert.Len(t, rowErrors, 1)
+	assert.Equal(t, 2, rowErrors[0].Line)
+	assert.Equal(t, "weight", rowErrors[0].Field)
+}
+
+func TestCatalogRowApply(t *testing.T) {
+	// Given an existing book
+	book := models.Book{Title: "Old title", Description: "Keep me", Category: "Novel"}
+
+	// When a row without a description is applied
+	rows, _, err := services.ParseCatalog(services.CatalogFormatCSV, strings.NewReader("title\nNew title\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows[0].Apply(&book)
+
+	// Then the description is kept
+	assert.Equal(t, "New title", book.Title)
+	assert.Equal(t, "Keep me", book.Description)
+	assert.Empty(t, rows[0].Validate(&book))
+}
+
+func TestCatalogBlankNumericCells(t *testing.T) {
+	// Given an existing book with prices, weight and page count
+	book := models.Book{Title: "Dune", Category: "Novel", Trending: true, OldPrice: money.IDR(150000), NewPrice: money.IDR(120000), Weight: 450, PageCount: 600}
+
+	// When a row with every numeric cell empty is applied
+	csv := "id,title,trending,old_price,new_price,weight,page_count\n,Dune Messiah,,,,,\n"
+	rows, rowErrors, err := services.ParseCatalog(services.CatalogFormatCSV, strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, rowErrors)
+	rows[0].Apply(&book)
+
+	// Then none of them change
+	assert.Equal(t, "Dune Messiah", book.Title)
+	assert.True(t, book.Trending)
+	assert.Equal(t, money.IDR(150000), book.OldPrice)
+	assert.Equal(t, money.IDR(120000), book.NewPrice)
+	assert.Equal(t, int64(450), book.Weight)
+	assert.Equal(t, 600, book.PageCount)
+	assert.Equal(t, map[string]bool{"title": true}, rows[0].Fields)
+}
+
+func TestCatalogRowValidate(t *testing.T) {
+	// Given a new book row with a 256 character title and no category
+	csv := "isbn,title,category\n" +
+		"9780061120084," + strings.Repeat("a", 256) + ",\n" +
+		",Dune,\n"
+	rows, _, err := services.ParseCatalog(services.CatalogFormatCSV, strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// And a row that empties an existing book's category
+	book := models.Book{Title: "Dune", Category: "Novel"}
+
+	// When the rows are validated
+	// Then they fail with the book form's messages
+	assert.Equal(t, []services.RowError{
+		{Line: 2, Field: "category", Message: "must not be empty"},
+		{Line: 2, Field: "title", Message: "must be at most 255 characters"},
+	}, rows[0].Validate(nil))
+	assert.Equal(t, []services.RowError{{Line: 3, Field: "category", Message: "must not be empty"}}, rows[1].Validate(&book))
+}
@@ -0,0 +1,152 @@
+package features
+
+import (
+	"testing"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Discount coupons
+//
+//	As a customer
+//	I want to enter a coupon code at checkout
+//	So I pay less for my order
+//
+//	Scenario: Applying a percentage coupon restricted to a category
+//		Given a cart with a novel and a cookbook
+//		And a 10% coupon for fiction capped at 12000
+//		When the coupon is applied
+//		Then only the novel is discounted, up to the cap
+//
+//	Scenario: Coupons that cannot be used
+//		Given a coupon outside its validity window, below its minimum or for other books
+//		When it is applied
+//		Then the customer is told why
+//
+//	Scenario: Fixed and free shipping coupons
+//		Given a fixed coupon worth more than the eligible books
+//		When it is applied
+//		Then it takes off no more than the books cost
+//		And a free shipping coupon takes off the shipping cost
+//
+//	Scenario: Creating a coupon
+//		Given a coupon with a lower case code, a percentage over 100 and an end before its start
+//		When it is validated
+//		Then the code is upper cased and the percentage and end are reported
+//
+//	Scenario: Creating an inactive coupon
+//		Given a coupon created with active set to false
+//		When it is read back
+//		Then it is still inactive
+//		And a coupon created without active is active
+
+var couponCart = []models.Book{
+	{BaseModel: models.BaseModel{ID: 1}, Category: "Fiction", NewPrice: money.IDR(150000)},
+	{BaseModel: models.BaseModel{ID: 2}, Category: "Cooking", NewPrice: money.IDR(90000)},
+}
+
+func TestPercentageCoupon(t *testing.T) {
+	// Given a cart with a novel and a cookbook
+	// And a 10% coupon for fiction capped at 12000
+	coupon := &models.Coupon{Type: models.CouponPercentage, PercentOff: 10, Categories: []string{"fiction"}, Active: true}
+
+	// When the coupon is applied
+	discount, err := services.CouponDiscount(coupon, couponCart, money.IDR(20000), time.Now())
+
+	// Then only the novel is discounted, up to the cap
+	assert.NoError(t, err)
+	assert.Equal(t, money.IDR(15000), discount)
+
+	coupon.MaxDiscount = money.IDR(12000)
+	discount, err = services.CouponDiscount(coupon, couponCart, money.IDR(20000), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, money.IDR(12000), discount)
+}
+
+func TestUnusableCoupons(t *testing.T) {
+	// Given a coupon outside its validity window, below its minimum or for other books
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tomorrow, yesterday := now.AddDate(0, 0, 1), now.AddDate(0, 0, -1)
+	cases := map[error]*models.Coupon{
+		services.ErrCouponInactive:      {Type: models.CouponFixed, AmountOff: money.IDR(5000)},
+		services.ErrCouponNotStarted:    {Type: models.CouponFixed, AmountOff: money.IDR(5000), Active: true, StartsAt: &tomorrow},
+		services.ErrCouponExpired:       {Type: models.CouponFixed, AmountOff: money.IDR(5000), Active: true, EndsAt: &yesterday},
+		services.ErrCouponMinSubtotal:   {Type: models.CouponFixed, AmountOff: money.IDR(5000), Active: true, MinSubtotal: money.IDR(500000)},
+		services.ErrCouponNotApplicable: {Type: models.CouponFixed, AmountOff: money.IDR(5000), Active: true, BookIDs: []uint{99}},
+	}
+
+	for expected, coupon := range cases {
+		// When it is applied
+		_, err := services.CouponDiscount(coupon, couponCart, money.IDR(20000), now)
+
+		// Then the customer is told why
+		assert.ErrorIs(t, err, expected)
+	}
+}
+
+func TestFixedAndFreeShippingCoupons(t *testing.T) {
+	// Given a fixed coupon worth more than the eligible books
+	coupon := &models.Coupon{Type: models.CouponFixed, AmountOff: money.IDR(100000), BookIDs: []uint{2}, Active: true}
+
+	// When it is applied
+	discount, err := services.CouponDiscount(coupon, couponCart, money.IDR(20000), time.Now())
+
+	// Then it takes off no more than the books cost
+	assert.NoError(t, err)
+	assert.Equal(t, money.IDR(90000), discount)
+
+	// And a free shipping coupon takes off the shipping cost
+	coupon = &models.Coupon{Type: models.CouponFreeShipping, Active: true}
+	discount, err = services.CouponDiscount(coupon, couponCart, money.IDR(20000), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, money.IDR(20000), discount)
+}
+
+func TestValidateCoupon(t *testing.T) {
+	// Given a coupon with a lower case code, a percentage over 100 and an end before its start
+	starts := time.Now()
+	ends := starts.Add(-time.Hour)
+	input := services.CouponInput{Code: " welcome10 ", Type: models.CouponPercentage, PercentOff: 110, StartsAt: &starts, EndsAt: &ends}
+
+	// When it is validated
+	errs := input.Validate()
+
+	// Then the code is upper cased and the percentage and end are reported
+	assert.Equal(t, "WELCOME10", input.Code)
+	assert.Contains(t, errs, "percent_off")
+	assert.Contains(t, errs, "ends_at")
+	assert.NotContains(t, errs, "code")
+}
+
+func TestCreateInactiveCoupon(t *testing.T) {
+	// Given a coupon created with active set to false
+	db := newTestDB(t)
+	coupons := services.NewCouponService(repositories.NewCouponRepository(db))
+	inactive := false
+	created, errs, err := coupons.CreateCoupon(&services.CouponInput{Code: "LATER10", Type: models.CouponPercentage, PercentOff: 10, Active: &inactive})
+	if err != nil || len(errs) > 0 {
+		t.Fatal(err, errs)
+	}
+
+	// When it is read back
+	stored, err := coupons.GetCoupon(created.ID)
+
+	// Then it is still inactive
+	assert.False(t, created.Active)
+	if assert.NoError(t, err) {
+		assert.False(t, stored.Active)
+	}
+
+	// And a coupon created without active is active
+	created, _, err = coupons.CreateCoupon(&services.CouponInput{Code: "NOW10", Type: models.CouponPercentage, PercentOff: 10})
+	if assert.NoError(t, err) {
+		stored, err = coupons.GetCoupon(created.ID)
+		assert.NoError(t, err)
+		assert.True(t, stored.Active)
+	}
+}
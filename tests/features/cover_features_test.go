@@ -0,0 +1,216 @@
+package features
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/febriaricandra/book-shop/internal/media"
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Cover image processing
+//
+//	As a customer
+//	I want covers in the size and format my screen needs
+//	So pages load fast on every device
+//
+//	Scenario: Processing a large cover
+//		Given a 1000x1500 cover upload
+//		When it is processed
+//		Then a JPEG and a WebP are produced for every size, scaled to its width
+//		And the keys are the same every time the same file is uploaded
+//
+//	Scenario: Processing a small cover
+//		Given a cover narrower than every size
+//		When it is processed
+//		Then no variant is upscaled
+//
+//	Scenario: Uploading something that is not an image
+//		Given a text file
+//		When it is processed
+//		Then ErrInvalidImage is returned
+//
+//	Scenario: Validating uploads against the policy
+//		Given a policy allowing JPEG and PNG up to 64KB and 500x500
+//		When an HTML file, an oversized file and a 600x400 PNG are validated
+//		Then they are rejected as unsupported, too large and too large in dimensions
+//		And a 300x300 PNG is accepted
+//
+//	Scenario: Failing to store a cover halfway
+//		Given a bucket that fails on the fourth upload and a book already using the same image
+//		When a cover is stored
+//		Then the error is returned
+//		And the variants already uploaded are removed
+//		But the variant the other book uses is kept
+
+func coverPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessLargeCover(t *testing.T) {
+	// Given a 1000x1500 cover upload
+	source := coverPNG(t, 1000, 1500)
+
+	// When it is processed
+	variants, err := media.ProcessCover(bytes.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Then a JPEG and a WebP are produced for every size, scaled to its width
+	assert.Len(t, variants, len(media.CoverSizes)*2)
+	widths := map[string]int{}
+	for _, size := range media.CoverSizes {
+		widths[size.Name] = size.Width
+	}
+	for _, variant := range variants {
+		assert.Equal(t, widths[variant.Size], variant.Width, variant.Key)
+		assert.Equal(t, widths[variant.Size]*3/2, variant.Height, variant.Key)
+		assert.NotEmpty(t, variant.Data)
+		if variant.Format == media.FormatJPEG {
+			decoded, err := jpeg.Decode(bytes.NewReader(variant.Data))
+			assert.NoError(t, err)
+			assert.Equal(t, variant.Width, decoded.Bounds().Dx())
+		}
+	}
+
+	// And the keys are the same every time the same file is uploaded
+	again, err := media.ProcessCover(bytes.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range variants {
+		assert.Equal(t, variants[i].Key, again[i].Key)
+	}
+	assert.Regexp(t, `^covers/[0-9a-f]{32}/thumbnail\.jpg$`, variants[0].Key)
+}
+
+func TestProcessSmallCover(t *testing.T) {
+	// Given a cover narrower than every size
+	source := coverPNG(t, 100, 150)
+
+	// When it is processed
+	variants, err := media.ProcessCover(bytes.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Then no variant is upscaled
+	for _, variant := range variants {
+		assert.Equal(t, 100, variant.Width, variant.Key)
+		assert.Equal(t, 150, variant.Height, variant.Key)
+	}
+}
+
+func TestProcessInvalidCover(t *testing.T) {
+	// Given a text file
+	source := []byte("definitely not an image")
+
+	// When it is processed
+	_, err := media.ProcessCover(bytes.NewReader(source))
+
+	// Then ErrInvalidImage is returned
+	assert.ErrorIs(t, err, media.ErrInvalidImage)
+}
+
+func TestCoverUploadPolicy(t *testing.T) {
+	// Given a policy allowing JPEG and PNG up to 64KB and 500x500
+	policy := media.UploadPolicy{
+		MaxBytes:     64 << 10,
+		MaxWidth:     500,
+		MaxHeight:    500,
+		AllowedTypes: []string{"image/jpeg", "image/png"},
+	}
+
+	// When an HTML file, an oversized file and a 600x400 PNG are validated
+	_, htmlErr := policy.Validate(bytes.NewReader([]byte("<!DOCTYPE html><html><script>alert(1)</script></html>")))
+	_, sizeErr := policy.Validate(bytes.NewReader(make([]byte, 65<<10)))
+	_, dimensionErr := policy.Validate(bytes.NewReader(coverPNG(t, 600, 400)))
+
+	// Then they are rejected as unsupported, too large and too large in dimensions
+	assert.ErrorIs(t, htmlErr, media.ErrUnsupportedType)
+	assert.ErrorIs(t, sizeErr, media.ErrTooLarge)
+	assert.ErrorIs(t, dimensionErr, media.ErrDimensionsTooLarge)
+
+	// And a 300x300 PNG is accepted
+	source := coverPNG(t, 300, 300)
+	data, err := policy.Validate(bytes.NewReader(source))
+	assert.NoError(t, err)
+	assert.Equal(t, source, data)
+}
+
+// flakyStore fails every Put after the first puts succeeded
+type flakyStore struct {
+	storage.ObjectStore
+	puts int
+}
+
+func (s *flakyStore) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	if s.puts == 0 {
+		return errors.New("bucket unavailable")
+	}
+	s.puts--
+	return s.ObjectStore.Put(ctx, key, body, contentType)
+}
+
+func TestStoreCoverFailure(t *testing.T) {
+	// Given a bucket that fails on the fourth upload and a book already using the same image
+	local, err := storage.NewLocalStore(t.TempDir(), "http://localhost:8080/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &flakyStore{ObjectStore: local, puts: 3}
+	source := coverPNG(t, 1000, 1500)
+	variants, err := media.ProcessCover(bytes.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := variants[0]
+	local.Put(context.Background(), shared.Key, bytes.NewReader(shared.Data), shared.ContentType)
+	db := newTestDB(t)
+	bookRepo := repositories.NewBookRepository(db)
+	if err := bookRepo.CreateBook(&models.Book{Title: "Cantik Itu Luka", Category: "Novel", CoverImage: local.PublicURL(shared.Key)}); err != nil {
+		t.Fatal(err)
+	}
+	policy := media.UploadPolicy{MaxBytes: 1 << 20, MaxWidth: 2000, MaxHeight: 3000, AllowedTypes: []string{"image/png"}}
+	covers := services.NewCoverService(bookRepo, repositories.NewUploadRepository(db), store, policy)
+
+	// When a cover is stored
+	_, _, err = covers.StoreCover(context.Background(), bytes.NewReader(source))
+
+	// Then the error is returned
+	assert.ErrorContains(t, err, "bucket unavailable")
+
+	// And the variants already uploaded are removed
+	// But the variant the other book uses is kept
+	var keys []string
+	err = local.List(context.Background(), "", func(info storage.ObjectInfo) error {
+		keys = append(keys, info.Key)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{shared.Key}, keys)
+}
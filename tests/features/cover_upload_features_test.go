@@ -0,0 +1,210 @@
+package features
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/media"
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// Feature: Direct cover uploads
+//
+//	As an admin
+//	I want to upload covers straight to the bucket
+//	So large files do not go through the API
+//
+//	Scenario: Presigning an upload
+//		Given a book and a policy allowing PNG up to 1MB
+//		When an upload is presigned for a PNG, an HTML file and a 2MB PNG
+//		Then only the PNG gets a signed PUT under incoming/
+//
+//	Scenario: Confirming someone else's upload
+//		Given two books and an upload presigned for the first
+//		When the upload is confirmed for the second book or with an unknown id
+//		Then ErrUploadNotFound is returned
+//
+//	Scenario: Confirming before or with the wrong file
+//		Given a presigned upload
+//		When it is confirmed before the file is put
+//		Then ErrUploadIncomplete is returned
+//		When a file of another size is put and it is confirmed
+//		Then ErrUploadMismatch is returned
+//
+//	Scenario: Confirming an upload
+//		Given a presigned upload with the file put
+//		When it is confirmed
+//		Then the book gets its cover variants
+//		And the upload and its incoming object are removed
+//
+//	Scenario: Collecting expired uploads
+//		Given an expired upload with its file, a pending upload and a confirmed cover
+//		When expired uploads are collected
+//		Then the expired upload and its object are removed
+//		And confirming it afterwards fails
+//		But the pending upload and the confirmed cover are kept
+
+func newCoverUploadFixture(t *testing.T) (*gorm.DB, *services.CoverService, *fakeBucket) {
+	db := newTestDB(t)
+	bookRepo := repositories.NewBookRepository(db)
+	for _, title := range []string{"Ronggeng Dukuh Paruk", "Cantik Itu Luka"} {
+		if err := bookRepo.CreateBook(&models.Book{Title: title, Category: "Novel", NewPrice: money.IDR(95000)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bucket := &fakeBucket{objects: map[string][]byte{}, contentTypes: map[string]string{}}
+	server := httptest.NewServer(bucket)
+	t.Cleanup(server.Close)
+
+	policy := media.UploadPolicy{MaxBytes: 1 << 20, MaxWidth: 2000, MaxHeight: 3000, AllowedTypes: []string{"image/jpeg", "image/png"}}
+	covers := services.NewCoverService(bookRepo, repositories.NewUploadRepository(db), newS3Store(server.URL), policy)
+	return db, covers, bucket
+}
+
+func presignPNG(t *testing.T, covers *services.CoverService, bookID uint, data []byte) *services.PresignedCoverUpload {
+	t.Helper()
+	upload, err := covers.PresignCover(context.Background(), bookID, "image/png", int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return upload
+}
+
+// putUpload stands in for the browser doing the presigned PUT
+func putUpload(bucket *fakeBucket, upload *services.PresignedCoverUpload, data []byte) {
+	bucket.objects["incoming/"+upload.UploadID] = data
+	bucket.contentTypes["incoming/"+upload.UploadID] = "image/png"
+}
+
+func TestPresignCover(t *testing.T) {
+	// Given a book and a policy allowing PNG up to 1MB
+	ctx := context.Background()
+	_, covers, _ := newCoverUploadFixture(t)
+
+	// When an upload is presigned for a PNG, an HTML file and a 2MB PNG
+	upload, err := covers.PresignCover(ctx, 1, "image/png", 4096)
+	_, htmlErr := covers.PresignCover(ctx, 1, "text/html", 4096)
+	_, largeErr := covers.PresignCover(ctx, 1, "image/png", 2<<20)
+
+	// Then only the PNG gets a signed PUT under incoming/
+	if assert.NoError(t, err) {
+		assert.Equal(t, "PUT", upload.Method)
+		assert.Contains(t, upload.URL, "/bookshop/incoming/"+upload.UploadID)
+		assert.Equal(t, "image/png", upload.Headers.Get("Content-Type"))
+	}
+	assert.ErrorIs(t, htmlErr, media.ErrUnsupportedType)
+	assert.ErrorIs(t, largeErr, media.ErrTooLarge)
+}
+
+func TestConfirmForeignUpload(t *testing.T) {
+	// Given two books and an upload presigned for the first
+	ctx := context.Background()
+	_, covers, bucket := newCoverUploadFixture(t)
+	data := coverPNG(t, 400, 600)
+	upload := presignPNG(t, covers, 1, data)
+	putUpload(bucket, upload, data)
+
+	// When the upload is confirmed for the second book or with an unknown id
+	_, foreignErr := covers.ConfirmCover(ctx, 2, upload.UploadID)
+	_, unknownErr := covers.ConfirmCover(ctx, 1, "00000000-0000-0000-0000-000000000000")
+
+	// Then ErrUploadNotFound is returned
+	assert.ErrorIs(t, foreignErr, services.ErrUploadNotFound)
+	assert.ErrorIs(t, unknownErr, services.ErrUploadNotFound)
+}
+
+func TestConfirmIncompleteUpload(t *testing.T) {
+	// Given a presigned upload
+	ctx := context.Background()
+	_, covers, bucket := newCoverUploadFixture(t)
+	data := coverPNG(t, 400, 600)
+	upload := presignPNG(t, covers, 1, data)
+
+	// When it is confirmed before the file is put
+	_, err := covers.ConfirmCover(ctx, 1, upload.UploadID)
+
+	// Then ErrUploadIncomplete is returned
+	assert.ErrorIs(t, err, services.ErrUploadIncomplete)
+
+	// When a file of another size is put and it is confirmed
+	putUpload(bucket, upload, coverPNG(t, 200, 300))
+	_, err = covers.ConfirmCover(ctx, 1, upload.UploadID)
+
+	// Then ErrUploadMismatch is returned
+	assert.ErrorIs(t, err, services.ErrUploadMismatch)
+}
+
+func TestConfirmUpload(t *testing.T) {
+	// Given a presigned upload with the file put
+	ctx := context.Background()
+	_, covers, bucket := newCoverUploadFixture(t)
+	data := coverPNG(t, 400, 600)
+	upload := presignPNG(t, covers, 1, data)
+	putUpload(bucket, upload, data)
+
+	// When it is confirmed
+	book, err := covers.ConfirmCover(ctx, 1, upload.UploadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Then the book gets its cover variants
+	assert.True(t, strings.HasPrefix(book.CoverImage, "https://covers.example.com/covers/"))
+	assert.Len(t, book.CoverImages, len(media.CoverSizes))
+
+	// And the upload and its incoming object are removed
+	assert.NotContains(t, bucket.objects, "incoming/"+upload.UploadID)
+	_, err = covers.ConfirmCover(ctx, 1, upload.UploadID)
+	assert.ErrorIs(t, err, services.ErrUploadNotFound)
+}
+
+func TestCollectExpiredUploads(t *testing.T) {
+	// Given an expired upload with its file, a pending upload and a confirmed cover
+	ctx := context.Background()
+	db, covers, bucket := newCoverUploadFixture(t)
+	data := coverPNG(t, 400, 600)
+
+	confirmed := presignPNG(t, covers, 1, data)
+	putUpload(bucket, confirmed, data)
+	if _, err := covers.ConfirmCover(ctx, 1, confirmed.UploadID); err != nil {
+		t.Fatal(err)
+	}
+	coverKeys := len(bucket.objects)
+
+	expired := presignPNG(t, covers, 2, data)
+	putUpload(bucket, expired, data)
+	db.Model(&models.CoverUpload{}).Where("id = ?", expired.UploadID).Update("expires_at", time.Now().Add(-time.Minute))
+	pending := presignPNG(t, covers, 2, data)
+
+	// When expired uploads are collected
+	collected, err := covers.CollectExpiredUploads(ctx)
+
+	// Then the expired upload and its object are removed
+	assert.NoError(t, err)
+	assert.Equal(t, 1, collected)
+	assert.NotContains(t, bucket.objects, "incoming/"+expired.UploadID)
+
+	// And confirming it afterwards fails
+	_, err = covers.ConfirmCover(ctx, 2, expired.UploadID)
+	assert.ErrorIs(t, err, services.ErrUploadNotFound)
+
+	// But the pending upload and the confirmed cover are kept
+	var remaining []models.CoverUpload
+	db.Find(&remaining)
+	if assert.Len(t, remaining, 1) {
+		assert.Equal(t, pending.UploadID, remaining[0].ID)
+	}
+	assert.Len(t, bucket.objects, coverKeys)
+	for key := range bucket.objects {
+		assert.True(t, strings.HasPrefix(key, "covers/"), key)
+	}
+}
@@ -0,0 +1,207 @@
+package features
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// Feature: Prices in the customer's currency
+//
+//	As a customer abroad
+//	I want to see prices in my own currency
+//	So I know what a book costs without converting it myself
+//
+//	Scenario: Showing a book in US dollars
+//		Given a book at Rp99.000 reduced from Rp120.000
+//		And a rate of 16250 rupiah to the dollar
+//		When its display prices are set
+//		Then both prices are in dollars rounded to the cent
+//		And the rupiah prices are unchanged
+//
+//	Scenario: Recording an order placed in US dollars
+//		Given an order of Rp250.000 placed while a dollar cost 16250 rupiah
+//		When its total in the display currency is asked for
+//		Then it is the total at that rate, whatever the rate is today
+//
+//	Scenario: Choosing a currency
+//		Given currency codes typed by customers
+//		When they are normalised
+//		Then only three letter codes are accepted
+//
+//	Scenario: A saved currency without a rate
+//		Given a customer who saved EUR, which has no rate, and one who saved JPY at a rate of zero
+//		When prices are shown to them without asking for a currency
+//		Then they are shown in rupiah
+//		But asking for EUR or JPY explicitly is rejected
+//
+//	Scenario: Removing a currency
+//		Given a customer who saved USD
+//		When the USD rate is deleted
+//		Then the customer is back on rupiah
+//
+//	Scenario: Following the rate provider
+//		Given a rate provider that is down
+//		When EUR is made automatic
+//		Then nothing is saved
+//		When the provider is back
+//		Then the fetched rate is saved at once
+
+func TestDisplayPrices(t *testing.T) {
+	// Given a book at Rp99.000 reduced from Rp120.000
+	lowest := money.IDR(89000)
+	books := []models.Book{{OldPrice: money.IDR(120000), NewPrice: money.IDR(99000), LowestPrice30d: &lowest}}
+	// And a rate of 16250 rupiah to the dollar
+	rate := &models.ExchangeRate{Currency: "USD", Rate: 16250}
+
+	// When its display prices are set
+	services.SetDisplayPrices(books, rate)
+
+	// Then both prices are in dollars rounded to the cent
+	display := books[0].DisplayPrice
+	if assert.NotNil(t, display) {
+		assert.Equal(t, "USD", display.Currency)
+		assert.Equal(t, money.New(738, "USD"), display.OldPrice)
+		assert.Equal(t, money.New(609, "USD"), display.NewPrice)
+		assert.Equal(t, money.New(548, "USD"), *display.LowestPrice30d)
+	}
+
+	// And the rupiah prices are unchanged
+	assert.Equal(t, money.IDR(99000), books[0].NewPrice)
+
+	// And nothing is added without a display currency
+	plain := []models.Book{{NewPrice: money.IDR(99000)}}
+	services.SetDisplayPrices(plain, nil)
+	assert.Nil(t, plain[0].DisplayPrice)
+}
+
+func TestOrderDisplayTotal(t *testing.T) {
+	// Given an order of Rp250.000 placed while a dollar cost 16250 rupiah
+	order := models.Order{TotalPrice: money.IDR(250000), Currency: "IDR", DisplayCurrency: "USD", ExchangeRate: 16250}
+
+	// When its total in the display currency is asked for
+	// Then it is the total at that rate, whatever the rate is today
+	assert.Equal(t, money.New(1538, "USD"), order.DisplayTotal())
+
+	order.DisplayCurrency, order.ExchangeRate = "IDR", 1
+	assert.Equal(t, money.IDR(250000), order.DisplayTotal())
+}
+
+func TestCurrencyCodes(t *testing.T) {
+	// Given currency codes typed by customers
+	// When they are normalised
+	// Then only three letter codes are accepted
+	assert.Equal(t, "SGD", services.NormalizeCurrency(" sgd "))
+	assert.True(t, services.ValidCurrencyCode("USD"))
+	for _, code := range []string{"", "US", "USDT", "U$D"} {
+		assert.False(t, services.ValidCurrencyCode(code), code)
+	}
+	assert.Equal(t, money.New(1250, "JPY"), money.IDR(125000).Convert("JPY", 0.01))
+}
+
+type stubRateProvider struct {
+	rates map[string]float64
+	err   error
+}
+
+func (p *stubRateProvider) Rates(ctx context.Context, base string, currencies []string) (map[string]float64, error) {
+	return p.rates, p.err
+}
+
+func newCurrencyFixture(t *testing.T, provider *stubRateProvider) (*gorm.DB, *services.CurrencyService) {
+	db := newTestDB(t)
+	return db, services.NewCurrencyService(repositories.NewCurrencyRepository(db), repositories.NewUserRepository(db), provider)
+}
+
+func createUser(t *testing.T, db *gorm.DB, email, currency string) *models.User {
+	t.Helper()
+	user := &models.User{Email: email, Name: email, Password: "x", Currency: currency}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestSavedCurrencyWithoutRate(t *testing.T) {
+	// Given a customer who saved EUR, which has no rate, and one who saved JPY at a rate of zero
+	db, currencies := newCurrencyFixture(t, nil)
+	euro := createUser(t, db, "ani@example.com", "EUR")
+	yen := createUser(t, db, "budi@example.com", "JPY")
+	db.Create(&models.ExchangeRate{Currency: "JPY", Rate: 0})
+
+	// When prices are shown to them without asking for a currency
+	for _, user := range []*models.User{euro, yen} {
+		rate, err := currencies.DisplayRate("", user.ID)
+
+		// Then they are shown in rupiah
+		assert.NoError(t, err)
+		assert.Nil(t, rate)
+	}
+
+	// But asking for EUR or JPY explicitly is rejected
+	_, err := currencies.DisplayRate("eur", euro.ID)
+	assert.ErrorIs(t, err, services.ErrUnsupportedCurrency)
+	_, err = currencies.DisplayRate("JPY", 0)
+	assert.ErrorIs(t, err, services.ErrUnsupportedCurrency)
+}
+
+func TestDeleteCurrency(t *testing.T) {
+	// Given a customer who saved USD
+	db, currencies := newCurrencyFixture(t, nil)
+	if _, errs, err := currencies.SetRate(context.Background(), "USD", &services.RateInput{Rate: 16250}); err != nil || len(errs) > 0 {
+		t.Fatal(err, errs)
+	}
+	user := createUser(t, db, "ani@example.com", "USD")
+	rate, err := currencies.DisplayRate("", user.ID)
+	if assert.NoError(t, err) && assert.NotNil(t, rate) {
+		assert.Equal(t, "USD", rate.Currency)
+	}
+
+	// When the USD rate is deleted
+	assert.NoError(t, currencies.DeleteRate("usd"))
+
+	// Then the customer is back on rupiah
+	var stored models.User
+	db.First(&stored, user.ID)
+	assert.Empty(t, stored.Currency)
+	rate, err = currencies.DisplayRate("", user.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, rate)
+}
+
+func TestAutomaticRate(t *testing.T) {
+	// Given a rate provider that is down
+	provider := &stubRateProvider{err: errors.New("exchangerate: 503 Service Unavailable")}
+	_, currencies := newCurrencyFixture(t, provider)
+
+	// When EUR is made automatic
+	_, _, err := currencies.SetRate(context.Background(), "EUR", &services.RateInput{Automatic: true})
+
+	// Then nothing is saved
+	assert.Error(t, err)
+	rates, err := currencies.GetRates()
+	assert.NoError(t, err)
+	assert.Empty(t, rates)
+
+	// When the provider is back
+	provider.err = nil
+	provider.rates = map[string]float64{"EUR": 0.00005}
+	rate, _, err := currencies.SetRate(context.Background(), "EUR", &services.RateInput{Automatic: true})
+
+	// Then the fetched rate is saved at once
+	if assert.NoError(t, err) {
+		assert.InDelta(t, 20000, rate.Rate, 0.001)
+		assert.False(t, rate.Manual)
+	}
+	display, err := currencies.DisplayRate("EUR", 0)
+	if assert.NoError(t, err) {
+		assert.InDelta(t, 20000, display.Rate, 0.001)
+	}
+}
@@ -0,0 +1,52 @@
+package features
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens an empty in-memory SQLite database with the shop's schema,
+// for scenarios that go through the repositories
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	err = db.AutoMigrate(&models.User{}, &models.Book{}, &models.Order{}, &models.OrderBook{}, &models.CoverUpload{}, &models.BookImage{}, &models.Review{}, &models.ReviewVote{}, &models.Wishlist{}, &models.WishlistItem{}, &models.Coupon{}, &models.CouponRedemption{}, &models.PriceRule{}, &models.PriceRuleBook{}, &models.PriceChange{}, &models.ExchangeRate{}, &models.TaxRate{}, &models.OrderTax{}, &models.Invoice{}, &models.InvoiceCounter{}, &models.RegionCache{}, &models.Shipment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// createOrder stores an order of the user holding the books, created at the
+// given time
+func createOrder(t *testing.T, db *gorm.DB, userID uint, status string, createdAt time.Time, bookIDs ...uint) *models.Order {
+	t.Helper()
+	order := &models.Order{Name: "Customer", UserId: userID, Status: status}
+	order.CreatedAt = createdAt
+	if err := db.Omit("Books", "Taxes", "User").Create(order).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, bookID := range bookIDs {
+		if err := db.Create(&models.OrderBook{OrderID: order.ID, BookID: bookID}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return order
+}
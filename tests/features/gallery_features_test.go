@@ -0,0 +1,161 @@
+package features
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Book image galleries
+//
+//	As an admin
+//	I want to show more than the front cover
+//	So customers can see the back cover, the spine and sample pages
+//
+//	Scenario: Reordering the gallery
+//		Given a book with three images and another book with one
+//		When the gallery is reordered leaving an image out, repeating one or with the other book's image
+//		Then ErrImageOrderMismatch is returned and the order is unchanged
+//		When every image is listed once
+//		Then the gallery follows the new order
+//
+//	Scenario: Choosing the primary image
+//		Given a book with three images
+//		Then the first image is primary
+//		When the third image is marked primary
+//		Then it is the only primary image
+//		When it is unmarked again
+//		Then the first image in the gallery takes over
+//
+//	Scenario: Deleting the primary image
+//		Given a book with three images where the second leads the gallery
+//		When the primary image is deleted
+//		Then the image now leading the gallery is primary
+//		When every image is deleted
+//		Then the gallery is empty
+
+func newGalleryFixture(t *testing.T) (*services.GalleryService, []uint) {
+	db, covers, _ := newCoverUploadFixture(t)
+	gallery := services.NewGalleryService(repositories.NewImageRepository(db), repositories.NewBookRepository(db), covers)
+
+	var ids []uint
+	for i, book := range []uint{1, 1, 1, 2} {
+		image, err := gallery.AddImage(context.Background(), book, bytes.NewReader(coverPNG(t, 200+i, 300)), "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, image.ID)
+	}
+	return gallery, ids
+}
+
+func galleryOrder(t *testing.T, gallery *services.GalleryService, bookID uint) (ids []uint, primary []uint) {
+	t.Helper()
+	images, err := gallery.GetImages(bookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, image := range images {
+		ids = append(ids, image.ID)
+		if image.IsPrimary {
+			primary = append(primary, image.ID)
+		}
+	}
+	return ids, primary
+}
+
+func TestReorderGallery(t *testing.T) {
+	// Given a book with three images and another book with one
+	gallery, ids := newGalleryFixture(t)
+
+	// When the gallery is reordered leaving an image out, repeating one or with the other book's image
+	for _, order := range [][]uint{
+		{ids[2], ids[0]},
+		{ids[2], ids[0], ids[0]},
+		{ids[2], ids[0], ids[3]},
+		{ids[2], ids[1], ids[0], ids[3]},
+	} {
+		_, err := gallery.ReorderImages(1, order)
+
+		// Then ErrImageOrderMismatch is returned and the order is unchanged
+		assert.ErrorIs(t, err, repositories.ErrImageOrderMismatch, order)
+	}
+	order, _ := galleryOrder(t, gallery, 1)
+	assert.Equal(t, ids[:3], order)
+
+	// When every image is listed once
+	images, err := gallery.ReorderImages(1, []uint{ids[2], ids[0], ids[1]})
+
+	// Then the gallery follows the new order
+	assert.NoError(t, err)
+	if assert.Len(t, images, 3) {
+		assert.Equal(t, ids[2], images[0].ID)
+		assert.Equal(t, 1, images[0].Position)
+	}
+	order, _ = galleryOrder(t, gallery, 1)
+	assert.Equal(t, []uint{ids[2], ids[0], ids[1]}, order)
+}
+
+func TestGalleryPrimaryImage(t *testing.T) {
+	// Given a book with three images
+	gallery, ids := newGalleryFixture(t)
+
+	// Then the first image is primary
+	_, primary := galleryOrder(t, gallery, 1)
+	assert.Equal(t, []uint{ids[0]}, primary)
+
+	// When the third image is marked primary
+	yes, no := true, false
+	_, err := gallery.UpdateImage(1, ids[2], &services.ImagePatch{IsPrimary: &yes})
+	assert.NoError(t, err)
+
+	// Then it is the only primary image
+	_, primary = galleryOrder(t, gallery, 1)
+	assert.Equal(t, []uint{ids[2]}, primary)
+
+	// When it is unmarked again
+	_, err = gallery.UpdateImage(1, ids[2], &services.ImagePatch{IsPrimary: &no})
+	assert.NoError(t, err)
+
+	// Then the first image in the gallery takes over
+	_, primary = galleryOrder(t, gallery, 1)
+	assert.Equal(t, []uint{ids[0]}, primary)
+
+	// And the only image of a book stays primary
+	image, err := gallery.UpdateImage(2, ids[3], &services.ImagePatch{IsPrimary: &no})
+	if assert.NoError(t, err) {
+		assert.True(t, image.IsPrimary)
+	}
+	_, primary = galleryOrder(t, gallery, 2)
+	assert.Equal(t, []uint{ids[3]}, primary)
+}
+
+func TestDeletePrimaryImage(t *testing.T) {
+	// Given a book with three images where the second leads the gallery
+	ctx := context.Background()
+	gallery, ids := newGalleryFixture(t)
+	if _, err := gallery.ReorderImages(1, []uint{ids[1], ids[0], ids[2]}); err != nil {
+		t.Fatal(err)
+	}
+
+	// When the primary image is deleted
+	assert.NoError(t, gallery.DeleteImage(ctx, 1, ids[0]))
+
+	// Then the image now leading the gallery is primary
+	order, primary := galleryOrder(t, gallery, 1)
+	assert.Equal(t, []uint{ids[1], ids[2]}, order)
+	assert.Equal(t, []uint{ids[1]}, primary)
+
+	// When every image is deleted
+	assert.NoError(t, gallery.DeleteImage(ctx, 1, ids[1]))
+	assert.NoError(t, gallery.DeleteImage(ctx, 1, ids[2]))
+
+	// Then the gallery is empty
+	images, err := gallery.GetImages(1)
+	assert.NoError(t, err)
+	assert.Empty(t, images)
+}
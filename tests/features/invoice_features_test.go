@@ -0,0 +1,203 @@
+package features
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/invoice"
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/mail"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// Feature: Invoices
+//
+//	As a customer
+//	I want a PDF invoice for my paid order
+//	So I can claim the books back from my employer
+//
+//	Scenario: Rendering the invoice of a paid order
+//		Given a paid order of two books with shipping and PPN
+//		When its invoice is rendered
+//		Then a PDF document is produced
+//
+//	Scenario: Writing amounts on invoices
+//		Given amounts in rupiah and in dollars
+//		When they are formatted
+//		Then thousands are separated by dots and decimals by a comma
+//
+//	Scenario: Numbering invoices
+//		Given two paid orders and a pending one
+//		When invoices are issued for them, one of them twice, and one issue fails
+//		Then the paid orders get consecutive numbers
+//		And issuing again returns the same invoice
+//		And neither the pending order nor the failed issue uses up a number
+//
+//	Scenario: Downloading an invoice
+//		Given an invoiced order whose book was renamed afterwards
+//		When the customer downloads the invoice
+//		Then it is the PDF that was issued
+//		But another customer cannot download it, while an admin can
+//
+//	Scenario: Emailing an invoice
+//		Given a paid order
+//		When its invoice is emailed
+//		Then the customer gets the PDF with the total in rupiah
+
+func TestRenderInvoice(t *testing.T) {
+	// Given a paid order of two books with shipping and PPN
+	order := &models.Order{
+		Name:       "Siti",
+		Email:      "siti@example.com",
+		Address:    models.Address{City: "Bandung", Province: "Jawa Barat"},
+		Shipping:   models.Shipping{ShippingType: "jne", ShippingService: "REG", ShippingCost: money.IDR(20000)},
+		Subtotal:   money.IDR(161000),
+		TaxMode:    models.TaxInclusive,
+		Taxes:      []models.OrderTax{{Name: "PPN", Percent: 11, Base: money.IDR(100000), Tax: money.IDR(11000)}},
+		TotalPrice: money.IDR(181000),
+		Status:     models.OrderPaid,
+		Books:      []models.Book{{BaseModel: models.BaseModel{ID: 1}, Title: "Laskar Pelangi"}, {BaseModel: models.BaseModel{ID: 2}, Title: "Bumi Manusia"}},
+	}
+	doc := &invoice.Document{
+		Invoice: &models.Invoice{Number: "INV-000001", IssuedAt: time.Now()},
+		Order:   order,
+		Prices:  map[uint]money.Money{1: money.IDR(111000), 2: money.IDR(50000)},
+	}
+
+	// When its invoice is rendered
+	var buf bytes.Buffer
+	err := invoice.Render(&buf, invoice.Store{Name: "Book Shop", Address: "Jl. Braga 1\nBandung"}, doc)
+
+	// Then a PDF document is produced
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")))
+}
+
+func TestInvoiceAmounts(t *testing.T) {
+	// Given amounts in rupiah and in dollars
+	// When they are formatted
+	// Then thousands are separated by dots and decimals by a comma
+	assert.Equal(t, "Rp99.000", invoice.Amount(money.IDR(99000)))
+	assert.Equal(t, "Rp1.250.000,50", invoice.Amount(money.New(125000050, "IDR")))
+	assert.Equal(t, "-Rp10.000", invoice.Amount(money.IDR(-10000)))
+	assert.Equal(t, "USD 6,09", invoice.Amount(money.New(609, "USD")))
+}
+
+type recordingMailer struct {
+	sent []*mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg *mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func newInvoiceFixture(t *testing.T) (*gorm.DB, *services.InvoiceService, *recordingMailer) {
+	db := newTestDB(t)
+	mailer := &recordingMailer{}
+	invoices := services.NewInvoiceService(repositories.NewInvoiceRepository(db), repositories.NewOrderRepository(db), mailer,
+		invoice.Store{Name: "Book Shop"}, "INV-")
+	if err := db.Create(&models.Book{Title: "Laskar Pelangi", NewPrice: money.IDR(99000)}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, invoices, mailer
+}
+
+func TestIssueInvoice(t *testing.T) {
+	// Given two paid orders and a pending one
+	db, invoices, _ := newInvoiceFixture(t)
+	first := createOrder(t, db, 1, models.OrderPaid, time.Now(), 1)
+	second := createOrder(t, db, 2, models.OrderPaid, time.Now(), 1)
+	pending := createOrder(t, db, 3, models.OrderPending, time.Now(), 1)
+
+	// When invoices are issued for them, one of them twice, and one issue fails
+	_, err := invoices.IssueInvoice(pending)
+	assert.ErrorIs(t, err, services.ErrOrderNotPaid)
+	firstInvoice, err := invoices.IssueInvoice(first)
+	assert.NoError(t, err)
+	again, err := invoices.IssueInvoice(first)
+	assert.NoError(t, err)
+	_, err = repositories.NewInvoiceRepository(db).IssueInvoice(second.ID, "INV-", time.Now(), func(*models.Invoice) ([]byte, error) {
+		return nil, errors.New("render failed")
+	})
+	assert.Error(t, err)
+	secondInvoice, err := invoices.IssueInvoice(second)
+	assert.NoError(t, err)
+
+	// Then the paid orders get consecutive numbers
+	assert.Equal(t, "INV-000001", firstInvoice.Number)
+	assert.Equal(t, "INV-000002", secondInvoice.Number)
+	assert.Equal(t, uint(2), secondInvoice.Sequence)
+
+	// And issuing again returns the same invoice
+	assert.Equal(t, firstInvoice.ID, again.ID)
+	assert.Equal(t, firstInvoice.Number, again.Number)
+
+	// And neither the pending order nor the failed issue uses up a number
+	var count int64
+	db.Model(&models.Invoice{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+	var counter models.InvoiceCounter
+	db.First(&counter, 1)
+	assert.Equal(t, uint(2), counter.Last)
+}
+
+func TestDownloadInvoice(t *testing.T) {
+	// Given an invoiced order whose book was renamed afterwards
+	db, invoices, _ := newInvoiceFixture(t)
+	order := createOrder(t, db, 1, models.OrderPaid, time.Now(), 1)
+	issued, err := invoices.IssueInvoice(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&models.Book{}).Where("id = 1").Update("title", "Sang Pemimpi")
+
+	// When the customer downloads the invoice
+	inv, pdf, err := invoices.InvoicePDF(order.ID, 1, false)
+
+	// Then it is the PDF that was issued
+	if assert.NoError(t, err) {
+		assert.Equal(t, issued.Number, inv.Number)
+		assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-")))
+		assert.Equal(t, issued.PDF, pdf)
+	}
+
+	// But another customer cannot download it, while an admin can
+	_, _, err = invoices.InvoicePDF(order.ID, 2, false)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, pdf, err = invoices.InvoicePDF(order.ID, 2, true)
+	assert.NoError(t, err)
+	assert.Equal(t, issued.PDF, pdf)
+}
+
+func TestEmailInvoice(t *testing.T) {
+	// Given a paid order
+	db, invoices, mailer := newInvoiceFixture(t)
+	order := createOrder(t, db, 1, models.OrderPaid, time.Now(), 1)
+	db.Model(order).Updates(map[string]any{"email": "siti@example.com", "total_price": money.IDR(119000)})
+	order.Email, order.TotalPrice = "siti@example.com", money.IDR(119000)
+
+	// When its invoice is emailed
+	err := invoices.SendInvoice(context.Background(), order)
+
+	// Then the customer gets the PDF with the total in rupiah
+	if assert.NoError(t, err) && assert.Len(t, mailer.sent, 1) {
+		msg := mailer.sent[0]
+		assert.Equal(t, []string{"siti@example.com"}, msg.To)
+		assert.Contains(t, msg.Text, "Your invoice INV-000001 for order #1 over Rp119.000 is attached")
+		if assert.Len(t, msg.Attachments, 1) {
+			assert.Equal(t, "INV-000001.pdf", msg.Attachments[0].Filename)
+			assert.True(t, bytes.HasPrefix(msg.Attachments[0].Data, []byte("%PDF-")))
+		}
+	}
+	var inv models.Invoice
+	db.First(&inv)
+	assert.NotNil(t, inv.EmailedAt)
+}
@@ -0,0 +1,129 @@
+package features
+
+import (
+	"testing"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// Feature: Lowest price before a discount
+//
+//	As a customer
+//	I want to see the lowest price a book had before its current price
+//	So I can tell whether a discount is real
+//
+//	Scenario: Adding a book
+//		Given an admin adds a book at 100000
+//		Then its price history starts with that price
+//		And its lowest price is its current price
+//
+//	Scenario: Discounting a book after a price rise
+//		Given a book at 100000 for 40 days, raised to 120000 20 days ago
+//		When it is discounted to 90000
+//		Then its lowest price is 100000, the lowest of the 30 days before the discount
+//		And the discount itself does not count
+//
+//	Scenario: Discounting a book with a steady price
+//		Given a book at 100000 for 90 days
+//		When it is discounted to 80000
+//		Then its lowest price is 100000
+
+type priceHistoryFixture struct {
+	db    *gorm.DB
+	repo  repositories.BookRepository
+	books *services.BookService
+	book  *models.Book
+}
+
+func newPriceHistoryFixture(t *testing.T, price money.Money, age time.Duration) *priceHistoryFixture {
+	db := newTestDB(t)
+	repo := repositories.NewBookRepository(db)
+	book := &models.Book{Title: "Gadis Kretek", Category: "Novel", NewPrice: price, PriceSource: services.ManualPriceChange(1)}
+	if err := repo.CreateBook(book); err != nil {
+		t.Fatal(err)
+	}
+	f := &priceHistoryFixture{db: db, repo: repo, books: services.NewBookService(repo), book: book}
+	f.backdate(t, age)
+	return f
+}
+
+// changePrice records a price change that happened ago
+func (f *priceHistoryFixture) changePrice(t *testing.T, price money.Money, ago time.Duration) {
+	t.Helper()
+	f.book.NewPrice = price
+	f.book.PriceSource = services.ManualPriceChange(1)
+	if err := f.repo.UpdateBook(f.book); err != nil {
+		t.Fatal(err)
+	}
+	f.backdate(t, ago)
+}
+
+// backdate moves the last price change back in time
+func (f *priceHistoryFixture) backdate(t *testing.T, ago time.Duration) {
+	t.Helper()
+	var last models.PriceChange
+	if err := f.db.Where("book_id = ?", f.book.ID).Order("id DESC").First(&last).Error; err != nil {
+		t.Fatal(err)
+	}
+	f.db.Model(&last).Update("created_at", time.Now().Add(-ago))
+}
+
+func (f *priceHistoryFixture) lowestPrice(t *testing.T) money.Money {
+	t.Helper()
+	book, err := f.books.GetBookWithImages(f.book.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *book.LowestPrice30d
+}
+
+const day = 24 * time.Hour
+
+func TestLowestPriceOfNewBook(t *testing.T) {
+	// Given an admin adds a book at 100000
+	f := newPriceHistoryFixture(t, money.IDR(100000), 0)
+
+	// Then its price history starts with that price
+	history, total, err := f.repo.GetPriceHistory(f.book.ID, 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, models.PriceReasonCreated, history[0].Reason)
+		assert.Equal(t, money.IDR(100000), history[0].NewPrice)
+		assert.True(t, history[0].OldPrice.IsZero())
+		assert.Equal(t, uint(1), *history[0].UserID)
+	}
+
+	// And its lowest price is its current price
+	assert.Equal(t, money.IDR(100000), f.lowestPrice(t))
+}
+
+func TestLowestPriceAfterPriceRise(t *testing.T) {
+	// Given a book at 100000 for 40 days, raised to 120000 20 days ago
+	f := newPriceHistoryFixture(t, money.IDR(100000), 40*day)
+	f.changePrice(t, money.IDR(120000), 20*day)
+
+	// When it is discounted to 90000
+	f.changePrice(t, money.IDR(90000), 0)
+
+	// Then its lowest price is 100000, the lowest of the 30 days before the discount
+	// And the discount itself does not count
+	assert.Equal(t, money.IDR(100000), f.lowestPrice(t))
+}
+
+func TestLowestPriceAfterSteadyPrice(t *testing.T) {
+	// Given a book at 100000 for 90 days
+	f := newPriceHistoryFixture(t, money.IDR(100000), 90*day)
+
+	// When it is discounted to 80000
+	f.changePrice(t, money.IDR(80000), 0)
+
+	// Then its lowest price is 100000
+	assert.Equal(t, money.IDR(100000), f.lowestPrice(t))
+}
@@ -0,0 +1,111 @@
+package features
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+
+	bookmail "github.com/febriaricandra/book-shop/pkg/mail"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Sending email
+//
+//	As a customer
+//	I want the shop's emails to arrive with their content
+//	So I can read price alerts and invoices
+//
+//	Scenario: Sending a text-only email
+//		Given an SMTP server
+//		When a message with only a text body is sent
+//		Then the server receives the headers
+//		And the text body follows them
+
+// newSMTPServer accepts one message without auth or TLS and hands over its
+// DATA
+func newSMTPServer(t *testing.T) (string, int, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "DATA"):
+				reply("354 end with .")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- data.String()
+				reply("250 queued")
+			case strings.HasPrefix(command, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return host, portNumber, received
+}
+
+func TestSendTextOnlyMail(t *testing.T) {
+	// Given an SMTP server
+	host, port, received := newSMTPServer(t)
+	sender := bookmail.NewSMTPSender(host, port, "", "", "Book Shop <shop@example.com>")
+
+	// When a message with only a text body is sent
+	err := sender.Send(context.Background(), &bookmail.Message{
+		To:      []string{"ani@example.com"},
+		Subject: "Harga turun: Laskar Pelangi",
+		Text:    "Laskar Pelangi is now Rp 79.000, down from Rp 89.000.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Then the server receives the headers
+	msg, err := mail.ReadMessage(strings.NewReader(<-received))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "ani@example.com", msg.Header.Get("To"))
+	assert.Equal(t, "text/plain; charset=utf-8", msg.Header.Get("Content-Type"))
+
+	// And the text body follows them
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	assert.NoError(t, err)
+	assert.Equal(t, "Laskar Pelangi is now Rp 79.000, down from Rp 89.000.", strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,94 @@
+package features
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Exact money amounts
+//
+//	As the shop owner
+//	I want prices and totals kept in whole sen
+//	So order totals never drift by a fraction of a rupiah
+//
+//	Scenario: Reading amounts
+//		Given prices written as rupiah with decimals
+//		When they are parsed
+//		Then they are kept in sen
+//		And amounts with more than 2 decimals are rejected
+//
+//	Scenario: Sending amounts over the API
+//		Given a book priced 99000.50
+//		When it is encoded and decoded as JSON
+//		Then the price is a plain number of rupiah and comes back unchanged
+//		And an invalid price is a type error the handlers report per field
+//
+//	Scenario: Reading amounts from the database
+//		Given the minor units MySQL returns for a column or a SUM
+//		When they are scanned
+//		Then they are amounts in rupiah
+
+func TestParseMoney(t *testing.T) {
+	// Given prices written as rupiah with decimals
+	for input, sen := range map[string]int64{"99000": 9900000, "9.99": 999, "0.1": 10, "-12.50": -1250, " 7 ": 700} {
+		// When they are parsed
+		amount, err := money.Parse(input, "IDR")
+
+		// Then they are kept in sen
+		assert.NoError(t, err)
+		assert.Equal(t, money.New(sen, "IDR"), amount, input)
+	}
+
+	// And amounts with more than 2 decimals are rejected
+	for _, input := range []string{"9.999", "", "-", "1e3", "12,50"} {
+		_, err := money.Parse(input, "IDR")
+		assert.ErrorIs(t, err, money.ErrInvalidAmount, input)
+	}
+	assert.Equal(t, "0.01", money.New(1, "IDR").Decimal())
+	assert.Equal(t, "-0.5", money.New(-50, "IDR").String())
+}
+
+func TestMoneyJSON(t *testing.T) {
+	// Given a book priced 99000.50
+	book := models.Book{NewPrice: money.New(9900050, "IDR"), OldPrice: money.IDR(120000)}
+
+	// When it is encoded and decoded as JSON
+	data, err := json.Marshal(book)
+	assert.NoError(t, err)
+	var decoded models.Book
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+
+	// Then the price is a plain number of rupiah and comes back unchanged
+	assert.Contains(t, string(data), `"new_price":99000.5,"`)
+	assert.Contains(t, string(data), `"old_price":120000,"`)
+	assert.Equal(t, book.NewPrice, decoded.NewPrice)
+
+	// And an invalid price is a type error the handlers report per field
+	err = json.Unmarshal([]byte(`{"new_price": 1.234}`), &decoded)
+	var typeErr *json.UnmarshalTypeError
+	if assert.ErrorAs(t, err, &typeErr) {
+		assert.Equal(t, "money.Money", typeErr.Type.String())
+	}
+}
+
+func TestScanMoney(t *testing.T) {
+	// Given the minor units MySQL returns for a column or a SUM
+	for _, src := range []interface{}{int64(1250), []byte("1250"), "1250.0000"} {
+		// When they are scanned
+		var amount money.Money
+		assert.NoError(t, amount.Scan(src))
+
+		// Then they are amounts in rupiah
+		assert.Equal(t, money.New(1250, "IDR"), amount)
+	}
+
+	var amount money.Money
+	assert.Error(t, amount.Scan("12.5"))
+	_, err := money.New(100, "USD").Value()
+	assert.ErrorIs(t, err, money.ErrCurrencyMismatch)
+	assert.Panics(t, func() { money.IDR(1).Add(money.New(1, "USD")) })
+}
@@ -0,0 +1,236 @@
+package features
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/febriaricandra/book-shop/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Object storage backends
+//
+//	As an operator
+//	I want covers to be stored on R2/S3 in production and on disk in development
+//	So the handlers behave the same wherever the objects live
+//
+//	Scenario: Storing objects on the local disk
+//		Given a local store
+//		When an object is put, read back and deleted
+//		Then the body and content type are returned while it exists
+//		And reading it afterwards returns ErrNotFound
+//		And deleting it again is not an error
+//
+//	Scenario: Keys escaping the local directory
+//		Given a local store
+//		When an object is put under "../"
+//		Then it is rejected
+//
+//	Scenario: Presigning on the local disk
+//		Given a local store
+//		When a GET and a PUT are presigned
+//		Then the GET is the public URL
+//		And the PUT returns ErrUnsupported
+//
+//	Scenario: Storing objects in an S3 compatible bucket
+//		Given an S3 store in front of a bucket
+//		When an object is put, read back and deleted
+//		Then the bucket receives the key and content type
+//		And missing keys return ErrNotFound
+//
+//	Scenario: Presigning an upload to the bucket
+//		Given an S3 store
+//		When a PUT is presigned with a content type and length
+//		Then the URL is signed for the key and expires as requested
+//		And the content type is one of the signed headers
+//		And no Host header is handed to the browser
+
+func TestLocalStoreObjects(t *testing.T) {
+	// Given a local store
+	ctx := context.Background()
+	store, err := storage.NewLocalStore(t.TempDir(), "http://localhost:8080/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// When an object is put, read back and deleted
+	err = store.Put(ctx, "covers/abc/card.jpg", strings.NewReader("jpeg"), "image/jpeg")
+	assert.NoError(t, err)
+	body, info, err := store.Get(ctx, "covers/abc/card.jpg")
+
+	// Then the body and content type are returned while it exists
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(body)
+		body.Close()
+		assert.Equal(t, "jpeg", string(data))
+		assert.Equal(t, "image/jpeg", info.ContentType)
+		assert.Equal(t, int64(4), info.Size)
+	}
+
+	// And reading it afterwards returns ErrNotFound
+	assert.NoError(t, store.Delete(ctx, "covers/abc/card.jpg"))
+	_, _, err = store.Get(ctx, "covers/abc/card.jpg")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// And deleting it again is not an error
+	assert.NoError(t, store.Delete(ctx, "covers/abc/card.jpg"))
+}
+
+func TestLocalStoreRejectsEscapingKeys(t *testing.T) {
+	// Given a local store
+	dir := t.TempDir()
+	store, err := storage.NewLocalStore(dir+"/uploads", "http://localhost:8080/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// When an object is put under "../"
+	err = store.Put(context.Background(), "../secret.txt", strings.NewReader("x"), "text/plain")
+
+	// Then it is rejected
+	assert.Error(t, err)
+	_, statErr := os.Stat(dir + "/secret.txt")
+	assert.True(t, os.IsNotExist(statErr))
+}
+
+func TestLocalStorePresign(t *testing.T) {
+	// Given a local store
+	ctx := context.Background()
+	store, err := storage.NewLocalStore(t.TempDir(), "http://localhost:8080/uploads/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// When a GET and a PUT are presigned
+	get, err := store.Presign(ctx, storage.PresignRequest{Method: http.MethodGet, Key: "covers/abc/card.jpg"})
+	_, putErr := store.Presign(ctx, storage.PresignRequest{Method: http.MethodPut, Key: "incoming/1", ContentType: "image/png"})
+
+	// Then the GET is the public URL
+	if assert.NoError(t, err) {
+		assert.Equal(t, "http://localhost:8080/uploads/covers/abc/card.jpg", get.URL)
+	}
+
+	// And the PUT returns ErrUnsupported
+	assert.ErrorIs(t, putErr, storage.ErrUnsupported)
+}
+
+// fakeBucket is a minimal path style S3 endpoint keeping objects in memory
+type fakeBucket struct {
+	mu           sync.Mutex
+	objects      map[string][]byte
+	contentTypes map[string]string
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/bookshop/")
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		b.objects[key] = data
+		b.contentTypes[key] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		data, ok := b.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+			return
+		}
+		w.Header().Set("Content-Type", b.contentTypes[key])
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	case http.MethodDelete:
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newS3Store(endpoint string) *storage.S3Store {
+	client := s3.New(s3.Options{
+		Region:       "auto",
+		BaseEndpoint: aws.String(endpoint),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("access", "secret", ""),
+	})
+	return storage.NewS3Store(client, "bookshop", "https://covers.example.com")
+}
+
+func TestS3StoreObjects(t *testing.T) {
+	// Given an S3 store in front of a bucket
+	ctx := context.Background()
+	bucket := &fakeBucket{objects: map[string][]byte{}, contentTypes: map[string]string{}}
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+	store := newS3Store(server.URL)
+
+	// When an object is put, read back and deleted
+	err := store.Put(ctx, "covers/abc/card.webp", strings.NewReader("webp"), "image/webp")
+
+	// Then the bucket receives the key and content type
+	if assert.NoError(t, err) {
+		assert.Equal(t, "webp", string(bucket.objects["covers/abc/card.webp"]))
+		assert.Equal(t, "image/webp", bucket.contentTypes["covers/abc/card.webp"])
+	}
+	body, info, err := store.Get(ctx, "covers/abc/card.webp")
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(body)
+		body.Close()
+		assert.Equal(t, "webp", string(data))
+		assert.Equal(t, "image/webp", info.ContentType)
+	}
+	assert.NoError(t, store.Delete(ctx, "covers/abc/card.webp"))
+
+	// And missing keys return ErrNotFound
+	_, _, err = store.Get(ctx, "covers/abc/card.webp")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Equal(t, "https://covers.example.com/covers/abc/card.webp", store.PublicURL("covers/abc/card.webp"))
+}
+
+func TestS3StorePresignPut(t *testing.T) {
+	// Given an S3 store
+	store := newS3Store("https://account.r2.cloudflarestorage.com")
+
+	// When a PUT is presigned with a content type and length
+	signed, err := store.Presign(context.Background(), storage.PresignRequest{
+		Method:        http.MethodPut,
+		Key:           "incoming/42",
+		ContentType:   "image/png",
+		ContentLength: 2048,
+		Expires:       10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Then the URL is signed for the key and expires as requested
+	assert.Equal(t, http.MethodPut, signed.Method)
+	signedURL, err := url.Parse(signed.URL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/bookshop/incoming/42", signedURL.Path)
+		assert.Equal(t, "600", signedURL.Query().Get("X-Amz-Expires"))
+		assert.NotEmpty(t, signedURL.Query().Get("X-Amz-Signature"))
+
+		// And the content type is one of the signed headers
+		assert.Contains(t, signedURL.Query().Get("X-Amz-SignedHeaders"), "content-type")
+	}
+	assert.Equal(t, "image/png", signed.Headers.Get("Content-Type"))
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), signed.ExpiresAt, time.Minute)
+
+	// And no Host header is handed to the browser
+	assert.Empty(t, signed.Headers.Get("Host"))
+}
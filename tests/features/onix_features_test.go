@@ -0,0 +1,150 @@
+package features
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/febriaricandra/book-shop/pkg/onix"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: ONIX 3.0 catalog feeds
+//
+//	As an admin
+//	I want to import publisher ONIX feeds and export our catalog as ONIX
+//	So publishers and marketplaces can exchange listings with us
+//
+//	Scenario: Importing an ONIX Product
+//		Given an ONIX 3.0 message with one Product
+//		When the catalog is parsed as onix
+//		Then the Product is mapped onto a catalog row
+//
+//	Scenario: Exporting a book as ONIX
+//		Given a book in our catalog
+//		When it is written as an ONIX message and read back
+//		Then the same row is produced
+
+const onixMessage = `<?xml version="1.0" encoding="UTF-8"?>
+<ONIXMessage release="3.0" xmlns="http://ns.editeur.org/onix/3.0/reference">
+  <Header><Sender><SenderName>Penerbit Contoh</SenderName></Sender><SentDateTime>20240101</SentDateTime></Header>
+  <Product>
+    <RecordReference>id.contoh.0001</RecordReference>
+    <NotificationType>03</NotificationType>
+    <ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9786020332956</IDValue></ProductIdentifier>
+    <DescriptiveDetail>
+      <ProductComposition>00</ProductComposition>
+      <ProductForm>BC</ProductForm>
+      <Measure><MeasureType>08</MeasureType><Measurement>0.35</Measurement><MeasureUnitCode>kg</MeasureUnitCode></Measure>
+      <Collection>
+        <CollectionType>10</CollectionType>
+        <TitleDetail>
+          <TitleType>01</TitleType>
+          <TitleElement><TitleElementLevel>02</TitleElementLevel><TitleText>Tetralogi Laskar Pelangi</TitleText></TitleElement>
+        </TitleDetail>
+      </Collection>
+      <TitleDetail>
+        <TitleType>01</TitleType>
+        <TitleElement><TitleElementLevel>01</TitleElementLevel><TitleText>Laskar Pelangi</TitleText></TitleElement>
+      </TitleDetail>
+      <Contributor><SequenceNumber>2</SequenceNumber><ContributorRole>B06</ContributorRole><PersonName>Translator</PersonName></Contributor>
+      <Contributor><SequenceNumber>1</SequenceNumber><ContributorRole>A01</ContributorRole><PersonName>Andrea Hirata</PersonName></Contributor>
+      <Extent><ExtentType>00</ExtentType><ExtentValue>529</ExtentValue><ExtentUnit>03</ExtentUnit></Extent>
+      <Subject><SubjectSchemeIdentifier>10</SubjectSchemeIdentifier><SubjectCode>FIC000000</SubjectCode></Subject>
+      <Subject><MainSubject/><SubjectSchemeIdentifier>20</SubjectSchemeIdentifier><SubjectHeadingText>Novel</SubjectHeadingText></Subject>
+    </DescriptiveDetail>
+    <CollateralDetail>
+      <TextContent><TextType>03</TextType><ContentAudience>00</ContentAudience><Text>Kisah sepuluh anak Belitung.</Text></TextContent>
+      <SupportingResource>
+        <ResourceContentType>01</ResourceContentType><ContentAudience>00</ContentAudience><ResourceMode>03</ResourceMode>
+        <ResourceVersion><ResourceForm>02</ResourceForm><ResourceLink>https://example.com/cover.jpg</ResourceLink></ResourceVersion>
+      </SupportingResource>
+    </CollateralDetail>
+    <PublishingDetail><Publisher><PublishingRole>01</PublishingRole><PublisherName>Bentang Pustaka</PublisherName></Publisher></PublishingDetail>
+    <ProductSupply>
+      <SupplyDetail>
+        <Supplier><SupplierRole>01</SupplierRole><SupplierName>Bentang Pustaka</SupplierName></Supplier>
+        <ProductAvailability>31</ProductAvailability>
+        <Price><PriceType>02</PriceType><PriceAmount>12.50</PriceAmount><CurrencyCode>USD</CurrencyCode></Price>
+        <Price><PriceType>02</PriceType><PriceAmount>89000</PriceAmount><CurrencyCode>IDR</CurrencyCode></Price>
+      </SupplyDetail>
+    </ProductSupply>
+  </Product>
+</ONIXMessage>`
+
+func TestParseCatalogONIX(t *testing.T) {
+	// Given an ONIX 3.0 message with one Product
+	// When the catalog is parsed as onix
+	rows, rowErrors, err := services.ParseCatalog(services.CatalogFormatONIX, strings.NewReader(onixMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Then the Product is mapped onto a catalog row
+	assert.Empty(t, rowErrors)
+	assert.Len(t, rows, 1)
+	row := rows[0]
+	assert.Equal(t, "9786020332956", row.ISBN)
+	assert.Equal(t, "Laskar Pelangi", row.Title)
+	assert.Equal(t, "Andrea Hirata", row.Author)
+	assert.Equal(t, "Novel", row.Category)
+	assert.Equal(t, "Kisah sepuluh anak Belitung.", row.Description)
+	assert.Equal(t, "https://example.com/cover.jpg", row.CoverImage)
+	assert.Equal(t, "Bentang Pustaka", row.Publisher)
+	assert.Equal(t, "Tetralogi Laskar Pelangi", row.Series)
+	assert.Equal(t, models.BookOutOfStock, row.Availability)
+	assert.Equal(t, money.IDR(89000), row.NewPrice)
+	assert.Equal(t, int64(350), row.Weight)
+	assert.Equal(t, 529, row.PageCount)
+	assert.Empty(t, row.Validate(nil))
+}
+
+func TestExportCatalogONIX(t *testing.T) {
+	// Given a book in our catalog
+	book := models.Book{
+		ISBN:         "9780743273565",
+		Title:        "The Great Gatsby",
+		Author:       "F. Scott Fitzgerald",
+		Description:  "A novel of the Jazz Age.",
+		Category:     "Novel",
+		CoverImage:   "https://example.com/gatsby.jpg",
+		NewPrice:     money.IDR(99000),
+		Weight:       300,
+		PageCount:    180,
+		Publisher:    "Scribner",
+		Series:       "Scribner Classics",
+		Availability: models.BookInStock,
+	}
+	book.ID = 7
+
+	// When it is written as an ONIX message and read back
+	var buf bytes.Buffer
+	writer, err := onix.NewWriter(&buf, onix.Header{SenderName: "Book Shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteProduct(services.ProductFromBook(&book)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, rowErrors, err := services.ParseCatalog(services.CatalogFormatONIX, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Then the same row is produced
+	assert.Empty(t, rowErrors)
+	assert.Len(t, rows, 1)
+	expected := services.CatalogRowFromBook(&book)
+	expected.ID = 0
+	expected.OldPrice = book.NewPrice
+	actual := rows[0]
+	actual.Line, actual.Fields = 0, nil
+	assert.Equal(t, expected, actual)
+}
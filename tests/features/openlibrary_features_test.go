@@ -0,0 +1,97 @@
+package features
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/febriaricandra/book-shop/pkg/openlibrary"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Metadata import by ISBN
+//
+//	As an admin
+//	I want to draft a book from its ISBN
+//	So I do not have to type the title and description by hand
+//
+//	Scenario: Looking up a known ISBN
+//		Given an Open Library compatible API that knows the ISBN
+//		When I look up the ISBN with hyphens
+//		Then the edition title, authors, description, page count and cover are returned
+//		And the cover can be downloaded
+//
+//	Scenario: Looking up an unknown ISBN
+//		Given an Open Library compatible API that does not know the ISBN
+//		When I look up the ISBN
+//		Then ErrNotFound is returned
+
+func newOpenLibraryServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/books", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("bibkeys") != "ISBN:9780743273565" {
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Write([]byte(`{"ISBN:9780743273565": {"details": {
+			"title": "The Great Gatsby",
+			"authors": [{"key": "/authors/OL27349A", "name": "F. Scott Fitzgerald"}],
+			"description": {"type": "/type/text", "value": "A novel of the Jazz Age."},
+			"number_of_pages": 180,
+			"covers": [8432047]
+		}}}`))
+	})
+	mux.HandleFunc("/b/id/8432047-L.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("jpeg-bytes"))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLookupISBN(t *testing.T) {
+	// Given an Open Library compatible API that knows the ISBN
+	server := newOpenLibraryServer(t)
+	client := openlibrary.NewClient(server.URL, server.URL)
+
+	// When I look up the ISBN with hyphens
+	edition, err := client.LookupISBN(context.Background(), "978-0-7432-7356-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Then the edition title, authors, description, page count and cover are returned
+	assert.Equal(t, "9780743273565", edition.ISBN)
+	assert.Equal(t, "The Great Gatsby", edition.Title)
+	assert.Equal(t, []string{"F. Scott Fitzgerald"}, edition.Authors)
+	assert.Equal(t, "A novel of the Jazz Age.", edition.Description)
+	assert.Equal(t, 180, edition.PageCount)
+	assert.Equal(t, server.URL+"/b/id/8432047-L.jpg", edition.CoverURL)
+
+	// And the cover can be downloaded
+	cover, contentType, err := client.FetchCover(context.Background(), edition.CoverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cover.Close()
+	body, _ := io.ReadAll(cover)
+	assert.Equal(t, "image/jpeg", contentType)
+	assert.Equal(t, "jpeg-bytes", string(body))
+}
+
+func TestLookupUnknownISBN(t *testing.T) {
+	// Given an Open Library compatible API that does not know the ISBN
+	server := newOpenLibraryServer(t)
+	client := openlibrary.NewClient(server.URL, server.URL)
+
+	// When I look up the ISBN
+	_, err := client.LookupISBN(context.Background(), "9780000000000")
+
+	// Then ErrNotFound is returned
+	assert.ErrorIs(t, err, openlibrary.ErrNotFound)
+}
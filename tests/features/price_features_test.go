@@ -0,0 +1,78 @@
+package features
+
+import (
+	"testing"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Scheduled sales
+//
+//	As an admin
+//	I want to schedule sale prices ahead of time
+//	So flash sales start and end at midnight without anyone changing prices by hand
+//
+//	Scenario: Pricing a book on sale
+//		Given a 25% off rule and a rule with a fixed sale price
+//		When they are applied to a book at 99000
+//		Then the percentage is taken off and rounded to whole rupiah
+//		And the fixed rule uses its sale price
+//
+//	Scenario: Scheduling a sale
+//		Given a rule for both a book and a category, with a sale price and a percentage, ending before it starts
+//		When it is validated
+//		Then each mistake is reported
+//		And a rule for a category at 30% off next week is accepted
+
+func TestSalePrice(t *testing.T) {
+	// Given a 25% off rule and a rule with a fixed sale price
+	percentOff := &models.PriceRule{PercentOff: 25}
+	fixed := &models.PriceRule{SalePrice: money.IDR(49000)}
+
+	// When they are applied to a book at 99000
+	// Then the percentage is taken off and rounded to whole rupiah
+	assert.Equal(t, money.IDR(74250), percentOff.SalePriceFor(money.IDR(99000)))
+	assert.Equal(t, money.IDR(74924), percentOff.SalePriceFor(money.IDR(99899)))
+
+	// And the fixed rule uses its sale price
+	assert.Equal(t, money.IDR(49000), fixed.SalePriceFor(money.IDR(99000)))
+}
+
+func TestValidatePriceRule(t *testing.T) {
+	// Given a rule for both a book and a category, with a sale price and a percentage, ending before it starts
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	bookID := uint(7)
+	input := services.PriceRuleInput{
+		Name:       "Payday sale",
+		BookID:     &bookID,
+		Category:   "Fiction",
+		SalePrice:  money.IDR(49000),
+		PercentOff: 10,
+		StartsAt:   now.Add(48 * time.Hour),
+		EndsAt:     now.Add(24 * time.Hour),
+	}
+
+	// When it is validated
+	errs := input.Validate(now)
+
+	// Then each mistake is reported
+	assert.Contains(t, errs, "book_id")
+	assert.Contains(t, errs, "sale_price")
+	assert.Contains(t, errs, "ends_at")
+	assert.NotContains(t, errs, "name")
+
+	// And a rule for a category at 30% off next week is accepted
+	input = services.PriceRuleInput{
+		Name:       " Payday sale ",
+		Category:   "Fiction",
+		PercentOff: 30,
+		StartsAt:   now.AddDate(0, 0, 7),
+		EndsAt:     now.AddDate(0, 0, 8),
+	}
+	assert.Empty(t, input.Validate(now))
+	assert.Equal(t, "Payday sale", input.Name)
+}
@@ -0,0 +1,325 @@
+package features
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/handlers"
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/febriaricandra/book-shop/pkg/rajaongkir"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: RajaOngkir shipping rates
+//
+//	As a customer
+//	I want to see what each courier charges to my city
+//	So I can pick how my books are shipped
+//
+//	Scenario: Listing provinces
+//		Given a RajaOngkir API with two provinces
+//		When the provinces are listed
+//		Then both are returned with their IDs
+//
+//	Scenario: Asking for shipping costs
+//		Given a RajaOngkir API quoting JNE
+//		When the cost of 1700 grams from Bandung to Jakarta is asked for
+//		Then the request is form encoded with the API key
+//		And every service is returned with its price in rupiah
+//
+//	Scenario: Using a wrong API key
+//		Given a RajaOngkir API that does not know the key
+//		When the provinces are listed
+//		Then ErrInvalidKey is returned
+//
+//	Scenario: Asking a starter account for another courier
+//		Given a starter account
+//		When the cost for SiCepat is asked for
+//		Then ErrUnsupportedCourier is returned without calling RajaOngkir
+//
+//	Scenario: Serving costs from a fake
+//		Given a fake RajaOngkir with JNE and POS rates
+//		When a customer posts the cost form for JNE
+//		Then only the JNE services are answered
+//
+//	Scenario: Caching provinces and cities
+//		Given provinces and cities fetched from RajaOngkir
+//		When RajaOngkir goes down while the cache is fresh
+//		Then the lists are still served without asking it
+//		And the cities are those of the province asked for
+//
+//	Scenario: Serving stale lists when RajaOngkir is down
+//		Given provinces fetched from RajaOngkir that have expired
+//		When RajaOngkir is down
+//		Then the old list is served marked as stale
+//		And a forced refresh reports the failure
+//
+//	Scenario: Many customers asking for provinces at once
+//		Given a slow RajaOngkir and an empty cache
+//		When customers ask for the provinces together and the first one gives up
+//		Then RajaOngkir is asked once
+//		And the others get the list
+
+func newRajaOngkirServer(t *testing.T, calls *int) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/province", func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		if r.Header.Get("key") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"rajaongkir":{"status":{"code":400,"description":"Invalid key. API key tidak ditemukan di database RajaOngkir."}}}`))
+			return
+		}
+		w.Write([]byte(`{"rajaongkir":{"status":{"code":200,"description":"OK"},"results":[
+			{"province_id":"1","province":"Bali"},{"province_id":"9","province":"Jawa Barat"}]}}`))
+	})
+	mux.HandleFunc("/cost", func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		r.ParseForm()
+		if r.Header.Get("key") != "secret" || r.PostForm.Get("origin") != "23" || r.PostForm.Get("destination") != "152" ||
+			r.PostForm.Get("weight") != "1700" || r.PostForm.Get("courier") != "jne" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"rajaongkir":{"status":{"code":400,"description":"Bad request"}}}`))
+			return
+		}
+		w.Write([]byte(`{"rajaongkir":{"status":{"code":200,"description":"OK"},"results":[{"code":"jne","name":"Jalur Nugraha Ekakurir (JNE)","costs":[
+			{"service":"OKE","description":"Ongkos Kirim Ekonomis","cost":[{"value":18000,"etd":"2-3","note":""}]},
+			{"service":"REG","description":"Layanan Reguler","cost":[{"value":22000,"etd":"1-2","note":""}]}]}]}}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRajaOngkirProvinces(t *testing.T) {
+	// Given a RajaOngkir API with two provinces
+	calls := 0
+	server := newRajaOngkirServer(t, &calls)
+	client := rajaongkir.NewClient("secret", rajaongkir.Starter, server.URL, 5*time.Second)
+
+	// When the provinces are listed
+	provinces, err := client.Provinces(context.Background())
+
+	// Then both are returned with their IDs
+	assert.NoError(t, err)
+	assert.Equal(t, []rajaongkir.Province{{ID: "1", Name: "Bali"}, {ID: "9", Name: "Jawa Barat"}}, provinces)
+}
+
+func TestRajaOngkirCosts(t *testing.T) {
+	// Given a RajaOngkir API quoting JNE
+	calls := 0
+	server := newRajaOngkirServer(t, &calls)
+	client := rajaongkir.NewClient("secret", rajaongkir.Starter, server.URL, 5*time.Second)
+
+	// When the cost of 1700 grams from Bandung to Jakarta is asked for
+	costs, err := client.Costs(context.Background(), rajaongkir.CostRequest{Origin: "23", Destination: "152", Weight: 1700, Courier: "JNE"})
+
+	// Then the request is form encoded with the API key
+	// And every service is returned with its price in rupiah
+	assert.NoError(t, err)
+	if assert.Len(t, costs, 2) {
+		assert.Equal(t, "jne", costs[0].Courier)
+		assert.Equal(t, "OKE", costs[0].Service)
+		assert.Equal(t, money.IDR(18000), costs[0].Value)
+		assert.Equal(t, "REG", costs[1].Service)
+		assert.Equal(t, "1-2", costs[1].ETD)
+	}
+}
+
+func TestRajaOngkirInvalidKey(t *testing.T) {
+	// Given a RajaOngkir API that does not know the key
+	calls := 0
+	server := newRajaOngkirServer(t, &calls)
+	client := rajaongkir.NewClient("wrong", rajaongkir.Starter, server.URL, 5*time.Second)
+
+	// When the provinces are listed
+	_, err := client.Provinces(context.Background())
+
+	// Then ErrInvalidKey is returned
+	assert.ErrorIs(t, err, rajaongkir.ErrInvalidKey)
+}
+
+func TestRajaOngkirTierCouriers(t *testing.T) {
+	// Given a starter account
+	calls := 0
+	server := newRajaOngkirServer(t, &calls)
+	client := rajaongkir.NewClient("secret", rajaongkir.Starter, server.URL, 5*time.Second)
+
+	// When the cost for SiCepat is asked for
+	_, err := client.Costs(context.Background(), rajaongkir.CostRequest{Origin: "23", Destination: "152", Weight: 1000, Courier: "sicepat"})
+
+	// Then ErrUnsupportedCourier is returned without calling RajaOngkir
+	assert.ErrorIs(t, err, rajaongkir.ErrUnsupportedCourier)
+	assert.Equal(t, 0, calls)
+
+	// And the pro tier has its own API
+	tier, err := rajaongkir.ParseTier("PRO")
+	assert.NoError(t, err)
+	assert.True(t, tier.SupportsCourier("sicepat"))
+	assert.Equal(t, "https://pro.rajaongkir.com/api", tier.BaseURL())
+}
+
+func TestRajaOngkirHandlerWithFake(t *testing.T) {
+	// Given a fake RajaOngkir with JNE and POS rates
+	fake := &rajaongkir.Fake{CostList: []rajaongkir.Cost{
+		{Courier: "jne", Service: "REG", Value: money.IDR(22000)},
+		{Courier: "pos", Service: "Paket Kilat Khusus", Value: money.IDR(20000)},
+	}}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/cost", handlers.NewRajaOngkirHandler(services.NewShippingService(fake, nil, nil, time.Hour, models.ShippingPolicy{})).GetCosts)
+
+	// When a customer posts the cost form for JNE
+	form := "origin=23&destination=152&weight=1700&courier=jne"
+	req := httptest.NewRequest(http.MethodPost, "/api/cost", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	// Then only the JNE services are answered
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response struct {
+		Data []rajaongkir.Cost `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, response.Data, 1) {
+		assert.Equal(t, "REG", response.Data[0].Service)
+	}
+	assert.Equal(t, []rajaongkir.CostRequest{{Origin: "23", Destination: "152", Weight: 1700, Courier: "jne"}}, fake.Requests())
+}
+
+func TestRegionCache(t *testing.T) {
+	// Given provinces and cities fetched from RajaOngkir
+	fake := &rajaongkir.Fake{
+		ProvinceList: []rajaongkir.Province{{ID: "1", Name: "Bali"}, {ID: "9", Name: "Jawa Barat"}},
+		CityList: []rajaongkir.City{
+			{ID: "17", ProvinceID: "1", Name: "Badung"},
+			{ID: "23", ProvinceID: "9", Name: "Bandung"},
+			{ID: "78", ProvinceID: "9", Name: "Bogor"},
+		},
+	}
+	shipping := services.NewShippingService(fake, nil, nil, time.Hour, models.ShippingPolicy{})
+	ctx := context.Background()
+	if _, err := shipping.GetProvinces(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shipping.GetCities(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// When RajaOngkir goes down while the cache is fresh
+	fake.Err = rajaongkir.ErrUnavailable
+	provinces, err := shipping.GetProvinces(ctx)
+	assert.NoError(t, err)
+	cities, err := shipping.GetCities(ctx, "9")
+	assert.NoError(t, err)
+
+	// Then the lists are still served without asking it
+	assert.False(t, provinces.Stale)
+	assert.Len(t, provinces.Items, 2)
+
+	// And the cities are those of the province asked for
+	assert.False(t, cities.Stale)
+	assert.Equal(t, []rajaongkir.City{{ID: "23", ProvinceID: "9", Name: "Bandung"}, {ID: "78", ProvinceID: "9", Name: "Bogor"}}, cities.Items)
+}
+
+func TestRegionCacheStale(t *testing.T) {
+	// Given provinces fetched from RajaOngkir that have expired
+	fake := &rajaongkir.Fake{ProvinceList: []rajaongkir.Province{{ID: "1", Name: "Bali"}}}
+	shipping := services.NewShippingService(fake, nil, nil, 0, models.ShippingPolicy{})
+	ctx := context.Background()
+	first, err := shipping.GetProvinces(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// When RajaOngkir is down
+	fake.Err = rajaongkir.ErrUnavailable
+	provinces, err := shipping.GetProvinces(ctx)
+
+	// Then the old list is served marked as stale
+	assert.NoError(t, err)
+	assert.True(t, provinces.Stale)
+	assert.Equal(t, first.Items, provinces.Items)
+	assert.Equal(t, first.FetchedAt, provinces.FetchedAt)
+
+	// And a forced refresh reports the failure
+	_, err = shipping.RefreshRegions(ctx)
+	assert.ErrorIs(t, err, rajaongkir.ErrUnavailable)
+
+	// And a city list never fetched cannot be served
+	_, err = shipping.GetCities(ctx, "1")
+	assert.ErrorIs(t, err, rajaongkir.ErrUnavailable)
+}
+
+// slowProvinces holds province requests until release is closed
+type slowProvinces struct {
+	*rajaongkir.Fake
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (api *slowProvinces) Provinces(ctx context.Context) ([]rajaongkir.Province, error) {
+	api.calls.Add(1)
+	select {
+	case <-api.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return api.Fake.Provinces(ctx)
+}
+
+func TestRegionCacheSingleFetch(t *testing.T) {
+	// Given a slow RajaOngkir and an empty cache
+	api := &slowProvinces{Fake: &rajaongkir.Fake{ProvinceList: []rajaongkir.Province{{ID: "1", Name: "Bali"}}}, release: make(chan struct{})}
+	shipping := services.NewShippingService(api, nil, nil, time.Hour, models.ShippingPolicy{})
+
+	// When customers ask for the provinces together and the first one gives up
+	ctx, cancel := context.WithCancel(context.Background())
+	gaveUp := make(chan error)
+	go func() {
+		_, err := shipping.GetProvinces(ctx)
+		gaveUp <- err
+	}()
+	for api.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	assert.ErrorIs(t, <-gaveUp, context.Canceled)
+
+	var wg sync.WaitGroup
+	lists := make([]*services.RegionList[rajaongkir.Province], 5)
+	errs := make([]error, len(lists))
+	for i := range lists {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lists[i], errs[i] = shipping.GetProvinces(context.Background())
+		}(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(api.release)
+	wg.Wait()
+
+	// Then RajaOngkir is asked once
+	assert.Equal(t, int32(1), api.calls.Load())
+
+	// And the others get the list
+	for i := range lists {
+		if assert.NoError(t, errs[i]) {
+			assert.Equal(t, []rajaongkir.Province{{ID: "1", Name: "Bali"}}, lists[i].Items)
+		}
+	}
+}
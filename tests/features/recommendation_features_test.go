@@ -0,0 +1,263 @@
+package features
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// Feature: Cached rankings
+//
+//	As the shop
+//	I want bestsellers and recommendations cached for a while
+//	So the home page does not aggregate every order on every request
+//
+//	Scenario: Loading a ranking
+//		Given an empty cache
+//		When a ranking is requested twice
+//		Then it is computed only once
+//		And a failed computation is not cached
+//		And the ranking is computed again once it expired
+//
+//	Scenario: Ranking bestsellers
+//		Given books sold in paid, shipped and delivered orders
+//		And sales before the window, pending and cancelled orders
+//		And sales of an unavailable and an archived book
+//		When the bestsellers since the window are ranked
+//		Then books are ranked by the sold orders in the window
+//		And the other orders and books are left out
+//		And pages follow the ranking
+//
+//	Scenario: Personal recommendations
+//		Given a customer who bought a book
+//		And other customers who bought it together with other books
+//		When recommendations are ranked for the customer
+//		Then the books most often bought together come first
+//		And books from pending or cancelled orders do not count
+//		And the book they bought is left out
+//
+//	Scenario: Related books without sales
+//		Given a book in a series, with books sharing its series, category and author or only some of them
+//		And books in other categories and an unavailable book
+//		When its related books are ranked
+//		Then books in the same series come first
+//		And then books sharing both category and author
+//		And then the best rated books of the category
+//		And the other books are left out
+//
+//	Scenario: Related books with sales
+//		Given a related book that was bought together with the book
+//		When its related books are ranked
+//		Then that book comes first
+//
+//	Scenario: Nothing to rank
+//		Given a shop with a trending book and no sales
+//		When bestsellers and recommendations for a guest and a new customer are requested
+//		Then the trending books are returned
+
+func TestRankingCache(t *testing.T) {
+	// Given an empty cache
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	rankings := cache.NewTTL[string, []uint](10 * time.Minute)
+	rankings.SetClock(func() time.Time { return now })
+	loads := 0
+	load := func() ([]uint, error) {
+		loads++
+		return []uint{3, 1, 2}, nil
+	}
+
+	// When a ranking is requested twice
+	first, err := rankings.GetOrLoad("bestsellers", load)
+	assert.NoError(t, err)
+	second, err := rankings.GetOrLoad("bestsellers", load)
+	assert.NoError(t, err)
+
+	// Then it is computed only once
+	assert.Equal(t, 1, loads)
+	assert.Equal(t, first, second)
+
+	// And a failed computation is not cached
+	_, err = rankings.GetOrLoad("also-bought", func() ([]uint, error) { return nil, errors.New("database is down") })
+	assert.Error(t, err)
+	_, ok := rankings.Get("also-bought")
+	assert.False(t, ok)
+
+	// And the ranking is computed again once it expired
+	now = now.Add(10*time.Minute - time.Second)
+	_, ok = rankings.Get("bestsellers")
+	assert.True(t, ok)
+	now = now.Add(time.Second)
+	_, ok = rankings.Get("bestsellers")
+	assert.False(t, ok)
+	_, err = rankings.GetOrLoad("bestsellers", load)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, loads)
+}
+
+// newRankingFixture stores the books titled and returns their ids in order
+func newRankingFixture(t *testing.T, titles ...string) (*gorm.DB, []uint) {
+	db := newTestDB(t)
+	bookRepo := repositories.NewBookRepository(db)
+	var ids []uint
+	for _, title := range titles {
+		book := &models.Book{Title: title, Category: "Novel"}
+		if err := bookRepo.CreateBook(book); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, book.ID)
+	}
+	return db, ids
+}
+
+func bookIDs(books []models.Book) []uint {
+	ids := []uint{}
+	for _, book := range books {
+		ids = append(ids, book.ID)
+	}
+	return ids
+}
+
+func TestRankBestsellers(t *testing.T) {
+	// Given books sold in paid, shipped and delivered orders
+	db, ids := newRankingFixture(t, "Cantik Itu Luka", "Laut Bercerita", "Pulang", "Supernova", "Saman")
+	now := time.Now()
+	since := now.Add(-30 * 24 * time.Hour)
+	for _, status := range []string{models.OrderPaid, models.OrderShipped, models.OrderDelivered} {
+		createOrder(t, db, 1, status, now, ids[1])
+	}
+	createOrder(t, db, 1, models.OrderPaid, now, ids[0], ids[1])
+	createOrder(t, db, 1, models.OrderDelivered, now, ids[0])
+
+	// And sales before the window, pending and cancelled orders
+	for i := 0; i < 3; i++ {
+		createOrder(t, db, 1, models.OrderDelivered, since.Add(-time.Hour), ids[2])
+	}
+	createOrder(t, db, 1, models.OrderPending, now, ids[2])
+	createOrder(t, db, 1, models.OrderCancelled, now, ids[2])
+
+	// And sales of an unavailable and an archived book
+	for i := 0; i < 5; i++ {
+		createOrder(t, db, 1, models.OrderPaid, now, ids[3], ids[4])
+	}
+	db.Model(&models.Book{}).Where("id = ?", ids[3]).Update("availability", models.BookUnavailable)
+	db.Model(&models.Book{}).Where("id = ?", ids[4]).Update("archived_at", now)
+
+	// When the bestsellers since the window are ranked
+	recommendations := repositories.NewRecommendationRepository(db)
+	books, total, err := recommendations.GetBestsellers(since, 1, 10)
+
+	// Then books are ranked by the sold orders in the window
+	// And the other orders and books are left out
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, []uint{ids[1], ids[0]}, bookIDs(books))
+
+	// And pages follow the ranking
+	books, total, err = recommendations.GetBestsellers(since, 2, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, []uint{ids[0]}, bookIDs(books))
+}
+
+func TestRankRecommendationsForUser(t *testing.T) {
+	// Given a customer who bought a book
+	db, ids := newRankingFixture(t, "Bumi", "Bulan", "Matahari", "Bintang")
+	now := time.Now()
+	createOrder(t, db, 7, models.OrderPaid, now, ids[0])
+
+	// And other customers who bought it together with other books
+	createOrder(t, db, 8, models.OrderPaid, now, ids[0], ids[1], ids[2])
+	createOrder(t, db, 9, models.OrderDelivered, now, ids[0], ids[1])
+	createOrder(t, db, 10, models.OrderPending, now, ids[0], ids[3])
+	createOrder(t, db, 11, models.OrderCancelled, now, ids[0], ids[3])
+
+	// When recommendations are ranked for the customer
+	books, total, err := repositories.NewRecommendationRepository(db).GetRecommendedForUser(7, 1, 10)
+
+	// Then the books most often bought together come first
+	// And books from pending or cancelled orders do not count
+	// And the book they bought is left out
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, []uint{ids[1], ids[2]}, bookIDs(books))
+}
+
+func TestRankingFallsBackToTrending(t *testing.T) {
+	// Given a shop with a trending book and no sales
+	db, ids := newRankingFixture(t, "Negeri 5 Menara", "Ayat-Ayat Cinta")
+	db.Model(&models.Book{}).Where("id = ?", ids[1]).Update("trending", true)
+	recommendations := services.NewRecommendationService(repositories.NewRecommendationRepository(db), repositories.NewBookRepository(db), 30*24*time.Hour, time.Minute)
+
+	// When bestsellers and recommendations for a guest and a new customer are requested
+	bestsellers, err := recommendations.GetBestsellers(1, 10)
+	assert.NoError(t, err)
+	guest, err := recommendations.GetRecommendations(0, 1, 10)
+	assert.NoError(t, err)
+	customer, err := recommendations.GetRecommendations(7, 1, 10)
+	assert.NoError(t, err)
+
+	// Then the trending books are returned
+	for _, page := range []*services.BookPage{bestsellers, guest, customer} {
+		assert.Equal(t, 1, page.Total)
+		assert.Equal(t, []uint{ids[1]}, bookIDs(page.Books))
+	}
+}
+
+func newRelatedFixture(t *testing.T) (*gorm.DB, []models.Book) {
+	db := newTestDB(t)
+	books := []models.Book{
+		{Title: "Supernova: Ksatria, Puteri dan Bintang Jatuh", Author: "Dee Lestari", Category: "Novel", Series: "Supernova"},
+		{Title: "Supernova: Akar", Author: "Dewi Lestari", Category: "Sains Fiksi", Series: "Supernova"},
+		{Title: "Perahu Kertas", Author: "Dee Lestari", Category: "Novel"},
+		{Title: "Laskar Pelangi", Author: "Andrea Hirata", Category: "Novel", RatingAverage: 4.5},
+		{Title: "Ronggeng Dukuh Paruk", Author: "Ahmad Tohari", Category: "Novel", RatingAverage: 3},
+		{Title: "Sejarah Indonesia Modern", Author: "M.C. Ricklefs", Category: "Sejarah"},
+		{Title: "Filosofi Kopi", Author: "Dee Lestari", Category: "Novel", Availability: models.BookUnavailable},
+	}
+	bookRepo := repositories.NewBookRepository(db)
+	for i := range books {
+		if err := bookRepo.CreateBook(&books[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, books
+}
+
+func TestRelatedBooksWithoutSales(t *testing.T) {
+	// Given a book in a series, with books sharing its series, category and author or only some of them
+	// And books in other categories and an unavailable book
+	db, books := newRelatedFixture(t)
+
+	// When its related books are ranked
+	related, total, err := repositories.NewRecommendationRepository(db).GetRelatedBooks(&books[0], 1, 10)
+
+	// Then books in the same series come first
+	// And then books sharing both category and author
+	// And then the best rated books of the category
+	// And the other books are left out
+	assert.NoError(t, err)
+	assert.Equal(t, 4, total)
+	assert.Equal(t, []uint{books[1].ID, books[2].ID, books[3].ID, books[4].ID}, bookIDs(related))
+}
+
+func TestRelatedBooksWithSales(t *testing.T) {
+	// Given a related book that was bought together with the book
+	db, books := newRelatedFixture(t)
+	createOrder(t, db, 1, models.OrderDelivered, time.Now(), books[0].ID, books[4].ID)
+	createOrder(t, db, 2, models.OrderCancelled, time.Now(), books[0].ID, books[3].ID)
+
+	// When its related books are ranked
+	related, total, err := repositories.NewRecommendationRepository(db).GetRelatedBooks(&books[0], 1, 2)
+
+	// Then that book comes first
+	assert.NoError(t, err)
+	assert.Equal(t, 4, total)
+	assert.Equal(t, []uint{books[4].ID, books[1].ID}, bookIDs(related))
+}
@@ -0,0 +1,63 @@
+package features
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Reviews from customers who received the book
+//
+//	As a customer
+//	I want to rate and review books I bought
+//	So other customers can decide what to buy
+//
+//	Scenario: Writing a review
+//		Given a review with a rating out of range and no title
+//		When it is validated
+//		Then the rating and title are reported
+//		And a 4 star review with a title and body is accepted
+//
+//	Scenario: Delivering an order
+//		Given an order moving through its lifecycle
+//		When the admin changes its status
+//		Then it can only reach delivered through paid and shipped
+//		And delivered and cancelled orders are final
+
+func TestValidateReview(t *testing.T) {
+	// Given a review with a rating out of range and no title
+	input := services.ReviewInput{Rating: 6, Title: "   ", Body: "Loved it"}
+
+	// When it is validated
+	errs := input.Validate()
+
+	// Then the rating and title are reported
+	assert.Contains(t, errs, "rating")
+	assert.Contains(t, errs, "title")
+	assert.NotContains(t, errs, "body")
+
+	// And a 4 star review with a title and body is accepted
+	input = services.ReviewInput{Rating: 4, Title: " Great read ", Body: strings.Repeat("a", 5000)}
+	assert.Empty(t, input.Validate())
+	assert.Equal(t, "Great read", input.Title)
+}
+
+func TestOrderStatusTransitions(t *testing.T) {
+	// Given an order moving through its lifecycle
+	// When the admin changes its status
+	// Then it can only reach delivered through paid and shipped
+	assert.True(t, services.CanTransitionOrder(models.OrderPending, models.OrderPaid))
+	assert.True(t, services.CanTransitionOrder(models.OrderPaid, models.OrderShipped))
+	assert.True(t, services.CanTransitionOrder(models.OrderShipped, models.OrderDelivered))
+	assert.False(t, services.CanTransitionOrder(models.OrderPending, models.OrderDelivered))
+	assert.False(t, services.CanTransitionOrder(models.OrderShipped, models.OrderCancelled))
+
+	// And delivered and cancelled orders are final
+	for _, status := range []string{models.OrderPending, models.OrderPaid, models.OrderShipped} {
+		assert.False(t, services.CanTransitionOrder(models.OrderDelivered, status))
+		assert.False(t, services.CanTransitionOrder(models.OrderCancelled, status))
+	}
+}
@@ -0,0 +1,201 @@
+package features
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cfg "github.com/febriaricandra/book-shop/config"
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/febriaricandra/book-shop/pkg/rajaongkir"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Shipping quotes
+//
+//	As the shop owner
+//	I want shipping priced by the shop from the weight of the books
+//	So customers cannot choose what they pay for shipping
+//
+//	Scenario: Quoting a cart
+//		Given a warehouse in Bandung and two books, one without a weight
+//		When JNE is quoted to Jakarta
+//		Then RajaOngkir is asked from Bandung for the weight of both books
+//		And every service comes with a signed quote ID
+//
+//	Scenario: Quoting a service with a negative cost
+//		Given RajaOngkir returns a service with a negative cost
+//		When it is quoted
+//		Then that service is not offered
+//
+//	Scenario: Ordering with a quote
+//		Given a quote for two books
+//		When it is verified for the same customer and books
+//		Then the quoted service, cost and city are returned
+//
+//	Scenario: Ordering with someone else's quote
+//		Given a quote for two books
+//		When it is verified for another customer, other books or tampered with
+//		Then it is rejected
+//
+//	Scenario: Ordering with an old quote
+//		Given a quote that has expired
+//		When it is verified
+//		Then ErrShippingQuoteExpired is returned
+//
+//	Scenario: Starting without a quote secret
+//		Given neither SHIPPING_QUOTE_SECRET nor JWT_SECRET
+//		When the shipping policy is configured
+//		Then it fails instead of signing quotes with an empty key
+
+var shippingPolicy = models.ShippingPolicy{Origin: "23", DefaultWeight: 300, QuoteTTL: 30 * time.Minute, QuoteSecret: []byte("secret")}
+
+func newShippingQuoteService(policy models.ShippingPolicy) (*services.ShippingService, *rajaongkir.Fake) {
+	fake := &rajaongkir.Fake{
+		CityList: []rajaongkir.City{
+			{ID: "23", ProvinceID: "9", Province: "Jawa Barat", Name: "Bandung"},
+			{ID: "152", ProvinceID: "6", Province: "DKI Jakarta", Name: "Jakarta Pusat"},
+		},
+		CostList: []rajaongkir.Cost{
+			{Courier: "jne", Service: "OKE", Value: money.IDR(18000), ETD: "2-3"},
+			{Courier: "jne", Service: "REG", Value: money.IDR(22000), ETD: "1-2"},
+		},
+	}
+	return services.NewShippingService(fake, nil, nil, time.Hour, policy), fake
+}
+
+var quotedBooks = []models.Book{
+	{BaseModel: models.BaseModel{ID: 7}, Weight: 450},
+	{BaseModel: models.BaseModel{ID: 3}},
+}
+
+func TestQuoteShipping(t *testing.T) {
+	// Given a warehouse in Bandung and two books, one without a weight
+	shipping, fake := newShippingQuoteService(shippingPolicy)
+
+	// When JNE is quoted to Jakarta
+	quotes, err := shipping.QuoteBooks(context.Background(), 1, quotedBooks, "152", "jne")
+
+	// Then RajaOngkir is asked from Bandung for the weight of both books
+	assert.NoError(t, err)
+	assert.Equal(t, []rajaongkir.CostRequest{{Origin: "23", Destination: "152", Weight: 750, Courier: "jne"}}, fake.Requests())
+
+	// And every service comes with a signed quote ID
+	if assert.Len(t, quotes, 2) {
+		assert.Equal(t, "OKE", quotes[0].Service)
+		assert.Equal(t, money.IDR(18000), quotes[0].Cost)
+		assert.Equal(t, "Jakarta Pusat", quotes[0].City)
+		assert.Equal(t, int64(750), quotes[0].Weight)
+		assert.NotEmpty(t, quotes[0].ID)
+		assert.NotEqual(t, quotes[0].ID, quotes[1].ID)
+	}
+
+	// And a city RajaOngkir does not know cannot be quoted
+	_, err = shipping.QuoteBooks(context.Background(), 1, quotedBooks, "999", "jne")
+	assert.ErrorIs(t, err, services.ErrUnknownDestination)
+}
+
+func TestQuoteNegativeShippingCost(t *testing.T) {
+	// Given RajaOngkir returns a service with a negative cost
+	shipping, fake := newShippingQuoteService(shippingPolicy)
+	fake.CostList[0].Value = money.IDR(-18000)
+
+	// When it is quoted
+	quotes, err := shipping.QuoteBooks(context.Background(), 1, quotedBooks, "152", "jne")
+
+	// Then that service is not offered
+	assert.NoError(t, err)
+	if assert.Len(t, quotes, 1) {
+		assert.Equal(t, "REG", quotes[0].Service)
+	}
+
+	// And nothing is offered when it was the only service
+	fake.CostList = fake.CostList[:1]
+	_, err = shipping.QuoteBooks(context.Background(), 1, quotedBooks, "152", "jne")
+	assert.ErrorIs(t, err, services.ErrNoShippingService)
+}
+
+func TestVerifyShippingQuote(t *testing.T) {
+	// Given a quote for two books
+	shipping, _ := newShippingQuoteService(shippingPolicy)
+	quotes, err := shipping.QuoteBooks(context.Background(), 1, quotedBooks, "152", "jne")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// When it is verified for the same customer and books
+	quote, err := shipping.VerifyQuote(quotes[1].ID, 1, []uint{3, 7, 3})
+
+	// Then the quoted service, cost and city are returned
+	assert.NoError(t, err)
+	assert.Equal(t, "jne", quote.Courier)
+	assert.Equal(t, "REG", quote.Service)
+	assert.Equal(t, money.IDR(22000), quote.Cost)
+	assert.Equal(t, "152", quote.Destination)
+	assert.Equal(t, "DKI Jakarta", quote.Province)
+}
+
+func TestRejectForeignShippingQuote(t *testing.T) {
+	// Given a quote for two books
+	shipping, _ := newShippingQuoteService(shippingPolicy)
+	quotes, err := shipping.QuoteBooks(context.Background(), 1, quotedBooks, "152", "jne")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := quotes[0].ID
+
+	// When it is verified for another customer, other books or tampered with
+	// Then it is rejected
+	_, err = shipping.VerifyQuote(id, 2, []uint{3, 7})
+	assert.ErrorIs(t, err, services.ErrInvalidShippingQuote)
+	_, err = shipping.VerifyQuote(id, 1, []uint{7})
+	assert.ErrorIs(t, err, services.ErrInvalidShippingQuote)
+	_, err = shipping.VerifyQuote(id[:len(id)-2]+"xx", 1, []uint{3, 7})
+	assert.ErrorIs(t, err, services.ErrInvalidShippingQuote)
+
+	other := shippingPolicy
+	other.QuoteSecret = []byte("another secret")
+	otherShop, _ := newShippingQuoteService(other)
+	_, err = otherShop.VerifyQuote(id, 1, []uint{3, 7})
+	assert.ErrorIs(t, err, services.ErrInvalidShippingQuote)
+
+	// And an order needs a quote
+	_, err = shipping.VerifyQuote("", 1, []uint{3, 7})
+	assert.ErrorIs(t, err, services.ErrShippingQuoteRequired)
+}
+
+func TestExpiredShippingQuote(t *testing.T) {
+	// Given a quote that has expired
+	expired := shippingPolicy
+	expired.QuoteTTL = -time.Minute
+	shipping, _ := newShippingQuoteService(expired)
+	quotes, err := shipping.QuoteBooks(context.Background(), 1, quotedBooks, "152", "jne")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// When it is verified
+	_, err = shipping.VerifyQuote(quotes[0].ID, 1, []uint{3, 7})
+
+	// Then ErrShippingQuoteExpired is returned
+	assert.ErrorIs(t, err, services.ErrShippingQuoteExpired)
+}
+
+func TestShippingPolicyWithoutSecret(t *testing.T) {
+	// Given neither SHIPPING_QUOTE_SECRET nor JWT_SECRET
+	t.Setenv("SHIPPING_QUOTE_SECRET", "")
+	t.Setenv("JWT_SECRET", "")
+
+	// When the shipping policy is configured
+	_, err := cfg.ShippingPolicy(cfg.LoadConfig())
+
+	// Then it fails instead of signing quotes with an empty key
+	assert.Error(t, err)
+
+	t.Setenv("JWT_SECRET", "secret")
+	policy, err := cfg.ShippingPolicy(cfg.LoadConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("secret"), policy.QuoteSecret)
+}
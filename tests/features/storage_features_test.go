@@ -0,0 +1,61 @@
+package features
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/febriaricandra/book-shop/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Finding orphaned objects
+//
+//	As an operator
+//	I want to map cover URLs back to keys and list what the bucket holds
+//	So objects no book refers to can be cleaned up
+//
+//	Scenario: Listing a local store
+//		Given a local store with two covers and a direct upload
+//		When the covers prefix is listed
+//		Then only the two covers are returned
+//		And their public URLs map back to the same keys
+//		And URLs outside the store do not map to a key
+
+func TestLocalStoreListAndKeys(t *testing.T) {
+	// Given a local store with two covers and a direct upload
+	ctx := context.Background()
+	store, err := storage.NewLocalStore(t.TempDir(), "http://localhost:8080/uploads/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"covers/abc/card.jpg", "covers/def/card.webp", "incoming/1234"} {
+		if err := store.Put(ctx, key, strings.NewReader("data"), "image/jpeg"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// When the covers prefix is listed
+	var keys []string
+	err = store.List(ctx, "covers/", func(object storage.ObjectInfo) error {
+		keys = append(keys, object.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Then only the two covers are returned
+	assert.ElementsMatch(t, []string{"covers/abc/card.jpg", "covers/def/card.webp"}, keys)
+
+	// And their public URLs map back to the same keys
+	for _, key := range keys {
+		mapped, ok := store.KeyForURL(store.PublicURL(key))
+		assert.True(t, ok)
+		assert.Equal(t, key, mapped)
+	}
+
+	// And URLs outside the store do not map to a key
+	_, ok := store.KeyForURL("https://covers.openlibrary.org/b/isbn/9780743273565-L.jpg")
+	assert.False(t, ok)
+}
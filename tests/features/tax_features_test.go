@@ -0,0 +1,115 @@
+package features
+
+import (
+	"testing"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Tax on orders
+//
+//	As the shop owner
+//	I want the PPN of every order worked out and kept with it
+//	So receipts show it and I can report what was charged
+//
+//	Scenario: Prices including PPN
+//		Given prices that include 11% PPN and exempt textbooks
+//		When the tax of a novel and a textbook is computed
+//		Then the novel's PPN is taken out of its price
+//		And the textbook is on a 0% line of its own
+//
+//	Scenario: Prices excluding PPN
+//		Given prices that do not include 11% PPN
+//		When the tax of a novel is computed
+//		Then PPN is charged on top of its price
+//
+//	Scenario: Taxing after a discount
+//		Given three books of Rp100.000 and a Rp10.000 discount
+//		When the discount is spread over them
+//		Then each pays its share and the shares add up to the discount
+//
+//	Scenario: Setting a category's rate
+//		Given rates typed by admins
+//		When they are validated
+//		Then the category is required and the rate must be a percentage
+
+var ppn = models.TaxPolicy{Mode: models.TaxInclusive, Name: "PPN", Percent: 11}
+
+func TestTaxIncludedInPrices(t *testing.T) {
+	// Given prices that include 11% PPN and exempt textbooks
+	rates := []models.TaxRate{{Category: "Textbook", Name: "PPN", Percent: 0}}
+
+	// When the tax of a novel and a textbook is computed
+	taxes := services.ComputeTaxes([]services.TaxableItem{
+		{Category: "textbook", Amount: money.IDR(50000)},
+		{Category: "Novel", Amount: money.IDR(111000)},
+	}, ppn, rates)
+
+	// Then the novel's PPN is taken out of its price
+	if assert.Len(t, taxes, 2) {
+		assert.Equal(t, 11.0, taxes[0].Percent)
+		assert.Equal(t, money.IDR(100000), taxes[0].Base)
+		assert.Equal(t, money.IDR(11000), taxes[0].Tax)
+
+		// And the textbook is on a 0% line of its own
+		assert.Equal(t, 0.0, taxes[1].Percent)
+		assert.Equal(t, money.IDR(50000), taxes[1].Base)
+		assert.True(t, taxes[1].Tax.IsZero())
+	}
+}
+
+func TestTaxAddedToPrices(t *testing.T) {
+	// Given prices that do not include 11% PPN
+	policy := ppn
+	policy.Mode = models.TaxExclusive
+
+	// When the tax of a novel is computed
+	taxes := services.ComputeTaxes([]services.TaxableItem{{Category: "Novel", Amount: money.IDR(100000)}}, policy, nil)
+
+	// Then PPN is charged on top of its price
+	if assert.Len(t, taxes, 1) {
+		assert.Equal(t, "PPN", taxes[0].Name)
+		assert.Equal(t, money.IDR(100000), taxes[0].Base)
+		assert.Equal(t, money.IDR(11000), taxes[0].Tax)
+	}
+}
+
+func TestSpreadDiscount(t *testing.T) {
+	// Given three books of Rp100.000 and a Rp10.000 discount
+	amounts := []money.Money{money.IDR(100000), money.IDR(100000), money.IDR(100000)}
+
+	// When the discount is spread over them
+	spread := services.SpreadDiscount(amounts, money.IDR(10000))
+
+	// Then each pays its share and the shares add up to the discount
+	assert.Equal(t, money.New(9666667, money.DefaultCurrency), spread[0])
+	assert.Equal(t, money.New(9666667, money.DefaultCurrency), spread[1])
+	assert.Equal(t, money.New(9666666, money.DefaultCurrency), spread[2])
+	assert.Equal(t, money.IDR(290000), money.Sum(spread...))
+
+	// And the amounts passed in are unchanged
+	assert.Equal(t, money.IDR(100000), amounts[0])
+
+	// And a discount larger than the books leaves nothing to tax
+	assert.True(t, money.Sum(services.SpreadDiscount(amounts, money.IDR(500000))...).IsZero())
+}
+
+func TestTaxRateValidation(t *testing.T) {
+	// Given rates typed by admins
+	missing := services.TaxRateInput{Category: "  ", Percent: 11}
+	tooHigh := services.TaxRateInput{Category: "Novel", Percent: 120}
+	exempt := services.TaxRateInput{Category: " Textbook ", Percent: 0}
+
+	// When they are validated
+	// Then the category is required and the rate must be a percentage
+	assert.Contains(t, missing.Validate(ppn), "category")
+	assert.Contains(t, tooHigh.Validate(ppn), "percent")
+	assert.Empty(t, exempt.Validate(ppn))
+
+	// And the name and category are tidied up
+	assert.Equal(t, "Textbook", exempt.Category)
+	assert.Equal(t, "PPN", exempt.Name)
+}
@@ -0,0 +1,326 @@
+package features
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cfg "github.com/febriaricandra/book-shop/config"
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/repositories"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/rajaongkir"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// Feature: Parcel tracking
+//
+//	As a customer
+//	I want to follow my parcel once my order is shipped
+//	So I know when my books arrive
+//
+//	Scenario: Tracking a delivered parcel
+//		Given a basic account and a JNE parcel that was delivered
+//		When its waybill is looked up
+//		Then its manifest is returned in Western Indonesian Time
+//		And it is reported delivered with the receiver
+//
+//	Scenario: Tracking on a starter account
+//		Given a starter account
+//		When a waybill is looked up
+//		Then ErrTrackingUnavailable is returned without calling RajaOngkir
+//
+//	Scenario: Tracking an unknown waybill
+//		Given a fake RajaOngkir with one parcel
+//		When another waybill is looked up
+//		Then ErrBadRequest is returned
+//
+//	Scenario: Entering a shipment
+//		Given an order quoted with JNE REG
+//		When warehouse staff only enter the waybill
+//		Then the courier and service are those of the quote
+//		And a waybill is required
+//
+//	Scenario: Shipping a paid order
+//		Given a paid order
+//		When warehouse staff record its parcel
+//		Then the order is shipped
+//
+//	Scenario: Following a parcel until it is delivered
+//		Given a shipped order whose parcel is on its way
+//		When the customer tracks it twice within the cache TTL
+//		Then the courier is asked once
+//		When the courier delivers it and the background run tracks it
+//		Then the order is delivered
+//
+//	Scenario: Configuring the tracking schedule
+//		Given TRACKING_CACHE_MINUTES of zero or below
+//		When the configuration is loaded
+//		Then the default of an hour is used
+
+func newWaybillServer(t *testing.T, calls *int) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/waybill", func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		r.ParseForm()
+		if r.Header.Get("key") != "secret" || r.PostForm.Get("waybill") != "SOCAG00183235715" || r.PostForm.Get("courier") != "jne" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"rajaongkir":{"status":{"code":400,"description":"Invalid waybill. Nomor resi tidak ditemukan."}}}`))
+			return
+		}
+		w.Write([]byte(`{"rajaongkir":{"status":{"code":200,"description":"OK"},"result":{
+			"delivered":true,
+			"summary":{"courier_code":"jne","waybill_number":"SOCAG00183235715","service_code":"REG","status":"DELIVERED"},
+			"delivery_status":{"status":"DELIVERED","pod_receiver":"BUDI","pod_date":"2026-10-17","pod_time":"14:05"},
+			"manifest":[
+				{"manifest_code":"1","manifest_description":"Manifested","manifest_date":"2026-10-15","manifest_time":"20:12:00","city_name":"BANDUNG"},
+				{"manifest_code":"3","manifest_description":"Received on Destination","manifest_date":"2026-10-17","manifest_time":"07:40:00","city_name":"JAKARTA"}]}}}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTrackDeliveredWaybill(t *testing.T) {
+	// Given a basic account and a JNE parcel that was delivered
+	calls := 0
+	server := newWaybillServer(t, &calls)
+	client := rajaongkir.NewClient("secret", rajaongkir.Basic, server.URL, 5*time.Second)
+
+	// When its waybill is looked up
+	waybill, err := client.Waybill(context.Background(), "SOCAG00183235715", "JNE")
+
+	// Then its manifest is returned in Western Indonesian Time
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.Len(t, waybill.Manifest, 2) {
+		assert.Equal(t, "Manifested", waybill.Manifest[0].Description)
+		assert.Equal(t, "BANDUNG", waybill.Manifest[0].City)
+		assert.Equal(t, time.Date(2026, 10, 15, 13, 12, 0, 0, time.UTC), waybill.Manifest[0].Time.UTC())
+	}
+
+	// And it is reported delivered with the receiver
+	assert.True(t, waybill.Delivered)
+	assert.Equal(t, "DELIVERED", waybill.Status)
+	assert.Equal(t, "BUDI", waybill.Receiver)
+	assert.Equal(t, "REG", waybill.Service)
+	assert.Equal(t, time.Date(2026, 10, 17, 7, 5, 0, 0, time.UTC), waybill.DeliveredAt.UTC())
+}
+
+func TestTrackingOnStarter(t *testing.T) {
+	// Given a starter account
+	calls := 0
+	server := newWaybillServer(t, &calls)
+	client := rajaongkir.NewClient("secret", rajaongkir.Starter, server.URL, 5*time.Second)
+
+	// When a waybill is looked up
+	_, err := client.Waybill(context.Background(), "SOCAG00183235715", "jne")
+
+	// Then ErrTrackingUnavailable is returned without calling RajaOngkir
+	assert.ErrorIs(t, err, rajaongkir.ErrTrackingUnavailable)
+	assert.Equal(t, 0, calls)
+}
+
+func TestTrackUnknownWaybill(t *testing.T) {
+	// Given a fake RajaOngkir with one parcel
+	fake := &rajaongkir.Fake{Waybills: map[string]*rajaongkir.Waybill{
+		"SOCAG00183235715": {Number: "SOCAG00183235715", Courier: "jne", Status: "ON PROCESS"},
+	}}
+
+	// When another waybill is looked up
+	_, err := fake.Waybill(context.Background(), "JP1234567890", "jne")
+
+	// Then ErrBadRequest is returned
+	assert.ErrorIs(t, err, rajaongkir.ErrBadRequest)
+	assert.Equal(t, 1, fake.Tracked())
+
+	// And the known one is found
+	waybill, err := fake.Waybill(context.Background(), "SOCAG00183235715", "JNE")
+	assert.NoError(t, err)
+	assert.Equal(t, "ON PROCESS", waybill.Status)
+}
+
+func TestShipmentInput(t *testing.T) {
+	// Given an order quoted with JNE REG
+	order := &models.Order{Shipping: models.Shipping{ShippingType: "jne", ShippingService: "REG"}}
+
+	// When warehouse staff only enter the waybill
+	input := services.ShipmentInput{Waybill: " SOCAG00183235715 "}
+	errs := input.Validate(order)
+
+	// Then the courier and service are those of the quote
+	assert.Empty(t, errs)
+	assert.Equal(t, "jne", input.Courier)
+	assert.Equal(t, "REG", input.Service)
+	assert.Equal(t, "SOCAG00183235715", input.Waybill)
+
+	// And a waybill is required
+	missing := services.ShipmentInput{Courier: "POS"}
+	assert.Contains(t, missing.Validate(order), "waybill")
+	assert.Equal(t, "pos", missing.Courier)
+}
+
+// stubOrders keeps orders in memory, only what shipments need of the order
+// repository is implemented
+type stubOrders struct {
+	repositories.OrderRepository
+	orders map[uint]*models.Order
+}
+
+func (r *stubOrders) GetOrderById(id uint) (*models.Order, error) {
+	order, ok := r.orders[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *order
+	return &copied, nil
+}
+
+func (r *stubOrders) UpdateOrderStatus(id uint, from, to string) error {
+	order, ok := r.orders[id]
+	if !ok || order.Status != from {
+		return repositories.ErrOrderStatusChanged
+	}
+	order.Status = to
+	return nil
+}
+
+// stubShipments keeps shipments in memory by order ID
+type stubShipments struct {
+	shipments map[uint]*models.Shipment
+	orders    *stubOrders
+}
+
+func (r *stubShipments) GetShipmentByOrder(orderId uint) (*models.Shipment, error) {
+	shipment, ok := r.shipments[orderId]
+	if !ok {
+		return &models.Shipment{}, gorm.ErrRecordNotFound
+	}
+	copied := *shipment
+	return &copied, nil
+}
+
+func (r *stubShipments) SaveShipment(shipment *models.Shipment) error {
+	if shipment.ID == 0 {
+		shipment.ID = uint(len(r.shipments) + 1)
+	}
+	copied := *shipment
+	r.shipments[shipment.OrderID] = &copied
+	return nil
+}
+
+func (r *stubShipments) GetShipmentsToTrack(trackedBefore time.Time, limit int) ([]models.Shipment, error) {
+	var shipments []models.Shipment
+	for _, shipment := range r.shipments {
+		shipped := r.orders.orders[shipment.OrderID].Status == models.OrderShipped
+		due := shipment.TrackedAt == nil || shipment.TrackedAt.Before(trackedBefore)
+		if shipped && due && shipment.DeliveredAt == nil && len(shipments) < limit {
+			shipments = append(shipments, *shipment)
+		}
+	}
+	return shipments, nil
+}
+
+func newShipmentFixture(fake *rajaongkir.Fake, cacheTTL time.Duration, orders ...*models.Order) (*services.ShipmentService, *stubOrders, *stubShipments) {
+	orderRepo := &stubOrders{orders: map[uint]*models.Order{}}
+	for _, order := range orders {
+		orderRepo.orders[order.ID] = order
+	}
+	shipmentRepo := &stubShipments{shipments: map[uint]*models.Shipment{}, orders: orderRepo}
+	orderService := services.NewOrderService(orderRepo, nil, nil, nil, models.TaxPolicy{}, nil, nil)
+	return services.NewShipmentService(shipmentRepo, orderRepo, orderService, fake, cacheTTL), orderRepo, shipmentRepo
+}
+
+func TestShipPaidOrder(t *testing.T) {
+	// Given a paid order
+	order := &models.Order{UserId: 1, Status: models.OrderPaid, Shipping: models.Shipping{ShippingType: "jne", ShippingService: "REG"}}
+	order.ID = 1
+	shipments, orders, _ := newShipmentFixture(&rajaongkir.Fake{}, time.Hour, order)
+
+	// When warehouse staff record its parcel
+	shipment, errs, err := shipments.SetShipment(1, &services.ShipmentInput{Waybill: "SOCAG00183235715"})
+
+	// Then the order is shipped
+	assert.NoError(t, err)
+	assert.Empty(t, errs)
+	assert.Equal(t, "jne", shipment.Courier)
+	assert.Equal(t, models.OrderShipped, orders.orders[1].Status)
+
+	// And a delivered order cannot be given a parcel
+	orders.orders[1].Status = models.OrderDelivered
+	_, _, err = shipments.SetShipment(1, &services.ShipmentInput{Waybill: "SOCAG00183235716"})
+	assert.ErrorIs(t, err, services.ErrOrderNotShippable)
+}
+
+func TestTrackUntilDelivered(t *testing.T) {
+	// Given a shipped order whose parcel is on its way
+	order := &models.Order{UserId: 1, Status: models.OrderShipped}
+	order.ID = 1
+	fake := &rajaongkir.Fake{Waybills: map[string]*rajaongkir.Waybill{
+		"SOCAG00183235715": {Number: "SOCAG00183235715", Courier: "jne", Status: "ON PROCESS", Manifest: []rajaongkir.ManifestEntry{{Code: "1", Description: "Manifested", City: "BANDUNG"}}},
+	}}
+	shipments, orders, shipmentRepo := newShipmentFixture(fake, time.Hour, order)
+	shipmentRepo.SaveShipment(&models.Shipment{OrderID: 1, Courier: "jne", Waybill: "SOCAG00183235715"})
+
+	// When the customer tracks it twice within the cache TTL
+	first, stale, err := shipments.TrackShipment(context.Background(), 1, 1, false)
+	assert.NoError(t, err)
+	assert.False(t, stale)
+	second, _, err := shipments.TrackShipment(context.Background(), 1, 1, false)
+	assert.NoError(t, err)
+
+	// Then the courier is asked once
+	assert.Equal(t, 1, fake.Tracked())
+	assert.Equal(t, "ON PROCESS", first.Status)
+	assert.Equal(t, first.Manifest, second.Manifest)
+	assert.Equal(t, models.OrderShipped, orders.orders[1].Status)
+
+	// And another customer cannot track it
+	_, _, err = shipments.TrackShipment(context.Background(), 1, 2, false)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// When the courier delivers it and the background run tracks it
+	fake.Waybills["SOCAG00183235715"].Status = "DELIVERED"
+	fake.Waybills["SOCAG00183235715"].Delivered = true
+	fake.Waybills["SOCAG00183235715"].Receiver = "BUDI"
+	tracked := *shipmentRepo.shipments[1].TrackedAt
+	expired := tracked.Add(-2 * time.Hour)
+	shipmentRepo.shipments[1].TrackedAt = &expired
+	report, err := shipments.TrackShipments(context.Background())
+
+	// Then the order is delivered
+	assert.NoError(t, err)
+	assert.Equal(t, services.TrackingReport{Tracked: 1, Delivered: 1}, report)
+	assert.Equal(t, models.OrderDelivered, orders.orders[1].Status)
+	assert.Equal(t, "BUDI", shipmentRepo.shipments[1].Receiver)
+	assert.NotNil(t, shipmentRepo.shipments[1].DeliveredAt)
+
+	// And a delivered parcel is not tracked again
+	fake.Err = errors.New("should not be asked")
+	delivered, stale, err := shipments.TrackShipment(context.Background(), 1, 1, false)
+	assert.NoError(t, err)
+	assert.False(t, stale)
+	assert.Equal(t, "DELIVERED", delivered.Status)
+	assert.Equal(t, 2, fake.Tracked())
+}
+
+func TestTrackingCacheConfig(t *testing.T) {
+	for _, value := range []string{"0", "-5"} {
+		// Given TRACKING_CACHE_MINUTES of zero or below
+		t.Setenv("TRACKING_CACHE_MINUTES", value)
+
+		// When the configuration is loaded
+		config := cfg.LoadConfig()
+
+		// Then the default of an hour is used
+		assert.Equal(t, time.Hour, config.TrackingCacheTTL, value)
+	}
+	t.Setenv("TRACKING_CACHE_MINUTES", "15")
+	assert.Equal(t, 15*time.Minute, cfg.LoadConfig().TrackingCacheTTL)
+}
@@ -0,0 +1,53 @@
+package features
+
+import (
+	"testing"
+
+	"github.com/febriaricandra/book-shop/internal/models"
+	"github.com/febriaricandra/book-shop/internal/services"
+	"github.com/febriaricandra/book-shop/pkg/money"
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Wishlist notifications
+//
+//	As a customer
+//	I want to hear when a book on my wishlist gets cheaper or is back in stock
+//	So I can buy it at the right moment
+//
+//	Scenario: Detecting what changed
+//		Given a wishlisted book seen at 120000 while out of stock
+//		When its price drops and it is restocked
+//		Then both a price drop and a restock are detected
+//		And a price increase is not worth an email
+//		And a book that was already in stock is not reported as restocked
+//		And a book that is still out of stock is not reported as restocked
+
+func TestDetectWishlistChange(t *testing.T) {
+	// Given a wishlisted book seen at 120000 while out of stock
+	item := &models.WishlistItem{
+		SeenPrice:        money.IDR(120000),
+		SeenAvailability: models.BookOutOfStock,
+		Book:             models.Book{NewPrice: money.IDR(120000), Availability: models.BookOutOfStock},
+	}
+
+	// When its price drops and it is restocked
+	item.Book.NewPrice = money.IDR(95000)
+	item.Book.Availability = models.BookInStock
+
+	// Then both a price drop and a restock are detected
+	assert.Equal(t, services.WishlistChange{PriceDrop: true, BackInStock: true}, services.DetectWishlistChange(item))
+
+	// And a price increase is not worth an email
+	item.Book.NewPrice = money.IDR(150000)
+	assert.False(t, services.DetectWishlistChange(item).PriceDrop)
+
+	// And a book that was already in stock is not reported as restocked
+	item.SeenAvailability = models.BookInStock
+	assert.False(t, services.DetectWishlistChange(item).BackInStock)
+
+	// And a book that is still out of stock is not reported as restocked
+	item.SeenAvailability = models.BookOutOfStock
+	item.Book.Availability = models.BookOutOfStock
+	assert.False(t, services.DetectWishlistChange(item).BackInStock)
+}